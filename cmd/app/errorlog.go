@@ -0,0 +1,63 @@
+package main
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"os"
+)
+
+// errorLogStderr is the --error-log value that sends error records to stderr
+const errorLogStderr = "stderr"
+
+// levelRouter is a slog handler that writes error records to one handler and
+// all other records to another, so error streams can be collected separately
+type levelRouter struct {
+	info  slog.Handler
+	error slog.Handler
+}
+
+// newLevelRouter returns a handler writing error records to errs and all other
+// records to info, both filtered by the current log level
+func newLevelRouter(info, errs io.Writer) *levelRouter {
+	opts := &slog.HandlerOptions{Level: logLevel}
+	return &levelRouter{
+		info:  slog.NewTextHandler(info, opts),
+		error: slog.NewTextHandler(errs, opts),
+	}
+}
+
+func (r *levelRouter) Enabled(ctx context.Context, level slog.Level) bool {
+	return r.info.Enabled(ctx, level)
+}
+
+func (r *levelRouter) Handle(ctx context.Context, record slog.Record) error {
+	if record.Level >= slog.LevelError {
+		return r.error.Handle(ctx, record)
+	}
+	return r.info.Handle(ctx, record)
+}
+
+func (r *levelRouter) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &levelRouter{info: r.info.WithAttrs(attrs), error: r.error.WithAttrs(attrs)}
+}
+
+func (r *levelRouter) WithGroup(name string) slog.Handler {
+	return &levelRouter{info: r.info.WithGroup(name), error: r.error.WithGroup(name)}
+}
+
+// openErrorLog opens the --error-log destination: stderr, or a file that is
+// appended to and created if needed
+func openErrorLog(path string) (io.WriteCloser, error) {
+	if path == errorLogStderr {
+		return nopWriteCloser{os.Stderr}, nil
+	}
+	return os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o644)
+}
+
+// nopWriteCloser adds a no-op Close to a writer that must stay open
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error { return nil }
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"log"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/anisimovdk/ip-whitelist-by-country/internal/ipdata"
+)
+
+// restoreDefaultLogger puts back the slog default logger and the log package
+// output when the test ends
+func restoreDefaultLogger(t *testing.T) {
+	t.Helper()
+	origLogger, origWriter, origFlags := slog.Default(), log.Writer(), log.Flags()
+	origLevel := logLevel.Level()
+	t.Cleanup(func() {
+		slog.SetDefault(origLogger)
+		log.SetOutput(origWriter)
+		log.SetFlags(origFlags)
+		setLogLevel(origLevel)
+	})
+}
+
+func TestLevelRouter(t *testing.T) {
+	restoreDefaultLogger(t)
+	setLogLevel(slog.LevelInfo)
+
+	var info, errs bytes.Buffer
+	logger := slog.New(newLevelRouter(&info, &errs)).With("component", "test").WithGroup("req")
+
+	logger.Debug("debug record")
+	logger.Info("info record", "id", 1)
+	logger.Warn("warn record")
+	logger.Error("error record", "id", 2)
+
+	for _, want := range []string{"level=INFO msg=\"info record\" component=test req.id=1", "level=WARN msg=\"warn record\""} {
+		if !strings.Contains(info.String(), want) {
+			t.Errorf("info sink = %q, want it to contain %q", info.String(), want)
+		}
+	}
+	if !strings.Contains(errs.String(), "level=ERROR msg=\"error record\" component=test req.id=2") {
+		t.Errorf("error sink = %q, want the error record", errs.String())
+	}
+	if strings.Contains(info.String(), "error record") {
+		t.Errorf("info sink = %q, want no error records", info.String())
+	}
+	if strings.Contains(errs.String(), "info record") || strings.Contains(errs.String(), "warn record") {
+		t.Errorf("error sink = %q, want only error records", errs.String())
+	}
+	if strings.Contains(info.String()+errs.String(), "debug record") {
+		t.Error("debug record logged at info level")
+	}
+}
+
+func TestLevelRouter_LogPackageStaysInfo(t *testing.T) {
+	restoreDefaultLogger(t)
+
+	var info, errs bytes.Buffer
+	slog.SetDefault(slog.New(newLevelRouter(&info, &errs)))
+
+	// Changing the level must not move log.Printf records to another stream
+	for _, level := range []slog.Level{slog.LevelError, slog.LevelDebug} {
+		setLogLevel(level)
+		info.Reset()
+		log.Printf("plain record at %s", level)
+
+		if level == slog.LevelError {
+			if info.Len()+errs.Len() != 0 {
+				t.Errorf("log.Printf logged at error level: info %q, errors %q", info.String(), errs.String())
+			}
+			continue
+		}
+		if !strings.Contains(info.String(), "level=INFO msg=\"plain record at DEBUG\"") {
+			t.Errorf("info sink = %q, want the log.Printf record at info", info.String())
+		}
+	}
+	if errs.Len() != 0 {
+		t.Errorf("error sink = %q, want it empty", errs.String())
+	}
+
+	setLogLevel(slog.LevelInfo)
+	slog.Error("failure")
+	if !strings.Contains(errs.String(), "msg=failure") {
+		t.Errorf("error sink = %q, want the slog.Error record", errs.String())
+	}
+}
+
+func TestOpenErrorLog(t *testing.T) {
+	w, err := openErrorLog(errorLogStderr)
+	if err != nil {
+		t.Fatalf("openErrorLog(stderr): %v", err)
+	}
+	if nop, ok := w.(nopWriteCloser); !ok || nop.Writer != os.Stderr {
+		t.Errorf("openErrorLog(stderr) = %#v, want stderr", w)
+	}
+	if err := w.Close(); err != nil {
+		t.Errorf("Close: %v", err)
+	}
+
+	path := filepath.Join(t.TempDir(), "error.log")
+	for _, line := range []string{"first\n", "second\n"} {
+		w, err := openErrorLog(path)
+		if err != nil {
+			t.Fatalf("openErrorLog(%s): %v", path, err)
+		}
+		w.Write([]byte(line))
+		w.Close()
+	}
+	if content, _ := os.ReadFile(path); string(content) != "first\nsecond\n" {
+		t.Errorf("error log = %q, want both lines appended", content)
+	}
+
+	if _, err := openErrorLog(filepath.Join(t.TempDir(), "missing", "error.log")); err == nil {
+		t.Error("expected an error for a missing directory")
+	}
+}
+
+func TestFatalf(t *testing.T) {
+	restoreDefaultLogger(t)
+	origOsExit := osExit
+	t.Cleanup(func() { osExit = origOsExit })
+
+	var info, errs bytes.Buffer
+	slog.SetDefault(slog.New(newLevelRouter(&info, &errs)))
+	code := -1
+	osExit = func(c int) { code = c }
+
+	fatalf("Failed to start server: %v", "address in use")
+
+	if code != 1 {
+		t.Errorf("exit code = %d, want 1", code)
+	}
+	if !strings.Contains(errs.String(), "level=ERROR msg=\"Failed to start server: address in use\"") {
+		t.Errorf("error sink = %q, want the fatal record", errs.String())
+	}
+	if info.Len() != 0 {
+		t.Errorf("info sink = %q, want it empty", info.String())
+	}
+}
+
+// unreachableClient fails every request like a download with the network down
+type unreachableClient struct{}
+
+func (unreachableClient) Do(*http.Request) (*http.Response, error) {
+	return nil, errors.New("network down")
+}
+
+func TestErrorLog_DownloadFailure(t *testing.T) {
+	restoreDefaultLogger(t)
+	origArgs := os.Args
+	t.Cleanup(func() { os.Args = origArgs })
+	os.Args = []string{"app"}
+
+	var info, errs bytes.Buffer
+	slog.SetDefault(slog.New(newLevelRouter(&info, &errs)))
+
+	processor := ipdata.NewProcessorWithClient(unreachableClient{})
+	if _, err := processor.GetIPListForCountry("DE"); err == nil {
+		t.Fatal("expected the download to fail")
+	}
+
+	if !strings.Contains(errs.String(), `level=ERROR msg="IP data download failed"`) || !strings.Contains(errs.String(), "network down") {
+		t.Errorf("error sink = %q, want the download failure", errs.String())
+	}
+	if strings.Contains(info.String(), "network down") {
+		t.Errorf("info sink = %q, want the failure in the error sink only", info.String())
+	}
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"net"
+	"net/http"
+	"sync"
+)
+
+// limitListener accepts at most a fixed number of simultaneous connections.
+// Connections beyond the limit are closed immediately instead of queuing.
+type limitListener struct {
+	net.Listener
+	slots chan struct{}
+}
+
+// newLimitListener wraps l so that no more than n connections are open at once
+func newLimitListener(l net.Listener, n int) net.Listener {
+	return &limitListener{Listener: l, slots: make(chan struct{}, n)}
+}
+
+// Accept waits for the next connection that fits within the limit
+func (l *limitListener) Accept() (net.Conn, error) {
+	for {
+		c, err := l.Listener.Accept()
+		if err != nil {
+			return nil, err
+		}
+
+		select {
+		case l.slots <- struct{}{}:
+			return &limitConn{Conn: c, release: func() { <-l.slots }}, nil
+		default:
+			c.Close()
+		}
+	}
+}
+
+// limitConn frees its listener slot when closed
+type limitConn struct {
+	net.Conn
+	releaseOnce sync.Once
+	release     func()
+}
+
+// Close closes the connection and frees its slot
+func (c *limitConn) Close() error {
+	err := c.Conn.Close()
+	c.releaseOnce.Do(c.release)
+	return err
+}
+
+// serveWithLimit listens on the server address and serves connections, accepting
+// at most maxConnections at once. A limit of zero or less disables it.
+func serveWithLimit(srv *http.Server, maxConnections int) error {
+	ln, err := net.Listen("tcp", srv.Addr)
+	if err != nil {
+		return err
+	}
+	if maxConnections > 0 {
+		ln = newLimitListener(ln, maxConnections)
+	}
+	return srv.Serve(ln)
+}
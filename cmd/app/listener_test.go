@@ -0,0 +1,139 @@
+package main
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+)
+
+// acceptLoop accepts connections from ln and sends them on the returned channel
+func acceptLoop(ln net.Listener) <-chan net.Conn {
+	conns := make(chan net.Conn, 8)
+	go func() {
+		for {
+			c, err := ln.Accept()
+			if err != nil {
+				close(conns)
+				return
+			}
+			conns <- c
+		}
+	}()
+	return conns
+}
+
+// expectClosedByServer asserts that the server closed the client connection without serving it
+func expectClosedByServer(t *testing.T, c net.Conn) {
+	t.Helper()
+	c.SetReadDeadline(time.Now().Add(2 * time.Second))
+	_, err := c.Read(make([]byte, 1))
+	// A reset instead of EOF is expected when unread request bytes were discarded
+	var netErr net.Error
+	if err == nil || (errors.As(err, &netErr) && netErr.Timeout()) {
+		t.Fatalf("expected connection beyond the limit to be closed, got %v", err)
+	}
+}
+
+func TestLimitListener(t *testing.T) {
+	inner, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ln := newLimitListener(inner, 1)
+	defer ln.Close()
+	accepted := acceptLoop(ln)
+
+	first, err := net.Dial("tcp", ln.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer first.Close()
+	serverSide := <-accepted
+
+	// The second connection exceeds the limit and is closed
+	second, err := net.Dial("tcp", ln.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer second.Close()
+	expectClosedByServer(t, second)
+
+	// Closing the first connection frees its slot, twice is harmless
+	serverSide.Close()
+	serverSide.Close()
+
+	third, err := net.Dial("tcp", ln.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer third.Close()
+	select {
+	case c := <-accepted:
+		c.Close()
+	case <-time.After(2 * time.Second):
+		t.Fatal("expected a connection to be accepted after a slot was freed")
+	}
+}
+
+func TestServeWithLimit(t *testing.T) {
+	release := make(chan struct{})
+	inFlight := make(chan struct{}, 1)
+	srv := &http.Server{
+		Addr: "127.0.0.1:0",
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			inFlight <- struct{}{}
+			<-release
+			w.Write([]byte("ok"))
+		}),
+	}
+
+	// Reserve a free port, then let serveWithLimit listen on it
+	probe, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv.Addr = probe.Addr().String()
+	probe.Close()
+
+	served := make(chan error, 1)
+	go func() { served <- serveWithLimit(srv, 1) }()
+	t.Cleanup(func() { srv.Close() })
+
+	var first net.Conn
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		first, err = net.Dial("tcp", srv.Addr)
+		if err == nil || time.Now().After(deadline) {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if err != nil {
+		t.Fatalf("server did not start: %v", err)
+	}
+	defer first.Close()
+	first.Write([]byte("GET / HTTP/1.1\r\nHost: test\r\n\r\n"))
+	<-inFlight
+
+	second, err := net.Dial("tcp", srv.Addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer second.Close()
+	second.Write([]byte("GET / HTTP/1.1\r\nHost: test\r\n\r\n"))
+	expectClosedByServer(t, second)
+
+	close(release)
+	srv.Close()
+	if err := <-served; err != http.ErrServerClosed {
+		t.Fatalf("serveWithLimit returned %v, want http.ErrServerClosed", err)
+	}
+}
+
+func TestServeWithLimit_ListenError(t *testing.T) {
+	if err := serveWithLimit(&http.Server{Addr: "invalid-address"}, 0); err == nil {
+		t.Fatal("expected error for invalid listen address")
+	}
+}
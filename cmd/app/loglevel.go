@@ -0,0 +1,66 @@
+package main
+
+import (
+	"log/slog"
+	"os"
+	"syscall"
+)
+
+// logLevel holds the current slog level; it can be changed at runtime with signals
+var logLevel = new(slog.LevelVar)
+
+// logLevels lists the levels SIGUSR1 cycles through, from least to most verbose
+var logLevels = []slog.Level{slog.LevelError, slog.LevelWarn, slog.LevelInfo, slog.LevelDebug}
+
+// parseLogLevel parses a level name such as "debug" or "WARN", returning
+// slog.LevelInfo for unknown values
+func parseLogLevel(name string) slog.Level {
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(name)); err != nil {
+		return slog.LevelInfo
+	}
+	return level
+}
+
+// setLogLevel changes the level of the levelRouter installed as the slog
+// default handler. The log package bridge keeps logging at info, so
+// log.Printf records are filtered like slog.Info records.
+func setLogLevel(level slog.Level) {
+	logLevel.Set(level)
+}
+
+// nextLogLevel returns the next more verbose level, wrapping around from debug to error
+func nextLogLevel(level slog.Level) slog.Level {
+	for _, l := range logLevels {
+		if l < level {
+			return l
+		}
+	}
+	return logLevels[0]
+}
+
+// watchLogLevelSignals applies the configured log level and adjusts it at
+// runtime: SIGUSR1 makes logging one step more verbose, SIGUSR2 restores the
+// configured level
+func watchLogLevelSignals(configured slog.Level) {
+	setLogLevel(configured)
+
+	sigChan := make(chan os.Signal, 1)
+	signalNotify(sigChan, syscall.SIGUSR1, syscall.SIGUSR2)
+	go handleLogLevelSignals(sigChan, configured)
+}
+
+// handleLogLevelSignals changes the log level for every signal received on sigChan
+func handleLogLevelSignals(sigChan <-chan os.Signal, configured slog.Level) {
+	for sig := range sigChan {
+		switch sig {
+		case syscall.SIGUSR1:
+			setLogLevel(nextLogLevel(logLevel.Level()))
+		case syscall.SIGUSR2:
+			setLogLevel(configured)
+		default:
+			continue
+		}
+		logPrintf("Log level set to %s\n", logLevel.Level())
+	}
+}
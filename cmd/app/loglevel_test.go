@@ -0,0 +1,168 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"log"
+	"log/slog"
+	"os"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// restoreLogLevel resets the global log level after a test changed it
+func restoreLogLevel(t *testing.T) {
+	orig := logLevel.Level()
+	t.Cleanup(func() { setLogLevel(orig) })
+}
+
+func TestParseLogLevel(t *testing.T) {
+	testCases := []struct {
+		name     string
+		expected slog.Level
+	}{
+		{name: "debug", expected: slog.LevelDebug},
+		{name: "INFO", expected: slog.LevelInfo},
+		{name: "warn", expected: slog.LevelWarn},
+		{name: "error", expected: slog.LevelError},
+		{name: "", expected: slog.LevelInfo},
+		{name: "loud", expected: slog.LevelInfo},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := parseLogLevel(tc.name); got != tc.expected {
+				t.Errorf("parseLogLevel(%q) = %v, want %v", tc.name, got, tc.expected)
+			}
+		})
+	}
+}
+
+func TestNextLogLevel(t *testing.T) {
+	testCases := []struct {
+		level    slog.Level
+		expected slog.Level
+	}{
+		{level: slog.LevelError, expected: slog.LevelWarn},
+		{level: slog.LevelWarn, expected: slog.LevelInfo},
+		{level: slog.LevelInfo, expected: slog.LevelDebug},
+		{level: slog.LevelDebug, expected: slog.LevelError},
+		{level: slog.LevelError + 4, expected: slog.LevelError},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.level.String(), func(t *testing.T) {
+			if got := nextLogLevel(tc.level); got != tc.expected {
+				t.Errorf("nextLogLevel(%v) = %v, want %v", tc.level, got, tc.expected)
+			}
+		})
+	}
+}
+
+func TestWatchLogLevelSignals(t *testing.T) {
+	restoreDefaultLogger(t)
+	slog.SetDefault(slog.New(newLevelRouter(io.Discard, io.Discard)))
+	origSignalNotify := signalNotify
+	origLogPrintf := logPrintf
+	t.Cleanup(func() {
+		signalNotify = origSignalNotify
+		logPrintf = origLogPrintf
+	})
+
+	var captured chan<- os.Signal
+	var registered []os.Signal
+	signalNotify = func(c chan<- os.Signal, sigs ...os.Signal) {
+		captured = c
+		registered = sigs
+	}
+	changed := make(chan struct{}, 1)
+	logPrintf = func(format string, args ...any) {
+		changed <- struct{}{}
+	}
+
+	watchLogLevelSignals(slog.LevelWarn)
+
+	if logLevel.Level() != slog.LevelWarn {
+		t.Fatalf("expected configured level %v, got %v", slog.LevelWarn, logLevel.Level())
+	}
+	if len(registered) != 2 || registered[0] != syscall.SIGUSR1 || registered[1] != syscall.SIGUSR2 {
+		t.Fatalf("expected SIGUSR1 and SIGUSR2 to be registered, got %v", registered)
+	}
+
+	send := func(sig os.Signal) {
+		t.Helper()
+		captured <- sig
+		select {
+		case <-changed:
+		case <-time.After(2 * time.Second):
+			t.Fatalf("timed out waiting for %v to be handled", sig)
+		}
+	}
+
+	// SIGUSR1 raises the verbosity and enables debug messages step by step
+	send(syscall.SIGUSR1)
+	if logLevel.Level() != slog.LevelInfo {
+		t.Errorf("after SIGUSR1 level = %v, want %v", logLevel.Level(), slog.LevelInfo)
+	}
+	send(syscall.SIGUSR1)
+	if logLevel.Level() != slog.LevelDebug {
+		t.Errorf("after second SIGUSR1 level = %v, want %v", logLevel.Level(), slog.LevelDebug)
+	}
+	if !slog.Default().Enabled(context.Background(), slog.LevelDebug) {
+		t.Error("expected debug messages to be enabled on the default logger")
+	}
+
+	// SIGUSR2 restores the configured level
+	send(syscall.SIGUSR2)
+	if logLevel.Level() != slog.LevelWarn {
+		t.Errorf("after SIGUSR2 level = %v, want %v", logLevel.Level(), slog.LevelWarn)
+	}
+	if slog.Default().Enabled(context.Background(), slog.LevelInfo) {
+		t.Error("expected info messages to be disabled again")
+	}
+}
+
+func TestSetLogLevel_FiltersLogPackage(t *testing.T) {
+	restoreDefaultLogger(t)
+	var logged bytes.Buffer
+	slog.SetDefault(slog.New(newLevelRouter(&logged, &logged)))
+
+	setLogLevel(slog.LevelDebug)
+	slog.Debug("debug record")
+	log.Printf("plain record")
+	for _, want := range []string{"msg=\"debug record\"", "msg=\"plain record\""} {
+		if !strings.Contains(logged.String(), want) {
+			t.Errorf("at debug level logged %q, want it to contain %q", logged.String(), want)
+		}
+	}
+
+	// Raising the level suppresses debug records and log.Printf output alike
+	setLogLevel(slog.LevelWarn)
+	logged.Reset()
+	slog.Debug("debug record")
+	log.Printf("plain record")
+	if logged.Len() != 0 {
+		t.Errorf("at warn level logged %q, want nothing", logged.String())
+	}
+}
+
+func TestHandleLogLevelSignalsIgnoresOtherSignals(t *testing.T) {
+	restoreLogLevel(t)
+	origLogPrintf := logPrintf
+	t.Cleanup(func() { logPrintf = origLogPrintf })
+	var logged int
+	logPrintf = func(format string, args ...any) { logged++ }
+
+	setLogLevel(slog.LevelInfo)
+	sigChan := make(chan os.Signal, 1)
+	sigChan <- syscall.SIGHUP
+	close(sigChan)
+	handleLogLevelSignals(sigChan, slog.LevelInfo)
+
+	if logLevel.Level() != slog.LevelInfo || logged != 0 {
+		t.Errorf("expected unrelated signal to be ignored, level %v, %d log lines", logLevel.Level(), logged)
+	}
+}
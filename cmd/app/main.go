@@ -1,12 +1,16 @@
 package main
 
 import (
+	"context"
 	"fmt"
+	"io"
 	"log"
+	"log/slog"
 	"net/http"
 	"os"
 	"os/signal"
 	"syscall"
+	"time"
 
 	"github.com/anisimovdk/ip-whitelist-by-country/internal/config"
 	"github.com/anisimovdk/ip-whitelist-by-country/internal/handler"
@@ -14,15 +18,26 @@ import (
 	"github.com/anisimovdk/ip-whitelist-by-country/internal/version"
 )
 
+// Defaults used when the configured timeouts are not valid durations
+const (
+	defaultShutdownTimeout   = 15 * time.Second
+	defaultReadHeaderTimeout = 10 * time.Second
+	defaultReadTimeout       = 30 * time.Second
+	defaultWriteTimeout      = 2 * time.Minute
+	defaultIdleTimeout       = 2 * time.Minute
+)
+
 var (
 	newProcessor   = ipdata.NewProcessor
 	newConfig      = config.NewConfig
 	newHandler     = handler.NewHandler
-	listenAndServe = http.ListenAndServe
+	exportData     = handler.Export
+	listenAndServe = serveWithLimit
 	signalNotify   = signal.Notify
 	logPrintf      = log.Printf
 	logPrintln     = log.Println
-	logFatalf      = log.Fatalf
+	logFatalf      = fatalf
+	osExit         = os.Exit
 )
 
 func main() {
@@ -33,7 +48,32 @@ func main() {
 
 	// Get configuration
 	cfg := newConfig()
-	serverAddr := ":" + cfg.ServerPort
+
+	// Route slog and log package records through one handler that follows the
+	// runtime log level; with --error-log, error records get their own stream
+	// and everything else goes to stdout
+	info, errs := io.Writer(os.Stderr), io.Writer(os.Stderr)
+	if cfg.ErrorLog != "" {
+		errorLog, err := openErrorLog(cfg.ErrorLog)
+		if err != nil {
+			logFatalf("Failed to open error log: %v", err)
+			return
+		}
+		defer errorLog.Close()
+		info, errs = os.Stdout, errorLog
+	}
+	slog.SetDefault(slog.New(newLevelRouter(info, errs)))
+
+	// In export mode write the per-country files and exit without serving
+	if cfg.Export != "" {
+		n, err := exportData(processor, cfg.Export, cfg.Format)
+		if err != nil {
+			logFatalf("Export failed: %v", err)
+			return
+		}
+		logPrintf("Exported %d countries to %s\n", n, cfg.Export)
+		return
+	}
 
 	// Pass the configuration to the handler
 	h := newHandler(processor, cfg)
@@ -41,19 +81,112 @@ func main() {
 	// Register routes
 	h.RegisterRoutes()
 
+	// Adjust the log level on SIGUSR1/SIGUSR2
+	watchLogLevelSignals(parseLogLevel(cfg.LogLevel))
+
+	// Background work is stopped on shutdown
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// Periodically log traffic and cache state if configured
+	if interval := parseTimeout(cfg.MetricsLogInterval, 0); interval > 0 {
+		startMetricsLogger(ctx, slog.Default(), interval, h.Requests, processor.Stats)
+	}
+
+	// Refresh daily shortly after the upstream publishes new data if configured
+	if cfg.RefreshAt != "" {
+		if at, err := config.ParseTimeOfDay(cfg.RefreshAt); err == nil {
+			logPrintf("Refreshing IP data daily at %s UTC\n", cfg.RefreshAt)
+			startRefreshScheduler(ctx, at, processor.ScheduledRefresh)
+		}
+	}
+
 	// Create a channel to listen for interrupt signals
 	sigChan := make(chan os.Signal, 1)
 	signalNotify(sigChan, os.Interrupt, syscall.SIGTERM)
 
-	// Start server in a goroutine
-	go func() {
-		logPrintf("Server started on %s\n", serverAddr)
-		if err := listenAndServe(serverAddr, nil); err != nil && err != http.ErrServerClosed {
-			logFatalf("Failed to start server: %v", err)
-		}
-	}()
+	// Start a server per listen address in goroutines, all serving the default mux
+	serverAddrs, _ := config.ParseListenAddresses(cfg.ListenAddresses, cfg.ServerPort)
+	var servers []*http.Server
+	for _, serverAddr := range serverAddrs {
+		srv := newServer(serverAddr, nil, cfg)
+		servers = append(servers, srv)
+		go func() {
+			logPrintf("Server started on %s\n", serverAddr)
+			if err := listenAndServe(srv, cfg.MaxConnections); err != nil && err != http.ErrServerClosed {
+				logFatalf("Failed to start server: %v", err)
+			}
+		}()
+	}
+
+	// Start the admin server on its own port if configured
+	if cfg.AdminPort != "" {
+		adminAddr := ":" + cfg.AdminPort
+		adminMux := http.NewServeMux()
+		h.RegisterAdminRoutesOn(adminMux)
+
+		adminSrv := newServer(adminAddr, adminMux, cfg)
+		servers = append(servers, adminSrv)
+		go func() {
+			logPrintf("Admin server started on %s\n", adminAddr)
+			if err := listenAndServe(adminSrv, 0); err != nil && err != http.ErrServerClosed {
+				logFatalf("Failed to start admin server: %v", err)
+			}
+		}()
+	}
 
 	// Wait for interrupt signal
 	<-sigChan
 	logPrintln("Shutting down server...")
+	cancel()
+	shutdownServers(shutdownTimeout(cfg), servers...)
+}
+
+// fatalf logs an error record and exits with status 1, like log.Fatalf but
+// at error level so the record reaches --error-log
+func fatalf(format string, args ...any) {
+	slog.Error(fmt.Sprintf(format, args...))
+	osExit(1)
+}
+
+// newServer creates an HTTP server for addr with the configured timeouts, so
+// slow or idle clients cannot hold connections open indefinitely. A nil
+// handler serves http.DefaultServeMux.
+func newServer(addr string, handler http.Handler, cfg *config.Config) *http.Server {
+	return &http.Server{
+		Addr:              addr,
+		Handler:           handler,
+		ReadHeaderTimeout: parseTimeout(cfg.ReadHeaderTimeout, defaultReadHeaderTimeout),
+		ReadTimeout:       parseTimeout(cfg.ReadTimeout, defaultReadTimeout),
+		WriteTimeout:      parseTimeout(cfg.WriteTimeout, defaultWriteTimeout),
+		IdleTimeout:       parseTimeout(cfg.IdleTimeout, defaultIdleTimeout),
+	}
+}
+
+// shutdownTimeout returns the configured graceful shutdown timeout
+func shutdownTimeout(cfg *config.Config) time.Duration {
+	return parseTimeout(cfg.ShutdownTimeout, defaultShutdownTimeout)
+}
+
+// parseTimeout parses a positive duration, returning fallback for invalid values
+func parseTimeout(value string, fallback time.Duration) time.Duration {
+	timeout, err := time.ParseDuration(value)
+	if err != nil || timeout <= 0 {
+		return fallback
+	}
+	return timeout
+}
+
+// shutdownServers gracefully stops the servers, waiting for in-flight requests.
+// Servers whose requests do not finish within timeout are closed forcibly.
+func shutdownServers(timeout time.Duration, servers ...*http.Server) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	for _, srv := range servers {
+		if err := srv.Shutdown(ctx); err != nil {
+			logPrintf("Graceful shutdown of %s did not complete, forcing close: %v\n", srv.Addr, err)
+			srv.Close()
+		}
+	}
 }
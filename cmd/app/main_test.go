@@ -1,14 +1,18 @@
 package main
 
 import (
+	"context"
 	"io"
+	"net"
 	"net/http"
 	"net/http/httptest"
 	"os"
 	"testing"
+	"time"
 
 	"github.com/anisimovdk/ip-whitelist-by-country/internal/config"
 	"github.com/anisimovdk/ip-whitelist-by-country/internal/handler"
+	"github.com/anisimovdk/ip-whitelist-by-country/internal/ipdata"
 )
 
 type mockProcessor struct {
@@ -16,6 +20,8 @@ type mockProcessor struct {
 	err  error
 }
 
+var _ ipdata.IPProcessor = mockProcessor{}
+
 func (m mockProcessor) GetIPListForCountry(countryCode string) ([]string, error) {
 	if m.err != nil {
 		return nil, m.err
@@ -23,6 +29,99 @@ func (m mockProcessor) GetIPListForCountry(countryCode string) ([]string, error)
 	return m.list, nil
 }
 
+func (m mockProcessor) GetIPListSnapshot(countryCode string) (ipdata.ListSnapshot, error) {
+	if m.err != nil {
+		return ipdata.ListSnapshot{}, m.err
+	}
+	return ipdata.ListSnapshot{CIDRs: m.list, DataSource: m.DataSource(), DataTime: m.DataTime()}, nil
+}
+
+func (m mockProcessor) GetIPListForCountryOn(countryCode string, date time.Time) ([]string, error) {
+	if m.err != nil {
+		return nil, m.err
+	}
+	return m.list, nil
+}
+
+func (m mockProcessor) GetAllCountries() (map[string][]string, error) {
+	if m.err != nil {
+		return nil, m.err
+	}
+	return map[string][]string{"US": m.list}, nil
+}
+
+func (m mockProcessor) GetProvenanceForCountry(countryCode string) (map[string]int, error) {
+	if m.err != nil {
+		return nil, m.err
+	}
+	return map[string]int{"ripencc": len(m.list)}, nil
+}
+
+func (m mockProcessor) GetIPListByRegistry(countryCode string) (map[string][]string, error) {
+	if m.err != nil {
+		return nil, m.err
+	}
+	return map[string][]string{"ripencc": m.list}, nil
+}
+
+func (m mockProcessor) GetIPListByStatus(countryCode string) (map[string][]string, error) {
+	if m.err != nil {
+		return nil, m.err
+	}
+	return map[string][]string{"allocated": m.list}, nil
+}
+
+func (m mockProcessor) GetCountForCountry(countryCode string) (ipdata.AllocationCount, error) {
+	if m.err != nil {
+		return ipdata.AllocationCount{}, m.err
+	}
+	return ipdata.AllocationCount{Blocks: len(m.list)}, nil
+}
+
+func (m mockProcessor) LookupCountry(ip net.IP) (string, bool, error) {
+	return "", false, m.err
+}
+
+func (m mockProcessor) GetASNsForCountry(countryCode string) ([]uint32, error) {
+	return []uint32{}, nil
+}
+
+func (m mockProcessor) Stats() ipdata.Stats {
+	return ipdata.Stats{}
+}
+
+func (m mockProcessor) Diagnostics() ipdata.ParseDiagnostics {
+	return ipdata.ParseDiagnostics{}
+}
+
+func (m mockProcessor) CheckUpstream(ctx context.Context) ipdata.UpstreamStatus {
+	return ipdata.UpstreamStatus{}
+}
+
+func (m mockProcessor) GetIPv6ListForCountry(countryCode string) ([]string, error) {
+	return nil, m.err
+}
+
+func (m mockProcessor) Export() (ipdata.Export, error) {
+	return ipdata.Export{}, m.err
+}
+
+func (m mockProcessor) Ready() bool {
+	return m.err == nil
+}
+
+func (m mockProcessor) DataSource() string {
+	return "live"
+}
+
+func (m mockProcessor) DataTime() time.Time {
+	return time.Now()
+}
+
+func (m mockProcessor) RefreshIfOlderThan(maxAge time.Duration) error {
+	return nil
+}
+
 func newTestServer(t *testing.T, cfg *config.Config) *httptest.Server {
 	t.Helper()
 
@@ -1,22 +1,123 @@
 package main
 
 import (
+	"context"
 	"errors"
+	"io"
+	"log/slog"
+	"net"
 	"net/http"
+	"net/http/httptest"
 	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/anisimovdk/ip-whitelist-by-country/internal/config"
+	"github.com/anisimovdk/ip-whitelist-by-country/internal/handler"
 	"github.com/anisimovdk/ip-whitelist-by-country/internal/ipdata"
 )
 
 type noopProcessor struct{}
 
+var _ ipdata.IPProcessor = noopProcessor{}
+
+// TestMockParity checks that the processor mocks have no exported methods
+// beyond IPProcessor, so a method renamed or dropped from the interface
+// cannot linger in them
+func TestMockParity(t *testing.T) {
+	iface := reflect.TypeFor[ipdata.IPProcessor]()
+	for _, mock := range []reflect.Type{reflect.TypeFor[mockProcessor](), reflect.TypeFor[noopProcessor]()} {
+		if mock.NumMethod() != iface.NumMethod() {
+			t.Errorf("%s has %d methods, IPProcessor declares %d", mock, mock.NumMethod(), iface.NumMethod())
+		}
+		for method := range mock.Methods() {
+			if _, ok := iface.MethodByName(method.Name); !ok {
+				t.Errorf("%s has method %s that IPProcessor does not declare", mock, method.Name)
+			}
+		}
+	}
+}
+
 func (noopProcessor) GetIPListForCountry(countryCode string) ([]string, error) {
 	return []string{}, nil
 }
 
+func (noopProcessor) GetIPListSnapshot(countryCode string) (ipdata.ListSnapshot, error) {
+	return ipdata.ListSnapshot{CIDRs: []string{}}, nil
+}
+
+func (noopProcessor) GetIPListForCountryOn(countryCode string, date time.Time) ([]string, error) {
+	return []string{}, nil
+}
+
+func (noopProcessor) GetAllCountries() (map[string][]string, error) {
+	return map[string][]string{}, nil
+}
+
+func (noopProcessor) GetProvenanceForCountry(countryCode string) (map[string]int, error) {
+	return map[string]int{}, nil
+}
+
+func (noopProcessor) GetIPListByRegistry(countryCode string) (map[string][]string, error) {
+	return map[string][]string{}, nil
+}
+
+func (noopProcessor) GetIPListByStatus(countryCode string) (map[string][]string, error) {
+	return map[string][]string{}, nil
+}
+
+func (noopProcessor) GetCountForCountry(countryCode string) (ipdata.AllocationCount, error) {
+	return ipdata.AllocationCount{}, nil
+}
+
+func (noopProcessor) LookupCountry(ip net.IP) (string, bool, error) {
+	return "", false, nil
+}
+
+func (noopProcessor) GetASNsForCountry(countryCode string) ([]uint32, error) {
+	return []uint32{}, nil
+}
+
+func (noopProcessor) Stats() ipdata.Stats {
+	return ipdata.Stats{}
+}
+
+func (noopProcessor) Diagnostics() ipdata.ParseDiagnostics {
+	return ipdata.ParseDiagnostics{}
+}
+
+func (noopProcessor) CheckUpstream(ctx context.Context) ipdata.UpstreamStatus {
+	return ipdata.UpstreamStatus{}
+}
+
+func (noopProcessor) GetIPv6ListForCountry(countryCode string) ([]string, error) {
+	return nil, nil
+}
+
+func (noopProcessor) Export() (ipdata.Export, error) {
+	return ipdata.Export{}, nil
+}
+
+func (noopProcessor) Ready() bool {
+	return true
+}
+
+func (noopProcessor) DataSource() string {
+	return ""
+}
+
+func (noopProcessor) DataTime() time.Time {
+	return time.Time{}
+}
+
+func (noopProcessor) RefreshIfOlderThan(maxAge time.Duration) error {
+	return nil
+}
+
 func TestMain_CoversStartupAndFatalPath(t *testing.T) {
 	oldMux := http.DefaultServeMux
 	http.DefaultServeMux = http.NewServeMux()
@@ -45,14 +146,16 @@ func TestMain_CoversStartupAndFatalPath(t *testing.T) {
 	_ = newHandler
 
 	var captured chan<- os.Signal
-	signalNotify = func(c chan<- os.Signal, _ ...os.Signal) {
-		captured = c
+	signalNotify = func(c chan<- os.Signal, sigs ...os.Signal) {
+		if slices.Contains(sigs, os.Interrupt) {
+			captured = c
+		}
 	}
 
 	started := make(chan struct{}, 1)
 	fatalCalled := make(chan struct{}, 1)
 
-	listenAndServe = func(addr string, handler http.Handler) error {
+	listenAndServe = func(srv *http.Server, maxConnections int) error {
 		started <- struct{}{}
 		return errors.New("listen failed")
 	}
@@ -92,3 +195,455 @@ func TestMain_CoversStartupAndFatalPath(t *testing.T) {
 		t.Fatal("timed out waiting for main to return")
 	}
 }
+
+func TestMain_StartsAdminServer(t *testing.T) {
+	oldMux := http.DefaultServeMux
+	http.DefaultServeMux = http.NewServeMux()
+	t.Cleanup(func() { http.DefaultServeMux = oldMux })
+
+	origNewProcessor := newProcessor
+	origNewConfig := newConfig
+	origListenAndServe := listenAndServe
+	origSignalNotify := signalNotify
+	origLogFatalf := logFatalf
+
+	t.Cleanup(func() {
+		newProcessor = origNewProcessor
+		newConfig = origNewConfig
+		listenAndServe = origListenAndServe
+		signalNotify = origSignalNotify
+		logFatalf = origLogFatalf
+	})
+
+	newProcessor = func() *ipdata.Processor { return &ipdata.Processor{} }
+	newConfig = func() *config.Config {
+		return &config.Config{ServerPort: "8080", AdminPort: "9090", EnablePprof: true, MaxConnections: 5, IdleTimeout: "45s", MetricsLogInterval: "1h", RefreshAt: "02:00"}
+	}
+	// Keep the scheduled refresh hours away
+	origScheduleNow := scheduleNow
+	t.Cleanup(func() { scheduleNow = origScheduleNow })
+	scheduleNow = func() time.Time { return time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC) }
+
+	var captured chan<- os.Signal
+	signalNotify = func(c chan<- os.Signal, sigs ...os.Signal) {
+		if slices.Contains(sigs, os.Interrupt) {
+			captured = c
+		}
+	}
+
+	type listenCall struct {
+		addr           string
+		handler        http.Handler
+		maxConnections int
+		idleTimeout    time.Duration
+	}
+	calls := make(chan listenCall, 2)
+	listenAndServe = func(srv *http.Server, maxConnections int) error {
+		calls <- listenCall{addr: srv.Addr, handler: srv.Handler, maxConnections: maxConnections, idleTimeout: srv.IdleTimeout}
+		return errors.New("listen failed")
+	}
+	fatalCalls := make(chan string, 2)
+	logFatalf = func(format string, args ...any) {
+		fatalCalls <- format
+	}
+
+	done := make(chan struct{})
+	go func() {
+		main()
+		close(done)
+	}()
+
+	handlers := map[string]http.Handler{}
+	limits := map[string]int{}
+	for i := 0; i < 2; i++ {
+		select {
+		case c := <-calls:
+			handlers[c.addr] = c.handler
+			limits[c.addr] = c.maxConnections
+			if c.idleTimeout != 45*time.Second {
+				t.Errorf("expected configured idle timeout on %s, got %v", c.addr, c.idleTimeout)
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatal("timed out waiting for servers to start")
+		}
+	}
+	for i := 0; i < 2; i++ {
+		select {
+		case <-fatalCalls:
+		case <-time.After(2 * time.Second):
+			t.Fatal("timed out waiting for logFatalf")
+		}
+	}
+
+	if h, ok := handlers[":8080"]; !ok || h != nil {
+		t.Fatalf("expected public server on :8080 with default mux, got %v", handlers)
+	}
+	if limits[":8080"] != 5 || limits[":9090"] != 0 {
+		t.Fatalf("expected connection limit 5 on the public server only, got %v", limits)
+	}
+	adminHandler, ok := handlers[":9090"]
+	if !ok || adminHandler == nil {
+		t.Fatalf("expected admin server on :9090 with its own mux, got %v", handlers)
+	}
+
+	rr := httptest.NewRecorder()
+	adminHandler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/debug/pprof/", nil))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected pprof on admin mux, got status %d", rr.Code)
+	}
+
+	rr = httptest.NewRecorder()
+	http.DefaultServeMux.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/debug/pprof/", nil))
+	if rr.Code != http.StatusNotFound {
+		t.Fatalf("expected pprof to be absent from public mux, got status %d", rr.Code)
+	}
+
+	if captured == nil {
+		t.Fatal("expected signal channel to be captured")
+	}
+	captured <- os.Interrupt
+
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("timed out waiting for main to return")
+	}
+}
+
+func TestMain_ListensOnEveryAddress(t *testing.T) {
+	oldMux := http.DefaultServeMux
+	http.DefaultServeMux = http.NewServeMux()
+	t.Cleanup(func() { http.DefaultServeMux = oldMux })
+
+	origNewProcessor := newProcessor
+	origNewConfig := newConfig
+	origListenAndServe := listenAndServe
+	origSignalNotify := signalNotify
+	origLogFatalf := logFatalf
+
+	t.Cleanup(func() {
+		newProcessor = origNewProcessor
+		newConfig = origNewConfig
+		listenAndServe = origListenAndServe
+		signalNotify = origSignalNotify
+		logFatalf = origLogFatalf
+	})
+
+	// Listen on IPv6 as well where the host supports it
+	listen := "127.0.0.1:0,127.0.0.1:0"
+	if ln, err := net.Listen("tcp", "[::1]:0"); err == nil {
+		ln.Close()
+		listen += ",[::1]:0"
+	}
+	wantServers := len(strings.Split(listen, ","))
+
+	newProcessor = func() *ipdata.Processor { return &ipdata.Processor{} }
+	newConfig = func() *config.Config {
+		return &config.Config{ServerPort: "8080", ListenAddresses: listen}
+	}
+
+	var captured chan<- os.Signal
+	signalNotify = func(c chan<- os.Signal, sigs ...os.Signal) {
+		if slices.Contains(sigs, os.Interrupt) {
+			captured = c
+		}
+	}
+
+	// Serve on real listeners, reporting where they listen and how they stopped
+	addrs := make(chan string, wantServers)
+	stopped := make(chan error, wantServers)
+	listenAndServe = func(srv *http.Server, maxConnections int) error {
+		ln, err := net.Listen("tcp", srv.Addr)
+		if err != nil {
+			return err
+		}
+		addrs <- ln.Addr().String()
+		err = srv.Serve(ln)
+		stopped <- err
+		return err
+	}
+	logFatalf = func(format string, args ...any) {
+		t.Errorf("unexpected fatal error: "+format, args...)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		main()
+		close(done)
+	}()
+
+	for range wantServers {
+		select {
+		case addr := <-addrs:
+			resp, err := http.Get("http://" + addr + "/livez")
+			if err != nil {
+				t.Fatalf("GET /livez on %s: %v", addr, err)
+			}
+			resp.Body.Close()
+			if resp.StatusCode != http.StatusOK {
+				t.Errorf("GET /livez on %s returned status %d", addr, resp.StatusCode)
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatal("timed out waiting for servers to start")
+		}
+	}
+
+	if captured == nil {
+		t.Fatal("expected signal channel to be captured")
+	}
+	captured <- os.Interrupt
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for main to return")
+	}
+
+	// Shutdown stops every listener
+	for range wantServers {
+		select {
+		case err := <-stopped:
+			if !errors.Is(err, http.ErrServerClosed) {
+				t.Errorf("server stopped with %v, want ErrServerClosed", err)
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatal("timed out waiting for a server to stop")
+		}
+	}
+}
+
+func TestMain_ExportModeSkipsServer(t *testing.T) {
+	origNewProcessor := newProcessor
+	origNewConfig := newConfig
+	origExportData := exportData
+	origListenAndServe := listenAndServe
+	origLogFatalf := logFatalf
+
+	t.Cleanup(func() {
+		newProcessor = origNewProcessor
+		newConfig = origNewConfig
+		exportData = origExportData
+		listenAndServe = origListenAndServe
+		logFatalf = origLogFatalf
+	})
+
+	newProcessor = func() *ipdata.Processor { return &ipdata.Processor{} }
+	newConfig = func() *config.Config {
+		return &config.Config{ServerPort: "8080", Export: "/tmp/out", Format: "netmask"}
+	}
+	listenAndServe = func(srv *http.Server, maxConnections int) error {
+		t.Errorf("unexpected server start on %s in export mode", srv.Addr)
+		return nil
+	}
+
+	testCases := []struct {
+		name      string
+		exportErr error
+		wantFatal bool
+	}{
+		{name: "Success", exportErr: nil, wantFatal: false},
+		{name: "Failure", exportErr: errors.New("download failed"), wantFatal: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var gotDir, gotFormat string
+			exportData = func(processor handler.CountryLister, dir, format string) (int, error) {
+				gotDir, gotFormat = dir, format
+				return 2, tc.exportErr
+			}
+			fatalCalled := false
+			logFatalf = func(format string, args ...any) {
+				fatalCalled = true
+			}
+
+			main()
+
+			if gotDir != "/tmp/out" || gotFormat != "netmask" {
+				t.Errorf("export called with (%q, %q), want (%q, %q)", gotDir, gotFormat, "/tmp/out", "netmask")
+			}
+			if fatalCalled != tc.wantFatal {
+				t.Errorf("logFatalf called = %v, want %v", fatalCalled, tc.wantFatal)
+			}
+		})
+	}
+}
+
+func TestMain_ErrorLog(t *testing.T) {
+	restoreDefaultLogger(t)
+	origNewProcessor := newProcessor
+	origNewConfig := newConfig
+	origExportData := exportData
+	origLogFatalf := logFatalf
+
+	t.Cleanup(func() {
+		newProcessor = origNewProcessor
+		newConfig = origNewConfig
+		exportData = origExportData
+		logFatalf = origLogFatalf
+	})
+
+	newProcessor = func() *ipdata.Processor { return &ipdata.Processor{} }
+	exportData = func(processor handler.CountryLister, dir, format string) (int, error) {
+		return 0, errors.New("download failed")
+	}
+
+	testCases := []struct {
+		name       string
+		errorLog   string
+		wantFatal  string
+		wantRouter bool
+	}{
+		{name: "Routes errors", errorLog: filepath.Join(t.TempDir(), "error.log"), wantFatal: "Export failed: %v", wantRouter: true},
+		{name: "No error log", wantFatal: "Export failed: %v", wantRouter: true},
+		{name: "Open failure", errorLog: filepath.Join(t.TempDir(), "missing", "error.log"), wantFatal: "Failed to open error log: %v"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			slog.SetDefault(slog.New(slog.NewTextHandler(io.Discard, nil)))
+			newConfig = func() *config.Config {
+				return &config.Config{ServerPort: "8080", Export: "/tmp/out", ErrorLog: tc.errorLog}
+			}
+			var fatal string
+			logFatalf = func(format string, args ...any) {
+				fatal = format
+			}
+
+			main()
+
+			if fatal != tc.wantFatal {
+				t.Errorf("logFatalf called with %q, want %q", fatal, tc.wantFatal)
+			}
+			if _, ok := slog.Default().Handler().(*levelRouter); ok != tc.wantRouter {
+				t.Errorf("default handler = %T, want levelRouter %v", slog.Default().Handler(), tc.wantRouter)
+			}
+		})
+	}
+}
+
+func TestShutdownTimeout(t *testing.T) {
+	testCases := []struct {
+		value    string
+		expected time.Duration
+	}{
+		{value: "30s", expected: 30 * time.Second},
+		{value: "", expected: defaultShutdownTimeout},
+		{value: "soon", expected: defaultShutdownTimeout},
+		{value: "-1s", expected: defaultShutdownTimeout},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.value, func(t *testing.T) {
+			if got := shutdownTimeout(&config.Config{ShutdownTimeout: tc.value}); got != tc.expected {
+				t.Errorf("shutdownTimeout(%q) = %v, want %v", tc.value, got, tc.expected)
+			}
+		})
+	}
+}
+
+func TestNewServer(t *testing.T) {
+	mux := http.NewServeMux()
+
+	t.Run("Configured timeouts", func(t *testing.T) {
+		cfg := &config.Config{ReadHeaderTimeout: "5s", ReadTimeout: "20s", WriteTimeout: "90s", IdleTimeout: "1m"}
+		srv := newServer(":8080", mux, cfg)
+
+		if srv.Addr != ":8080" || srv.Handler != mux {
+			t.Errorf("unexpected server address or handler: %q %v", srv.Addr, srv.Handler)
+		}
+		if srv.ReadHeaderTimeout != 5*time.Second {
+			t.Errorf("ReadHeaderTimeout = %v, want 5s", srv.ReadHeaderTimeout)
+		}
+		if srv.ReadTimeout != 20*time.Second {
+			t.Errorf("ReadTimeout = %v, want 20s", srv.ReadTimeout)
+		}
+		if srv.WriteTimeout != 90*time.Second {
+			t.Errorf("WriteTimeout = %v, want 90s", srv.WriteTimeout)
+		}
+		if srv.IdleTimeout != time.Minute {
+			t.Errorf("IdleTimeout = %v, want 1m", srv.IdleTimeout)
+		}
+	})
+
+	t.Run("Invalid timeouts fall back to defaults", func(t *testing.T) {
+		cfg := &config.Config{ReadHeaderTimeout: "soon", ReadTimeout: "0s", WriteTimeout: "-1s"}
+		srv := newServer(":8080", nil, cfg)
+
+		if srv.ReadHeaderTimeout != defaultReadHeaderTimeout ||
+			srv.ReadTimeout != defaultReadTimeout ||
+			srv.WriteTimeout != defaultWriteTimeout ||
+			srv.IdleTimeout != defaultIdleTimeout {
+			t.Errorf("expected default timeouts, got header %v read %v write %v idle %v",
+				srv.ReadHeaderTimeout, srv.ReadTimeout, srv.WriteTimeout, srv.IdleTimeout)
+		}
+	})
+}
+
+func TestShutdownServers(t *testing.T) {
+	origLogPrintf := logPrintf
+	t.Cleanup(func() { logPrintf = origLogPrintf })
+	var forced []string
+	logPrintf = func(format string, args ...any) {
+		forced = append(forced, format)
+	}
+
+	testCases := []struct {
+		name        string
+		handlerTime time.Duration
+		timeout     time.Duration
+		expectForce bool
+		expectOK    bool
+	}{
+		{name: "In-flight request finishes in time", handlerTime: 50 * time.Millisecond, timeout: 2 * time.Second, expectForce: false, expectOK: true},
+		{name: "In-flight request exceeds timeout", handlerTime: 5 * time.Second, timeout: 100 * time.Millisecond, expectForce: true, expectOK: false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			forced = nil
+			inFlight := make(chan struct{})
+			srv := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				close(inFlight)
+				select {
+				case <-time.After(tc.handlerTime):
+				case <-r.Context().Done():
+				}
+				w.Write([]byte("done"))
+			})}
+
+			ln, err := net.Listen("tcp", "127.0.0.1:0")
+			if err != nil {
+				t.Fatal(err)
+			}
+			go srv.Serve(ln)
+
+			result := make(chan error, 1)
+			go func() {
+				resp, err := http.Get("http://" + ln.Addr().String())
+				if err == nil {
+					resp.Body.Close()
+				}
+				result <- err
+			}()
+			<-inFlight
+
+			start := time.Now()
+			shutdownServers(tc.timeout, srv)
+			elapsed := time.Since(start)
+
+			if elapsed > tc.timeout+time.Second {
+				t.Errorf("shutdown took %v, want it bounded by %v", elapsed, tc.timeout)
+			}
+			if tc.expectForce && elapsed < tc.timeout {
+				t.Errorf("shutdown returned after %v, before the %v timeout", elapsed, tc.timeout)
+			}
+			if got := len(forced) > 0; got != tc.expectForce {
+				t.Errorf("forced close = %v, want %v", got, tc.expectForce)
+			}
+			if err := <-result; (err == nil) != tc.expectOK {
+				t.Errorf("in-flight request error = %v, want success=%v", err, tc.expectOK)
+			}
+		})
+	}
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/anisimovdk/ip-whitelist-by-country/internal/ipdata"
+)
+
+// metricsSample holds the counters read at one metrics tick
+type metricsSample struct {
+	requests uint64
+	hits     uint64
+	misses   uint64
+}
+
+// startMetricsLogger logs a summary of the traffic since the previous tick and
+// of the cache state every interval until ctx is done. The returned channel is
+// closed once the logger has stopped.
+func startMetricsLogger(ctx context.Context, logger *slog.Logger, interval time.Duration, requests func() uint64, stats func() ipdata.Stats) <-chan struct{} {
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		var last metricsSample
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				s := stats()
+				current := metricsSample{requests: requests(), hits: s.CacheHits, misses: s.CacheMisses}
+				logMetrics(logger, last, current, s)
+				last = current
+			}
+		}
+	}()
+	return done
+}
+
+// logMetrics logs the counter deltas between two samples and the cache state
+func logMetrics(logger *slog.Logger, last, current metricsSample, s ipdata.Stats) {
+	hits, misses := current.hits-last.hits, current.misses-last.misses
+	attrs := []any{
+		"requests", current.requests - last.requests,
+		"cache_hits", hits,
+		"cache_misses", misses,
+	}
+	if hits+misses > 0 {
+		attrs = append(attrs, "hit_rate", float64(hits)/float64(hits+misses))
+	}
+	attrs = append(attrs, "countries", s.Countries, "data_source", s.DataSource)
+	if !s.Generated.IsZero() {
+		attrs = append(attrs, "cache_age", time.Since(s.Generated).Round(time.Second))
+	}
+	logger.Info("Metrics", attrs...)
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/anisimovdk/ip-whitelist-by-country/internal/ipdata"
+)
+
+// syncBuffer is a bytes.Buffer safe for concurrent writes and reads
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+func TestStartMetricsLogger(t *testing.T) {
+	var out syncBuffer
+	logger := slog.New(slog.NewTextHandler(&out, nil))
+
+	var requests atomic.Uint64
+	var hits atomic.Uint64
+	stats := func() ipdata.Stats {
+		hits.Add(3)
+		return ipdata.Stats{DataSource: ipdata.DataSourceLive, Countries: 2, CacheHits: hits.Load(), CacheMisses: 1}
+	}
+	requestCount := func() uint64 { return requests.Add(4) }
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	done := startMetricsLogger(ctx, logger, 10*time.Millisecond, requestCount, stats)
+
+	deadline := time.Now().Add(2 * time.Second)
+	for strings.Count(out.String(), "msg=Metrics") < 2 {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for two summary lines, got %q", out.String())
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("metrics logger did not stop after cancel")
+	}
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if want := "requests=4 cache_hits=3 cache_misses=1 hit_rate=0.75 countries=2 data_source=live"; !strings.Contains(lines[0], want) {
+		t.Errorf("first summary = %q, want it to contain %q", lines[0], want)
+	}
+	// Later ticks report the change since the previous one
+	if want := "requests=4 cache_hits=3 cache_misses=0 hit_rate=1 "; !strings.Contains(lines[1], want) {
+		t.Errorf("second summary = %q, want it to contain %q", lines[1], want)
+	}
+}
+
+func TestLogMetrics(t *testing.T) {
+	t.Run("No lookups and no download yet", func(t *testing.T) {
+		var out bytes.Buffer
+		logMetrics(slog.New(slog.NewTextHandler(&out, nil)), metricsSample{}, metricsSample{requests: 2}, ipdata.Stats{})
+
+		got := out.String()
+		if !strings.Contains(got, "requests=2 cache_hits=0 cache_misses=0 countries=0") {
+			t.Errorf("summary = %q, want request and cache counters", got)
+		}
+		if strings.Contains(got, "hit_rate") || strings.Contains(got, "cache_age") {
+			t.Errorf("summary = %q, want no hit rate without lookups and no age without data", got)
+		}
+	})
+
+	t.Run("Cache age", func(t *testing.T) {
+		var out bytes.Buffer
+		s := ipdata.Stats{Generated: time.Now().Add(-90 * time.Second)}
+		logMetrics(slog.New(slog.NewTextHandler(&out, nil)), metricsSample{}, metricsSample{}, s)
+
+		if got := out.String(); !strings.Contains(got, "cache_age=1m30s") {
+			t.Errorf("summary = %q, want cache_age=1m30s", got)
+		}
+	})
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"time"
+)
+
+// scheduleNow returns the current time for the refresh scheduler (replaced in tests)
+var scheduleNow = time.Now
+
+// startRefreshScheduler calls refresh every day at the time of day at (an
+// offset from midnight UTC) until ctx is done. The returned channel is closed
+// once the scheduler has stopped.
+func startRefreshScheduler(ctx context.Context, at time.Duration, refresh func(ctx context.Context) (bool, error)) <-chan struct{} {
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+
+		for {
+			timer := time.NewTimer(nextRefresh(scheduleNow(), at).Sub(scheduleNow()))
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return
+			case <-timer.C:
+				if _, err := refresh(ctx); err != nil {
+					slog.Error("Scheduled refresh failed", "error", err)
+				}
+			}
+		}
+	}()
+	return done
+}
+
+// nextRefresh returns the first time after now that is at past midnight UTC
+func nextRefresh(now time.Time, at time.Duration) time.Time {
+	now = now.UTC()
+	next := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC).Add(at)
+	if !next.After(now) {
+		next = next.AddDate(0, 0, 1)
+	}
+	return next
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestNextRefresh(t *testing.T) {
+	at := 90 * time.Minute // 01:30 UTC
+
+	testCases := []struct {
+		name     string
+		now      time.Time
+		expected time.Time
+	}{
+		{
+			name:     "Before the publish time",
+			now:      time.Date(2024, 1, 2, 0, 15, 0, 0, time.UTC),
+			expected: time.Date(2024, 1, 2, 1, 30, 0, 0, time.UTC),
+		},
+		{
+			name:     "At the publish time",
+			now:      time.Date(2024, 1, 2, 1, 30, 0, 0, time.UTC),
+			expected: time.Date(2024, 1, 3, 1, 30, 0, 0, time.UTC),
+		},
+		{
+			name:     "After the publish time",
+			now:      time.Date(2024, 12, 31, 18, 0, 0, 0, time.UTC),
+			expected: time.Date(2025, 1, 1, 1, 30, 0, 0, time.UTC),
+		},
+		{
+			name:     "Local time zone",
+			now:      time.Date(2024, 1, 2, 2, 0, 0, 0, time.FixedZone("CET", 3600)),
+			expected: time.Date(2024, 1, 2, 1, 30, 0, 0, time.UTC),
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := nextRefresh(tc.now, at); !got.Equal(tc.expected) {
+				t.Errorf("nextRefresh(%v) = %v, want %v", tc.now, got, tc.expected)
+			}
+		})
+	}
+}
+
+func TestStartRefreshScheduler(t *testing.T) {
+	// Every scheduled refresh is due 10ms from now
+	origScheduleNow := scheduleNow
+	t.Cleanup(func() { scheduleNow = origScheduleNow })
+	at := time.Hour
+	scheduleNow = func() time.Time {
+		return time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC).Add(at - 10*time.Millisecond)
+	}
+
+	restoreDefaultLogger(t)
+	var info, logged syncBuffer
+	slog.SetDefault(slog.New(newLevelRouter(&info, &logged)))
+
+	var calls atomic.Int32
+	refresh := func(ctx context.Context) (bool, error) {
+		if calls.Add(1) == 1 {
+			return false, errors.New("download failed")
+		}
+		return true, nil
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	done := startRefreshScheduler(ctx, at, refresh)
+
+	deadline := time.Now().Add(2 * time.Second)
+	for calls.Load() < 2 {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for two scheduled refreshes, got %d", calls.Load())
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("scheduler did not stop after cancel")
+	}
+
+	if got := logged.String(); !strings.Contains(got, `level=ERROR msg="Scheduled refresh failed" error="download failed"`) {
+		t.Errorf("log = %q, want the failed refresh", got)
+	}
+}
@@ -3,7 +3,11 @@ package config
 import (
 	"fmt"
 	"io"
+	"net"
 	"os"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/alexflint/go-arg"
 	"github.com/anisimovdk/ip-whitelist-by-country/internal/version"
@@ -16,10 +20,59 @@ var (
 
 // Config represents the application configuration
 type Config struct {
-	ServerPort    string `arg:"--port,env:SERVER_PORT" help:"Port to run the server on"`
-	AuthToken     string `arg:"--auth-token,env:AUTH_TOKEN" help:"Authentication token for API requests (leave empty to disable auth)"`
-	CacheDuration string `arg:"--cache-duration,env:CACHE_DURATION" help:"Duration to cache IP data (e.g., 24h)"`
-	ShowVersion   bool   `arg:"--version,-v" help:"Show version information"`
+	ServerPort         string `arg:"--port,env:SERVER_PORT" help:"Port to run the server on"`
+	ListenAddresses    string `arg:"--listen,env:LISTEN_ADDRESSES" help:"Comma-separated addresses to serve the API on (e.g. 0.0.0.0:8080,[::1]:8080); entries without a port use --port (empty listens on all interfaces)"`
+	AdminPort          string `arg:"--admin-port,env:ADMIN_PORT" help:"Separate port for management endpoints (leave empty to serve them on the main port)"`
+	AuthToken          string `arg:"--auth-token,env:AUTH_TOKEN" help:"Authentication token for API requests (leave empty to disable auth)"`
+	MaxConnections     int    `arg:"--max-connections,env:MAX_CONNECTIONS" help:"Maximum simultaneous connections on the main port, per listen address; extra connections are closed (0 means unlimited)"`
+	MaxBodyBytes       int64  `arg:"--max-body-bytes,env:MAX_BODY_BYTES" help:"Read at most this many bytes of a request body before closing the connection; /get rejects GET and HEAD requests that carry one"`
+	ShutdownTimeout    string `arg:"--shutdown-timeout,env:SHUTDOWN_TIMEOUT" help:"How long to wait for in-flight requests on shutdown before closing connections (e.g., 15s)"`
+	ReadHeaderTimeout  string `arg:"--read-header-timeout,env:READ_HEADER_TIMEOUT" help:"Maximum time to read request headers (e.g., 10s)"`
+	ReadTimeout        string `arg:"--read-timeout,env:READ_TIMEOUT" help:"Maximum time to read an entire request (e.g., 30s)"`
+	WriteTimeout       string `arg:"--write-timeout,env:WRITE_TIMEOUT" help:"Maximum time to write a response, including any synchronous data download (e.g., 2m)"`
+	IdleTimeout        string `arg:"--idle-timeout,env:IDLE_TIMEOUT" help:"How long idle keep-alive connections stay open (e.g., 2m)"`
+	PublicCountries    string `arg:"--public-countries,env:PUBLIC_COUNTRIES" help:"Comma-separated country codes that /get serves without the auth token (e.g. DE,FR); other countries still require it"`
+	CountryAliases     string `arg:"--country-aliases,env:COUNTRY_ALIASES" help:"Additional country code aliases as ALIAS=CC pairs (e.g. KS=XK); UK=GB and EL=GR are built in"`
+	CacheDuration      string `arg:"--cache-duration,env:CACHE_DURATION" help:"Duration to cache IP data (e.g., 24h)"`
+	MinCacheDuration   string `arg:"--min-cache-duration,env:MIN_CACHE_DURATION" help:"Lower bound for the cache duration to avoid hammering the upstream registry"`
+	RefreshAt          string `arg:"--refresh-at,env:REFRESH_AT" help:"Also refresh the data every day at this UTC time (HH:MM), shortly after RIPE NCC publishes it; skipped if the upstream file is unchanged (empty disables)"`
+	CountryTTL         string `arg:"--country-ttl,env:COUNTRY_TTL" help:"Per-country cache duration overrides as CC=duration pairs (e.g. DE=10m,FR=2h)"`
+	CacheJitter        int    `arg:"--cache-jitter,env:CACHE_JITTER" help:"Randomize the cache duration by up to this percentage per instance to spread out refreshes"`
+	ColdStartWait      string `arg:"--cold-start-wait,env:COLD_START_WAIT" help:"While no data has been downloaded yet, requests wait at most this long for the first download and then get 503 with Retry-After (e.g., 2s; empty waits for the whole download)"`
+	MaxDownloadBytes   int64  `arg:"--max-download-bytes,env:MAX_DOWNLOAD_BYTES" help:"Abort downloads larger than this many bytes (0 disables the limit)"`
+	HeadSizeCheck      bool   `arg:"--head-size-check,env:HEAD_SIZE_CHECK" help:"Send a HEAD request before each download and skip it if the upstream file has no Last-Modified header and the same Content-Length as the previous download"`
+	FallbackDataURL    string `arg:"--fallback-data-url,env:FALLBACK_DATA_URL" help:"Mirror of the delegated-stats file to download from when the primary download fails"`
+	StaleOnParseError  bool   `arg:"--stale-on-parse-error,env:STALE_ON_PARSE_ERROR" help:"Keep serving the previous data when a refresh downloads data that fails to parse, instead of failing requests"`
+	MaxStaleAge        string `arg:"--max-stale-age,env:MAX_STALE_AGE" help:"When a refresh fails, keep serving cached data younger than this and fail requests with 503 once it is older (e.g., 48h; empty disables)"`
+	ArchiveURL         string `arg:"--archive-url,env:ARCHIVE_URL" help:"URL template of archived daily delegated-stats files with {date} (YYYYMMDD) and {year} placeholders, enabling the date parameter of /get (empty disables)"`
+	MaxSnapshots       int    `arg:"--max-snapshots,env:MAX_SNAPSHOTS" help:"Number of archived days kept in memory for the date parameter of /get"`
+	UpstreamPeer       string `arg:"--upstream-peer,env:UPSTREAM_PEER" help:"Base URL of another instance to load the parsed dataset from via its /export endpoint instead of downloading from RIPE NCC"`
+	BreakerThreshold   int    `arg:"--breaker-threshold,env:BREAKER_THRESHOLD" help:"Stop attempting downloads after this many consecutive failures (0 disables the circuit breaker)"`
+	BreakerCooldown    string `arg:"--breaker-cooldown,env:BREAKER_COOLDOWN" help:"How long downloads stay paused once the circuit breaker opens (e.g., 1m)"`
+	EmbeddedFallback   bool   `arg:"--embedded-fallback,env:EMBEDDED_FALLBACK" help:"Serve the snapshot compiled into the binary until the first live download succeeds"`
+	DataHostIP         string `arg:"--data-host-ip,env:DATA_HOST_IP" help:"Connect to this IP for RIPE NCC downloads instead of resolving its host"`
+	HTTPProxy          string `arg:"--http-proxy,env:HTTP_PROXY_URL" help:"Proxy URL for data downloads (overrides HTTP_PROXY/HTTPS_PROXY)"`
+	NoProxy            string `arg:"--no-proxy,env:NO_PROXY_HOSTS" help:"Comma-separated hosts, domains or CIDRs that bypass --http-proxy"`
+	ExtraCIDRs         string `arg:"--extra-cidrs,env:EXTRA_CIDRS" help:"CIDR blocks added to a country's list on every refresh as CC=CIDR pairs (e.g. DE=198.51.100.0/24), or @file with one pair per line"`
+	ExcludeCIDRs       string `arg:"--exclude-cidrs,env:EXCLUDE_CIDRS" help:"CIDR blocks removed from every country's list on every refresh, carving them out of larger blocks (e.g. 198.51.100.0/28), or @file with one block per line"`
+	ExcludeSpecial     bool   `arg:"--exclude-special,env:EXCLUDE_SPECIAL" help:"Drop CIDR blocks within RFC1918, loopback, link-local and other special-use ranges"`
+	ParseWorkers       int    `arg:"--parse-workers,env:PARSE_WORKERS" help:"Number of goroutines parsing downloaded data in chunks; 1 parses serially"`
+	StrictParse        bool   `arg:"--strict-parse,env:STRICT_PARSE" help:"Verify each CIDR mask against the source address count and log mismatches"`
+	StrictCountryCase  bool   `arg:"--strict-country-case,env:STRICT_COUNTRY_CASE" help:"Reject country codes that are not exactly two uppercase letters instead of normalizing them"`
+	MaxCountries       int    `arg:"--max-countries,env:MAX_COUNTRIES" help:"Maximum number of comma-separated countries accepted in one /get request"`
+	StrictQuery        bool   `arg:"--strict-query,env:STRICT_QUERY" help:"Reject requests containing unrecognized query parameters"`
+	Export             string `arg:"--export,env:EXPORT_DIR" help:"Download the IP data, write one file per country into this directory and exit"`
+	Format             string `arg:"--format,env:EXPORT_FORMAT" help:"Output format for --export (cidr, netmask, complement, ndjson, cisco, csv, mikrotik)"`
+	EnabledFormats     string `arg:"--enabled-formats,env:ENABLED_FORMATS" help:"Comma-separated /get formats to serve (e.g. cidr,ndjson); requests for other formats get 400 (empty enables all)"`
+	RefreshWebhookURL  string `arg:"--refresh-webhook-url,env:REFRESH_WEBHOOK_URL" help:"POST a JSON summary of the data to this URL after each successful refresh (best effort; empty disables)"`
+	PrecomputeFormats  string `arg:"--precompute-formats,env:PRECOMPUTE_FORMATS" help:"Render these /get responses as CC=format pairs (e.g. DE=cidr,US=netmask) right after each refresh, so requests for them with default options skip rendering"`
+	MetricsLogInterval string `arg:"--metrics-log-interval,env:METRICS_LOG_INTERVAL" help:"Log a summary of requests and cache state at this interval (e.g., 5m; empty disables)"`
+	LogLevel           string `arg:"--log-level,env:LOG_LEVEL" help:"Initial log level (debug, info, warn, error); SIGUSR1 raises the verbosity, SIGUSR2 restores this level"`
+	ErrorLog           string `arg:"--error-log,env:ERROR_LOG" help:"Write error-level log records to this file (or stderr) and all other records to stdout (empty keeps everything in one stream)"`
+	RequestIDHeader    string `arg:"--request-id-header,env:REQUEST_ID_HEADER" help:"Header carrying the request ID, which is echoed in the response and included in the request's log lines; a UUID is generated when a request has none (empty disables)"`
+	Maintenance        bool   `arg:"--maintenance,env:MAINTENANCE" help:"Start in maintenance mode: /get returns 503 until it is turned off via the /maintenance endpoint"`
+	EnablePprof        bool   `arg:"--enable-pprof,env:ENABLE_PPROF" help:"Expose runtime profiling endpoints under /debug/pprof/"`
+	ShowVersion        bool   `arg:"--version,-v" help:"Show version information"`
 }
 
 // Version returns the version string for go-arg
@@ -35,9 +88,24 @@ func (Config) Description() string {
 // NewConfig parses command-line arguments and returns a Config instance
 func NewConfig() *Config {
 	cfg := &Config{
-		ServerPort:    "8080",
-		AuthToken:     "", // Empty by default = no authentication required
-		CacheDuration: "1h",
+		ServerPort:        "8080",
+		AuthToken:         "",       // Empty by default = no authentication required
+		MaxBodyBytes:      64 << 10, // 64 KiB
+		ShutdownTimeout:   "15s",
+		ReadHeaderTimeout: "10s",
+		ReadTimeout:       "30s",
+		WriteTimeout:      "2m",
+		IdleTimeout:       "2m",
+		CacheDuration:     "1h",
+		MinCacheDuration:  "5m",
+		MaxDownloadBytes:  50 << 20, // 50 MiB
+		BreakerCooldown:   "1m",
+		MaxCountries:      50,
+		MaxSnapshots:      7,
+		ParseWorkers:      1,
+		Format:            "cidr",
+		LogLevel:          "info",
+		RequestIDHeader:   "X-Request-ID",
 	}
 
 	parser := arg.MustParse(cfg)
@@ -48,8 +116,76 @@ func NewConfig() *Config {
 		osExit(0)
 	}
 
-	// Add custom help behavior if needed
-	_ = parser
+	// Reject malformed ports here rather than with an obscure listen error at startup
+	if err := validatePort(cfg.ServerPort); err != nil {
+		fail(parser, "--port: "+err.Error())
+	}
+	if cfg.AdminPort != "" {
+		if err := validatePort(cfg.AdminPort); err != nil {
+			fail(parser, "--admin-port: "+err.Error())
+		}
+	}
+	if _, err := ParseListenAddresses(cfg.ListenAddresses, cfg.ServerPort); err != nil {
+		fail(parser, "--listen: "+err.Error())
+	}
+
+	if cfg.RefreshAt != "" {
+		if _, err := ParseTimeOfDay(cfg.RefreshAt); err != nil {
+			fail(parser, "--refresh-at: "+err.Error())
+		}
+	}
 
 	return cfg
 }
+
+// ParseTimeOfDay parses a time of day in HH:MM form, e.g. "01:30", into the
+// offset from midnight
+func ParseTimeOfDay(value string) (time.Duration, error) {
+	t, err := time.Parse("15:04", value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid time of day %q, must be HH:MM", value)
+	}
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, nil
+}
+
+// ParseListenAddresses parses a comma-separated list of listen addresses, e.g.
+// "127.0.0.1:8080,[::1]". Entries without a port listen on port, and an empty
+// list listens on all interfaces on port.
+func ParseListenAddresses(value, port string) ([]string, error) {
+	var addrs []string
+	for _, entry := range strings.Split(value, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		host, entryPort, err := net.SplitHostPort(entry)
+		if err != nil {
+			host, entryPort = strings.Trim(entry, "[]"), port
+		}
+		if err := validatePort(entryPort); err != nil {
+			return nil, fmt.Errorf("address %q: %w", entry, err)
+		}
+		addrs = append(addrs, net.JoinHostPort(host, entryPort))
+	}
+	if len(addrs) == 0 {
+		return []string{":" + port}, nil
+	}
+	return addrs, nil
+}
+
+// validatePort checks that port is a TCP port number, or 0 to let the system
+// pick an ephemeral port
+func validatePort(port string) error {
+	n, err := strconv.Atoi(port)
+	if err != nil || n < 0 || n > 65535 {
+		return fmt.Errorf("invalid port %q, must be a number between 1 and 65535, or 0 for an ephemeral port", port)
+	}
+	return nil
+}
+
+// fail prints the usage and msg like go-arg does for invalid arguments and exits with status 2
+func fail(parser *arg.Parser, msg string) {
+	parser.WriteUsage(stdOut)
+	fmt.Fprintln(stdOut, "error:", msg)
+	osExit(2)
+}
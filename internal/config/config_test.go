@@ -3,8 +3,10 @@ package config
 import (
 	"bytes"
 	"os"
+	"slices"
 	"strings"
 	"testing"
+	"time"
 )
 
 func TestConfigVersion(t *testing.T) {
@@ -92,12 +94,159 @@ func TestNewConfig_Defaults(t *testing.T) {
 	if cfg.ServerPort != "8080" {
 		t.Errorf("ServerPort = %q, want %q", cfg.ServerPort, "8080")
 	}
+	if cfg.AdminPort != "" {
+		t.Errorf("AdminPort = %q, want empty string", cfg.AdminPort)
+	}
+	if cfg.ListenAddresses != "" {
+		t.Errorf("ListenAddresses = %q, want empty string", cfg.ListenAddresses)
+	}
 	if cfg.AuthToken != "" {
 		t.Errorf("AuthToken = %q, want empty string", cfg.AuthToken)
 	}
+	if cfg.MaxBodyBytes != 64<<10 {
+		t.Errorf("MaxBodyBytes = %d, want %d", cfg.MaxBodyBytes, 64<<10)
+	}
+	if cfg.MaxConnections != 0 {
+		t.Errorf("MaxConnections = %d, want 0", cfg.MaxConnections)
+	}
+	if cfg.ShutdownTimeout != "15s" {
+		t.Errorf("ShutdownTimeout = %q, want %q", cfg.ShutdownTimeout, "15s")
+	}
+	if cfg.ReadHeaderTimeout != "10s" {
+		t.Errorf("ReadHeaderTimeout = %q, want %q", cfg.ReadHeaderTimeout, "10s")
+	}
+	if cfg.ReadTimeout != "30s" {
+		t.Errorf("ReadTimeout = %q, want %q", cfg.ReadTimeout, "30s")
+	}
+	if cfg.WriteTimeout != "2m" {
+		t.Errorf("WriteTimeout = %q, want %q", cfg.WriteTimeout, "2m")
+	}
+	if cfg.IdleTimeout != "2m" {
+		t.Errorf("IdleTimeout = %q, want %q", cfg.IdleTimeout, "2m")
+	}
+	if cfg.PublicCountries != "" {
+		t.Errorf("PublicCountries = %q, want empty string", cfg.PublicCountries)
+	}
+	if cfg.CountryAliases != "" {
+		t.Errorf("CountryAliases = %q, want empty string", cfg.CountryAliases)
+	}
 	if cfg.CacheDuration != "1h" {
 		t.Errorf("CacheDuration = %q, want %q", cfg.CacheDuration, "1h")
 	}
+	if cfg.MinCacheDuration != "5m" {
+		t.Errorf("MinCacheDuration = %q, want %q", cfg.MinCacheDuration, "5m")
+	}
+	if cfg.MaxDownloadBytes != 50<<20 {
+		t.Errorf("MaxDownloadBytes = %d, want %d", cfg.MaxDownloadBytes, 50<<20)
+	}
+	if cfg.EmbeddedFallback {
+		t.Errorf("EmbeddedFallback = %v, want false", cfg.EmbeddedFallback)
+	}
+	if cfg.DataHostIP != "" {
+		t.Errorf("DataHostIP = %q, want empty string", cfg.DataHostIP)
+	}
+	if cfg.RefreshAt != "" {
+		t.Errorf("RefreshAt = %q, want empty string", cfg.RefreshAt)
+	}
+	if cfg.CountryTTL != "" {
+		t.Errorf("CountryTTL = %q, want empty string", cfg.CountryTTL)
+	}
+	if cfg.CacheJitter != 0 {
+		t.Errorf("CacheJitter = %d, want 0", cfg.CacheJitter)
+	}
+	if cfg.StaleOnParseError {
+		t.Errorf("StaleOnParseError = %v, want false", cfg.StaleOnParseError)
+	}
+	if cfg.HeadSizeCheck {
+		t.Errorf("HeadSizeCheck = %v, want false", cfg.HeadSizeCheck)
+	}
+	if cfg.MaxStaleAge != "" {
+		t.Errorf("MaxStaleAge = %q, want empty", cfg.MaxStaleAge)
+	}
+	if cfg.ColdStartWait != "" {
+		t.Errorf("ColdStartWait = %q, want empty", cfg.ColdStartWait)
+	}
+	if cfg.RefreshWebhookURL != "" {
+		t.Errorf("RefreshWebhookURL = %q, want empty", cfg.RefreshWebhookURL)
+	}
+	if cfg.PrecomputeFormats != "" {
+		t.Errorf("PrecomputeFormats = %q, want empty", cfg.PrecomputeFormats)
+	}
+	if cfg.EnabledFormats != "" {
+		t.Errorf("EnabledFormats = %q, want empty", cfg.EnabledFormats)
+	}
+	if cfg.RequestIDHeader != "X-Request-ID" {
+		t.Errorf("RequestIDHeader = %q, want %q", cfg.RequestIDHeader, "X-Request-ID")
+	}
+	if cfg.ArchiveURL != "" {
+		t.Errorf("ArchiveURL = %q, want empty", cfg.ArchiveURL)
+	}
+	if cfg.MaxSnapshots != 7 {
+		t.Errorf("MaxSnapshots = %d, want 7", cfg.MaxSnapshots)
+	}
+	if cfg.UpstreamPeer != "" {
+		t.Errorf("UpstreamPeer = %q, want empty string", cfg.UpstreamPeer)
+	}
+	if cfg.FallbackDataURL != "" {
+		t.Errorf("FallbackDataURL = %q, want empty string", cfg.FallbackDataURL)
+	}
+	if cfg.BreakerThreshold != 0 {
+		t.Errorf("BreakerThreshold = %d, want 0", cfg.BreakerThreshold)
+	}
+	if cfg.BreakerCooldown != "1m" {
+		t.Errorf("BreakerCooldown = %q, want %q", cfg.BreakerCooldown, "1m")
+	}
+	if cfg.HTTPProxy != "" {
+		t.Errorf("HTTPProxy = %q, want empty string", cfg.HTTPProxy)
+	}
+	if cfg.NoProxy != "" {
+		t.Errorf("NoProxy = %q, want empty string", cfg.NoProxy)
+	}
+	if cfg.ExtraCIDRs != "" {
+		t.Errorf("ExtraCIDRs = %q, want empty string", cfg.ExtraCIDRs)
+	}
+	if cfg.ExcludeCIDRs != "" {
+		t.Errorf("ExcludeCIDRs = %q, want empty string", cfg.ExcludeCIDRs)
+	}
+	if cfg.ExcludeSpecial {
+		t.Errorf("ExcludeSpecial = %v, want false", cfg.ExcludeSpecial)
+	}
+	if cfg.Export != "" {
+		t.Errorf("Export = %q, want empty string", cfg.Export)
+	}
+	if cfg.Format != "cidr" {
+		t.Errorf("Format = %q, want %q", cfg.Format, "cidr")
+	}
+	if cfg.StrictParse {
+		t.Errorf("StrictParse = %v, want false", cfg.StrictParse)
+	}
+	if cfg.StrictCountryCase {
+		t.Errorf("StrictCountryCase = %v, want false", cfg.StrictCountryCase)
+	}
+	if cfg.ParseWorkers != 1 {
+		t.Errorf("ParseWorkers = %d, want 1", cfg.ParseWorkers)
+	}
+	if cfg.MaxCountries != 50 {
+		t.Errorf("MaxCountries = %d, want %d", cfg.MaxCountries, 50)
+	}
+	if cfg.StrictQuery {
+		t.Errorf("StrictQuery = %v, want false", cfg.StrictQuery)
+	}
+	if cfg.MetricsLogInterval != "" {
+		t.Errorf("MetricsLogInterval = %q, want empty", cfg.MetricsLogInterval)
+	}
+	if cfg.LogLevel != "info" {
+		t.Errorf("LogLevel = %q, want %q", cfg.LogLevel, "info")
+	}
+	if cfg.ErrorLog != "" {
+		t.Errorf("ErrorLog = %q, want empty string", cfg.ErrorLog)
+	}
+	if cfg.Maintenance {
+		t.Errorf("Maintenance = %v, want false", cfg.Maintenance)
+	}
+	if cfg.EnablePprof {
+		t.Errorf("EnablePprof = %v, want false", cfg.EnablePprof)
+	}
 	if cfg.ShowVersion {
 		t.Errorf("ShowVersion = %v, want false", cfg.ShowVersion)
 	}
@@ -109,19 +258,215 @@ func TestNewConfig_EnvOverrides(t *testing.T) {
 
 	os.Args = []string{"app"}
 	t.Setenv("SERVER_PORT", "9091")
+	t.Setenv("ADMIN_PORT", "9092")
+	t.Setenv("LISTEN_ADDRESSES", "127.0.0.1,[::1]:9093")
 	t.Setenv("AUTH_TOKEN", "env-token")
 	t.Setenv("CACHE_DURATION", "2h")
+	t.Setenv("MIN_CACHE_DURATION", "10m")
+	t.Setenv("MAX_DOWNLOAD_BYTES", "1048576")
+	t.Setenv("EMBEDDED_FALLBACK", "true")
+	t.Setenv("DATA_HOST_IP", "193.0.6.140")
+	t.Setenv("MAX_CONNECTIONS", "100")
+	t.Setenv("MAX_BODY_BYTES", "1024")
+	t.Setenv("SHUTDOWN_TIMEOUT", "25s")
+	t.Setenv("READ_HEADER_TIMEOUT", "5s")
+	t.Setenv("READ_TIMEOUT", "20s")
+	t.Setenv("WRITE_TIMEOUT", "90s")
+	t.Setenv("IDLE_TIMEOUT", "1m")
+	t.Setenv("COUNTRY_ALIASES", "KS=XK")
+	t.Setenv("PUBLIC_COUNTRIES", "DE,FR")
+	t.Setenv("COUNTRY_TTL", "DE=10m")
+	t.Setenv("REFRESH_AT", "01:30")
+	t.Setenv("CACHE_JITTER", "15")
+	t.Setenv("UPSTREAM_PEER", "http://leader:8080")
+	t.Setenv("STALE_ON_PARSE_ERROR", "true")
+	t.Setenv("HEAD_SIZE_CHECK", "true")
+	t.Setenv("MAX_STALE_AGE", "48h")
+	t.Setenv("COLD_START_WAIT", "2s")
+	t.Setenv("REFRESH_WEBHOOK_URL", "http://hooks.example.com/refresh")
+	t.Setenv("PRECOMPUTE_FORMATS", "DE=cidr,US=netmask")
+	t.Setenv("REQUEST_ID_HEADER", "X-Correlation-ID")
+	t.Setenv("ENABLED_FORMATS", "cidr,ndjson")
+	t.Setenv("ARCHIVE_URL", "https://archive.example/{date}")
+	t.Setenv("MAX_SNAPSHOTS", "3")
+	t.Setenv("FALLBACK_DATA_URL", "https://mirror.example.net/latest")
+	t.Setenv("BREAKER_THRESHOLD", "3")
+	t.Setenv("BREAKER_COOLDOWN", "30s")
+	t.Setenv("HTTP_PROXY_URL", "http://proxy.internal:3128")
+	t.Setenv("NO_PROXY_HOSTS", "mirror.local")
+	t.Setenv("EXTRA_CIDRS", "DE=198.51.100.0/24")
+	t.Setenv("EXCLUDE_CIDRS", "198.51.100.0/28")
+	t.Setenv("EXCLUDE_SPECIAL", "true")
+	t.Setenv("EXPORT_DIR", "/tmp/export")
+	t.Setenv("EXPORT_FORMAT", "netmask")
+	t.Setenv("STRICT_PARSE", "true")
+	t.Setenv("STRICT_COUNTRY_CASE", "true")
+	t.Setenv("MAX_COUNTRIES", "5")
+	t.Setenv("PARSE_WORKERS", "4")
+	t.Setenv("STRICT_QUERY", "true")
+	t.Setenv("METRICS_LOG_INTERVAL", "5m")
+	t.Setenv("LOG_LEVEL", "debug")
+	t.Setenv("ERROR_LOG", "stderr")
+	t.Setenv("MAINTENANCE", "true")
+	t.Setenv("ENABLE_PPROF", "true")
 
 	cfg := NewConfig()
 	if cfg.ServerPort != "9091" {
 		t.Errorf("ServerPort = %q, want %q", cfg.ServerPort, "9091")
 	}
+	if cfg.AdminPort != "9092" {
+		t.Errorf("AdminPort = %q, want %q", cfg.AdminPort, "9092")
+	}
+	if cfg.ListenAddresses != "127.0.0.1,[::1]:9093" {
+		t.Errorf("ListenAddresses = %q, want %q", cfg.ListenAddresses, "127.0.0.1,[::1]:9093")
+	}
 	if cfg.AuthToken != "env-token" {
 		t.Errorf("AuthToken = %q, want %q", cfg.AuthToken, "env-token")
 	}
 	if cfg.CacheDuration != "2h" {
 		t.Errorf("CacheDuration = %q, want %q", cfg.CacheDuration, "2h")
 	}
+	if cfg.MinCacheDuration != "10m" {
+		t.Errorf("MinCacheDuration = %q, want %q", cfg.MinCacheDuration, "10m")
+	}
+	if cfg.MaxDownloadBytes != 1048576 {
+		t.Errorf("MaxDownloadBytes = %d, want %d", cfg.MaxDownloadBytes, 1048576)
+	}
+	if !cfg.EmbeddedFallback {
+		t.Errorf("EmbeddedFallback = %v, want true", cfg.EmbeddedFallback)
+	}
+	if cfg.DataHostIP != "193.0.6.140" {
+		t.Errorf("DataHostIP = %q, want %q", cfg.DataHostIP, "193.0.6.140")
+	}
+	if cfg.PublicCountries != "DE,FR" {
+		t.Errorf("PublicCountries = %q, want %q", cfg.PublicCountries, "DE,FR")
+	}
+	if cfg.CountryAliases != "KS=XK" {
+		t.Errorf("CountryAliases = %q, want %q", cfg.CountryAliases, "KS=XK")
+	}
+	if cfg.MaxBodyBytes != 1024 {
+		t.Errorf("MaxBodyBytes = %d, want 1024", cfg.MaxBodyBytes)
+	}
+	if cfg.MaxConnections != 100 {
+		t.Errorf("MaxConnections = %d, want 100", cfg.MaxConnections)
+	}
+	if cfg.ShutdownTimeout != "25s" {
+		t.Errorf("ShutdownTimeout = %q, want %q", cfg.ShutdownTimeout, "25s")
+	}
+	if cfg.ReadHeaderTimeout != "5s" {
+		t.Errorf("ReadHeaderTimeout = %q, want %q", cfg.ReadHeaderTimeout, "5s")
+	}
+	if cfg.ReadTimeout != "20s" {
+		t.Errorf("ReadTimeout = %q, want %q", cfg.ReadTimeout, "20s")
+	}
+	if cfg.WriteTimeout != "90s" {
+		t.Errorf("WriteTimeout = %q, want %q", cfg.WriteTimeout, "90s")
+	}
+	if cfg.IdleTimeout != "1m" {
+		t.Errorf("IdleTimeout = %q, want %q", cfg.IdleTimeout, "1m")
+	}
+	if cfg.RefreshAt != "01:30" {
+		t.Errorf("RefreshAt = %q, want %q", cfg.RefreshAt, "01:30")
+	}
+	if cfg.CountryTTL != "DE=10m" {
+		t.Errorf("CountryTTL = %q, want %q", cfg.CountryTTL, "DE=10m")
+	}
+	if cfg.CacheJitter != 15 {
+		t.Errorf("CacheJitter = %d, want 15", cfg.CacheJitter)
+	}
+	if !cfg.StaleOnParseError {
+		t.Errorf("StaleOnParseError = %v, want true", cfg.StaleOnParseError)
+	}
+	if !cfg.HeadSizeCheck {
+		t.Errorf("HeadSizeCheck = %v, want true", cfg.HeadSizeCheck)
+	}
+	if cfg.MaxStaleAge != "48h" {
+		t.Errorf("MaxStaleAge = %q, want %q", cfg.MaxStaleAge, "48h")
+	}
+	if cfg.ColdStartWait != "2s" {
+		t.Errorf("ColdStartWait = %q, want %q", cfg.ColdStartWait, "2s")
+	}
+	if cfg.RefreshWebhookURL != "http://hooks.example.com/refresh" {
+		t.Errorf("RefreshWebhookURL = %q, want %q", cfg.RefreshWebhookURL, "http://hooks.example.com/refresh")
+	}
+	if cfg.PrecomputeFormats != "DE=cidr,US=netmask" {
+		t.Errorf("PrecomputeFormats = %q, want %q", cfg.PrecomputeFormats, "DE=cidr,US=netmask")
+	}
+	if cfg.EnabledFormats != "cidr,ndjson" {
+		t.Errorf("EnabledFormats = %q, want %q", cfg.EnabledFormats, "cidr,ndjson")
+	}
+	if cfg.RequestIDHeader != "X-Correlation-ID" {
+		t.Errorf("RequestIDHeader = %q, want %q", cfg.RequestIDHeader, "X-Correlation-ID")
+	}
+	if cfg.ArchiveURL != "https://archive.example/{date}" {
+		t.Errorf("ArchiveURL = %q, want %q", cfg.ArchiveURL, "https://archive.example/{date}")
+	}
+	if cfg.MaxSnapshots != 3 {
+		t.Errorf("MaxSnapshots = %d, want 3", cfg.MaxSnapshots)
+	}
+	if cfg.UpstreamPeer != "http://leader:8080" {
+		t.Errorf("UpstreamPeer = %q, want %q", cfg.UpstreamPeer, "http://leader:8080")
+	}
+	if cfg.FallbackDataURL != "https://mirror.example.net/latest" {
+		t.Errorf("FallbackDataURL = %q, want %q", cfg.FallbackDataURL, "https://mirror.example.net/latest")
+	}
+	if cfg.BreakerThreshold != 3 {
+		t.Errorf("BreakerThreshold = %d, want 3", cfg.BreakerThreshold)
+	}
+	if cfg.BreakerCooldown != "30s" {
+		t.Errorf("BreakerCooldown = %q, want %q", cfg.BreakerCooldown, "30s")
+	}
+	if cfg.HTTPProxy != "http://proxy.internal:3128" {
+		t.Errorf("HTTPProxy = %q, want %q", cfg.HTTPProxy, "http://proxy.internal:3128")
+	}
+	if cfg.NoProxy != "mirror.local" {
+		t.Errorf("NoProxy = %q, want %q", cfg.NoProxy, "mirror.local")
+	}
+	if cfg.Export != "/tmp/export" {
+		t.Errorf("Export = %q, want %q", cfg.Export, "/tmp/export")
+	}
+	if cfg.Format != "netmask" {
+		t.Errorf("Format = %q, want %q", cfg.Format, "netmask")
+	}
+	if cfg.ExtraCIDRs != "DE=198.51.100.0/24" {
+		t.Errorf("ExtraCIDRs = %q, want %q", cfg.ExtraCIDRs, "DE=198.51.100.0/24")
+	}
+	if cfg.ExcludeCIDRs != "198.51.100.0/28" {
+		t.Errorf("ExcludeCIDRs = %q, want %q", cfg.ExcludeCIDRs, "198.51.100.0/28")
+	}
+	if !cfg.ExcludeSpecial {
+		t.Errorf("ExcludeSpecial = %v, want true", cfg.ExcludeSpecial)
+	}
+	if !cfg.StrictParse {
+		t.Errorf("StrictParse = %v, want true", cfg.StrictParse)
+	}
+	if !cfg.StrictCountryCase {
+		t.Errorf("StrictCountryCase = %v, want true", cfg.StrictCountryCase)
+	}
+	if cfg.ParseWorkers != 4 {
+		t.Errorf("ParseWorkers = %d, want 4", cfg.ParseWorkers)
+	}
+	if cfg.MaxCountries != 5 {
+		t.Errorf("MaxCountries = %d, want %d", cfg.MaxCountries, 5)
+	}
+	if !cfg.StrictQuery {
+		t.Errorf("StrictQuery = %v, want true", cfg.StrictQuery)
+	}
+	if cfg.MetricsLogInterval != "5m" {
+		t.Errorf("MetricsLogInterval = %q, want %q", cfg.MetricsLogInterval, "5m")
+	}
+	if cfg.LogLevel != "debug" {
+		t.Errorf("LogLevel = %q, want %q", cfg.LogLevel, "debug")
+	}
+	if cfg.ErrorLog != "stderr" {
+		t.Errorf("ErrorLog = %q, want %q", cfg.ErrorLog, "stderr")
+	}
+	if !cfg.Maintenance {
+		t.Errorf("Maintenance = %v, want true", cfg.Maintenance)
+	}
+	if !cfg.EnablePprof {
+		t.Errorf("EnablePprof = %v, want true", cfg.EnablePprof)
+	}
 }
 
 func TestNewConfig_VersionFlagExits(t *testing.T) {
@@ -159,3 +504,170 @@ func TestNewConfig_VersionFlagExits(t *testing.T) {
 
 	_ = NewConfig()
 }
+
+func TestNewConfig_Validation(t *testing.T) {
+	testCases := []struct {
+		name         string
+		args         []string
+		env          string
+		expectedExit bool
+		expectedErr  string
+	}{
+		{name: "Default port", args: []string{"app"}},
+		{name: "Ephemeral port", args: []string{"app", "--port", "0"}},
+		{name: "Lowest port", args: []string{"app", "--port", "1"}},
+		{name: "Highest port", args: []string{"app", "--port", "65535"}},
+		{name: "Valid admin port", args: []string{"app", "--admin-port", "9090"}},
+		{
+			name:         "Non-numeric port",
+			args:         []string{"app", "--port", "abc"},
+			expectedExit: true,
+			expectedErr:  `error: --port: invalid port "abc", must be a number between 1 and 65535, or 0 for an ephemeral port`,
+		},
+		{
+			name:         "Port out of range",
+			args:         []string{"app", "--port", "99999"},
+			expectedExit: true,
+			expectedErr:  `error: --port: invalid port "99999"`,
+		},
+		{
+			name:         "Negative port",
+			args:         []string{"app", "--port=-1"},
+			expectedExit: true,
+			expectedErr:  `error: --port: invalid port "-1"`,
+		},
+		{
+			name:         "Empty port",
+			args:         []string{"app"},
+			env:          " ",
+			expectedExit: true,
+			expectedErr:  `error: --port: invalid port " "`,
+		},
+		{
+			name:         "Invalid admin port",
+			args:         []string{"app", "--admin-port", "80a"},
+			expectedExit: true,
+			expectedErr:  `error: --admin-port: invalid port "80a"`,
+		},
+		{name: "Valid listen addresses", args: []string{"app", "--listen", "127.0.0.1:8080,[::1]"}},
+		{
+			name:         "Invalid listen port",
+			args:         []string{"app", "--listen", "127.0.0.1:80a"},
+			expectedExit: true,
+			expectedErr:  `error: --listen: address "127.0.0.1:80a": invalid port "80a"`,
+		},
+		{name: "Valid refresh time", args: []string{"app", "--refresh-at", "23:59"}},
+		{
+			name:         "Invalid refresh time",
+			args:         []string{"app", "--refresh-at", "25:00"},
+			expectedExit: true,
+			expectedErr:  `error: --refresh-at: invalid time of day "25:00", must be HH:MM`,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			origArgs := os.Args
+			origExit := osExit
+			origStdout := stdOut
+			t.Cleanup(func() {
+				os.Args = origArgs
+				osExit = origExit
+				stdOut = origStdout
+			})
+
+			var buf bytes.Buffer
+			stdOut = &buf
+			exitCode := -1
+			osExit = func(code int) {
+				if exitCode == -1 {
+					exitCode = code
+				}
+			}
+			os.Args = tc.args
+			if tc.env != "" {
+				t.Setenv("SERVER_PORT", tc.env)
+			}
+
+			NewConfig()
+
+			if !tc.expectedExit {
+				if exitCode != -1 {
+					t.Fatalf("unexpected exit with code %d: %s", exitCode, buf.String())
+				}
+				return
+			}
+			if exitCode != 2 {
+				t.Fatalf("exit code = %d, want 2", exitCode)
+			}
+			if !strings.Contains(buf.String(), tc.expectedErr) {
+				t.Errorf("output %q does not contain %q", buf.String(), tc.expectedErr)
+			}
+			if !strings.Contains(buf.String(), "Usage:") {
+				t.Errorf("output %q does not contain the usage", buf.String())
+			}
+		})
+	}
+}
+
+func TestParseListenAddresses(t *testing.T) {
+	testCases := []struct {
+		value    string
+		expected []string
+		wantErr  bool
+	}{
+		{value: "", expected: []string{":8080"}},
+		{value: " , ", expected: []string{":8080"}},
+		{value: "127.0.0.1:9000", expected: []string{"127.0.0.1:9000"}},
+		{value: "127.0.0.1, [::1]:9000", expected: []string{"127.0.0.1:8080", "[::1]:9000"}},
+		{value: "[::1],::1", expected: []string{"[::1]:8080", "[::1]:8080"}},
+		{value: ":9000,localhost", expected: []string{":9000", "localhost:8080"}},
+		{value: "127.0.0.1:99999", wantErr: true},
+		{value: "127.0.0.1:", wantErr: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.value, func(t *testing.T) {
+			got, err := ParseListenAddresses(tc.value, "8080")
+			if tc.wantErr {
+				if err == nil {
+					t.Fatalf("ParseListenAddresses(%q) = %v, want an error", tc.value, got)
+				}
+				return
+			}
+			if err != nil || !slices.Equal(got, tc.expected) {
+				t.Errorf("ParseListenAddresses(%q) = %v, %v, want %v", tc.value, got, err, tc.expected)
+			}
+		})
+	}
+}
+
+func TestParseTimeOfDay(t *testing.T) {
+	testCases := []struct {
+		value    string
+		expected time.Duration
+		wantErr  bool
+	}{
+		{value: "00:00", expected: 0},
+		{value: "01:30", expected: 90 * time.Minute},
+		{value: "23:59", expected: 23*time.Hour + 59*time.Minute},
+		{value: "24:00", wantErr: true},
+		{value: "01:30:00", wantErr: true},
+		{value: "", wantErr: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.value, func(t *testing.T) {
+			got, err := ParseTimeOfDay(tc.value)
+			if tc.wantErr {
+				if err == nil {
+					t.Fatalf("ParseTimeOfDay(%q) = %v, want an error", tc.value, got)
+				}
+				return
+			}
+			if err != nil || got != tc.expected {
+				t.Errorf("ParseTimeOfDay(%q) = %v, %v, want %v", tc.value, got, err, tc.expected)
+			}
+		})
+	}
+}
@@ -0,0 +1,48 @@
+package handler
+
+import (
+	"log"
+	"maps"
+	"net/http"
+	"strings"
+)
+
+// defaultCountryAliases maps commonly used non-ISO codes to their ISO 3166-1 alpha-2 equivalents
+var defaultCountryAliases = map[string]string{
+	"UK": "GB", // United Kingdom
+	"EL": "GR", // Greece, as used by the European Union
+}
+
+// countryAliases returns the built-in aliases extended by a comma-separated list of
+// ALIAS=CC pairs (e.g. "UK=GB,KS=XK"). Malformed entries are logged and skipped.
+func countryAliases(spec string) map[string]string {
+	aliases := maps.Clone(defaultCountryAliases)
+	for _, entry := range strings.Split(spec, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		alias, canonical, ok := strings.Cut(entry, "=")
+		alias = normalizeCountry(alias)
+		canonical = normalizeCountry(canonical)
+		if !ok || alias == "" || canonical == "" {
+			log.Printf("Ignoring invalid country alias %q\n", entry)
+			continue
+		}
+		aliases[alias] = canonical
+	}
+	return aliases
+}
+
+// resolveCountryAlias replaces an alias with its canonical country code. When a
+// substitution happens, the canonical code is reported in the X-Canonical-Country
+// header so clients can learn it.
+func (h *Handler) resolveCountryAlias(w http.ResponseWriter, country string) string {
+	canonical, ok := h.aliases[country]
+	if !ok {
+		return country
+	}
+	w.Header().Set("X-Canonical-Country", canonical)
+	return canonical
+}
@@ -0,0 +1,111 @@
+package handler
+
+import (
+	"bytes"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/anisimovdk/ip-whitelist-by-country/internal/config"
+)
+
+func TestCountryAliases(t *testing.T) {
+	testCases := []struct {
+		name     string
+		spec     string
+		expected map[string]string
+	}{
+		{name: "Built-in only", spec: "", expected: map[string]string{"UK": "GB", "EL": "GR"}},
+		{
+			name:     "Extended",
+			spec:     "ks=xk, UK=GB",
+			expected: map[string]string{"UK": "GB", "EL": "GR", "KS": "XK"},
+		},
+		{
+			name:     "Override built-in",
+			spec:     "EL=GB",
+			expected: map[string]string{"UK": "GB", "EL": "GB"},
+		},
+		{
+			name:     "Invalid entries skipped",
+			spec:     "KS,=XK,KS=",
+			expected: map[string]string{"UK": "GB", "EL": "GR"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var logBuf bytes.Buffer
+			origOutput := log.Writer()
+			log.SetOutput(&logBuf)
+			t.Cleanup(func() { log.SetOutput(origOutput) })
+
+			if got := countryAliases(tc.spec); !reflect.DeepEqual(got, tc.expected) {
+				t.Errorf("countryAliases(%q) = %v, want %v", tc.spec, got, tc.expected)
+			}
+		})
+	}
+
+	if defaultCountryAliases["EL"] != "GR" {
+		t.Fatal("countryAliases modified the built-in table")
+	}
+}
+
+func TestGetIpListHandlerCountryAlias(t *testing.T) {
+	mockProc := &MockProcessor{
+		ipLists: map[string][]string{
+			"GB": {"2.24.0.0/13"},
+			"GR": {"2.84.0.0/14"},
+			"XK": {"31.0.0.0/24"},
+		},
+	}
+	h := NewHandler(mockProc, &config.Config{CountryAliases: "KS=XK"})
+
+	testCases := []struct {
+		query             string
+		expectedBody      string
+		expectedCanonical string
+	}{
+		{query: "country=UK", expectedBody: "2.24.0.0/13\n", expectedCanonical: "GB"},
+		{query: "country=uk", expectedBody: "2.24.0.0/13\n", expectedCanonical: "GB"},
+		{query: "country=EL", expectedBody: "2.84.0.0/14\n", expectedCanonical: "GR"},
+		{query: "country=KS", expectedBody: "31.0.0.0/24\n", expectedCanonical: "XK"},
+		{query: "country=GB", expectedBody: "2.24.0.0/13\n", expectedCanonical: ""},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.query, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			http.HandlerFunc(h.getIpListHandler).ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/get?"+tc.query, nil))
+
+			if rr.Code != http.StatusOK {
+				t.Fatalf("handler returned wrong status code: got %v want %v", rr.Code, http.StatusOK)
+			}
+			if rr.Body.String() != tc.expectedBody {
+				t.Errorf("handler returned unexpected body: got %q want %q", rr.Body.String(), tc.expectedBody)
+			}
+			if got := rr.Header().Get("X-Canonical-Country"); got != tc.expectedCanonical {
+				t.Errorf("X-Canonical-Country = %q, want %q", got, tc.expectedCanonical)
+			}
+		})
+	}
+}
+
+func TestProvenanceHandlerCountryAlias(t *testing.T) {
+	mockProc := &MockProcessor{
+		provenance: map[string]map[string]int{"GB": {"ripencc": 3}},
+	}
+	h := NewHandler(mockProc, &config.Config{})
+
+	rr := httptest.NewRecorder()
+	http.HandlerFunc(h.provenanceHandler).ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/provenance?country=UK", nil))
+
+	if want := `{"country":"GB","registries":{"ripencc":3}}` + "\n"; rr.Body.String() != want {
+		t.Errorf("handler returned unexpected body: got %q want %q", rr.Body.String(), want)
+	}
+	if got := rr.Header().Get("X-Canonical-Country"); got != "GB" {
+		t.Errorf("X-Canonical-Country = %q, want %q", got, "GB")
+	}
+}
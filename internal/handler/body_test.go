@@ -0,0 +1,96 @@
+package handler
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/anisimovdk/ip-whitelist-by-country/internal/config"
+)
+
+func TestGetIpListHandlerRejectsBody(t *testing.T) {
+	testCases := []struct {
+		name           string
+		method         string
+		body           io.Reader
+		expectedStatus int
+		expectedBody   string
+	}{
+		{
+			name:           "Without a body",
+			method:         http.MethodGet,
+			body:           http.NoBody,
+			expectedStatus: http.StatusOK,
+			expectedBody:   "2.0.0.0/12\n",
+		},
+		{
+			name:           "Small body",
+			method:         http.MethodGet,
+			body:           strings.NewReader("country=FR"),
+			expectedStatus: http.StatusBadRequest,
+			expectedBody:   "Request body not allowed\n",
+		},
+		{
+			name:           "Body over the limit",
+			method:         http.MethodGet,
+			body:           bytes.NewReader(make([]byte, 1<<20)),
+			expectedStatus: http.StatusBadRequest,
+			expectedBody:   "Request body not allowed\n",
+		},
+		{
+			name:           "HEAD with a body",
+			method:         http.MethodHead,
+			body:           strings.NewReader("x"),
+			expectedStatus: http.StatusBadRequest,
+			expectedBody:   "Request body not allowed\n",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			mockProc := &MockProcessor{ipLists: map[string][]string{"DE": {"2.0.0.0/12"}}}
+			h := NewHandler(mockProc, &config.Config{MaxBodyBytes: 1024})
+
+			rr := httptest.NewRecorder()
+			http.HandlerFunc(h.getIpListHandler).ServeHTTP(rr, httptest.NewRequest(tc.method, "/get?country=DE", tc.body))
+
+			if rr.Code != tc.expectedStatus {
+				t.Errorf("handler returned wrong status code: got %v want %v", rr.Code, tc.expectedStatus)
+			}
+			if tc.method == http.MethodGet && rr.Body.String() != tc.expectedBody {
+				t.Errorf("handler returned unexpected body: got %q want %q", rr.Body.String(), tc.expectedBody)
+			}
+			if tc.expectedStatus == http.StatusBadRequest && mockProc.calls != 0 {
+				t.Errorf("expected processor not to be called, got %d calls", mockProc.calls)
+			}
+		})
+	}
+}
+
+func TestGetIpListHandlerLargeBodyClosesConnection(t *testing.T) {
+	mockProc := &MockProcessor{ipLists: map[string][]string{"DE": {"2.0.0.0/12"}}}
+	h := NewHandler(mockProc, &config.Config{MaxBodyBytes: 1024})
+	srv := httptest.NewServer(http.HandlerFunc(h.getIpListHandler))
+	defer srv.Close()
+
+	req, err := http.NewRequest(http.MethodGet, srv.URL+"/get?country=DE", bytes.NewReader(make([]byte, 4<<20)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := srv.Client().Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("status = %d, want %d", resp.StatusCode, http.StatusBadRequest)
+	}
+	// The server must give up on the connection instead of reading the whole body
+	if !resp.Close {
+		t.Error("expected the server to close the connection")
+	}
+}
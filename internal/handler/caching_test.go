@@ -0,0 +1,116 @@
+package handler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/anisimovdk/ip-whitelist-by-country/internal/config"
+)
+
+func TestGetIpListHandlerCacheHeaders(t *testing.T) {
+	generated := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	mockProc := &MockProcessor{
+		ipLists:  map[string][]string{"US": {"192.168.0.0/24", "10.0.0.0/16"}},
+		dataTime: generated,
+	}
+
+	get := func(h *Handler, url string, header http.Header) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, url, nil)
+		for key, values := range header {
+			req.Header[key] = values
+		}
+		rr := httptest.NewRecorder()
+		http.HandlerFunc(h.getIpListHandler).ServeHTTP(rr, req)
+		return rr
+	}
+
+	h := NewHandler(mockProc, &config.Config{})
+	cidr := get(h, "/get?country=US", nil)
+	if cidr.Code != http.StatusOK {
+		t.Fatalf("handler returned wrong status code: got %v want %v", cidr.Code, http.StatusOK)
+	}
+	etag := cidr.Header().Get("ETag")
+	if etag == "" {
+		t.Fatal("expected an ETag header")
+	}
+	if got := cidr.Header().Get("Last-Modified"); got != generated.Format(http.TimeFormat) {
+		t.Errorf("Last-Modified = %q, want %q", got, generated.Format(http.TimeFormat))
+	}
+	if got := cidr.Header().Get("Cache-Control"); got != "public, no-cache" {
+		t.Errorf("Cache-Control = %q, want %q", got, "public, no-cache")
+	}
+	wantVary := "format, sep, trailing_newline, groupby, acl_action, acl_direction, list, within, ipv6_aggregate, date, status, sort"
+	if got := cidr.Header().Get("Vary"); got != wantVary {
+		t.Errorf("Vary = %q, want %q", got, wantVary)
+	}
+
+	t.Run("Variants have distinct ETags", func(t *testing.T) {
+		for _, url := range []string{
+			"/get?country=US&format=netmask",
+			"/get?country=US&format=ndjson",
+			"/get?country=US&sep=comma",
+			"/get?country=US&groupby=registry",
+		} {
+			rr := get(h, url, nil)
+			if rr.Code != http.StatusOK {
+				t.Fatalf("%s returned status %d", url, rr.Code)
+			}
+			if got := rr.Header().Get("ETag"); got == "" || got == etag {
+				t.Errorf("%s ETag = %q, want one different from %q", url, got, etag)
+			}
+			if got := rr.Header().Get("Vary"); got != wantVary {
+				t.Errorf("%s Vary = %q, want %q", url, got, wantVary)
+			}
+		}
+		if got := get(h, "/get?country=US", nil).Header().Get("ETag"); got != etag {
+			t.Errorf("repeated request ETag = %q, want %q", got, etag)
+		}
+	})
+
+	t.Run("Conditional requests", func(t *testing.T) {
+		testCases := []struct {
+			name           string
+			header         http.Header
+			expectedStatus int
+		}{
+			{name: "Matching If-None-Match", header: http.Header{"If-None-Match": {etag}}, expectedStatus: http.StatusNotModified},
+			{name: "Stale If-None-Match", header: http.Header{"If-None-Match": {`"stale"`}}, expectedStatus: http.StatusOK},
+			{name: "If-Modified-Since at data time", header: http.Header{"If-Modified-Since": {generated.Format(http.TimeFormat)}}, expectedStatus: http.StatusNotModified},
+			{name: "If-Modified-Since before data time", header: http.Header{"If-Modified-Since": {generated.Add(-time.Hour).Format(http.TimeFormat)}}, expectedStatus: http.StatusOK},
+		}
+
+		for _, tc := range testCases {
+			t.Run(tc.name, func(t *testing.T) {
+				rr := get(h, "/get?country=US", tc.header)
+				if rr.Code != tc.expectedStatus {
+					t.Errorf("handler returned wrong status code: got %v want %v", rr.Code, tc.expectedStatus)
+				}
+				if tc.expectedStatus == http.StatusNotModified && rr.Body.Len() != 0 {
+					t.Errorf("expected an empty 304 body, got %q", rr.Body.String())
+				}
+				if got := rr.Header().Get("Vary"); got != wantVary {
+					t.Errorf("Vary = %q, want %q", got, wantVary)
+				}
+			})
+		}
+	})
+
+	t.Run("Private with auth", func(t *testing.T) {
+		h := NewHandler(mockProc, &config.Config{AuthToken: "secret"})
+		rr := get(h, "/get?country=US&auth=secret", nil)
+		if got := rr.Header().Get("Cache-Control"); got != "private, no-cache" {
+			t.Errorf("Cache-Control = %q, want %q", got, "private, no-cache")
+		}
+	})
+}
+
+func TestVariantQueryParamsAreRecognized(t *testing.T) {
+	for _, param := range variantQueryParams {
+		if !slices.Contains(getQueryParams, param) {
+			t.Errorf("Vary lists %q, which /get does not recognize", param)
+		}
+	}
+}
@@ -0,0 +1,71 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/anisimovdk/ip-whitelist-by-country/internal/config"
+)
+
+func TestGetIpListHandlerCanceledRequest(t *testing.T) {
+	origOutput := log.Writer()
+	t.Cleanup(func() { log.SetOutput(origOutput) })
+	var logBuf bytes.Buffer
+	log.SetOutput(&logBuf)
+
+	for _, format := range []string{"cidr", "complement"} {
+		t.Run(format, func(t *testing.T) {
+			logBuf.Reset()
+			mockProc := &MockProcessor{ipLists: map[string][]string{"US": syntheticCIDRs(200000)}}
+			h := NewHandler(mockProc, &config.Config{})
+
+			ctx, cancel := context.WithCancel(context.Background())
+			cancel()
+			req := httptest.NewRequest(http.MethodGet, "/get?country=US&format="+format, nil).WithContext(ctx)
+			rr := httptest.NewRecorder()
+			http.HandlerFunc(h.getIpListHandler).ServeHTTP(rr, req)
+
+			if rr.Body.Len() != 0 {
+				t.Errorf("expected no body for a canceled request, got %d bytes", rr.Body.Len())
+			}
+			if rr.Header().Get("Content-Length") != "" {
+				t.Errorf("expected no Content-Length, got %q", rr.Header().Get("Content-Length"))
+			}
+			if !strings.Contains(logBuf.String(), "Client went away, aborting GET /get: context canceled") {
+				t.Errorf("expected cancellation to be logged, got %q", logBuf.String())
+			}
+		})
+	}
+}
+
+func TestRenderListContextCanceledDuringRendering(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	rendered := 0
+	format := outputFormat{render: func(_, cidr string) string {
+		rendered++
+		if rendered == cancelCheckInterval+1 {
+			cancel()
+		}
+		return cidr
+	}}
+
+	ipList := syntheticCIDRs(10 * cancelCheckInterval)
+	buf, err := renderListContext(ctx, "US", ipList, format, separators["lf"])
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected context.Canceled, got %v", err)
+	}
+	if buf != nil {
+		t.Errorf("expected no output, got %d bytes", len(buf))
+	}
+	if rendered != 2*cancelCheckInterval {
+		t.Errorf("expected rendering to stop at the next check after %d entries, rendered %d", 2*cancelCheckInterval, rendered)
+	}
+}
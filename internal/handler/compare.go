@@ -0,0 +1,75 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/anisimovdk/ip-whitelist-by-country/internal/ipdata"
+)
+
+// compareQueryParams lists the query parameters recognized by the /compare endpoint
+var compareQueryParams = []string{"a", "b", "auth"}
+
+// compareResponse is the JSON body returned by the compare endpoint
+type compareResponse struct {
+	A         string   `json:"a"`
+	B         string   `json:"b"`
+	Overlap   []string `json:"overlap"`
+	Addresses uint64   `json:"addresses"`
+}
+
+// compareHandler handles requests for the address space allocated to both of
+// two countries, which usually points at transfers or registry errors
+func (h *Handler) compareHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if !h.requireAuth(w, r) {
+		return
+	}
+
+	if !h.checkQueryParams(w, r, compareQueryParams) {
+		return
+	}
+
+	a, ok := h.singleCountryParam(w, r, "a")
+	if !ok {
+		return
+	}
+	b, ok := h.singleCountryParam(w, r, "b")
+	if !ok {
+		return
+	}
+	a, b = h.canonicalCountry(a), h.canonicalCountry(b)
+
+	listA, err := h.processor.GetIPListForCountry(a)
+	if err != nil {
+		writeProcessingError(w, err)
+		return
+	}
+	listB, err := h.processor.GetIPListForCountry(b)
+	if err != nil {
+		writeProcessingError(w, err)
+		return
+	}
+
+	overlap := ipdata.IntersectCIDRs(listA, listB)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(compareResponse{
+		A:         a,
+		B:         b,
+		Overlap:   overlap,
+		Addresses: ipdata.CoveredAddresses(overlap),
+	})
+}
+
+// canonicalCountry returns the canonical code of an alias, or the code itself
+func (h *Handler) canonicalCountry(country string) string {
+	if canonical, ok := h.aliases[country]; ok {
+		return canonical
+	}
+	return country
+}
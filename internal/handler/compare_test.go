@@ -0,0 +1,159 @@
+package handler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/anisimovdk/ip-whitelist-by-country/internal/config"
+	"github.com/anisimovdk/ip-whitelist-by-country/internal/ipdata"
+)
+
+func TestCompareHandler(t *testing.T) {
+	testCases := []struct {
+		name           string
+		method         string
+		query          string
+		token          string
+		err            error
+		expectedStatus int
+		expectedBody   string
+	}{
+		{
+			name:           "One shared block",
+			method:         http.MethodGet,
+			query:          "a=us&b=CA",
+			expectedStatus: http.StatusOK,
+			expectedBody:   "{\"a\":\"US\",\"b\":\"CA\",\"overlap\":[\"24.0.0.0/16\"],\"addresses\":65536}\n",
+		},
+		{
+			name:           "Block inside a larger allocation",
+			method:         http.MethodGet,
+			query:          "a=US&b=MX",
+			expectedStatus: http.StatusOK,
+			expectedBody:   "{\"a\":\"US\",\"b\":\"MX\",\"overlap\":[\"8.8.8.0/24\"],\"addresses\":256}\n",
+		},
+		{
+			name:           "No overlap",
+			method:         http.MethodGet,
+			query:          "a=CA&b=MX",
+			expectedStatus: http.StatusOK,
+			expectedBody:   "{\"a\":\"CA\",\"b\":\"MX\",\"overlap\":[],\"addresses\":0}\n",
+		},
+		{
+			name:           "Country without allocations",
+			method:         http.MethodGet,
+			query:          "a=US&b=FR",
+			expectedStatus: http.StatusOK,
+			expectedBody:   "{\"a\":\"US\",\"b\":\"FR\",\"overlap\":[],\"addresses\":0}\n",
+		},
+		{
+			name:           "Alias resolved",
+			method:         http.MethodGet,
+			query:          "a=UK&b=US",
+			expectedStatus: http.StatusOK,
+			expectedBody:   "{\"a\":\"GB\",\"b\":\"US\",\"overlap\":[\"8.8.4.0/24\"],\"addresses\":256}\n",
+		},
+		{
+			name:           "Missing first country",
+			method:         http.MethodGet,
+			query:          "b=CA",
+			expectedStatus: http.StatusBadRequest,
+			expectedBody:   "Missing a parameter\n",
+		},
+		{
+			name:           "Missing second country",
+			method:         http.MethodGet,
+			query:          "a=US",
+			expectedStatus: http.StatusBadRequest,
+			expectedBody:   "Missing b parameter\n",
+		},
+		{
+			name:           "Wildcard",
+			method:         http.MethodGet,
+			query:          "a=US&b=*",
+			expectedStatus: http.StatusBadRequest,
+			expectedBody:   "Invalid b parameter\n",
+		},
+		{
+			name:           "Unknown parameter",
+			method:         http.MethodGet,
+			query:          "a=US&b=CA&country=DE",
+			expectedStatus: http.StatusBadRequest,
+			expectedBody:   "Unknown query parameters: country\n",
+		},
+		{
+			name:           "Unauthorized",
+			method:         http.MethodGet,
+			query:          "a=US&b=CA",
+			token:          "secret",
+			expectedStatus: http.StatusUnauthorized,
+			expectedBody:   "Unauthorized\n",
+		},
+		{
+			name:           "Processor error",
+			method:         http.MethodGet,
+			query:          "a=US&b=CA",
+			err:            ipdata.ErrBadUpstreamData,
+			expectedStatus: http.StatusBadGateway,
+			expectedBody:   "Error processing request: " + ipdata.ErrBadUpstreamData.Error() + "\n",
+		},
+		{
+			name:           "Wrong method",
+			method:         http.MethodPost,
+			query:          "a=US&b=CA",
+			expectedStatus: http.StatusMethodNotAllowed,
+			expectedBody:   "Method not allowed\n",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			mockProc := &MockProcessor{
+				ipLists: map[string][]string{
+					"US": {"8.0.0.0/8", "24.0.0.0/16"},
+					"CA": {"24.0.0.0/16", "99.0.0.0/8"},
+					"MX": {"8.8.8.0/24", "187.0.0.0/8"},
+					"GB": {"8.8.4.0/24"},
+				},
+				err: tc.err,
+			}
+			h := NewHandler(mockProc, &config.Config{AuthToken: tc.token, StrictQuery: true})
+
+			rr := httptest.NewRecorder()
+			http.HandlerFunc(h.compareHandler).ServeHTTP(rr, httptest.NewRequest(tc.method, "/compare?"+tc.query, nil))
+
+			if rr.Code != tc.expectedStatus {
+				t.Errorf("handler returned wrong status code: got %v want %v", rr.Code, tc.expectedStatus)
+			}
+			if rr.Body.String() != tc.expectedBody {
+				t.Errorf("handler returned unexpected body: got %q want %q", rr.Body.String(), tc.expectedBody)
+			}
+		})
+	}
+}
+
+func TestCompareHandler_SecondLookupError(t *testing.T) {
+	mockProc := &failingAfterProcessor{MockProcessor: MockProcessor{ipLists: map[string][]string{"US": {"8.0.0.0/8"}}}, failAfter: 1}
+	h := NewHandler(mockProc, &config.Config{})
+
+	rr := httptest.NewRecorder()
+	http.HandlerFunc(h.compareHandler).ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/compare?a=US&b=CA", nil))
+
+	if rr.Code != http.StatusBadGateway {
+		t.Errorf("handler returned wrong status code: got %v want %v", rr.Code, http.StatusBadGateway)
+	}
+}
+
+// failingAfterProcessor fails list lookups once failAfter of them have succeeded
+type failingAfterProcessor struct {
+	MockProcessor
+	failAfter int
+}
+
+func (m *failingAfterProcessor) GetIPListForCountry(countryCode string) ([]string, error) {
+	if m.calls >= m.failAfter {
+		return nil, ipdata.ErrBadUpstreamData
+	}
+	return m.MockProcessor.GetIPListForCountry(countryCode)
+}
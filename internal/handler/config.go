@@ -0,0 +1,69 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// redactedSecret replaces secret configuration values in /config responses
+const redactedSecret = "***"
+
+// configQueryParams lists the query parameters recognized by the /config endpoint
+var configQueryParams = []string{"auth"}
+
+// configHandler returns the effective configuration as JSON, with the auth
+// token and any passwords in URLs redacted
+func (h *Handler) configHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if !h.requireAuth(w, r) {
+		return
+	}
+
+	if !h.checkQueryParams(w, r, configQueryParams) {
+		return
+	}
+
+	cfg := *h.config
+	if cfg.AuthToken != "" {
+		cfg.AuthToken = redactedSecret
+	}
+	cfg.HTTPProxy = redactURL(cfg.HTTPProxy)
+	cfg.FallbackDataURL = redactURL(cfg.FallbackDataURL)
+	cfg.UpstreamPeer = redactURL(cfg.UpstreamPeer)
+	cfg.RefreshWebhookURL = redactURL(cfg.RefreshWebhookURL)
+	cfg.ArchiveURL = redactURL(cfg.ArchiveURL)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	json.NewEncoder(w).Encode(cfg)
+}
+
+// redactURL replaces the password of a URL with redactedSecret. Values that do not
+// parse as URLs are redacted as a whole, as they may still hold credentials.
+// The rest of the value is kept as written where possible, so templates such
+// as the {date} placeholders of the archive URL are not percent-encoded.
+func redactURL(value string) string {
+	if value == "" {
+		return ""
+	}
+	u, err := url.Parse(value)
+	if err != nil {
+		return redactedSecret
+	}
+	if _, ok := u.User.Password(); !ok {
+		return value
+	}
+	// url.UserPassword would percent-encode the marker
+	redacted := url.User(u.User.Username()).String() + ":" + redactedSecret + "@"
+	if userinfo := u.User.String() + "@"; strings.Contains(value, userinfo) {
+		return strings.Replace(value, userinfo, redacted, 1)
+	}
+	u.User = nil
+	return strings.Replace(u.String(), "//", "//"+redacted, 1)
+}
@@ -0,0 +1,50 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// countQueryParams lists the query parameters recognized by the /count endpoint
+var countQueryParams = []string{"country", "auth"}
+
+// countResponse is the JSON body returned by the count endpoint
+type countResponse struct {
+	Country   string `json:"country"`
+	Addresses uint64 `json:"addresses"`
+	Blocks    int    `json:"blocks"`
+}
+
+// countHandler handles requests for the number of addresses allocated to a country
+func (h *Handler) countHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if !h.requireAuth(w, r) {
+		return
+	}
+
+	if !h.checkQueryParams(w, r, countQueryParams) {
+		return
+	}
+
+	country, ok := h.countryParam(w, r)
+	if !ok {
+		return
+	}
+
+	count, err := h.processor.GetCountForCountry(country)
+	if err != nil {
+		writeProcessingError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(countResponse{
+		Country:   country,
+		Addresses: count.Addresses,
+		Blocks:    count.Blocks,
+	})
+}
@@ -0,0 +1,94 @@
+package handler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/anisimovdk/ip-whitelist-by-country/internal/config"
+	"github.com/anisimovdk/ip-whitelist-by-country/internal/ipdata"
+)
+
+func TestCountHandler(t *testing.T) {
+	testCases := []struct {
+		name           string
+		method         string
+		query          string
+		token          string
+		err            error
+		expectedStatus int
+		expectedBody   string
+	}{
+		{
+			name:           "Country with allocations",
+			method:         http.MethodGet,
+			query:          "country=br",
+			expectedStatus: http.StatusOK,
+			expectedBody:   "{\"country\":\"BR\",\"addresses\":1114112,\"blocks\":2}\n",
+		},
+		{
+			name:           "Country without allocations",
+			method:         http.MethodGet,
+			query:          "country=FR",
+			expectedStatus: http.StatusOK,
+			expectedBody:   "{\"country\":\"FR\",\"addresses\":0,\"blocks\":0}\n",
+		},
+		{
+			name:           "Missing country",
+			method:         http.MethodGet,
+			query:          "",
+			expectedStatus: http.StatusBadRequest,
+			expectedBody:   "Missing country parameter\n",
+		},
+		{
+			name:           "Unauthorized",
+			method:         http.MethodGet,
+			query:          "country=BR",
+			token:          "secret",
+			expectedStatus: http.StatusUnauthorized,
+			expectedBody:   "Unauthorized\n",
+		},
+		{
+			name:           "Processor error",
+			method:         http.MethodGet,
+			query:          "country=BR",
+			err:            ipdata.ErrBadUpstreamData,
+			expectedStatus: http.StatusBadGateway,
+			expectedBody:   "Error processing request: " + ipdata.ErrBadUpstreamData.Error() + "\n",
+		},
+		{
+			name:           "Wrong method",
+			method:         http.MethodPost,
+			query:          "country=BR",
+			expectedStatus: http.StatusMethodNotAllowed,
+			expectedBody:   "Method not allowed\n",
+		},
+		{
+			name:           "Unknown parameter",
+			method:         http.MethodGet,
+			query:          "country=BR&format=cidr",
+			expectedStatus: http.StatusBadRequest,
+			expectedBody:   "Unknown query parameters: format\n",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			mockProc := &MockProcessor{
+				counts: map[string]ipdata.AllocationCount{"BR": {Addresses: 1114112, Blocks: 2}},
+				err:    tc.err,
+			}
+			h := NewHandler(mockProc, &config.Config{AuthToken: tc.token, StrictQuery: true})
+
+			rr := httptest.NewRecorder()
+			http.HandlerFunc(h.countHandler).ServeHTTP(rr, httptest.NewRequest(tc.method, "/count?"+tc.query, nil))
+
+			if rr.Code != tc.expectedStatus {
+				t.Errorf("handler returned wrong status code: got %v want %v", rr.Code, tc.expectedStatus)
+			}
+			if rr.Body.String() != tc.expectedBody {
+				t.Errorf("handler returned unexpected body: got %q want %q", rr.Body.String(), tc.expectedBody)
+			}
+		})
+	}
+}
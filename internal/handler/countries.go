@@ -0,0 +1,64 @@
+package handler
+
+import (
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// countryBlocks holds CIDR blocks rendered under a country label
+type countryBlocks struct {
+	country string
+	cidrs   []string
+}
+
+// countriesParam reads the comma-separated country query parameter of /get.
+// Codes are normalized, aliases resolved and repeated codes dropped, keeping
+// the order of first appearance. The list is capped at MaxCountries entries,
+// and the "*" summary wildcard is rejected, whether alone or mixed with codes.
+// It returns false if a response has been written.
+func (h *Handler) countriesParam(w http.ResponseWriter, r *http.Request) ([]string, bool) {
+	value := r.URL.Query().Get("country")
+	if strings.TrimSpace(value) == "" {
+		http.Error(w, "Missing country parameter", http.StatusBadRequest)
+		return nil, false
+	}
+
+	// Check the size before doing any work on the entries
+	limit := max(h.config.MaxCountries, 1)
+	if strings.Count(value, ",") >= limit {
+		http.Error(w, "Too many countries, at most "+strconv.Itoa(limit)+" are allowed", http.StatusBadRequest)
+		return nil, false
+	}
+
+	entries := strings.Split(value, ",")
+	countries := make([]string, 0, len(entries))
+	substituted := false
+	for _, entry := range entries {
+		country := normalizeCountry(entry)
+		if country == "*" && len(entries) > 1 {
+			http.Error(w, "Wildcard country cannot be combined with country codes", http.StatusBadRequest)
+			return nil, false
+		}
+		if country == "" || country == "*" {
+			http.Error(w, "Invalid country parameter", http.StatusBadRequest)
+			return nil, false
+		}
+		if !h.exactCase(w, "country", entry) {
+			return nil, false
+		}
+
+		if canonical, ok := h.aliases[country]; ok {
+			country, substituted = canonical, true
+		}
+		if !slices.Contains(countries, country) {
+			countries = append(countries, country)
+		}
+	}
+
+	if substituted {
+		w.Header().Set("X-Canonical-Country", strings.Join(countries, ","))
+	}
+	return countries, true
+}
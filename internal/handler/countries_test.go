@@ -0,0 +1,394 @@
+package handler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/anisimovdk/ip-whitelist-by-country/internal/config"
+	"github.com/anisimovdk/ip-whitelist-by-country/internal/ipdata"
+)
+
+func TestGetIpListHandlerMultipleCountries(t *testing.T) {
+	testCases := []struct {
+		name             string
+		query            string
+		maxCountries     int
+		err              error
+		expectedStatus   int
+		expectedBody     string
+		expectedHeader   string
+		expectedFilename string
+	}{
+		{
+			name:           "Two countries",
+			query:          "country=DE,FR",
+			expectedStatus: http.StatusOK,
+			expectedBody:   "2.0.0.0/12\n5.0.0.0/16\n",
+		},
+		{
+			name:           "Repeated codes are de-duplicated",
+			query:          "country=" + url.QueryEscape("de, FR ,DE"),
+			expectedStatus: http.StatusOK,
+			expectedBody:   "2.0.0.0/12\n5.0.0.0/16\n",
+		},
+		{
+			name:           "Alias and canonical code are de-duplicated",
+			query:          "country=UK,GB",
+			expectedStatus: http.StatusOK,
+			expectedBody:   "81.2.69.0/24\n",
+			expectedHeader: "GB",
+		},
+		{
+			name:           "Per-entry country in ndjson",
+			query:          "country=FR,DE&format=ndjson",
+			expectedStatus: http.StatusOK,
+			expectedBody:   "{\"country\":\"FR\",\"cidr\":\"5.0.0.0/16\"}\n{\"country\":\"DE\",\"cidr\":\"2.0.0.0/12\"}\n",
+		},
+		{
+			name:           "Complement of the union",
+			query:          "country=DE,FR&format=complement&within=" + url.QueryEscape("2.0.0.0/7"),
+			expectedStatus: http.StatusOK,
+			expectedBody:   "2.16.0.0/12\n2.32.0.0/11\n2.64.0.0/10\n2.128.0.0/9\n3.0.0.0/8\n",
+		},
+		{
+			name:           "Grouped by registry",
+			query:          "country=DE,FR&groupby=registry",
+			expectedStatus: http.StatusOK,
+			expectedBody:   "{\"ripencc\":[\"2.0.0.0/12\",\"5.0.0.0/16\"]}\n",
+		},
+		{
+			name:             "Download file name",
+			query:            "country=DE,FR&download=true",
+			expectedStatus:   http.StatusOK,
+			expectedBody:     "2.0.0.0/12\n5.0.0.0/16\n",
+			expectedFilename: `attachment; filename=DE_FR.txt`,
+		},
+		{
+			name:           "Wildcard mixed with codes",
+			query:          "country=" + url.QueryEscape("*,US"),
+			expectedStatus: http.StatusBadRequest,
+			expectedBody:   "Wildcard country cannot be combined with country codes\n",
+		},
+		{
+			name:           "Codes mixed with wildcard",
+			query:          "country=" + url.QueryEscape("DE, *"),
+			expectedStatus: http.StatusBadRequest,
+			expectedBody:   "Wildcard country cannot be combined with country codes\n",
+		},
+		{
+			name:           "Empty entry",
+			query:          "country=DE,,FR",
+			expectedStatus: http.StatusBadRequest,
+			expectedBody:   "Invalid country parameter\n",
+		},
+		{
+			name:           "Over the cap",
+			query:          "country=DE,FR,GB,NL",
+			expectedStatus: http.StatusBadRequest,
+			expectedBody:   "Too many countries, at most 3 are allowed\n",
+		},
+		{
+			name:           "Repeated codes count towards the cap",
+			query:          "country=DE,DE,DE,DE",
+			expectedStatus: http.StatusBadRequest,
+			expectedBody:   "Too many countries, at most 3 are allowed\n",
+		},
+		{
+			name:           "Unset cap allows a single country",
+			query:          "country=DE,FR",
+			maxCountries:   -1,
+			expectedStatus: http.StatusBadRequest,
+			expectedBody:   "Too many countries, at most 1 are allowed\n",
+		},
+		{
+			name:           "Processor error",
+			query:          "country=DE,FR",
+			err:            ipdata.ErrBadUpstreamData,
+			expectedStatus: http.StatusBadGateway,
+			expectedBody:   "Error processing request: " + ipdata.ErrBadUpstreamData.Error() + "\n",
+		},
+		{
+			name:           "Processor error when grouping",
+			query:          "country=DE,FR&groupby=registry",
+			err:            ipdata.ErrBadUpstreamData,
+			expectedStatus: http.StatusBadGateway,
+			expectedBody:   "Error processing request: " + ipdata.ErrBadUpstreamData.Error() + "\n",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			mockProc := &MockProcessor{
+				ipLists: map[string][]string{
+					"DE": {"2.0.0.0/12"},
+					"FR": {"5.0.0.0/16"},
+					"GB": {"81.2.69.0/24"},
+				},
+				registries: map[string]map[string][]string{
+					"DE": {"ripencc": {"2.0.0.0/12"}},
+					"FR": {"ripencc": {"5.0.0.0/16"}},
+				},
+				err: tc.err,
+			}
+			maxCountries := tc.maxCountries
+			if maxCountries == 0 {
+				maxCountries = 3
+			}
+			h := NewHandler(mockProc, &config.Config{MaxCountries: maxCountries})
+
+			rr := httptest.NewRecorder()
+			http.HandlerFunc(h.getIpListHandler).ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/get?"+tc.query, nil))
+
+			if rr.Code != tc.expectedStatus {
+				t.Errorf("handler returned wrong status code: got %v want %v", rr.Code, tc.expectedStatus)
+			}
+			if rr.Body.String() != tc.expectedBody {
+				t.Errorf("handler returned unexpected body: got %q want %q", rr.Body.String(), tc.expectedBody)
+			}
+			if got := rr.Header().Get("X-Canonical-Country"); got != tc.expectedHeader {
+				t.Errorf("X-Canonical-Country = %q, want %q", got, tc.expectedHeader)
+			}
+			if got := rr.Header().Get("Content-Disposition"); got != tc.expectedFilename {
+				t.Errorf("Content-Disposition = %q, want %q", got, tc.expectedFilename)
+			}
+			if tc.expectedStatus == http.StatusBadRequest && mockProc.calls != 0 {
+				t.Errorf("expected processor not to be called, got %d calls", mockProc.calls)
+			}
+		})
+	}
+}
+
+func TestGetIpListHandlerPartialResults(t *testing.T) {
+	testCases := []struct {
+		name               string
+		query              string
+		failing            map[string]error
+		expectedStatus     int
+		expectedBody       string
+		expectedUnresolved string
+	}{
+		{
+			name:               "Failed country left out",
+			query:              "country=DE,FR,GB",
+			failing:            map[string]error{"FR": ipdata.ErrDownloadFailed},
+			expectedStatus:     http.StatusOK,
+			expectedBody:       "2.0.0.0/12\n81.2.69.0/24\n",
+			expectedUnresolved: "FR",
+		},
+		{
+			name:               "Failed countries left out of ndjson",
+			query:              "country=DE,FR,GB&format=ndjson",
+			failing:            map[string]error{"DE": ipdata.ErrDownloadFailed, "GB": ipdata.ErrNotReady},
+			expectedStatus:     http.StatusOK,
+			expectedBody:       "{\"country\":\"FR\",\"cidr\":\"5.0.0.0/16\"}\n",
+			expectedUnresolved: "DE,GB",
+		},
+		{
+			name:               "Failed IPv6 lookup left out",
+			query:              "country=DE,FR&ipv6_aggregate=48",
+			failing:            map[string]error{"DE/ipv6": ipdata.ErrDownloadFailed},
+			expectedStatus:     http.StatusOK,
+			expectedBody:       "5.0.0.0/16\n2001:db8::/48\n",
+			expectedUnresolved: "DE",
+		},
+		{
+			name:               "Warnings when grouping",
+			query:              "country=DE,FR&groupby=registry",
+			failing:            map[string]error{"DE": ipdata.ErrDownloadFailed},
+			expectedStatus:     http.StatusOK,
+			expectedBody:       "{\"ripencc\":[\"5.0.0.0/16\"],\"warnings\":[\"DE\"]}\n",
+			expectedUnresolved: "DE",
+		},
+		{
+			name:           "All countries failed",
+			query:          "country=DE,FR",
+			failing:        map[string]error{"DE": ipdata.ErrNotReady, "FR": ipdata.ErrDownloadFailed},
+			expectedStatus: http.StatusServiceUnavailable,
+			expectedBody:   "Error processing request: " + ipdata.ErrNotReady.Error() + "\n",
+		},
+		{
+			name:           "All countries failed when grouping",
+			query:          "country=DE,FR&groupby=registry",
+			failing:        map[string]error{"DE": ipdata.ErrBadUpstreamData, "FR": ipdata.ErrDownloadFailed},
+			expectedStatus: http.StatusBadGateway,
+			expectedBody:   "Error processing request: " + ipdata.ErrBadUpstreamData.Error() + "\n",
+		},
+		{
+			name:           "Complement needs every country",
+			query:          "country=DE,FR&format=complement",
+			failing:        map[string]error{"FR": ipdata.ErrDownloadFailed},
+			expectedStatus: http.StatusServiceUnavailable,
+			expectedBody:   "Error processing request: " + ipdata.ErrDownloadFailed.Error() + "\n",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			mockProc := &failingCountryProcessor{
+				MockProcessor: MockProcessor{
+					ipLists: map[string][]string{
+						"DE": {"2.0.0.0/12"},
+						"FR": {"5.0.0.0/16"},
+						"GB": {"81.2.69.0/24"},
+					},
+					ipv6Lists: map[string][]string{
+						"FR": {"2001:db8::/48"},
+					},
+					registries: map[string]map[string][]string{
+						"DE": {"ripencc": {"2.0.0.0/12"}},
+						"FR": {"ripencc": {"5.0.0.0/16"}},
+					},
+				},
+				failing: tc.failing,
+			}
+			h := NewHandler(mockProc, &config.Config{MaxCountries: 3})
+
+			rr := httptest.NewRecorder()
+			http.HandlerFunc(h.getIpListHandler).ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/get?"+tc.query, nil))
+
+			if rr.Code != tc.expectedStatus {
+				t.Errorf("handler returned wrong status code: got %v want %v", rr.Code, tc.expectedStatus)
+			}
+			if rr.Body.String() != tc.expectedBody {
+				t.Errorf("handler returned unexpected body: got %q want %q", rr.Body.String(), tc.expectedBody)
+			}
+			if got := rr.Header().Get("X-Unresolved-Countries"); got != tc.expectedUnresolved {
+				t.Errorf("X-Unresolved-Countries = %q, want %q", got, tc.expectedUnresolved)
+			}
+		})
+	}
+}
+
+// failingCountryProcessor fails the lookups of the countries in failing; the
+// IPv6 lookup of a country fails for the key "CC/ipv6"
+type failingCountryProcessor struct {
+	MockProcessor
+	failing map[string]error
+}
+
+func (m *failingCountryProcessor) GetIPListForCountry(countryCode string) ([]string, error) {
+	if err := m.failing[countryCode]; err != nil {
+		return nil, err
+	}
+	return m.MockProcessor.GetIPListForCountry(countryCode)
+}
+
+func (m *failingCountryProcessor) GetIPv6ListForCountry(countryCode string) ([]string, error) {
+	if err := m.failing[countryCode+"/ipv6"]; err != nil {
+		return nil, err
+	}
+	return m.MockProcessor.GetIPv6ListForCountry(countryCode)
+}
+
+func (m *failingCountryProcessor) GetIPListByRegistry(countryCode string) (map[string][]string, error) {
+	if err := m.failing[countryCode]; err != nil {
+		return nil, err
+	}
+	return m.MockProcessor.GetIPListByRegistry(countryCode)
+}
+
+func (m *failingCountryProcessor) GetIPListByStatus(countryCode string) (map[string][]string, error) {
+	if err := m.failing[countryCode]; err != nil {
+		return nil, err
+	}
+	return m.MockProcessor.GetIPListByStatus(countryCode)
+}
+
+func TestStrictCountryCase(t *testing.T) {
+	testCases := []struct {
+		name           string
+		strict         bool
+		handler        func(h *Handler) http.HandlerFunc
+		query          string
+		expectedStatus int
+		expectedBody   string
+	}{
+		{
+			name:           "Lowercase accepted by default",
+			handler:        func(h *Handler) http.HandlerFunc { return h.getIpListHandler },
+			query:          "country=de",
+			expectedStatus: http.StatusOK,
+			expectedBody:   "2.0.0.0/12\n",
+		},
+		{
+			name:           "Lowercase rejected in strict mode",
+			strict:         true,
+			handler:        func(h *Handler) http.HandlerFunc { return h.getIpListHandler },
+			query:          "country=de",
+			expectedStatus: http.StatusBadRequest,
+			expectedBody:   "Invalid country parameter, expected an uppercase ISO 3166-1 alpha-2 code\n",
+		},
+		{
+			name:           "Mixed case entry rejected in strict mode",
+			strict:         true,
+			handler:        func(h *Handler) http.HandlerFunc { return h.getIpListHandler },
+			query:          "country=DE,Fr",
+			expectedStatus: http.StatusBadRequest,
+			expectedBody:   "Invalid country parameter, expected an uppercase ISO 3166-1 alpha-2 code\n",
+		},
+		{
+			name:           "Padded entry rejected in strict mode",
+			strict:         true,
+			handler:        func(h *Handler) http.HandlerFunc { return h.getIpListHandler },
+			query:          "country=" + url.QueryEscape("DE, FR"),
+			expectedStatus: http.StatusBadRequest,
+			expectedBody:   "Invalid country parameter, expected an uppercase ISO 3166-1 alpha-2 code\n",
+		},
+		{
+			name:           "Uppercase accepted in strict mode",
+			strict:         true,
+			handler:        func(h *Handler) http.HandlerFunc { return h.getIpListHandler },
+			query:          "country=DE,FR",
+			expectedStatus: http.StatusOK,
+			expectedBody:   "2.0.0.0/12\n5.0.0.0/16\n",
+		},
+		{
+			name:           "Lowercase accepted by default on single-country endpoints",
+			handler:        func(h *Handler) http.HandlerFunc { return h.countHandler },
+			query:          "country=fr",
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "Lowercase rejected in strict mode on single-country endpoints",
+			strict:         true,
+			handler:        func(h *Handler) http.HandlerFunc { return h.countHandler },
+			query:          "country=fr",
+			expectedStatus: http.StatusBadRequest,
+			expectedBody:   "Invalid country parameter, expected an uppercase ISO 3166-1 alpha-2 code\n",
+		},
+		{
+			name:           "Uppercase accepted in strict mode on single-country endpoints",
+			strict:         true,
+			handler:        func(h *Handler) http.HandlerFunc { return h.countHandler },
+			query:          "country=FR",
+			expectedStatus: http.StatusOK,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			mockProc := &MockProcessor{
+				ipLists: map[string][]string{
+					"DE": {"2.0.0.0/12"},
+					"FR": {"5.0.0.0/16"},
+				},
+			}
+			h := NewHandler(mockProc, &config.Config{MaxCountries: 3, StrictCountryCase: tc.strict})
+
+			rr := httptest.NewRecorder()
+			tc.handler(h).ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/?"+tc.query, nil))
+
+			if rr.Code != tc.expectedStatus {
+				t.Errorf("handler returned wrong status code: got %v want %v", rr.Code, tc.expectedStatus)
+			}
+			if tc.expectedBody != "" && rr.Body.String() != tc.expectedBody {
+				t.Errorf("handler returned unexpected body: got %q want %q", rr.Body.String(), tc.expectedBody)
+			}
+			if tc.expectedStatus == http.StatusBadRequest && mockProc.calls != 0 {
+				t.Errorf("expected processor not to be called, got %d calls", mockProc.calls)
+			}
+		})
+	}
+}
@@ -0,0 +1,157 @@
+package handler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/anisimovdk/ip-whitelist-by-country/internal/config"
+	"github.com/anisimovdk/ip-whitelist-by-country/internal/ipdata"
+)
+
+func TestGetIpListHandlerDate(t *testing.T) {
+	tomorrow := time.Now().AddDate(0, 0, 1).Format(ipdata.ArchiveDateLayout)
+
+	testCases := []struct {
+		name           string
+		query          string
+		archiveOff     bool
+		err            error
+		expectedStatus int
+		expectedBody   string
+		expectedDate   string
+		expectedSource string
+	}{
+		{
+			name:           "Latest data without a date",
+			query:          "country=DE",
+			expectedStatus: http.StatusOK,
+			expectedBody:   "2.0.0.0/12\n5.0.0.0/16\n46.0.0.0/8\n",
+			expectedSource: "live",
+		},
+		{
+			name:           "First day",
+			query:          "country=DE&date=20240101",
+			expectedStatus: http.StatusOK,
+			expectedBody:   "2.0.0.0/12\n",
+			expectedDate:   "20240101",
+		},
+		{
+			name:           "Second day",
+			query:          "country=DE&date=20240102",
+			expectedStatus: http.StatusOK,
+			expectedBody:   "2.0.0.0/12\n5.0.0.0/16\n",
+			expectedDate:   "20240102",
+		},
+		{
+			name:           "Several countries in a format",
+			query:          "country=DE,FR&date=20240102&format=netmask",
+			expectedStatus: http.StatusOK,
+			expectedBody:   "2.0.0.0 255.240.0.0\n5.0.0.0 255.255.0.0\n81.2.69.0 255.255.255.0\n",
+			expectedDate:   "20240102",
+		},
+		{
+			name:           "Day not archived",
+			query:          "country=DE&date=20231231",
+			expectedStatus: http.StatusNotFound,
+			expectedBody:   "Error processing request: " + ipdata.ErrNoArchive.Error() + "\n",
+		},
+		{
+			name:           "Archive download failed",
+			query:          "country=DE&date=20240101",
+			err:            ipdata.ErrDownloadFailed,
+			expectedStatus: http.StatusServiceUnavailable,
+			expectedBody:   "Error processing request: " + ipdata.ErrDownloadFailed.Error() + "\n",
+		},
+		{
+			name:           "Archive disabled",
+			query:          "country=DE&date=20240101",
+			archiveOff:     true,
+			expectedStatus: http.StatusBadRequest,
+			expectedBody:   "Invalid date parameter, archived data is not enabled\n",
+		},
+		{
+			name:           "Malformed date",
+			query:          "country=DE&date=2024-01-01",
+			expectedStatus: http.StatusBadRequest,
+			expectedBody:   "Invalid date parameter\n",
+		},
+		{
+			name:           "Date before the archive",
+			query:          "country=DE&date=20021231",
+			expectedStatus: http.StatusBadRequest,
+			expectedBody:   "Invalid date parameter\n",
+		},
+		{
+			name:           "Impossible date",
+			query:          "country=DE&date=20240230",
+			expectedStatus: http.StatusBadRequest,
+			expectedBody:   "Invalid date parameter\n",
+		},
+		{
+			name:           "Future date",
+			query:          "country=DE&date=" + tomorrow,
+			expectedStatus: http.StatusBadRequest,
+			expectedBody:   "Invalid date parameter\n",
+		},
+		{
+			name:           "With groupby",
+			query:          "country=DE&date=20240101&groupby=registry",
+			expectedStatus: http.StatusBadRequest,
+			expectedBody:   "Invalid date parameter for groupby, ipv6_aggregate or max_age\n",
+		},
+		{
+			name:           "With ipv6_aggregate",
+			query:          "country=DE&date=20240101&ipv6_aggregate=48",
+			expectedStatus: http.StatusBadRequest,
+			expectedBody:   "Invalid date parameter for groupby, ipv6_aggregate or max_age\n",
+		},
+		{
+			name:           "With max_age",
+			query:          "country=DE&date=20240101&max_age=1h",
+			expectedStatus: http.StatusBadRequest,
+			expectedBody:   "Invalid date parameter for groupby, ipv6_aggregate or max_age\n",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			mockProc := &MockProcessor{
+				ipLists: map[string][]string{"DE": {"2.0.0.0/12", "5.0.0.0/16", "46.0.0.0/8"}},
+				snapshots: map[string]map[string][]string{
+					"20240101": {"DE": {"2.0.0.0/12"}},
+					"20240102": {"DE": {"2.0.0.0/12", "5.0.0.0/16"}, "FR": {"81.2.69.0/24"}},
+				},
+				source:   "live",
+				dataTime: time.Now(),
+				err:      tc.err,
+			}
+			archiveURL := "http://archive.test/{date}"
+			if tc.archiveOff {
+				archiveURL = ""
+			}
+			h := NewHandler(mockProc, &config.Config{ArchiveURL: archiveURL, MaxCountries: 2})
+
+			rr := httptest.NewRecorder()
+			http.HandlerFunc(h.getIpListHandler).ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/get?"+tc.query, nil))
+
+			if rr.Code != tc.expectedStatus {
+				t.Errorf("handler returned wrong status code: got %v want %v", rr.Code, tc.expectedStatus)
+			}
+			if rr.Body.String() != tc.expectedBody {
+				t.Errorf("handler returned unexpected body: got %q want %q", rr.Body.String(), tc.expectedBody)
+			}
+			if got := rr.Header().Get("X-Data-Date"); got != tc.expectedDate {
+				t.Errorf("X-Data-Date = %q, want %q", got, tc.expectedDate)
+			}
+			// Archived responses do not describe the live data
+			if got := rr.Header().Get("X-Data-Source"); got != tc.expectedSource {
+				t.Errorf("X-Data-Source = %q, want %q", got, tc.expectedSource)
+			}
+			if tc.expectedStatus == http.StatusBadRequest && mockProc.calls != 0 {
+				t.Errorf("expected processor not to be called, got %d calls", mockProc.calls)
+			}
+		})
+	}
+}
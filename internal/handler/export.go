@@ -0,0 +1,67 @@
+package handler
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/anisimovdk/ip-whitelist-by-country/internal/ipdata"
+)
+
+// CountryLister is an IP processor that can enumerate the countries it has data for
+type CountryLister interface {
+	ipdata.IPProcessor
+	Countries() ([]string, error)
+}
+
+// checksumManifest is the name of the export manifest, which lists the SHA-256
+// of every exported file in the format read by sha256sum -c
+const checksumManifest = "SHA256SUMS"
+
+// Export writes one <CC>.<ext> file per country into dir, rendered in the named
+// output format with one entry per line, followed by a SHA256SUMS manifest of
+// the files. It returns the number of country files written.
+func Export(processor CountryLister, dir, formatName string) (int, error) {
+	format, ok := outputFormats[formatName]
+	if !ok {
+		return 0, fmt.Errorf("unknown output format %q", formatName)
+	}
+
+	countries, err := processor.Countries()
+	if err != nil {
+		return 0, err
+	}
+
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return 0, fmt.Errorf("failed to create export directory: %w", err)
+	}
+
+	var manifest []byte
+	for i, country := range countries {
+		ipList, err := processor.GetIPListForCountry(country)
+		if err != nil {
+			return i, err
+		}
+		if format.transform != nil {
+			ipList = format.transform(ipList)
+		}
+
+		name := country + "." + format.extension
+		body := renderList(country, ipList, format, separators["lf"])
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, body, 0o644); err != nil {
+			return i, fmt.Errorf("failed to write %s: %w", path, err)
+		}
+
+		sum := sha256.Sum256(body)
+		manifest = fmt.Appendf(manifest, "%s  %s\n", hex.EncodeToString(sum[:]), name)
+	}
+
+	path := filepath.Join(dir, checksumManifest)
+	if err := os.WriteFile(path, manifest, 0o644); err != nil {
+		return len(countries), fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	return len(countries), nil
+}
@@ -0,0 +1,264 @@
+package handler
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/anisimovdk/ip-whitelist-by-country/internal/ipdata"
+)
+
+func TestExport(t *testing.T) {
+	mockProc := &MockProcessor{
+		countries: []string{"DE", "US"},
+		ipLists: map[string][]string{
+			"DE": {"2.0.0.0/12"},
+			"US": {"192.168.0.0/24", "10.0.0.0/16"},
+		},
+	}
+
+	testCases := []struct {
+		name     string
+		format   string
+		expected map[string]string
+	}{
+		{
+			name:   "Cidr",
+			format: "cidr",
+			expected: map[string]string{
+				"DE.txt": "2.0.0.0/12\n",
+				"US.txt": "192.168.0.0/24\n10.0.0.0/16\n",
+			},
+		},
+		{
+			name:   "Complement",
+			format: "complement",
+			expected: map[string]string{
+				"DE.txt": "0.0.0.0/7\n2.16.0.0/12\n2.32.0.0/11\n2.64.0.0/10\n2.128.0.0/9\n3.0.0.0/8\n4.0.0.0/6\n8.0.0.0/5\n16.0.0.0/4\n32.0.0.0/3\n64.0.0.0/2\n128.0.0.0/1\n",
+				"US.txt": "0.0.0.0/5\n8.0.0.0/7\n10.1.0.0/16\n10.2.0.0/15\n10.4.0.0/14\n10.8.0.0/13\n10.16.0.0/12\n10.32.0.0/11\n10.64.0.0/10\n10.128.0.0/9\n11.0.0.0/8\n12.0.0.0/6\n16.0.0.0/4\n32.0.0.0/3\n64.0.0.0/2\n128.0.0.0/2\n192.0.0.0/9\n192.128.0.0/11\n192.160.0.0/13\n192.168.1.0/24\n192.168.2.0/23\n192.168.4.0/22\n192.168.8.0/21\n192.168.16.0/20\n192.168.32.0/19\n192.168.64.0/18\n192.168.128.0/17\n192.169.0.0/16\n192.170.0.0/15\n192.172.0.0/14\n192.176.0.0/12\n192.192.0.0/10\n193.0.0.0/8\n194.0.0.0/7\n196.0.0.0/6\n200.0.0.0/5\n208.0.0.0/4\n224.0.0.0/3\n",
+			},
+		},
+		{
+			name:   "Netmask",
+			format: "netmask",
+			expected: map[string]string{
+				"DE.txt": "2.0.0.0 255.240.0.0\n",
+				"US.txt": "192.168.0.0 255.255.255.0\n10.0.0.0 255.255.0.0\n",
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			dir := filepath.Join(t.TempDir(), "out")
+
+			n, err := Export(mockProc, dir, tc.format)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if n != len(tc.expected) {
+				t.Errorf("Export wrote %d files, want %d", n, len(tc.expected))
+			}
+
+			entries, err := os.ReadDir(dir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(entries) != len(tc.expected)+1 {
+				t.Errorf("export directory has %d entries, want %d files and the manifest", len(entries), len(tc.expected))
+			}
+
+			for name, want := range tc.expected {
+				got, err := os.ReadFile(filepath.Join(dir, name))
+				if err != nil {
+					t.Fatalf("reading %s: %v", name, err)
+				}
+				if string(got) != want {
+					t.Errorf("%s = %q, want %q", name, got, want)
+				}
+			}
+		})
+	}
+}
+
+// verifyManifest checks the SHA256SUMS manifest in dir the way sha256sum -c
+// does and returns the names of the files it lists
+func verifyManifest(t *testing.T, dir string) []string {
+	t.Helper()
+	manifest, err := os.ReadFile(filepath.Join(dir, checksumManifest))
+	if err != nil {
+		t.Fatalf("reading manifest: %v", err)
+	}
+
+	var names []string
+	scanner := bufio.NewScanner(bytes.NewReader(manifest))
+	for scanner.Scan() {
+		sum, name, ok := strings.Cut(scanner.Text(), "  ")
+		if !ok || len(sum) != sha256.Size*2 {
+			t.Fatalf("malformed manifest line %q", scanner.Text())
+		}
+		body, err := os.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			t.Fatalf("manifest lists %s: %v", name, err)
+		}
+		if got := sha256.Sum256(body); hex.EncodeToString(got[:]) != sum {
+			t.Errorf("%s: FAILED, manifest has %s", name, sum)
+		}
+		names = append(names, name)
+	}
+	return names
+}
+
+func TestExport_ChecksumManifest(t *testing.T) {
+	mockProc := &MockProcessor{
+		countries: []string{"DE", "US"},
+		ipLists: map[string][]string{
+			"DE": {"2.0.0.0/12"},
+			"US": {"192.168.0.0/24", "10.0.0.0/16"},
+		},
+	}
+
+	for _, format := range []string{"cidr", "csv", "cisco"} {
+		t.Run(format, func(t *testing.T) {
+			dir := t.TempDir()
+			if _, err := Export(mockProc, dir, format); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			ext := outputFormats[format].extension
+			names := verifyManifest(t, dir)
+			if want := []string{"DE." + ext, "US." + ext}; strings.Join(names, ",") != strings.Join(want, ",") {
+				t.Errorf("manifest lists %v, want %v", names, want)
+			}
+
+			// A modified file no longer matches its checksum
+			if err := os.WriteFile(filepath.Join(dir, "DE."+ext), []byte("0.0.0.0/0\n"), 0o644); err != nil {
+				t.Fatal(err)
+			}
+			manifest, _ := os.ReadFile(filepath.Join(dir, checksumManifest))
+			sum := sha256.Sum256([]byte("0.0.0.0/0\n"))
+			if strings.Contains(string(manifest), hex.EncodeToString(sum[:])) {
+				t.Error("manifest matches the tampered file")
+			}
+		})
+	}
+}
+
+func TestExport_ChecksumManifestSha256sum(t *testing.T) {
+	if _, err := exec.LookPath("sha256sum"); err != nil {
+		t.Skip("sha256sum not installed")
+	}
+
+	mockProc := &MockProcessor{
+		countries: []string{"DE"},
+		ipLists:   map[string][]string{"DE": {"2.0.0.0/12"}},
+	}
+	dir := t.TempDir()
+	if _, err := Export(mockProc, dir, "cidr"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	cmd := exec.Command("sha256sum", "-c", checksumManifest)
+	cmd.Dir = dir
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("sha256sum -c: %v\n%s", err, out)
+	}
+}
+
+func TestExport_InvalidFormat(t *testing.T) {
+	dir := t.TempDir()
+
+	if _, err := Export(&MockProcessor{countries: []string{"DE"}}, dir, "xml"); err == nil {
+		t.Fatal("expected error for unknown format")
+	}
+
+	entries, _ := os.ReadDir(dir)
+	if len(entries) != 0 {
+		t.Errorf("expected no files to be written, got %d", len(entries))
+	}
+}
+
+func TestExport_ProcessorError(t *testing.T) {
+	mockProc := &MockProcessor{err: ipdata.ErrDownloadFailed}
+
+	if _, err := Export(mockProc, t.TempDir(), "cidr"); !errors.Is(err, ipdata.ErrDownloadFailed) {
+		t.Fatalf("expected ErrDownloadFailed, got %v", err)
+	}
+}
+
+// listErrorProcessor lists countries successfully but fails to return their CIDR blocks
+type listErrorProcessor struct {
+	*MockProcessor
+	countries []string
+}
+
+func (p listErrorProcessor) Countries() ([]string, error) {
+	return p.countries, nil
+}
+
+func TestExport_ListError(t *testing.T) {
+	mockProc := listErrorProcessor{
+		MockProcessor: &MockProcessor{err: ipdata.ErrNotReady},
+		countries:     []string{"DE"},
+	}
+
+	n, err := Export(mockProc, t.TempDir(), "cidr")
+	if !errors.Is(err, ipdata.ErrNotReady) {
+		t.Fatalf("expected ErrNotReady, got %v", err)
+	}
+	if n != 0 {
+		t.Errorf("Export wrote %d files, want 0", n)
+	}
+}
+
+func TestExport_FilesystemErrors(t *testing.T) {
+	mockProc := &MockProcessor{
+		countries: []string{"DE", "FR"},
+		ipLists:   map[string][]string{"DE": {"2.0.0.0/12"}, "FR": {"5.0.0.0/16"}},
+	}
+
+	t.Run("Directory is a file", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "file")
+		if err := os.WriteFile(path, nil, 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := Export(mockProc, path, "cidr"); err == nil {
+			t.Fatal("expected error when the export directory is a file")
+		}
+	})
+
+	t.Run("Target is a directory", func(t *testing.T) {
+		dir := t.TempDir()
+		if err := os.Mkdir(filepath.Join(dir, "FR.txt"), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		n, err := Export(mockProc, dir, "cidr")
+		if err == nil {
+			t.Fatal("expected error when a target file cannot be written")
+		}
+		if n != 1 {
+			t.Errorf("Export reported %d files written, want 1", n)
+		}
+	})
+
+	t.Run("Manifest is a directory", func(t *testing.T) {
+		dir := t.TempDir()
+		if err := os.Mkdir(filepath.Join(dir, checksumManifest), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		n, err := Export(mockProc, dir, "cidr")
+		if err == nil {
+			t.Fatal("expected error when the manifest cannot be written")
+		}
+		if n != 2 {
+			t.Errorf("Export reported %d files written, want 2", n)
+		}
+	})
+}
@@ -0,0 +1,200 @@
+package handler
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"log"
+	"net"
+	"net/netip"
+	"strconv"
+	"strings"
+
+	"github.com/anisimovdk/ip-whitelist-by-country/internal/ipdata"
+)
+
+// outputFormat describes how CIDR blocks are rendered in /get responses
+type outputFormat struct {
+	extension   string                            // file extension used for downloads
+	contentType string                            // response media type
+	lineBased   bool                              // entries must be separated by line feeds
+	header      string                            // optional first line, e.g. column names
+	transform   func(cidrs []string) []string     // optional transformation of the whole list
+	render      func(country, cidr string) string // renders a single CIDR block
+}
+
+// outputFormats maps the format query parameter values to output formats
+var outputFormats = map[string]outputFormat{
+	"cidr":    {extension: "txt", contentType: "text/plain", render: renderCIDR},
+	"netmask": {extension: "txt", contentType: "text/plain", render: renderNetmask},
+	"complement": {
+		extension:   "txt",
+		contentType: "text/plain",
+		transform:   ipdata.ComplementCIDRs,
+		render:      renderCIDR,
+	},
+	"ndjson": {extension: "ndjson", contentType: "application/x-ndjson", lineBased: true, render: renderNDJSON},
+	"cisco":  {extension: "acl", contentType: "text/plain", lineBased: true, render: ciscoACLRenderer("permit", "source")},
+	"csv":    {extension: "csv", contentType: "text/csv", lineBased: true, header: csvHeader, render: renderCSV},
+	"mikrotik": {
+		extension:   "rsc",
+		contentType: "text/plain",
+		lineBased:   true,
+		render:      mikrotikRenderer(""),
+	},
+}
+
+// csvHeader names the columns of the csv output format
+var csvHeader = csvRecord("country", "cidr", "network", "prefix")
+
+// aclActions and aclDirections list the values accepted by the acl_action and
+// acl_direction query parameters of the cisco format; the first is the default
+var (
+	aclActions    = []string{"permit", "deny"}
+	aclDirections = []string{"source", "destination"}
+)
+
+// maxListNameLength caps the list query parameter of the mikrotik format
+const maxListNameLength = 64
+
+// enabledFormats parses a comma-separated list of format names (e.g.
+// "cidr,ndjson") that /get serves. It returns nil, enabling every format, for
+// an empty list. Unknown entries are logged and skipped.
+func enabledFormats(spec string) map[string]bool {
+	if strings.TrimSpace(spec) == "" {
+		return nil
+	}
+	enabled := make(map[string]bool)
+	for _, entry := range strings.Split(spec, ",") {
+		name := strings.TrimSpace(entry)
+		if name == "" {
+			continue
+		}
+		if _, ok := outputFormats[name]; !ok {
+			log.Printf("Ignoring unknown enabled format %q\n", name)
+			continue
+		}
+		enabled[name] = true
+	}
+	return enabled
+}
+
+// validListName reports whether name can be used unquoted as a RouterOS
+// address-list name: letters, digits, '_', '-' and '.' only, so a list name
+// cannot inject further commands
+func validListName(name string) bool {
+	if name == "" || len(name) > maxListNameLength {
+		return false
+	}
+	for _, c := range name {
+		if !('a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9' || c == '_' || c == '-' || c == '.') {
+			return false
+		}
+	}
+	return true
+}
+
+// renderCIDR renders a CIDR block unchanged
+func renderCIDR(_, cidr string) string {
+	return cidr
+}
+
+// renderNetmask renders a CIDR block as a "network netmask" pair
+func renderNetmask(_, cidr string) string {
+	return cidrToNetmask(cidr)
+}
+
+// ndjsonEntry is a single line of the ndjson output format
+type ndjsonEntry struct {
+	Country string `json:"country"`
+	CIDR    string `json:"cidr"`
+}
+
+// renderNDJSON renders a CIDR block as a standalone JSON object,
+// e.g. {"country":"DE","cidr":"2.0.0.0/12"}
+func renderNDJSON(country, cidr string) string {
+	line, _ := json.Marshal(ndjsonEntry{Country: country, CIDR: cidr})
+	return string(line)
+}
+
+// renderCSV renders a CIDR block as a CSV row of the country, the block, its
+// network address and prefix length, e.g. "DE,2.0.0.0/12,2.0.0.0,12".
+// Values that are not valid CIDR blocks leave the last two columns empty.
+func renderCSV(country, cidr string) string {
+	var network, prefix string
+	if p, err := netip.ParsePrefix(cidr); err == nil {
+		network, prefix = p.Addr().String(), strconv.Itoa(p.Bits())
+	}
+	return csvRecord(country, cidr, network, prefix)
+}
+
+// csvRecord formats fields as one CSV line without the line terminator,
+// quoting them as needed
+func csvRecord(fields ...string) string {
+	var b strings.Builder
+	w := csv.NewWriter(&b)
+	w.Write(fields)
+	w.Flush()
+	return strings.TrimSuffix(b.String(), "\n")
+}
+
+// ciscoACLRenderer returns a renderer emitting Cisco extended ACL entries that
+// match the CIDR block as source or destination, e.g. with ("permit", "source")
+// "192.168.0.0/24" becomes "permit ip 192.168.0.0 0.0.0.255 any"
+func ciscoACLRenderer(action, direction string) func(country, cidr string) string {
+	return func(_, cidr string) string {
+		network, wildcard, ok := cidrToWildcard(cidr)
+		if !ok {
+			return cidr
+		}
+		if direction == "destination" {
+			return action + " ip any " + network + " " + wildcard
+		}
+		return action + " ip " + network + " " + wildcard + " any"
+	}
+}
+
+// mikrotikRenderer returns a renderer emitting RouterOS commands that add the
+// CIDR block to the address list named list, or to a list named after the
+// country when list is empty, e.g. "/ip firewall address-list add list=US
+// address=1.2.3.0/24"
+func mikrotikRenderer(list string) func(country, cidr string) string {
+	return func(country, cidr string) string {
+		name := list
+		if name == "" {
+			name = country
+		}
+		return "/ip firewall address-list add list=" + name + " address=" + cidr
+	}
+}
+
+// cidrToWildcard splits an IPv4 CIDR block into its network address and Cisco
+// wildcard mask (the inverted netmask), e.g. "192.168.0.0/24" becomes
+// "192.168.0.0" and "0.0.0.255"
+func cidrToWildcard(cidr string) (network, wildcard string, ok bool) {
+	_, ipNet, err := net.ParseCIDR(cidr)
+	if err != nil || ipNet.IP.To4() == nil {
+		return "", "", false
+	}
+
+	ones, _ := ipNet.Mask.Size()
+	mask := net.CIDRMask(ones, 32)
+	inverted := make(net.IP, len(mask))
+	for i, b := range mask {
+		inverted[i] = ^b
+	}
+	return ipNet.IP.String(), inverted.String(), true
+}
+
+// cidrToNetmask converts CIDR notation to a "network netmask" pair,
+// e.g. "192.168.0.0/24" becomes "192.168.0.0 255.255.255.0".
+// Values that are not valid IPv4 CIDR blocks are returned unchanged.
+func cidrToNetmask(cidr string) string {
+	_, ipNet, err := net.ParseCIDR(cidr)
+	if err != nil || ipNet.IP.To4() == nil {
+		return cidr
+	}
+
+	ones, _ := ipNet.Mask.Size()
+	mask := net.IP(net.CIDRMask(ones, 32))
+	return ipNet.IP.String() + " " + mask.String()
+}
@@ -0,0 +1,570 @@
+package handler
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/anisimovdk/ip-whitelist-by-country/internal/config"
+)
+
+func TestCidrToNetmask(t *testing.T) {
+	testCases := []struct {
+		cidr     string
+		expected string
+	}{
+		{cidr: "192.168.0.0/24", expected: "192.168.0.0 255.255.255.0"},
+		{cidr: "10.0.0.0/16", expected: "10.0.0.0 255.255.0.0"},
+		{cidr: "1.2.3.4/32", expected: "1.2.3.4 255.255.255.255"},
+		{cidr: "2.0.0.0/12", expected: "2.0.0.0 255.240.0.0"},
+		{cidr: "2001:db8::/32", expected: "2001:db8::/32"},
+		{cidr: "garbage", expected: "garbage"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.cidr, func(t *testing.T) {
+			if got := cidrToNetmask(tc.cidr); got != tc.expected {
+				t.Errorf("cidrToNetmask(%q) = %q, want %q", tc.cidr, got, tc.expected)
+			}
+		})
+	}
+}
+
+func TestGetIpListHandlerFormat(t *testing.T) {
+	mockProc := &MockProcessor{
+		ipLists: map[string][]string{
+			"US": {"192.168.0.0/24", "10.0.0.0/16", "1.2.3.4/32"},
+			"EU": {"128.0.0.0/1", "0.0.0.0/2"},
+		},
+	}
+	h := NewHandler(mockProc, &config.Config{})
+
+	testCases := []struct {
+		name           string
+		query          string
+		expectedStatus int
+		expectedBody   string
+	}{
+		{
+			name:           "Default cidr",
+			query:          "country=US",
+			expectedStatus: http.StatusOK,
+			expectedBody:   "192.168.0.0/24\n10.0.0.0/16\n1.2.3.4/32\n",
+		},
+		{
+			name:           "Netmask",
+			query:          "country=US&format=netmask",
+			expectedStatus: http.StatusOK,
+			expectedBody:   "192.168.0.0 255.255.255.0\n10.0.0.0 255.255.0.0\n1.2.3.4 255.255.255.255\n",
+		},
+		{
+			name:           "Netmask with comma separator",
+			query:          "country=US&format=netmask&sep=comma",
+			expectedStatus: http.StatusOK,
+			expectedBody:   "192.168.0.0 255.255.255.0,10.0.0.0 255.255.0.0,1.2.3.4 255.255.255.255",
+		},
+		{
+			name:           "Complement",
+			query:          "country=EU&format=complement",
+			expectedStatus: http.StatusOK,
+			expectedBody:   "64.0.0.0/2\n",
+		},
+		{
+			name:           "Invalid format",
+			query:          "country=US&format=xml",
+			expectedStatus: http.StatusBadRequest,
+			expectedBody:   "Invalid format parameter\n",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/get?"+tc.query, nil)
+			rr := httptest.NewRecorder()
+			http.HandlerFunc(h.getIpListHandler).ServeHTTP(rr, req)
+
+			if rr.Code != tc.expectedStatus {
+				t.Errorf("handler returned wrong status code: got %v want %v",
+					rr.Code, tc.expectedStatus)
+			}
+			if rr.Body.String() != tc.expectedBody {
+				t.Errorf("handler returned unexpected body: got %q want %q",
+					rr.Body.String(), tc.expectedBody)
+			}
+		})
+	}
+}
+
+func TestGetIpListHandlerNDJSON(t *testing.T) {
+	mockProc := &MockProcessor{
+		ipLists: map[string][]string{
+			"US": {"192.168.0.0/24", "10.0.0.0/16", "1.2.3.4/32"},
+		},
+	}
+	h := NewHandler(mockProc, &config.Config{})
+
+	req := httptest.NewRequest(http.MethodGet, "/get?country=us&format=ndjson", nil)
+	rr := httptest.NewRecorder()
+	http.HandlerFunc(h.getIpListHandler).ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("handler returned wrong status code: got %v want %v", rr.Code, http.StatusOK)
+	}
+	if ct := rr.Header().Get("Content-Type"); ct != "application/x-ndjson" {
+		t.Errorf("Content-Type = %q, want %q", ct, "application/x-ndjson")
+	}
+
+	lines := strings.Split(strings.TrimSuffix(rr.Body.String(), "\n"), "\n")
+	want := mockProc.ipLists["US"]
+	if len(lines) != len(want) {
+		t.Fatalf("got %d lines, want %d: %q", len(lines), len(want), rr.Body.String())
+	}
+	for i, line := range lines {
+		var entry map[string]string
+		if err := json.Unmarshal([]byte(line), &entry); err != nil {
+			t.Fatalf("line %d is not valid JSON: %q: %v", i, line, err)
+		}
+		if len(entry) != 2 || entry["country"] != "US" || entry["cidr"] != want[i] {
+			t.Errorf("line %d = %v, want country US and cidr %s", i, entry, want[i])
+		}
+	}
+}
+
+func TestGetIpListHandlerNDJSONRejectsSeparator(t *testing.T) {
+	mockProc := &MockProcessor{ipLists: map[string][]string{"US": {"1.2.3.4/32"}}}
+	h := NewHandler(mockProc, &config.Config{})
+
+	req := httptest.NewRequest(http.MethodGet, "/get?country=US&format=ndjson&sep=comma", nil)
+	rr := httptest.NewRecorder()
+	http.HandlerFunc(h.getIpListHandler).ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("handler returned wrong status code: got %v want %v", rr.Code, http.StatusBadRequest)
+	}
+	if rr.Body.String() != "Invalid sep parameter\n" {
+		t.Errorf("handler returned unexpected body: got %q", rr.Body.String())
+	}
+}
+
+func TestGetIpListHandlerCSV(t *testing.T) {
+	mockProc := &MockProcessor{
+		ipLists: map[string][]string{
+			"DE": {"2.0.0.0/12", "5.0.0.0/16"},
+			"FR": {"81.2.69.0/24"},
+			"NL": {},
+		},
+		ipv6Lists: map[string][]string{"DE": {"2001:db8::/32"}},
+	}
+	h := NewHandler(mockProc, &config.Config{MaxCountries: 3})
+
+	testCases := []struct {
+		name         string
+		query        string
+		expectedBody string
+	}{
+		{
+			name:         "Single country",
+			query:        "country=DE&format=csv",
+			expectedBody: "country,cidr,network,prefix\nDE,2.0.0.0/12,2.0.0.0,12\nDE,5.0.0.0/16,5.0.0.0,16\n",
+		},
+		{
+			name:         "Each row carries its country",
+			query:        "country=DE,FR&format=csv",
+			expectedBody: "country,cidr,network,prefix\nDE,2.0.0.0/12,2.0.0.0,12\nDE,5.0.0.0/16,5.0.0.0,16\nFR,81.2.69.0/24,81.2.69.0,24\n",
+		},
+		{
+			name:         "Without trailing newline",
+			query:        "country=FR&format=csv&trailing_newline=false",
+			expectedBody: "country,cidr,network,prefix\nFR,81.2.69.0/24,81.2.69.0,24",
+		},
+		{
+			name:         "Empty list",
+			query:        "country=NL&format=csv",
+			expectedBody: "country,cidr,network,prefix\n",
+		},
+		{
+			name:         "Empty list without trailing newline",
+			query:        "country=NL&format=csv&trailing_newline=false",
+			expectedBody: "country,cidr,network,prefix",
+		},
+		{
+			name:         "IPv6 prefixes",
+			query:        "country=DE&format=csv&ipv6_aggregate=48",
+			expectedBody: "country,cidr,network,prefix\nDE,2.0.0.0/12,2.0.0.0,12\nDE,5.0.0.0/16,5.0.0.0,16\nDE,2001:db8::/32,2001:db8::,32\n",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			http.HandlerFunc(h.getIpListHandler).ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/get?"+tc.query, nil))
+
+			if rr.Code != http.StatusOK {
+				t.Fatalf("handler returned wrong status code: got %v want %v", rr.Code, http.StatusOK)
+			}
+			if ct := rr.Header().Get("Content-Type"); ct != "text/csv" {
+				t.Errorf("Content-Type = %q, want %q", ct, "text/csv")
+			}
+			if rr.Body.String() != tc.expectedBody {
+				t.Errorf("handler returned unexpected body: got %q want %q", rr.Body.String(), tc.expectedBody)
+			}
+		})
+	}
+}
+
+func TestGetIpListHandlerCSVParses(t *testing.T) {
+	mockProc := &MockProcessor{ipLists: map[string][]string{"DE": {"2.0.0.0/12"}, "FR": {"81.2.69.0/24"}}}
+	h := NewHandler(mockProc, &config.Config{MaxCountries: 2})
+
+	rr := httptest.NewRecorder()
+	http.HandlerFunc(h.getIpListHandler).ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/get?country=DE,FR&format=csv&download=true", nil))
+
+	records, err := csv.NewReader(strings.NewReader(rr.Body.String())).ReadAll()
+	if err != nil {
+		t.Fatalf("response is not valid CSV: %v", err)
+	}
+	want := [][]string{
+		{"country", "cidr", "network", "prefix"},
+		{"DE", "2.0.0.0/12", "2.0.0.0", "12"},
+		{"FR", "81.2.69.0/24", "81.2.69.0", "24"},
+	}
+	if !reflect.DeepEqual(records, want) {
+		t.Errorf("records = %q, want %q", records, want)
+	}
+	if cd := rr.Header().Get("Content-Disposition"); cd != "attachment; filename=DE_FR.csv" {
+		t.Errorf("Content-Disposition = %q, want the DE_FR.csv attachment", cd)
+	}
+}
+
+func TestCSVRecordQuotesFields(t *testing.T) {
+	if got, want := csvRecord("a,b", `say "hi"`, "plain"), `"a,b","say ""hi""",plain`; got != want {
+		t.Errorf("csvRecord = %q, want %q", got, want)
+	}
+}
+
+func TestGetIpListHandlerCSVRejectsSeparator(t *testing.T) {
+	h := NewHandler(&MockProcessor{ipLists: map[string][]string{"US": {"1.2.3.4/32"}}}, &config.Config{})
+
+	rr := httptest.NewRecorder()
+	http.HandlerFunc(h.getIpListHandler).ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/get?country=US&format=csv&sep=comma", nil))
+
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("handler returned wrong status code: got %v want %v", rr.Code, http.StatusBadRequest)
+	}
+}
+
+func TestRenderCSVPassesThroughInvalidCIDR(t *testing.T) {
+	if got := renderCSV("DE", "garbage"); got != "DE,garbage,," {
+		t.Errorf("renderCSV(garbage) = %q, want %q", got, "DE,garbage,,")
+	}
+}
+
+func TestCidrToWildcard(t *testing.T) {
+	testCases := []struct {
+		cidr     string
+		network  string
+		wildcard string
+		ok       bool
+	}{
+		{cidr: "192.168.0.0/24", network: "192.168.0.0", wildcard: "0.0.0.255", ok: true},
+		{cidr: "10.0.0.4/30", network: "10.0.0.4", wildcard: "0.0.0.3", ok: true},
+		{cidr: "1.2.3.4/32", network: "1.2.3.4", wildcard: "0.0.0.0", ok: true},
+		{cidr: "2.0.0.0/12", network: "2.0.0.0", wildcard: "0.15.255.255", ok: true},
+		{cidr: "0.0.0.0/0", network: "0.0.0.0", wildcard: "255.255.255.255", ok: true},
+		{cidr: "2001:db8::/32"},
+		{cidr: "garbage"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.cidr, func(t *testing.T) {
+			network, wildcard, ok := cidrToWildcard(tc.cidr)
+			if network != tc.network || wildcard != tc.wildcard || ok != tc.ok {
+				t.Errorf("cidrToWildcard(%q) = %q, %q, %v; want %q, %q, %v",
+					tc.cidr, network, wildcard, ok, tc.network, tc.wildcard, tc.ok)
+			}
+		})
+	}
+}
+
+func TestGetIpListHandlerCisco(t *testing.T) {
+	mockProc := &MockProcessor{
+		ipLists: map[string][]string{
+			"US": {"192.168.0.0/24", "10.0.0.4/30", "1.2.3.4/32"},
+		},
+	}
+	h := NewHandler(mockProc, &config.Config{})
+
+	testCases := []struct {
+		name           string
+		query          string
+		expectedStatus int
+		expectedBody   string
+	}{
+		{
+			name:           "Default permit source",
+			query:          "",
+			expectedStatus: http.StatusOK,
+			expectedBody:   "permit ip 192.168.0.0 0.0.0.255 any\npermit ip 10.0.0.4 0.0.0.3 any\npermit ip 1.2.3.4 0.0.0.0 any\n",
+		},
+		{
+			name:           "Deny destination",
+			query:          "&acl_action=deny&acl_direction=destination",
+			expectedStatus: http.StatusOK,
+			expectedBody:   "deny ip any 192.168.0.0 0.0.0.255\ndeny ip any 10.0.0.4 0.0.0.3\ndeny ip any 1.2.3.4 0.0.0.0\n",
+		},
+		{
+			name:           "Invalid action",
+			query:          "&acl_action=allow",
+			expectedStatus: http.StatusBadRequest,
+			expectedBody:   "Invalid acl_action parameter\n",
+		},
+		{
+			name:           "Invalid direction",
+			query:          "&acl_direction=in",
+			expectedStatus: http.StatusBadRequest,
+			expectedBody:   "Invalid acl_direction parameter\n",
+		},
+		{
+			name:           "Separator other than lf",
+			query:          "&sep=comma",
+			expectedStatus: http.StatusBadRequest,
+			expectedBody:   "Invalid sep parameter\n",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/get?country=US&format=cisco"+tc.query, nil)
+			rr := httptest.NewRecorder()
+			http.HandlerFunc(h.getIpListHandler).ServeHTTP(rr, req)
+
+			if rr.Code != tc.expectedStatus {
+				t.Errorf("handler returned wrong status code: got %v want %v", rr.Code, tc.expectedStatus)
+			}
+			if rr.Body.String() != tc.expectedBody {
+				t.Errorf("handler returned unexpected body: got %q want %q", rr.Body.String(), tc.expectedBody)
+			}
+		})
+	}
+}
+
+func TestGetIpListHandlerACLParamsRequireCisco(t *testing.T) {
+	h := NewHandler(&MockProcessor{ipLists: map[string][]string{"US": {"1.2.3.4/32"}}}, &config.Config{})
+
+	req := httptest.NewRequest(http.MethodGet, "/get?country=US&acl_action=deny", nil)
+	rr := httptest.NewRecorder()
+	http.HandlerFunc(h.getIpListHandler).ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("handler returned wrong status code: got %v want %v", rr.Code, http.StatusBadRequest)
+	}
+	if rr.Body.String() != "Invalid format parameter for acl_action or acl_direction\n" {
+		t.Errorf("handler returned unexpected body: got %q", rr.Body.String())
+	}
+}
+
+func TestCiscoACLRendererPassesThroughInvalidCIDR(t *testing.T) {
+	if got := ciscoACLRenderer("permit", "source")("US", "garbage"); got != "garbage" {
+		t.Errorf("render(garbage) = %q, want %q", got, "garbage")
+	}
+}
+
+func TestGetIpListHandlerMikrotik(t *testing.T) {
+	mockProc := &MockProcessor{
+		ipLists: map[string][]string{
+			"US": {"1.2.3.0/24", "10.0.0.4/30"},
+			"DE": {"2.0.0.0/12"},
+		},
+	}
+	h := NewHandler(mockProc, &config.Config{MaxCountries: 2})
+
+	testCases := []struct {
+		name           string
+		query          string
+		expectedStatus int
+		expectedBody   string
+	}{
+		{
+			name:           "List named after the country",
+			query:          "country=US",
+			expectedStatus: http.StatusOK,
+			expectedBody:   "/ip firewall address-list add list=US address=1.2.3.0/24\n/ip firewall address-list add list=US address=10.0.0.4/30\n",
+		},
+		{
+			name:           "One list per country",
+			query:          "country=US,DE",
+			expectedStatus: http.StatusOK,
+			expectedBody:   "/ip firewall address-list add list=US address=1.2.3.0/24\n/ip firewall address-list add list=US address=10.0.0.4/30\n/ip firewall address-list add list=DE address=2.0.0.0/12\n",
+		},
+		{
+			name:           "Custom list name",
+			query:          "country=US,DE&list=geo-block_v1.2",
+			expectedStatus: http.StatusOK,
+			expectedBody:   "/ip firewall address-list add list=geo-block_v1.2 address=1.2.3.0/24\n/ip firewall address-list add list=geo-block_v1.2 address=10.0.0.4/30\n/ip firewall address-list add list=geo-block_v1.2 address=2.0.0.0/12\n",
+		},
+		{
+			name:           "List name injecting a command",
+			query:          "country=US&list=x%3B%2Fsystem%20reboot",
+			expectedStatus: http.StatusBadRequest,
+			expectedBody:   "Invalid list parameter\n",
+		},
+		{
+			name:           "List name too long",
+			query:          "country=US&list=" + strings.Repeat("a", maxListNameLength+1),
+			expectedStatus: http.StatusBadRequest,
+			expectedBody:   "Invalid list parameter\n",
+		},
+		{
+			name:           "Separator other than lf",
+			query:          "country=US&sep=space",
+			expectedStatus: http.StatusBadRequest,
+			expectedBody:   "Invalid sep parameter\n",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/get?format=mikrotik&"+tc.query, nil)
+			rr := httptest.NewRecorder()
+			http.HandlerFunc(h.getIpListHandler).ServeHTTP(rr, req)
+
+			if rr.Code != tc.expectedStatus {
+				t.Errorf("handler returned wrong status code: got %v want %v", rr.Code, tc.expectedStatus)
+			}
+			if rr.Body.String() != tc.expectedBody {
+				t.Errorf("handler returned unexpected body: got %q want %q", rr.Body.String(), tc.expectedBody)
+			}
+		})
+	}
+}
+
+func TestGetIpListHandlerListParamRequiresMikrotik(t *testing.T) {
+	h := NewHandler(&MockProcessor{ipLists: map[string][]string{"US": {"1.2.3.4/32"}}}, &config.Config{})
+
+	req := httptest.NewRequest(http.MethodGet, "/get?country=US&format=cisco&list=blocklist", nil)
+	rr := httptest.NewRecorder()
+	http.HandlerFunc(h.getIpListHandler).ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("handler returned wrong status code: got %v want %v", rr.Code, http.StatusBadRequest)
+	}
+	if rr.Body.String() != "Invalid format parameter for list\n" {
+		t.Errorf("handler returned unexpected body: got %q", rr.Body.String())
+	}
+}
+
+func TestValidListName(t *testing.T) {
+	testCases := []struct {
+		name     string
+		expected bool
+	}{
+		{name: "US", expected: true},
+		{name: "geo-block_v1.2", expected: true},
+		{name: strings.Repeat("a", maxListNameLength), expected: true},
+		{name: "", expected: false},
+		{name: strings.Repeat("a", maxListNameLength+1), expected: false},
+		{name: "two words", expected: false},
+		{name: `a"b`, expected: false},
+		{name: "a;b", expected: false},
+		{name: "a\nb", expected: false},
+	}
+
+	for _, tc := range testCases {
+		if got := validListName(tc.name); got != tc.expected {
+			t.Errorf("validListName(%q) = %v, want %v", tc.name, got, tc.expected)
+		}
+	}
+}
+
+func TestEnabledFormats(t *testing.T) {
+	testCases := []struct {
+		spec     string
+		expected map[string]bool
+	}{
+		{spec: "", expected: nil},
+		{spec: " ", expected: nil},
+		{spec: "cidr,ndjson", expected: map[string]bool{"cidr": true, "ndjson": true}},
+		{spec: " csv , ,cidr", expected: map[string]bool{"csv": true, "cidr": true}},
+		{spec: "cidr,iptables", expected: map[string]bool{"cidr": true}},
+		{spec: "iptables", expected: map[string]bool{}},
+	}
+
+	for _, tc := range testCases {
+		if got := enabledFormats(tc.spec); !reflect.DeepEqual(got, tc.expected) {
+			t.Errorf("enabledFormats(%q) = %v, want %v", tc.spec, got, tc.expected)
+		}
+	}
+}
+
+func TestGetIpListHandlerEnabledFormats(t *testing.T) {
+	testCases := []struct {
+		name           string
+		enabled        string
+		query          string
+		expectedStatus int
+		expectedBody   string
+	}{
+		{
+			name:           "All formats enabled by default",
+			query:          "country=DE&format=cisco",
+			expectedStatus: http.StatusOK,
+			expectedBody:   "permit ip 2.0.0.0 0.15.255.255 any\n",
+		},
+		{
+			name:           "Enabled format",
+			enabled:        "cidr,ndjson",
+			query:          "country=DE&format=ndjson",
+			expectedStatus: http.StatusOK,
+			expectedBody:   `{"country":"DE","cidr":"2.0.0.0/12"}` + "\n",
+		},
+		{
+			name:           "Default format enabled",
+			enabled:        "cidr,ndjson",
+			query:          "country=DE",
+			expectedStatus: http.StatusOK,
+			expectedBody:   "2.0.0.0/12\n",
+		},
+		{
+			name:           "Disabled format",
+			enabled:        "cidr,ndjson",
+			query:          "country=DE&format=cisco",
+			expectedStatus: http.StatusBadRequest,
+			expectedBody:   "Invalid format parameter, cisco is not enabled\n",
+		},
+		{
+			name:           "Disabled default format",
+			enabled:        "ndjson",
+			query:          "country=DE",
+			expectedStatus: http.StatusBadRequest,
+			expectedBody:   "Invalid format parameter, cidr is not enabled\n",
+		},
+		{
+			name:           "Unknown format",
+			enabled:        "cidr",
+			query:          "country=DE&format=iptables",
+			expectedStatus: http.StatusBadRequest,
+			expectedBody:   "Invalid format parameter\n",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			mockProc := &MockProcessor{ipLists: map[string][]string{"DE": {"2.0.0.0/12"}}}
+			h := NewHandler(mockProc, &config.Config{EnabledFormats: tc.enabled})
+
+			rr := httptest.NewRecorder()
+			http.HandlerFunc(h.getIpListHandler).ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/get?"+tc.query, nil))
+
+			if rr.Code != tc.expectedStatus {
+				t.Errorf("handler returned wrong status code: got %v want %v", rr.Code, tc.expectedStatus)
+			}
+			if rr.Body.String() != tc.expectedBody {
+				t.Errorf("handler returned unexpected body: got %q want %q", rr.Body.String(), tc.expectedBody)
+			}
+		})
+	}
+}
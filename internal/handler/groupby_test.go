@@ -0,0 +1,107 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/anisimovdk/ip-whitelist-by-country/internal/config"
+	"github.com/anisimovdk/ip-whitelist-by-country/internal/ipdata"
+)
+
+func TestGetIpListHandlerGroupByRegistry(t *testing.T) {
+	registries := map[string][]string{
+		"ripencc": {"31.0.0.0/24", "46.0.0.0/16"},
+		"arin":    {"3.0.0.0/8"},
+	}
+	mockProc := &MockProcessor{
+		registries: map[string]map[string][]string{"US": registries},
+		source:     ipdata.DataSourceLive,
+		dataTime:   time.Now(),
+	}
+	h := NewHandler(mockProc, &config.Config{})
+
+	req := httptest.NewRequest(http.MethodGet, "/get?country=us&groupby=registry&download=true", nil)
+	rr := httptest.NewRecorder()
+	http.HandlerFunc(h.getIpListHandler).ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("handler returned wrong status code: got %v want %v", rr.Code, http.StatusOK)
+	}
+	if ct := rr.Header().Get("Content-Type"); ct != "application/json" {
+		t.Errorf("Content-Type = %q, want %q", ct, "application/json")
+	}
+	if source := rr.Header().Get("X-Data-Source"); source != "live" {
+		t.Errorf("X-Data-Source = %q, want %q", source, "live")
+	}
+	if cd := rr.Header().Get("Content-Disposition"); cd != `attachment; filename=US.json` {
+		t.Errorf("Content-Disposition = %q", cd)
+	}
+
+	var got map[string][]string
+	if err := json.Unmarshal(rr.Body.Bytes(), &got); err != nil {
+		t.Fatalf("failed to decode response %q: %v", rr.Body.String(), err)
+	}
+	if !reflect.DeepEqual(got, registries) {
+		t.Errorf("groups = %v, want %v", got, registries)
+	}
+}
+
+func TestGetIpListHandlerGroupByErrors(t *testing.T) {
+	testCases := []struct {
+		name           string
+		query          string
+		err            error
+		expectedStatus int
+		expectedBody   string
+	}{
+		{
+			name:           "Unknown grouping",
+			query:          "country=US&groupby=asn",
+			expectedStatus: http.StatusBadRequest,
+			expectedBody:   "Invalid groupby parameter\n",
+		},
+		{
+			name:           "Non-CIDR format",
+			query:          "country=US&groupby=registry&format=netmask",
+			expectedStatus: http.StatusBadRequest,
+			expectedBody:   "Invalid format parameter for groupby\n",
+		},
+		{
+			name:           "Explicit CIDR format",
+			query:          "country=US&groupby=registry&format=cidr",
+			expectedStatus: http.StatusOK,
+			expectedBody:   "{\"ripencc\":[\"31.0.0.0/24\"]}\n",
+		},
+		{
+			name:           "Processor error",
+			query:          "country=US&groupby=registry",
+			err:            ipdata.ErrBadUpstreamData,
+			expectedStatus: http.StatusBadGateway,
+			expectedBody:   "Error processing request: " + ipdata.ErrBadUpstreamData.Error() + "\n",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			mockProc := &MockProcessor{
+				registries: map[string]map[string][]string{"US": {"ripencc": {"31.0.0.0/24"}}},
+				err:        tc.err,
+			}
+			h := NewHandler(mockProc, &config.Config{})
+
+			rr := httptest.NewRecorder()
+			http.HandlerFunc(h.getIpListHandler).ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/get?"+tc.query, nil))
+
+			if rr.Code != tc.expectedStatus {
+				t.Errorf("handler returned wrong status code: got %v want %v", rr.Code, tc.expectedStatus)
+			}
+			if rr.Body.String() != tc.expectedBody {
+				t.Errorf("handler returned unexpected body: got %q want %q", rr.Body.String(), tc.expectedBody)
+			}
+		})
+	}
+}
@@ -1,26 +1,107 @@
 package handler
 
 import (
+	"bytes"
+	"cmp"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"mime"
 	"net/http"
+	"net/http/pprof"
+	"net/netip"
+	"slices"
+	"strconv"
+	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/anisimovdk/ip-whitelist-by-country/internal/config"
 	"github.com/anisimovdk/ip-whitelist-by-country/internal/ipdata"
+	"github.com/anisimovdk/ip-whitelist-by-country/internal/version"
 )
 
+// serviceName identifies the service in the root index
+const serviceName = "ip-whitelist-by-country"
+
+// separator describes how CIDR blocks are delimited in the response
+type separator struct {
+	value    string
+	trailing bool // whether the last entry is also followed by the separator
+}
+
+// separators maps the sep query parameter values to output separators.
+// Line terminators (lf, crlf) end every entry, list separators (comma, space)
+// only appear between entries.
+var separators = map[string]separator{
+	"lf":    {value: "\n", trailing: true},
+	"crlf":  {value: "\r\n", trailing: true},
+	"comma": {value: ",", trailing: false},
+	"space": {value: " ", trailing: false},
+}
+
+// renderedEntrySizeHint is the expected length of one rendered CIDR block, used to
+// preallocate response buffers ("255.255.255.255/32" is 18 bytes)
+const renderedEntrySizeHint = 18
+
+// cancelCheckInterval is how many entries are rendered between checks for a
+// canceled request
+const cancelCheckInterval = 1024
+
+// getAllowedMethods is advertised in the Allow header of /get responses
+const getAllowedMethods = "GET, HEAD, OPTIONS"
+
+// getQueryParams lists the query parameters recognized by the /get endpoint
+var getQueryParams = []string{"country", "auth", "format", "sep", "download", "trailing_newline", "max_age", "groupby", "acl_action", "acl_direction", "list", "within", "ipv6_aggregate", "date", "status", "sort"}
+
+// ipv6AggregateLevels lists the prefix lengths accepted by the ipv6_aggregate query parameter
+var ipv6AggregateLevels = []int{48, 56, 64}
+
+// asnsQueryParams lists the query parameters recognized by the /asns endpoint
+var asnsQueryParams = []string{"country", "auth"}
+
+// provenanceQueryParams lists the query parameters recognized by the /provenance endpoint
+var provenanceQueryParams = []string{"country", "auth"}
+
+// statsQueryParams lists the query parameters recognized by the /stats endpoint
+var statsQueryParams = []string{"diagnostics"}
+
 // Handler handles HTTP requests for the IP whitelist service
 type Handler struct {
-	processor ipdata.IPProcessor
-	config    *config.Config
-	mutex     sync.RWMutex
+	processor   ipdata.IPProcessor
+	config      *config.Config
+	aliases     map[string]string // alternative country code -> canonical code
+	public      map[string]bool   // country codes /get serves without a token
+	formats     map[string]bool   // formats /get serves, nil if all are
+	maintenance atomic.Bool       // whether /get is answered with 503
+	requests    atomic.Uint64     // requests received by the data endpoints
+	mutex       sync.RWMutex
+
+	precomputeTargets []precomputeTarget // /get responses rendered after each refresh
+	rendered          renderCache        // bodies of the precompute targets
 }
 
 // NewHandler creates a new handler
 func NewHandler(processor ipdata.IPProcessor, cfg *config.Config) *Handler {
-	return &Handler{
+	h := &Handler{
 		processor: processor,
 		config:    cfg,
+		aliases:   countryAliases(cfg.CountryAliases),
+	}
+	h.public = publicCountries(cfg.PublicCountries, h.aliases)
+	h.formats = enabledFormats(cfg.EnabledFormats)
+	h.maintenance.Store(cfg.Maintenance)
+
+	// Render the popular responses ahead of the requests whenever data is loaded
+	h.precomputeTargets = precomputeTargets(cfg.PrecomputeFormats, h.aliases)
+	if notifier, ok := processor.(refreshNotifier); ok && len(h.precomputeTargets) > 0 {
+		notifier.OnRefresh(h.precompute)
 	}
+	return h
 }
 
 // RegisterRoutes registers the HTTP routes for the handler
@@ -29,46 +110,883 @@ func (h *Handler) RegisterRoutes() {
 }
 
 // RegisterRoutesOn registers the HTTP routes for the handler on the provided mux.
+// A panic in any of them is answered with 500 Internal Server Error, and
+// every response carries the request ID.
 func (h *Handler) RegisterRoutesOn(mux *http.ServeMux) {
-	mux.HandleFunc("/get", h.getIpListHandler)
+	mux.HandleFunc("/get", h.instrumented(h.counted(h.getIpListHandler)))
+	mux.HandleFunc("/provenance", h.instrumented(h.counted(h.provenanceHandler)))
+	mux.HandleFunc("/asns", h.instrumented(h.counted(h.asnsHandler)))
+	mux.HandleFunc("/manifest", h.instrumented(h.counted(h.manifestHandler)))
+	mux.HandleFunc("/count", h.instrumented(h.counted(h.countHandler)))
+	mux.HandleFunc("/compare", h.instrumented(h.counted(h.compareHandler)))
+	mux.HandleFunc("/lookup", h.instrumented(h.counted(h.lookupHandler)))
+	mux.HandleFunc("/export", h.instrumented(h.counted(h.exportHandler)))
+	mux.HandleFunc("/livez", h.instrumented(h.livezHandler))
+	mux.HandleFunc("/readyz", h.instrumented(h.readyzHandler))
+	mux.HandleFunc("/healthz/upstream", h.instrumented(h.upstreamHandler))
+	mux.HandleFunc("/openapi.json", h.instrumented(h.openapiHandler))
+	endpoints := []string{"/get", "/provenance", "/asns", "/manifest", "/count", "/compare", "/lookup", "/export", "/livez", "/readyz", "/healthz/upstream", "/openapi.json"}
+
+	// Without a dedicated admin port, management endpoints share the public mux
+	if h.config.AdminPort == "" {
+		h.RegisterAdminRoutesOn(mux)
+		endpoints = append(endpoints, h.adminEndpoints()...)
+	}
+
+	mux.Handle("GET /{$}", h.instrumented(h.indexHandler(endpoints)))
+}
+
+// counted wraps a data endpoint so its requests are included in Requests
+func (h *Handler) counted(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		h.requests.Add(1)
+		next(w, r)
+	}
+}
+
+// Requests returns the number of requests received by the data endpoints
+// (/get, /provenance, /asns, /manifest, /count, /compare, /lookup and
+// /export) since startup.
+// Probes, the index and management endpoints are not counted.
+func (h *Handler) Requests() uint64 {
+	return h.requests.Load()
+}
+
+// RegisterAdminRoutesOn registers the management routes for the handler on the provided mux.
+func (h *Handler) RegisterAdminRoutesOn(mux *http.ServeMux) {
+	mux.HandleFunc("/stats", h.instrumented(h.statsHandler))
+	mux.HandleFunc("/maintenance", h.instrumented(h.maintenanceHandler))
+	mux.HandleFunc("/config", h.instrumented(h.configHandler))
+	if h.config.EnablePprof {
+		registerPprof(mux)
+	}
+}
+
+// adminEndpoints lists the management paths registered by RegisterAdminRoutesOn
+func (h *Handler) adminEndpoints() []string {
+	endpoints := []string{"/stats", "/maintenance", "/config"}
+	if h.config.EnablePprof {
+		endpoints = append(endpoints, "/debug/pprof/")
+	}
+	return endpoints
+}
+
+// registerPprof registers the runtime profiling handlers under /debug/pprof/
+func registerPprof(mux *http.ServeMux) {
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
 }
 
 // getIpListHandler handles requests to get IP list for a country
 func (h *Handler) getIpListHandler(w http.ResponseWriter, r *http.Request) {
 	// Validate request method
-	if r.Method != http.MethodGet {
+	switch r.Method {
+	case http.MethodGet, http.MethodHead:
+	case http.MethodOptions:
+		w.Header().Set("Allow", getAllowedMethods)
+		w.WriteHeader(http.StatusNoContent)
+		return
+	default:
+		w.Header().Set("Allow", getAllowedMethods)
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
 
+	if !h.rejectBody(w, r) {
+		return
+	}
+
+	if h.maintenance.Load() {
+		writeMaintenance(w)
+		return
+	}
+
+	// Listed countries are served without a token
+	if !h.isPublicRequest(r) && !h.requireAuth(w, r) {
+		return
+	}
+
+	if !h.checkQueryParams(w, r, getQueryParams) {
+		return
+	}
+
 	// Get query parameters
-	country := r.URL.Query().Get("country")
-	auth := r.URL.Query().Get("auth")
+	formatName := r.URL.Query().Get("format")
+	sepName := r.URL.Query().Get("sep")
+	downloadParam := r.URL.Query().Get("download")
+	trailingParam := r.URL.Query().Get("trailing_newline")
+	maxAgeParam := r.URL.Query().Get("max_age")
+	groupBy := r.URL.Query().Get("groupby")
+	aclAction := r.URL.Query().Get("acl_action")
+	aclDirection := r.URL.Query().Get("acl_direction")
+	listName := r.URL.Query().Get("list")
+	withinParam := r.URL.Query().Get("within")
+	ipv6AggregateParam := r.URL.Query().Get("ipv6_aggregate")
+	dateParam := r.URL.Query().Get("date")
+	statusParam := r.URL.Query().Get("status")
+	sortParam := r.URL.Query().Get("sort")
 
 	// Validate parameters
-	if country == "" {
-		http.Error(w, "Missing country parameter", http.StatusBadRequest)
+	countries, ok := h.countriesParam(w, r)
+	if !ok {
+		return
+	}
+
+	if formatName == "" {
+		formatName = "cidr"
+	}
+	format, ok := outputFormats[formatName]
+	if !ok {
+		http.Error(w, "Invalid format parameter", http.StatusBadRequest)
+		return
+	}
+	if h.formats != nil && !h.formats[formatName] {
+		http.Error(w, "Invalid format parameter, "+formatName+" is not enabled", http.StatusBadRequest)
+		return
+	}
+
+	// ACL entries are only emitted by the cisco format
+	if (aclAction != "" || aclDirection != "") && formatName != "cisco" {
+		http.Error(w, "Invalid format parameter for acl_action or acl_direction", http.StatusBadRequest)
+		return
+	}
+	if formatName == "cisco" {
+		if aclAction == "" {
+			aclAction = aclActions[0]
+		}
+		if !slices.Contains(aclActions, aclAction) {
+			http.Error(w, "Invalid acl_action parameter", http.StatusBadRequest)
+			return
+		}
+		if aclDirection == "" {
+			aclDirection = aclDirections[0]
+		}
+		if !slices.Contains(aclDirections, aclDirection) {
+			http.Error(w, "Invalid acl_direction parameter", http.StatusBadRequest)
+			return
+		}
+		format.render = ciscoACLRenderer(aclAction, aclDirection)
+	}
+
+	// Address-list names are only emitted by the mikrotik format
+	if listName != "" {
+		if formatName != "mikrotik" {
+			http.Error(w, "Invalid format parameter for list", http.StatusBadRequest)
+			return
+		}
+		if !validListName(listName) {
+			http.Error(w, "Invalid list parameter", http.StatusBadRequest)
+			return
+		}
+		format.render = mikrotikRenderer(listName)
+	}
+
+	if sepName == "" {
+		sepName = "lf"
+	}
+	sep, ok := separators[sepName]
+	if !ok || (format.lineBased && sep.value != "\n") {
+		http.Error(w, "Invalid sep parameter", http.StatusBadRequest)
+		return
+	}
+
+	if trailingParam != "" {
+		trailing, err := strconv.ParseBool(trailingParam)
+		if err != nil {
+			http.Error(w, "Invalid trailing_newline parameter", http.StatusBadRequest)
+			return
+		}
+		sep.trailing = sep.trailing && trailing
+	}
+
+	download := false
+	if downloadParam != "" {
+		var err error
+		download, err = strconv.ParseBool(downloadParam)
+		if err != nil {
+			http.Error(w, "Invalid download parameter", http.StatusBadRequest)
+			return
+		}
+	}
+
+	var maxAge time.Duration
+	if maxAgeParam != "" {
+		var err error
+		maxAge, err = time.ParseDuration(maxAgeParam)
+		if err != nil || maxAge <= 0 {
+			http.Error(w, "Invalid max_age parameter", http.StatusBadRequest)
+			return
+		}
+	}
+
+	var within netip.Prefix
+	if withinParam != "" {
+		var ok bool
+		within, ok = parseWithin(withinParam)
+		if !ok {
+			http.Error(w, "Invalid within parameter", http.StatusBadRequest)
+			return
+		}
+	}
+
+	ipv6Aggregate := 0
+	if ipv6AggregateParam != "" {
+		var err error
+		ipv6Aggregate, err = strconv.Atoi(ipv6AggregateParam)
+		if err != nil || !slices.Contains(ipv6AggregateLevels, ipv6Aggregate) {
+			http.Error(w, "Invalid ipv6_aggregate parameter", http.StatusBadRequest)
+			return
+		}
+		// The other formats only know how to render IPv4 blocks
+		if formatName != "cidr" && formatName != "ndjson" && formatName != "csv" {
+			http.Error(w, "Invalid format parameter for ipv6_aggregate", http.StatusBadRequest)
+			return
+		}
+		if groupBy != "" {
+			http.Error(w, "Invalid groupby parameter for ipv6_aggregate", http.StatusBadRequest)
+			return
+		}
+	}
+
+	if sortParam != "" && !slices.Contains(sortOrders, sortParam) {
+		http.Error(w, "Invalid sort parameter", http.StatusBadRequest)
+		return
+	}
+	bySize := sortParam == "size"
+
+	// Grouped responses are JSON, so they only carry plain CIDR blocks
+	if groupBy != "" && groupBy != "registry" {
+		http.Error(w, "Invalid groupby parameter", http.StatusBadRequest)
+		return
+	}
+	if groupBy != "" && formatName != "cidr" {
+		http.Error(w, "Invalid format parameter for groupby", http.StatusBadRequest)
+		return
+	}
+
+	// Archived days only provide the IPv4 blocks of each country
+	var date time.Time
+	if dateParam != "" {
+		if h.config.ArchiveURL == "" {
+			http.Error(w, "Invalid date parameter, archived data is not enabled", http.StatusBadRequest)
+			return
+		}
+		var err error
+		date, err = time.Parse(ipdata.ArchiveDateLayout, dateParam)
+		if err != nil || date.Before(ipdata.ArchiveFirstDate) || date.After(time.Now()) {
+			http.Error(w, "Invalid date parameter", http.StatusBadRequest)
+			return
+		}
+		if groupBy != "" || ipv6Aggregate != 0 || maxAge > 0 {
+			http.Error(w, "Invalid date parameter for groupby, ipv6_aggregate or max_age", http.StatusBadRequest)
+			return
+		}
+	}
+
+	// Only the latest IPv4 blocks are grouped by status
+	var statuses []string
+	if statusParam != "" {
+		statuses, ok = parseStatuses(statusParam)
+		if !ok {
+			http.Error(w, "Invalid status parameter", http.StatusBadRequest)
+			return
+		}
+		if statuses != nil && (groupBy != "" || ipv6Aggregate != 0 || !date.IsZero()) {
+			http.Error(w, "Invalid status parameter for groupby, ipv6_aggregate or date", http.StatusBadRequest)
+			return
+		}
+	}
+
+	// Refresh synchronously if the client demands fresher data than is cached
+	if maxAge > 0 {
+		if err := h.processor.RefreshIfOlderThan(maxAge); err != nil {
+			http.Error(w, "Error refreshing data: "+err.Error(), http.StatusServiceUnavailable)
+			return
+		}
+	}
+
+	if groupBy != "" {
+		h.writeRegistryGroups(w, r, countries, within, bySize, download)
 		return
 	}
 
-	// Only check authentication if an AuthToken is configured
-	if h.config.AuthToken != "" && (auth == "" || auth != h.config.AuthToken) {
-		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+	// Process the request. Countries that fail are left out as long as others
+	// succeed, except for transformations: the complement of a partial union
+	// would cover the missing countries' blocks.
+	groups := make([]countryBlocks, 0, len(countries))
+	var unresolved []string
+	var firstErr error
+	for _, country := range countries {
+		var ipList []string
+		var err error
+		if statuses != nil {
+			ipList, err = h.blocksByStatus(country, statuses)
+		} else {
+			ipList, err = h.blocksForCountry(country, date, ipv6Aggregate)
+		}
+		if err != nil {
+			unresolved = append(unresolved, country)
+			firstErr = cmp.Or(firstErr, err)
+			continue
+		}
+		groups = append(groups, countryBlocks{country: country, cidrs: ipList})
+	}
+	if firstErr != nil && (len(groups) == 0 || format.transform != nil) {
+		writeProcessingError(w, firstErr)
 		return
 	}
+	logUnresolved(r, unresolved, firstErr)
+
+	// Responses with the default options may have been rendered after the
+	// last refresh already. The ACL options have their defaults filled in by now.
+	var body []byte
+	precomputed := false
+	defaultACL := formatName != "cisco" || aclAction == aclActions[0] && aclDirection == aclDirections[0]
+	if len(countries) == 1 && sep == separators["lf"] && defaultACL &&
+		listName == "" && !within.IsValid() && ipv6Aggregate == 0 && date.IsZero() && statuses == nil && !bySize {
+		body, precomputed = h.precomputed(countries[0], formatName)
+	}
+
+	if !precomputed {
+		if format.transform != nil {
+			// Transformations are expensive, skip them if nobody is waiting
+			if clientGone(r) {
+				return
+			}
+			// The transformation applies to the union of the countries' blocks
+			var union []string
+			for _, group := range groups {
+				union = append(union, group.cidrs...)
+			}
+			groups = []countryBlocks{{country: strings.Join(countries, ","), cidrs: format.transform(union)}}
+		}
+		if within.IsValid() {
+			for i := range groups {
+				groups[i].cidrs = filterWithin(groups[i].cidrs, within)
+			}
+		}
+		if bySize {
+			for i := range groups {
+				groups[i].cidrs = sortBySize(groups[i].cidrs)
+			}
+		}
+
+		// Render the response to write it in a single call
+		var err error
+		body, err = renderGroupsContext(r.Context(), groups, format, sep)
+		if err != nil {
+			logCanceled(r, err)
+			return
+		}
+	}
 
-	// Process the request
+	// Set content type
+	w.Header().Set("Content-Type", format.contentType)
+	if date.IsZero() {
+		h.setDataHeaders(w)
+	} else {
+		w.Header().Set("X-Data-Date", dateParam)
+	}
+	setUnresolvedHeader(w, unresolved)
+	if download {
+		w.Header().Set("Content-Disposition", attachmentDisposition(strings.Join(countries, "_"), format.extension))
+	}
+
+	h.serveCacheable(w, r, body)
+}
+
+// blocksForCountry returns the country's CIDR blocks for /get, followed by its
+// IPv6 prefixes rolled up to ipv6Aggregate bits if that is not 0. A non-zero
+// date selects the archived blocks of that day.
+func (h *Handler) blocksForCountry(country string, date time.Time, ipv6Aggregate int) ([]string, error) {
+	if !date.IsZero() {
+		return h.processor.GetIPListForCountryOn(country, date)
+	}
 	ipList, err := h.processor.GetIPListForCountry(country)
+	if err != nil || ipv6Aggregate == 0 {
+		return ipList, err
+	}
+	ipv6List, err := h.processor.GetIPv6ListForCountry(country)
 	if err != nil {
-		http.Error(w, "Error processing request: "+err.Error(), http.StatusInternalServerError)
+		return nil, err
+	}
+	return slices.Concat(ipList, ipdata.AggregateIPv6Prefixes(ipv6List, ipv6Aggregate)), nil
+}
+
+// logUnresolved logs the countries left out of a partial /get response
+func logUnresolved(r *http.Request, unresolved []string, err error) {
+	if len(unresolved) > 0 {
+		logRequestf(r, "Serving a partial response without %s: %v\n", strings.Join(unresolved, ","), err)
+	}
+}
+
+// setUnresolvedHeader lists the countries left out of a partial /get response
+func setUnresolvedHeader(w http.ResponseWriter, unresolved []string) {
+	if len(unresolved) > 0 {
+		w.Header().Set("X-Unresolved-Countries", strings.Join(unresolved, ","))
+	}
+}
+
+// writeRegistryGroups writes the countries' CIDR blocks grouped by source
+// registry as JSON, each group ordered largest block first with bySize.
+// Countries that fail are left out as long as others succeed and listed
+// under a "warnings" key.
+func (h *Handler) writeRegistryGroups(w http.ResponseWriter, r *http.Request, countries []string, within netip.Prefix, bySize, download bool) {
+	groups := make(map[string][]string)
+	var unresolved []string
+	var firstErr error
+	for _, country := range countries {
+		registries, err := h.processor.GetIPListByRegistry(country)
+		if err != nil {
+			unresolved = append(unresolved, country)
+			firstErr = cmp.Or(firstErr, err)
+			continue
+		}
+		for registry, cidrs := range registries {
+			if within.IsValid() {
+				cidrs = filterWithin(cidrs, within)
+			}
+			groups[registry] = append(groups[registry], cidrs...)
+		}
+	}
+	if bySize {
+		for registry, cidrs := range groups {
+			groups[registry] = sortBySize(cidrs)
+		}
+	}
+	if len(unresolved) == len(countries) {
+		writeProcessingError(w, firstErr)
+		return
+	}
+	logUnresolved(r, unresolved, firstErr)
+	if len(unresolved) > 0 {
+		groups["warnings"] = unresolved
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	h.setDataHeaders(w)
+	setUnresolvedHeader(w, unresolved)
+	if download {
+		w.Header().Set("Content-Disposition", attachmentDisposition(strings.Join(countries, "_"), "json"))
+	}
+	body, _ := json.Marshal(groups)
+	h.serveCacheable(w, r, append(body, '\n'))
+}
+
+// variantQueryParams lists the /get query parameters that select which
+// representation is served, advertised in the Vary header
+var variantQueryParams = []string{"format", "sep", "trailing_newline", "groupby", "acl_action", "acl_direction", "list", "within", "ipv6_aggregate", "date", "status", "sort"}
+
+// serveCacheable writes a /get response body with HTTP caching headers and
+// answers conditional requests. The ETag is derived from the body, so every
+// variant gets its own validator, and Vary names the query parameters that
+// select the variant. Responses must be revalidated before reuse and are only
+// cacheable by shared caches when no auth token is configured.
+func (h *Handler) serveCacheable(w http.ResponseWriter, r *http.Request, body []byte) {
+	sum := sha256.Sum256(body)
+	w.Header().Set("ETag", `"`+hex.EncodeToString(sum[:16])+`"`)
+	w.Header().Set("Vary", strings.Join(variantQueryParams, ", "))
+	if h.config.AuthToken != "" {
+		w.Header().Set("Cache-Control", "private, no-cache")
+	} else {
+		w.Header().Set("Cache-Control", "public, no-cache")
+	}
+
+	// ServeContent sets Last-Modified from the data time and handles
+	// If-None-Match, If-Modified-Since, Range and HEAD requests
+	http.ServeContent(w, r, "", h.processor.DataTime(), bytes.NewReader(body))
+}
+
+// setDataHeaders describes the source and age of the served data in response headers
+func (h *Handler) setDataHeaders(w http.ResponseWriter) {
+	if source := h.processor.DataSource(); source != "" {
+		w.Header().Set("X-Data-Source", source)
+	}
+	if generated := h.processor.DataTime(); !generated.IsZero() {
+		w.Header().Set("X-Data-Generated", generated.UTC().Format(time.RFC3339))
+		w.Header().Set("X-Data-Age-Seconds", strconv.Itoa(int(time.Since(generated).Seconds())))
+	}
+}
+
+// renderList renders the country's CIDR blocks in the output format, delimited by sep
+func renderList(country string, ipList []string, format outputFormat, sep separator) []byte {
+	buf, _ := renderListContext(context.Background(), country, ipList, format, sep)
+	return buf
+}
+
+// renderListContext is like renderList but gives up with the context's error
+// once ctx is done, checking every cancelCheckInterval entries
+func renderListContext(ctx context.Context, country string, ipList []string, format outputFormat, sep separator) ([]byte, error) {
+	return renderGroupsContext(ctx, []countryBlocks{{country: country, cidrs: ipList}}, format, sep)
+}
+
+// renderGroupsContext renders the CIDR blocks of several countries as one list,
+// each entry rendered under its own country. It checks the context every
+// cancelCheckInterval entries and gives up with its error once it is done.
+func renderGroupsContext(ctx context.Context, groups []countryBlocks, format outputFormat, sep separator) ([]byte, error) {
+	total := 0
+	for _, group := range groups {
+		total += len(group.cidrs)
+	}
+
+	buf := make([]byte, 0, len(format.header)+total*(renderedEntrySizeHint+len(sep.value)))
+	if format.header != "" {
+		buf = append(buf, format.header...)
+		if sep.trailing || total > 0 {
+			buf = append(buf, sep.value...)
+		}
+	}
+	i := 0
+	for _, group := range groups {
+		for _, ip := range group.cidrs {
+			if i%cancelCheckInterval == 0 {
+				if err := ctx.Err(); err != nil {
+					return nil, err
+				}
+			}
+			if i > 0 && !sep.trailing {
+				buf = append(buf, sep.value...)
+			}
+			buf = append(buf, format.render(group.country, ip)...)
+			if sep.trailing {
+				buf = append(buf, sep.value...)
+			}
+			i++
+		}
+	}
+	return buf, nil
+}
+
+// clientGone reports whether the client has canceled the request, logging the
+// cancellation so the handler can stop working on a response nobody will read
+func clientGone(r *http.Request) bool {
+	if err := r.Context().Err(); err != nil {
+		logCanceled(r, err)
+		return true
+	}
+	return false
+}
+
+// logCanceled logs that a request was abandoned because its context is done
+func logCanceled(r *http.Request, err error) {
+	logRequestf(r, "Client went away, aborting %s %s: %v\n", r.Method, r.URL.Path, err)
+}
+
+// rejectBody reads the request body, which GET and HEAD requests must not
+// carry, up to MaxBodyBytes. A longer body makes the server close the
+// connection rather than read the rest of it for keep-alive. It returns false
+// if a response has been written.
+func (h *Handler) rejectBody(w http.ResponseWriter, r *http.Request) bool {
+	if r.Body == nil {
+		return true
+	}
+	n, err := io.Copy(io.Discard, http.MaxBytesReader(w, r.Body, h.config.MaxBodyBytes))
+	if n == 0 && err == nil {
+		return true
+	}
+	http.Error(w, "Request body not allowed", http.StatusBadRequest)
+	return false
+}
+
+// countryParam reads and validates the country query parameter and resolves
+// aliases to the canonical code. It returns false if a response has been written.
+func (h *Handler) countryParam(w http.ResponseWriter, r *http.Request) (string, bool) {
+	country, ok := h.singleCountryParam(w, r, "country")
+	if !ok {
+		return "", false
+	}
+	return h.resolveCountryAlias(w, country), true
+}
+
+// singleCountryParam reads and normalizes the single country code in the named
+// query parameter, without resolving aliases. It returns false if a response
+// has been written.
+func (h *Handler) singleCountryParam(w http.ResponseWriter, r *http.Request, name string) (string, bool) {
+	value := r.URL.Query().Get(name)
+	country := normalizeCountry(value)
+	if country == "" {
+		http.Error(w, "Missing "+name+" parameter", http.StatusBadRequest)
+		return "", false
+	}
+	if country == "*" {
+		http.Error(w, "Invalid "+name+" parameter", http.StatusBadRequest)
+		return "", false
+	}
+	if !h.exactCase(w, name, value) {
+		return "", false
+	}
+	return country, true
+}
+
+// exactCase rejects country codes that are not sent as exactly two uppercase
+// letters when strict country case is enabled. It returns false if a response
+// has been written.
+func (h *Handler) exactCase(w http.ResponseWriter, name, country string) bool {
+	if !h.config.StrictCountryCase || isUpperAlpha2(country) {
+		return true
+	}
+	http.Error(w, "Invalid "+name+" parameter, expected an uppercase ISO 3166-1 alpha-2 code", http.StatusBadRequest)
+	return false
+}
+
+// isUpperAlpha2 reports whether s consists of exactly two letters A-Z
+func isUpperAlpha2(s string) bool {
+	return len(s) == 2 && 'A' <= s[0] && s[0] <= 'Z' && 'A' <= s[1] && s[1] <= 'Z'
+}
+
+// normalizeCountry trims surrounding whitespace from the country parameter and uppercases it
+func normalizeCountry(country string) string {
+	return strings.ToUpper(strings.TrimSpace(country))
+}
+
+// attachmentDisposition returns a Content-Disposition header value that makes
+// browsers save the response as a file named after the country and format
+func attachmentDisposition(country, extension string) string {
+	filename := strings.ToUpper(country) + "." + extension
+	return mime.FormatMediaType("attachment", map[string]string{"filename": filename})
+}
+
+// provenanceResponse is the JSON body returned by the provenance endpoint
+type provenanceResponse struct {
+	Country    string         `json:"country"`
+	Registries map[string]int `json:"registries"`
+}
+
+// provenanceHandler handles requests for the per-registry block counts of a country
+func (h *Handler) provenanceHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if !h.requireAuth(w, r) {
+		return
+	}
+
+	if !h.checkQueryParams(w, r, provenanceQueryParams) {
+		return
+	}
+
+	country, ok := h.countryParam(w, r)
+	if !ok {
+		return
+	}
+
+	registries, err := h.processor.GetProvenanceForCountry(country)
+	if err != nil {
+		writeProcessingError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(provenanceResponse{
+		Country:    country,
+		Registries: registries,
+	})
+}
+
+// asnsHandler handles requests for the AS numbers allocated to a country
+func (h *Handler) asnsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if !h.requireAuth(w, r) {
+		return
+	}
+
+	if !h.checkQueryParams(w, r, asnsQueryParams) {
+		return
+	}
+
+	country, ok := h.countryParam(w, r)
+	if !ok {
+		return
+	}
+
+	asns, err := h.processor.GetASNsForCountry(country)
+	if err != nil {
+		writeProcessingError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/plain")
+	var buf []byte
+	for _, asn := range asns {
+		buf = strconv.AppendUint(buf, uint64(asn), 10)
+		buf = append(buf, '\n')
+	}
+	w.Write(buf)
+}
+
+// indexResponse is the JSON body returned by the root index
+type indexResponse struct {
+	Service   string   `json:"service"`
+	Version   string   `json:"version"`
+	Endpoints []string `json:"endpoints"`
+}
+
+// indexHandler describes the service and the endpoints registered alongside it.
+// It requires no authentication so uptime checks can confirm the right service answers.
+func (h *Handler) indexHandler(endpoints []string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(indexResponse{
+			Service:   serviceName,
+			Version:   version.GetVersion(),
+			Endpoints: endpoints,
+		})
+	}
+}
+
+// statsHandler reports a summary of the cached IP data, including the number of
+// source lines skipped while parsing it. It never triggers a download.
+func (h *Handler) statsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if !h.checkQueryParams(w, r, statsQueryParams) {
+		return
+	}
+
+	resp := statsResponse{Stats: h.processor.Stats()}
+	if param := r.URL.Query().Get("diagnostics"); param != "" {
+		diagnostics, err := strconv.ParseBool(param)
+		if err != nil {
+			http.Error(w, "Invalid diagnostics parameter", http.StatusBadRequest)
+			return
+		}
+		if diagnostics {
+			d := h.processor.Diagnostics()
+			resp.Diagnostics = &d
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// statsResponse is the body of /stats: the data summary, with the parse
+// diagnostics when requested
+type statsResponse struct {
+	ipdata.Stats
+	Diagnostics *ipdata.ParseDiagnostics `json:"diagnostics,omitempty"`
+}
+
+// livezHandler reports that the process is alive. It never touches the IP data.
+func (h *Handler) livezHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain")
+	w.Write([]byte("ok\n"))
+}
+
+// readyzHandler reports whether the service has IP data loaded and is ready to serve
+func (h *Handler) readyzHandler(w http.ResponseWriter, r *http.Request) {
+	if !h.processor.Ready() {
+		http.Error(w, "not ready", http.StatusServiceUnavailable)
 		return
 	}
 
-	// Set content type
 	w.Header().Set("Content-Type", "text/plain")
+	w.Write([]byte("ready\n"))
+}
+
+// checkQueryParams rejects requests with unrecognized query parameters when
+// strict query mode is enabled. It returns false if a response has been written.
+func (h *Handler) checkQueryParams(w http.ResponseWriter, r *http.Request, allowed []string) bool {
+	if !h.config.StrictQuery {
+		return true
+	}
+
+	var unknown []string
+	for key := range r.URL.Query() {
+		if !slices.Contains(allowed, key) {
+			unknown = append(unknown, key)
+		}
+	}
+	if len(unknown) == 0 {
+		return true
+	}
+
+	slices.Sort(unknown)
+	http.Error(w, "Unknown query parameters: "+strings.Join(unknown, ", "), http.StatusBadRequest)
+	return false
+}
+
+// requireAuth rejects requests without a valid token. Handlers call it before
+// validating any other query parameter, so unauthenticated clients get the same
+// 401 response whether or not their parameters (e.g. country) are valid. It
+// returns false if a response has been written.
+func (h *Handler) requireAuth(w http.ResponseWriter, r *http.Request) bool {
+	if h.authorized(r.URL.Query().Get("auth")) {
+		return true
+	}
+	http.Error(w, "Unauthorized", http.StatusUnauthorized)
+	return false
+}
+
+// authorized reports whether the provided token grants access.
+// Authentication is only checked if an AuthToken is configured.
+func (h *Handler) authorized(auth string) bool {
+	return h.config.AuthToken == "" || auth == h.config.AuthToken
+}
+
+// coldStartRetryAfter is the Retry-After value, in seconds, sent to requests
+// that gave up waiting for the first download
+const coldStartRetryAfter = "5"
+
+// writeProcessingError answers a request whose processor call failed with err.
+// Requests that gave up waiting for the first download are told when to retry.
+// The body names only the kind of failure: the full error can carry upstream
+// URLs and details that are for the logs, not for clients.
+func writeProcessingError(w http.ResponseWriter, err error) {
+	if errors.Is(err, ipdata.ErrColdStart) {
+		w.Header().Set("Retry-After", coldStartRetryAfter)
+	}
+	http.Error(w, "Error processing request: "+clientErrorMessage(err), statusForError(err))
+}
+
+// clientErrorMessage returns the message of the most specific known processor
+// error in err, or a generic one for anything else
+func clientErrorMessage(err error) string {
+	var statusErr *ipdata.UpstreamStatusError
+	if errors.As(err, &statusErr) {
+		return statusErr.Error()
+	}
+	for _, known := range []error{
+		ipdata.ErrColdStart,
+		ipdata.ErrNotReady,
+		ipdata.ErrDownloadTooLarge,
+		ipdata.ErrBadUpstreamData,
+		ipdata.ErrArchiveDisabled,
+		ipdata.ErrNoArchive,
+		ipdata.ErrDownloadFailed,
+	} {
+		if errors.Is(err, known) {
+			return known.Error()
+		}
+	}
+	return "internal error"
+}
 
-	// Write the response
-	for _, ip := range ipList {
-		w.Write([]byte(ip + "\n"))
+// statusForError maps processor errors to HTTP status codes
+func statusForError(err error) int {
+	var statusErr *ipdata.UpstreamStatusError
+	switch {
+	case errors.As(err, &statusErr) && statusErr.StatusCode >= http.StatusInternalServerError:
+		return http.StatusServiceUnavailable
+	case errors.Is(err, ipdata.ErrBadUpstreamData), errors.As(err, &statusErr):
+		return http.StatusBadGateway
+	case errors.Is(err, ipdata.ErrNoArchive):
+		return http.StatusNotFound
+	case errors.Is(err, ipdata.ErrDownloadFailed), errors.Is(err, ipdata.ErrNotReady):
+		return http.StatusServiceUnavailable
+	default:
+		return http.StatusInternalServerError
 	}
 }
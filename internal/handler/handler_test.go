@@ -1,28 +1,228 @@
 package handler
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
 	"errors"
+	"fmt"
+	"io"
+	"net"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"slices"
+	"strconv"
 	"testing"
+	"time"
 
 	"github.com/anisimovdk/ip-whitelist-by-country/internal/config"
+	"github.com/anisimovdk/ip-whitelist-by-country/internal/ipdata"
+	"github.com/anisimovdk/ip-whitelist-by-country/internal/version"
 )
 
 // MockProcessor is a mock implementation of the processor interface for testing
 type MockProcessor struct {
-	ipLists map[string][]string
-	err     error
+	countries  []string
+	ipLists    map[string][]string
+	ipv6Lists  map[string][]string
+	snapshots  map[string]map[string][]string // date (YYYYMMDD) -> country code -> CIDR blocks
+	provenance map[string]map[string]int
+	registries map[string]map[string][]string
+	statuses   map[string]map[string][]string
+	asns       map[string][]uint32
+	counts     map[string]ipdata.AllocationCount
+	lookups    map[string]string
+	ready      bool
+	source     string
+	dataTime   time.Time
+	refreshErr error
+	refreshes  int
+	stats      ipdata.Stats
+	diagnosed  ipdata.ParseDiagnostics
+	upstream   ipdata.UpstreamStatus
+	calls      int
+	err        error
 }
 
+// The mocks must keep up with the interfaces the handler consumes
+var (
+	_ ipdata.IPProcessor = (*MockProcessor)(nil)
+	_ CountryLister      = (*MockProcessor)(nil)
+	_ CountryLister      = listErrorProcessor{}
+	_ refreshNotifier    = (*notifyingProcessor)(nil)
+)
+
 // GetIPListForCountry is a mock implementation that returns test data
 func (m *MockProcessor) GetIPListForCountry(countryCode string) ([]string, error) {
+	m.calls++
 	if m.err != nil {
 		return nil, m.err
 	}
 	return m.ipLists[countryCode], nil
 }
 
+// GetIPListSnapshot is a mock implementation that returns test data with the test source and time
+func (m *MockProcessor) GetIPListSnapshot(countryCode string) (ipdata.ListSnapshot, error) {
+	m.calls++
+	if m.err != nil {
+		return ipdata.ListSnapshot{}, m.err
+	}
+	return ipdata.ListSnapshot{CIDRs: m.ipLists[countryCode], DataSource: m.source, DataTime: m.dataTime}, nil
+}
+
+// GetIPListForCountryOn is a mock implementation that returns the test data of the day
+func (m *MockProcessor) GetIPListForCountryOn(countryCode string, date time.Time) ([]string, error) {
+	m.calls++
+	if m.err != nil {
+		return nil, m.err
+	}
+	snapshot, ok := m.snapshots[date.Format(ipdata.ArchiveDateLayout)]
+	if !ok {
+		return nil, ipdata.ErrNoArchive
+	}
+	return snapshot[countryCode], nil
+}
+
+// GetAllCountries is a mock implementation that returns a copy of all test data
+func (m *MockProcessor) GetAllCountries() (map[string][]string, error) {
+	m.calls++
+	if m.err != nil {
+		return nil, m.err
+	}
+	all := make(map[string][]string, len(m.ipLists))
+	for country, ipList := range m.ipLists {
+		all[country] = slices.Clone(ipList)
+	}
+	return all, nil
+}
+
+// GetProvenanceForCountry is a mock implementation that returns test registry counts
+func (m *MockProcessor) GetProvenanceForCountry(countryCode string) (map[string]int, error) {
+	if m.err != nil {
+		return nil, m.err
+	}
+	return m.provenance[countryCode], nil
+}
+
+// GetIPListByRegistry is a mock implementation that returns test registry groups
+func (m *MockProcessor) GetIPListByRegistry(countryCode string) (map[string][]string, error) {
+	m.calls++
+	if m.err != nil {
+		return nil, m.err
+	}
+	return m.registries[countryCode], nil
+}
+
+// GetIPListByStatus is a mock implementation that returns test status groups
+func (m *MockProcessor) GetIPListByStatus(countryCode string) (map[string][]string, error) {
+	m.calls++
+	if m.err != nil {
+		return nil, m.err
+	}
+	return m.statuses[countryCode], nil
+}
+
+// GetASNsForCountry is a mock implementation that returns test AS numbers
+func (m *MockProcessor) GetASNsForCountry(countryCode string) ([]uint32, error) {
+	m.calls++
+	if m.err != nil {
+		return nil, m.err
+	}
+	return m.asns[countryCode], nil
+}
+
+// GetCountForCountry is a mock implementation that returns test allocation counts
+func (m *MockProcessor) GetCountForCountry(countryCode string) (ipdata.AllocationCount, error) {
+	m.calls++
+	if m.err != nil {
+		return ipdata.AllocationCount{}, m.err
+	}
+	return m.counts[countryCode], nil
+}
+
+// LookupCountry is a mock implementation that returns the test country of an address
+func (m *MockProcessor) LookupCountry(ip net.IP) (string, bool, error) {
+	m.calls++
+	if m.err != nil {
+		return "", false, m.err
+	}
+	country, ok := m.lookups[ip.String()]
+	return country, ok, nil
+}
+
+// Ready is a mock implementation that returns the configured readiness
+func (m *MockProcessor) Ready() bool {
+	m.calls++
+	return m.ready
+}
+
+// Countries is a mock implementation that returns the configured country codes
+func (m *MockProcessor) Countries() ([]string, error) {
+	if m.err != nil {
+		return nil, m.err
+	}
+	return m.countries, nil
+}
+
+// DataSource is a mock implementation that returns the configured data source
+func (m *MockProcessor) DataSource() string {
+	return m.source
+}
+
+// RefreshIfOlderThan is a mock implementation that counts refreshes of data older than maxAge
+func (m *MockProcessor) RefreshIfOlderThan(maxAge time.Duration) error {
+	if time.Since(m.dataTime) < maxAge {
+		return nil
+	}
+	m.refreshes++
+	if m.refreshErr != nil {
+		return m.refreshErr
+	}
+	m.dataTime = time.Now()
+	return nil
+}
+
+// Stats is a mock implementation that returns the configured stats
+func (m *MockProcessor) Stats() ipdata.Stats {
+	return m.stats
+}
+
+// Diagnostics is a mock implementation that returns the configured diagnostics
+func (m *MockProcessor) Diagnostics() ipdata.ParseDiagnostics {
+	return m.diagnosed
+}
+
+// CheckUpstream is a mock implementation that returns the configured upstream status
+func (m *MockProcessor) CheckUpstream(ctx context.Context) ipdata.UpstreamStatus {
+	m.calls++
+	return m.upstream
+}
+
+// GetIPv6ListForCountry is a mock implementation that returns test IPv6 prefixes
+func (m *MockProcessor) GetIPv6ListForCountry(countryCode string) ([]string, error) {
+	m.calls++
+	if m.err != nil {
+		return nil, m.err
+	}
+	return m.ipv6Lists[countryCode], nil
+}
+
+// Export is a mock implementation that returns the test data as a dataset
+func (m *MockProcessor) Export() (ipdata.Export, error) {
+	m.calls++
+	if m.err != nil {
+		return ipdata.Export{}, m.err
+	}
+	return ipdata.Export{Generated: m.dataTime, Countries: m.ipLists, ASNs: m.asns}, nil
+}
+
+// DataTime is a mock implementation that returns the configured download time
+func (m *MockProcessor) DataTime() time.Time {
+	return m.dataTime
+}
+
 func TestNewHandler(t *testing.T) {
 	mockProc := &MockProcessor{}
 	cfg := &config.Config{
@@ -201,6 +401,45 @@ func TestGetIpListHandlerWithAuth(t *testing.T) {
 	}
 }
 
+func TestAuthCheckedBeforeParameters(t *testing.T) {
+	h := NewHandler(&MockProcessor{}, &config.Config{AuthToken: "test-token", StrictQuery: true})
+	mux := http.NewServeMux()
+	h.RegisterRoutesOn(mux)
+
+	// Unauthenticated requests must not learn whether their parameters are valid
+	testCases := []struct {
+		name string
+		url  string
+	}{
+		{name: "Get missing country", url: "/get"},
+		{name: "Get invalid country", url: "/get?country=*"},
+		{name: "Get invalid format", url: "/get?country=DE&format=bogus"},
+		{name: "Get unknown parameter", url: "/get?country=DE&bogus=1"},
+		{name: "Provenance missing country", url: "/provenance"},
+		{name: "ASNs missing country", url: "/asns"},
+		{name: "Manifest missing country", url: "/manifest"},
+		{name: "Count missing country", url: "/count"},
+		{name: "Compare missing countries", url: "/compare"},
+		{name: "Export", url: "/export"},
+		{name: "Lookup missing address", url: "/lookup"},
+		{name: "Lookup malformed address", url: "/lookup?ip=bogus&auth=wrong-token"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			mux.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, tc.url, nil))
+
+			if rr.Code != http.StatusUnauthorized {
+				t.Errorf("GET %s returned status %d, want %d", tc.url, rr.Code, http.StatusUnauthorized)
+			}
+			if rr.Body.String() != "Unauthorized\n" {
+				t.Errorf("GET %s returned body %q, want %q", tc.url, rr.Body.String(), "Unauthorized\n")
+			}
+		})
+	}
+}
+
 func TestGetIpListHandlerMissingCountry(t *testing.T) {
 	// Create a mock processor
 	mockProc := &MockProcessor{}
@@ -265,6 +504,52 @@ func TestGetIpListHandlerWrongMethod(t *testing.T) {
 		t.Errorf("handler returned wrong status code: got %v want %v",
 			status, http.StatusMethodNotAllowed)
 	}
+	if allow := rr.Header().Get("Allow"); allow != "GET, HEAD, OPTIONS" {
+		t.Errorf("handler returned wrong Allow header: got %q want %q", allow, "GET, HEAD, OPTIONS")
+	}
+}
+
+func TestGetIpListHandlerOptions(t *testing.T) {
+	mockProc := &MockProcessor{
+		ipLists: map[string][]string{"US": {"192.168.0.0/24"}},
+	}
+	h := NewHandler(mockProc, &config.Config{AuthToken: "secret"})
+
+	// OPTIONS needs neither a country nor auth
+	req := httptest.NewRequest(http.MethodOptions, "/get", nil)
+	rr := httptest.NewRecorder()
+	http.HandlerFunc(h.getIpListHandler).ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusNoContent {
+		t.Errorf("handler returned wrong status code: got %v want %v", rr.Code, http.StatusNoContent)
+	}
+	if allow := rr.Header().Get("Allow"); allow != "GET, HEAD, OPTIONS" {
+		t.Errorf("handler returned wrong Allow header: got %q want %q", allow, "GET, HEAD, OPTIONS")
+	}
+	if rr.Body.Len() != 0 {
+		t.Errorf("expected empty body, got %q", rr.Body.String())
+	}
+	if mockProc.calls != 0 {
+		t.Errorf("expected processor not to be called, got %d calls", mockProc.calls)
+	}
+}
+
+func TestGetIpListHandlerHead(t *testing.T) {
+	mockProc := &MockProcessor{
+		ipLists: map[string][]string{"US": {"192.168.0.0/24"}},
+	}
+	h := NewHandler(mockProc, &config.Config{})
+
+	req := httptest.NewRequest(http.MethodHead, "/get?country=US", nil)
+	rr := httptest.NewRecorder()
+	http.HandlerFunc(h.getIpListHandler).ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Errorf("handler returned wrong status code: got %v want %v", rr.Code, http.StatusOK)
+	}
+	if ct := rr.Header().Get("Content-Type"); ct != "text/plain" {
+		t.Errorf("handler returned wrong Content-Type: got %q want %q", ct, "text/plain")
+	}
 }
 
 func TestGetIpListHandlerProcessorError(t *testing.T) {
@@ -307,6 +592,101 @@ func TestGetIpListHandlerProcessorError(t *testing.T) {
 	}
 }
 
+func TestGetIpListHandlerErrorStatusMapping(t *testing.T) {
+	peerErr := &url.Error{Op: "Get", URL: "http://leader:8080/export?auth=s3cret", Err: errors.New("connection refused")}
+
+	testCases := []struct {
+		name               string
+		err                error
+		expectedStatus     int
+		expectedMessage    string
+		expectedRetryAfter string
+	}{
+		{
+			name:            "Download failed",
+			err:             fmt.Errorf("failed to download and process data: %w", ipdata.ErrDownloadFailed),
+			expectedStatus:  http.StatusServiceUnavailable,
+			expectedMessage: ipdata.ErrDownloadFailed.Error(),
+		},
+		{
+			name:            "Peer unreachable",
+			err:             fmt.Errorf("%w: failed to download data from peer: %w", ipdata.ErrDownloadFailed, peerErr),
+			expectedStatus:  http.StatusServiceUnavailable,
+			expectedMessage: ipdata.ErrDownloadFailed.Error(),
+		},
+		{
+			name:            "Bad upstream data",
+			err:             fmt.Errorf("failed to download and process data: %w", ipdata.ErrBadUpstreamData),
+			expectedStatus:  http.StatusBadGateway,
+			expectedMessage: ipdata.ErrBadUpstreamData.Error(),
+		},
+		{
+			name:            "Download too large",
+			err:             fmt.Errorf("failed to download and process data: %w", ipdata.ErrDownloadTooLarge),
+			expectedStatus:  http.StatusBadGateway,
+			expectedMessage: ipdata.ErrDownloadTooLarge.Error(),
+		},
+		{
+			name:            "Not ready",
+			err:             ipdata.ErrNotReady,
+			expectedStatus:  http.StatusServiceUnavailable,
+			expectedMessage: ipdata.ErrNotReady.Error(),
+		},
+		{
+			name:               "Cold start wait exceeded",
+			err:                ipdata.ErrColdStart,
+			expectedStatus:     http.StatusServiceUnavailable,
+			expectedMessage:    ipdata.ErrColdStart.Error(),
+			expectedRetryAfter: coldStartRetryAfter,
+		},
+		{
+			name:            "Archive disabled",
+			err:             ipdata.ErrArchiveDisabled,
+			expectedStatus:  http.StatusInternalServerError,
+			expectedMessage: ipdata.ErrArchiveDisabled.Error(),
+		},
+		{
+			name:            "Upstream 5xx",
+			err:             fmt.Errorf("wrapped: %w", &ipdata.UpstreamStatusError{StatusCode: http.StatusBadGateway}),
+			expectedStatus:  http.StatusServiceUnavailable,
+			expectedMessage: "received non-200 response: 502",
+		},
+		{
+			name:            "Upstream 4xx",
+			err:             fmt.Errorf("wrapped: %w", &ipdata.UpstreamStatusError{StatusCode: http.StatusNotFound}),
+			expectedStatus:  http.StatusBadGateway,
+			expectedMessage: "received non-200 response: 404",
+		},
+		{
+			name:            "Unknown error",
+			err:             errors.New("something else"),
+			expectedStatus:  http.StatusInternalServerError,
+			expectedMessage: "internal error",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			h := NewHandler(&MockProcessor{err: tc.err}, &config.Config{})
+
+			req := httptest.NewRequest(http.MethodGet, "/get?country=US", nil)
+			rr := httptest.NewRecorder()
+			http.HandlerFunc(h.getIpListHandler).ServeHTTP(rr, req)
+
+			if rr.Code != tc.expectedStatus {
+				t.Errorf("handler returned wrong status code: got %v want %v",
+					rr.Code, tc.expectedStatus)
+			}
+			if want := "Error processing request: " + tc.expectedMessage + "\n"; rr.Body.String() != want {
+				t.Errorf("handler returned unexpected body: got %q want %q", rr.Body.String(), want)
+			}
+			if got := rr.Header().Get("Retry-After"); got != tc.expectedRetryAfter {
+				t.Errorf("Retry-After = %q, want %q", got, tc.expectedRetryAfter)
+			}
+		})
+	}
+}
+
 func TestGetIpListHandlerEmptyResult(t *testing.T) {
 	// Create a mock processor that returns empty result for unknown country
 	mockProc := &MockProcessor{
@@ -389,3 +769,1126 @@ func TestGetIpListHandlerContentType(t *testing.T) {
 			contentType, "text/plain")
 	}
 }
+
+func TestGetIpListHandlerSeparator(t *testing.T) {
+	mockProc := &MockProcessor{
+		ipLists: map[string][]string{
+			"US": {"192.168.1.0/24", "10.0.0.0/8"},
+			"XX": {},
+		},
+	}
+	h := NewHandler(mockProc, &config.Config{})
+
+	testCases := []struct {
+		name           string
+		query          string
+		expectedStatus int
+		expectedBody   string
+	}{
+		{
+			name:           "Default is lf",
+			query:          "country=US",
+			expectedStatus: http.StatusOK,
+			expectedBody:   "192.168.1.0/24\n10.0.0.0/8\n",
+		},
+		{
+			name:           "lf",
+			query:          "country=US&sep=lf",
+			expectedStatus: http.StatusOK,
+			expectedBody:   "192.168.1.0/24\n10.0.0.0/8\n",
+		},
+		{
+			name:           "crlf",
+			query:          "country=US&sep=crlf",
+			expectedStatus: http.StatusOK,
+			expectedBody:   "192.168.1.0/24\r\n10.0.0.0/8\r\n",
+		},
+		{
+			name:           "comma",
+			query:          "country=US&sep=comma",
+			expectedStatus: http.StatusOK,
+			expectedBody:   "192.168.1.0/24,10.0.0.0/8",
+		},
+		{
+			name:           "space",
+			query:          "country=US&sep=space",
+			expectedStatus: http.StatusOK,
+			expectedBody:   "192.168.1.0/24 10.0.0.0/8",
+		},
+		{
+			name:           "Empty list with comma",
+			query:          "country=XX&sep=comma",
+			expectedStatus: http.StatusOK,
+			expectedBody:   "",
+		},
+		{
+			name:           "Invalid separator",
+			query:          "country=US&sep=tab",
+			expectedStatus: http.StatusBadRequest,
+			expectedBody:   "Invalid sep parameter\n",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/get?"+tc.query, nil)
+			rr := httptest.NewRecorder()
+			http.HandlerFunc(h.getIpListHandler).ServeHTTP(rr, req)
+
+			if rr.Code != tc.expectedStatus {
+				t.Errorf("handler returned wrong status code: got %v want %v",
+					rr.Code, tc.expectedStatus)
+			}
+			if rr.Body.String() != tc.expectedBody {
+				t.Errorf("handler returned unexpected body: got %q want %q",
+					rr.Body.String(), tc.expectedBody)
+			}
+		})
+	}
+}
+
+func TestProvenanceHandler(t *testing.T) {
+	mockProc := &MockProcessor{
+		provenance: map[string]map[string]int{
+			"US": {"arin": 3, "ripencc": 1},
+		},
+	}
+	h := NewHandler(mockProc, &config.Config{AuthToken: "test-token"})
+
+	testCases := []struct {
+		name           string
+		method         string
+		query          string
+		expectedStatus int
+		expectedBody   string
+	}{
+		{
+			name:           "Breakdown by registry",
+			method:         http.MethodGet,
+			query:          "country=US&auth=test-token",
+			expectedStatus: http.StatusOK,
+			expectedBody:   `{"country":"US","registries":{"arin":3,"ripencc":1}}` + "\n",
+		},
+		{
+			name:           "Missing country",
+			method:         http.MethodGet,
+			query:          "auth=test-token",
+			expectedStatus: http.StatusBadRequest,
+			expectedBody:   "Missing country parameter\n",
+		},
+		{
+			name:           "Unauthorized",
+			method:         http.MethodGet,
+			query:          "country=US&auth=wrong",
+			expectedStatus: http.StatusUnauthorized,
+			expectedBody:   "Unauthorized\n",
+		},
+		{
+			name:           "Wrong method",
+			method:         http.MethodPost,
+			query:          "country=US&auth=test-token",
+			expectedStatus: http.StatusMethodNotAllowed,
+			expectedBody:   "Method not allowed\n",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(tc.method, "/provenance?"+tc.query, nil)
+			rr := httptest.NewRecorder()
+			http.HandlerFunc(h.provenanceHandler).ServeHTTP(rr, req)
+
+			if rr.Code != tc.expectedStatus {
+				t.Errorf("handler returned wrong status code: got %v want %v",
+					rr.Code, tc.expectedStatus)
+			}
+			if rr.Body.String() != tc.expectedBody {
+				t.Errorf("handler returned unexpected body: got %q want %q",
+					rr.Body.String(), tc.expectedBody)
+			}
+		})
+	}
+}
+
+func TestProvenanceHandlerProcessorError(t *testing.T) {
+	h := NewHandler(&MockProcessor{err: ipdata.ErrDownloadFailed}, &config.Config{})
+
+	req := httptest.NewRequest(http.MethodGet, "/provenance?country=US", nil)
+	rr := httptest.NewRecorder()
+	http.HandlerFunc(h.provenanceHandler).ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusServiceUnavailable {
+		t.Errorf("handler returned wrong status code: got %v want %v",
+			rr.Code, http.StatusServiceUnavailable)
+	}
+}
+
+func TestProbeHandlers(t *testing.T) {
+	testCases := []struct {
+		name            string
+		ready           bool
+		expectedLivez   int
+		expectedReadyz  int
+		expectedReadyzB string
+	}{
+		{
+			name:            "Cold cache",
+			ready:           false,
+			expectedLivez:   http.StatusOK,
+			expectedReadyz:  http.StatusServiceUnavailable,
+			expectedReadyzB: "not ready\n",
+		},
+		{
+			name:            "Warm cache",
+			ready:           true,
+			expectedLivez:   http.StatusOK,
+			expectedReadyz:  http.StatusOK,
+			expectedReadyzB: "ready\n",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			mockProc := &MockProcessor{ready: tc.ready}
+			mux := http.NewServeMux()
+			NewHandler(mockProc, &config.Config{AuthToken: "test-token"}).RegisterRoutesOn(mux)
+
+			rr := httptest.NewRecorder()
+			mux.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/livez", nil))
+			if rr.Code != tc.expectedLivez {
+				t.Errorf("livez returned wrong status code: got %v want %v", rr.Code, tc.expectedLivez)
+			}
+			if rr.Body.String() != "ok\n" {
+				t.Errorf("livez returned unexpected body: %q", rr.Body.String())
+			}
+			if mockProc.calls != 0 {
+				t.Errorf("livez must not touch the processor, calls=%d", mockProc.calls)
+			}
+
+			rr = httptest.NewRecorder()
+			mux.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+			if rr.Code != tc.expectedReadyz {
+				t.Errorf("readyz returned wrong status code: got %v want %v", rr.Code, tc.expectedReadyz)
+			}
+			if rr.Body.String() != tc.expectedReadyzB {
+				t.Errorf("readyz returned unexpected body: got %q want %q", rr.Body.String(), tc.expectedReadyzB)
+			}
+		})
+	}
+}
+
+func TestGetIpListHandlerDownload(t *testing.T) {
+	mockProc := &MockProcessor{
+		ipLists: map[string][]string{
+			"US": {"192.168.1.0/24"},
+			"us": {"192.168.1.0/24"},
+		},
+	}
+	h := NewHandler(mockProc, &config.Config{})
+
+	testCases := []struct {
+		name                string
+		query               string
+		expectedStatus      int
+		expectedDisposition string
+	}{
+		{
+			name:                "Download enabled",
+			query:               "country=US&download=true",
+			expectedStatus:      http.StatusOK,
+			expectedDisposition: `attachment; filename=US.txt`,
+		},
+		{
+			name:                "Lowercase country",
+			query:               "country=us&download=1",
+			expectedStatus:      http.StatusOK,
+			expectedDisposition: `attachment; filename=US.txt`,
+		},
+		{
+			name:                "Download with netmask format",
+			query:               "country=US&format=netmask&download=true",
+			expectedStatus:      http.StatusOK,
+			expectedDisposition: `attachment; filename=US.txt`,
+		},
+		{
+			name:                "Download disabled",
+			query:               "country=US&download=false",
+			expectedStatus:      http.StatusOK,
+			expectedDisposition: "",
+		},
+		{
+			name:                "Download omitted",
+			query:               "country=US",
+			expectedStatus:      http.StatusOK,
+			expectedDisposition: "",
+		},
+		{
+			name:                "Invalid download value",
+			query:               "country=US&download=maybe",
+			expectedStatus:      http.StatusBadRequest,
+			expectedDisposition: "",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/get?"+tc.query, nil)
+			rr := httptest.NewRecorder()
+			http.HandlerFunc(h.getIpListHandler).ServeHTTP(rr, req)
+
+			if rr.Code != tc.expectedStatus {
+				t.Errorf("handler returned wrong status code: got %v want %v",
+					rr.Code, tc.expectedStatus)
+			}
+			if got := rr.Header().Get("Content-Disposition"); got != tc.expectedDisposition {
+				t.Errorf("Content-Disposition = %q, want %q", got, tc.expectedDisposition)
+			}
+		})
+	}
+}
+
+func TestAttachmentDispositionQuotesUnsafeNames(t *testing.T) {
+	got := attachmentDisposition(`x"y`, "txt")
+	want := `attachment; filename="X\"Y.txt"`
+	if got != want {
+		t.Errorf("attachmentDisposition = %q, want %q", got, want)
+	}
+}
+
+func TestGetIpListHandlerTrailingNewline(t *testing.T) {
+	mockProc := &MockProcessor{
+		ipLists: map[string][]string{
+			"US": {"192.168.1.0/24", "10.0.0.0/8"},
+			"DE": {"2.0.0.0/12"},
+			"XX": {},
+		},
+	}
+	h := NewHandler(mockProc, &config.Config{})
+
+	testCases := []struct {
+		name           string
+		query          string
+		expectedStatus int
+		expectedBody   string
+	}{
+		{
+			name:           "Multi CIDR default",
+			query:          "country=US",
+			expectedStatus: http.StatusOK,
+			expectedBody:   "192.168.1.0/24\n10.0.0.0/8\n",
+		},
+		{
+			name:           "Multi CIDR trailing true",
+			query:          "country=US&trailing_newline=true",
+			expectedStatus: http.StatusOK,
+			expectedBody:   "192.168.1.0/24\n10.0.0.0/8\n",
+		},
+		{
+			name:           "Multi CIDR trailing false",
+			query:          "country=US&trailing_newline=false",
+			expectedStatus: http.StatusOK,
+			expectedBody:   "192.168.1.0/24\n10.0.0.0/8",
+		},
+		{
+			name:           "Single CIDR default",
+			query:          "country=DE",
+			expectedStatus: http.StatusOK,
+			expectedBody:   "2.0.0.0/12\n",
+		},
+		{
+			name:           "Single CIDR trailing false",
+			query:          "country=DE&trailing_newline=false",
+			expectedStatus: http.StatusOK,
+			expectedBody:   "2.0.0.0/12",
+		},
+		{
+			name:           "Empty result trailing false",
+			query:          "country=XX&trailing_newline=false",
+			expectedStatus: http.StatusOK,
+			expectedBody:   "",
+		},
+		{
+			name:           "CRLF trailing false",
+			query:          "country=US&sep=crlf&trailing_newline=false",
+			expectedStatus: http.StatusOK,
+			expectedBody:   "192.168.1.0/24\r\n10.0.0.0/8",
+		},
+		{
+			name:           "Comma ignores trailing true",
+			query:          "country=US&sep=comma&trailing_newline=true",
+			expectedStatus: http.StatusOK,
+			expectedBody:   "192.168.1.0/24,10.0.0.0/8",
+		},
+		{
+			name:           "Invalid value",
+			query:          "country=US&trailing_newline=nope",
+			expectedStatus: http.StatusBadRequest,
+			expectedBody:   "Invalid trailing_newline parameter\n",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/get?"+tc.query, nil)
+			rr := httptest.NewRecorder()
+			http.HandlerFunc(h.getIpListHandler).ServeHTTP(rr, req)
+
+			if rr.Code != tc.expectedStatus {
+				t.Errorf("handler returned wrong status code: got %v want %v",
+					rr.Code, tc.expectedStatus)
+			}
+			if rr.Body.String() != tc.expectedBody {
+				t.Errorf("handler returned unexpected body: got %q want %q",
+					rr.Body.String(), tc.expectedBody)
+			}
+		})
+	}
+}
+
+func TestRegisterRoutesOnPprof(t *testing.T) {
+	testCases := []struct {
+		name           string
+		enablePprof    bool
+		expectedStatus int
+	}{
+		{name: "Pprof disabled", enablePprof: false, expectedStatus: http.StatusNotFound},
+		{name: "Pprof enabled", enablePprof: true, expectedStatus: http.StatusOK},
+	}
+
+	paths := []string{"/debug/pprof/", "/debug/pprof/cmdline", "/debug/pprof/symbol"}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			mux := http.NewServeMux()
+			NewHandler(&MockProcessor{}, &config.Config{EnablePprof: tc.enablePprof}).RegisterRoutesOn(mux)
+
+			for _, path := range paths {
+				rr := httptest.NewRecorder()
+				mux.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, path, nil))
+				if rr.Code != tc.expectedStatus {
+					t.Errorf("%s returned wrong status code: got %v want %v", path, rr.Code, tc.expectedStatus)
+				}
+			}
+		})
+	}
+}
+
+func TestRegisterRoutesAdminSplit(t *testing.T) {
+	mockProc := &MockProcessor{ipLists: map[string][]string{"US": {"192.168.1.0/24"}}}
+	h := NewHandler(mockProc, &config.Config{AdminPort: "9090", EnablePprof: true})
+
+	publicMux := http.NewServeMux()
+	adminMux := http.NewServeMux()
+	h.RegisterRoutesOn(publicMux)
+	h.RegisterAdminRoutesOn(adminMux)
+
+	testCases := []struct {
+		path           string
+		expectedPublic int
+		expectedAdmin  int
+	}{
+		{path: "/get?country=US", expectedPublic: http.StatusOK, expectedAdmin: http.StatusNotFound},
+		{path: "/livez", expectedPublic: http.StatusOK, expectedAdmin: http.StatusNotFound},
+		{path: "/stats", expectedPublic: http.StatusNotFound, expectedAdmin: http.StatusOK},
+		{path: "/maintenance", expectedPublic: http.StatusNotFound, expectedAdmin: http.StatusOK},
+		{path: "/debug/pprof/", expectedPublic: http.StatusNotFound, expectedAdmin: http.StatusOK},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.path, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			publicMux.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, tc.path, nil))
+			if rr.Code != tc.expectedPublic {
+				t.Errorf("public mux returned wrong status code: got %v want %v", rr.Code, tc.expectedPublic)
+			}
+
+			rr = httptest.NewRecorder()
+			adminMux.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, tc.path, nil))
+			if rr.Code != tc.expectedAdmin {
+				t.Errorf("admin mux returned wrong status code: got %v want %v", rr.Code, tc.expectedAdmin)
+			}
+		})
+	}
+}
+
+func TestStrictQueryParams(t *testing.T) {
+	mockProc := &MockProcessor{
+		ipLists:    map[string][]string{"US": {"192.168.1.0/24"}},
+		provenance: map[string]map[string]int{"US": {"ripencc": 1}},
+	}
+
+	testCases := []struct {
+		name           string
+		strictQuery    bool
+		path           string
+		expectedStatus int
+		expectedBody   string
+	}{
+		{
+			name:           "Typo ignored in lenient mode",
+			strictQuery:    false,
+			path:           "/get?country=US&frmat=json",
+			expectedStatus: http.StatusOK,
+			expectedBody:   "192.168.1.0/24\n",
+		},
+		{
+			name:           "Typo rejected in strict mode",
+			strictQuery:    true,
+			path:           "/get?country=US&frmat=json&zz=1",
+			expectedStatus: http.StatusBadRequest,
+			expectedBody:   "Unknown query parameters: frmat, zz\n",
+		},
+		{
+			name:           "Known parameters accepted in strict mode",
+			strictQuery:    true,
+			path:           "/get?country=US&sep=lf&download=false&trailing_newline=true",
+			expectedStatus: http.StatusOK,
+			expectedBody:   "192.168.1.0/24\n",
+		},
+		{
+			name:           "Provenance rejects get-only parameter in strict mode",
+			strictQuery:    true,
+			path:           "/provenance?country=US&sep=lf",
+			expectedStatus: http.StatusBadRequest,
+			expectedBody:   "Unknown query parameters: sep\n",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			mux := http.NewServeMux()
+			NewHandler(mockProc, &config.Config{StrictQuery: tc.strictQuery}).RegisterRoutesOn(mux)
+
+			rr := httptest.NewRecorder()
+			mux.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, tc.path, nil))
+
+			if rr.Code != tc.expectedStatus {
+				t.Errorf("handler returned wrong status code: got %v want %v",
+					rr.Code, tc.expectedStatus)
+			}
+			if rr.Body.String() != tc.expectedBody {
+				t.Errorf("handler returned unexpected body: got %q want %q",
+					rr.Body.String(), tc.expectedBody)
+			}
+		})
+	}
+}
+
+func TestGetIpListHandlerDataSourceHeader(t *testing.T) {
+	testCases := []struct {
+		name     string
+		source   string
+		expected string
+	}{
+		{name: "Embedded", source: ipdata.DataSourceEmbedded, expected: "embedded"},
+		{name: "Live", source: ipdata.DataSourceLive, expected: "live"},
+		{name: "Unknown", source: "", expected: ""},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			mockProc := &MockProcessor{
+				ipLists: map[string][]string{"US": {"192.168.1.0/24"}},
+				source:  tc.source,
+			}
+			h := NewHandler(mockProc, &config.Config{})
+
+			rr := httptest.NewRecorder()
+			http.HandlerFunc(h.getIpListHandler).ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/get?country=US", nil))
+
+			if got := rr.Header().Get("X-Data-Source"); got != tc.expected {
+				t.Errorf("X-Data-Source = %q, want %q", got, tc.expected)
+			}
+		})
+	}
+}
+
+func TestRootIndex(t *testing.T) {
+	origVersion := version.Version
+	version.Version = "1.2.3"
+	t.Cleanup(func() { version.Version = origVersion })
+
+	testCases := []struct {
+		name              string
+		cfg               *config.Config
+		expectedEndpoints []string
+	}{
+		{
+			name:              "Default routes",
+			cfg:               &config.Config{AuthToken: "secret"},
+			expectedEndpoints: []string{"/get", "/provenance", "/asns", "/manifest", "/count", "/compare", "/lookup", "/export", "/livez", "/readyz", "/healthz/upstream", "/openapi.json", "/stats", "/maintenance", "/config"},
+		},
+		{
+			name:              "Pprof on the public mux",
+			cfg:               &config.Config{AuthToken: "secret", EnablePprof: true},
+			expectedEndpoints: []string{"/get", "/provenance", "/asns", "/manifest", "/count", "/compare", "/lookup", "/export", "/livez", "/readyz", "/healthz/upstream", "/openapi.json", "/stats", "/maintenance", "/config", "/debug/pprof/"},
+		},
+		{
+			name:              "Pprof on the admin port",
+			cfg:               &config.Config{AuthToken: "secret", EnablePprof: true, AdminPort: "9090"},
+			expectedEndpoints: []string{"/get", "/provenance", "/asns", "/manifest", "/count", "/compare", "/lookup", "/export", "/livez", "/readyz", "/healthz/upstream", "/openapi.json"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			mux := http.NewServeMux()
+			NewHandler(&MockProcessor{}, tc.cfg).RegisterRoutesOn(mux)
+
+			rr := httptest.NewRecorder()
+			mux.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/", nil))
+
+			if rr.Code != http.StatusOK {
+				t.Fatalf("handler returned wrong status code: got %v want %v", rr.Code, http.StatusOK)
+			}
+			if ct := rr.Header().Get("Content-Type"); ct != "application/json" {
+				t.Errorf("handler returned wrong Content-Type: got %q want %q", ct, "application/json")
+			}
+
+			var got indexResponse
+			if err := json.NewDecoder(rr.Body).Decode(&got); err != nil {
+				t.Fatalf("failed to decode response: %v", err)
+			}
+			if got.Service != "ip-whitelist-by-country" {
+				t.Errorf("service = %q, want %q", got.Service, "ip-whitelist-by-country")
+			}
+			if got.Version != "1.2.3" {
+				t.Errorf("version = %q, want %q", got.Version, "1.2.3")
+			}
+			if !reflect.DeepEqual(got.Endpoints, tc.expectedEndpoints) {
+				t.Errorf("endpoints = %v, want %v", got.Endpoints, tc.expectedEndpoints)
+			}
+		})
+	}
+}
+
+func TestRootIndexOnlyMatchesRoot(t *testing.T) {
+	mux := http.NewServeMux()
+	NewHandler(&MockProcessor{}, &config.Config{}).RegisterRoutesOn(mux)
+
+	rr := httptest.NewRecorder()
+	mux.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/unknown", nil))
+	if rr.Code != http.StatusNotFound {
+		t.Errorf("unknown path returned wrong status code: got %v want %v", rr.Code, http.StatusNotFound)
+	}
+
+	rr = httptest.NewRecorder()
+	mux.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/", nil))
+	if rr.Code != http.StatusMethodNotAllowed {
+		t.Errorf("POST / returned wrong status code: got %v want %v", rr.Code, http.StatusMethodNotAllowed)
+	}
+}
+
+func TestGetIpListHandlerCountryNormalization(t *testing.T) {
+	testCases := []struct {
+		name           string
+		query          string
+		expectedStatus int
+		expectedBody   string
+	}{
+		{name: "Space only", query: "country=%20", expectedStatus: http.StatusBadRequest, expectedBody: "Missing country parameter\n"},
+		{name: "Tabs and spaces", query: "country=%09%20", expectedStatus: http.StatusBadRequest, expectedBody: "Missing country parameter\n"},
+		{name: "Summary wildcard", query: "country=*", expectedStatus: http.StatusBadRequest, expectedBody: "Invalid country parameter\n"},
+		{name: "Padded wildcard", query: "country=%20*%20", expectedStatus: http.StatusBadRequest, expectedBody: "Invalid country parameter\n"},
+		{name: "Lowercase", query: "country=de", expectedStatus: http.StatusOK, expectedBody: "2.0.0.0/12\n"},
+		{name: "Mixed case", query: "country=dE", expectedStatus: http.StatusOK, expectedBody: "2.0.0.0/12\n"},
+		{name: "Padded", query: "country=%20De%20", expectedStatus: http.StatusOK, expectedBody: "2.0.0.0/12\n"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			mockProc := &MockProcessor{
+				ipLists: map[string][]string{"DE": {"2.0.0.0/12"}, "*": {"0.0.0.0/0"}},
+			}
+			h := NewHandler(mockProc, &config.Config{})
+
+			rr := httptest.NewRecorder()
+			http.HandlerFunc(h.getIpListHandler).ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/get?"+tc.query, nil))
+
+			if rr.Code != tc.expectedStatus {
+				t.Errorf("handler returned wrong status code: got %v want %v", rr.Code, tc.expectedStatus)
+			}
+			if rr.Body.String() != tc.expectedBody {
+				t.Errorf("handler returned unexpected body: got %q want %q", rr.Body.String(), tc.expectedBody)
+			}
+			if tc.expectedStatus != http.StatusOK && mockProc.calls != 0 {
+				t.Errorf("expected processor not to be called, got %d calls", mockProc.calls)
+			}
+		})
+	}
+}
+
+func TestProvenanceHandlerCountryNormalization(t *testing.T) {
+	mockProc := &MockProcessor{
+		provenance: map[string]map[string]int{"DE": {"ripencc": 2}},
+	}
+	h := NewHandler(mockProc, &config.Config{})
+
+	testCases := []struct {
+		name           string
+		query          string
+		expectedStatus int
+		expectedBody   string
+	}{
+		{name: "Space only", query: "country=%20", expectedStatus: http.StatusBadRequest, expectedBody: "Missing country parameter\n"},
+		{name: "Summary wildcard", query: "country=*", expectedStatus: http.StatusBadRequest, expectedBody: "Invalid country parameter\n"},
+		{name: "Padded mixed case", query: "country=%20dE", expectedStatus: http.StatusOK, expectedBody: `{"country":"DE","registries":{"ripencc":2}}` + "\n"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			http.HandlerFunc(h.provenanceHandler).ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/provenance?"+tc.query, nil))
+
+			if rr.Code != tc.expectedStatus {
+				t.Errorf("handler returned wrong status code: got %v want %v", rr.Code, tc.expectedStatus)
+			}
+			if rr.Body.String() != tc.expectedBody {
+				t.Errorf("handler returned unexpected body: got %q want %q", rr.Body.String(), tc.expectedBody)
+			}
+		})
+	}
+}
+
+func TestGetIpListHandlerDataTimeHeaders(t *testing.T) {
+	t.Run("Downloaded data", func(t *testing.T) {
+		generated := time.Now().Add(-90 * time.Second)
+		mockProc := &MockProcessor{
+			ipLists:  map[string][]string{"US": {"192.168.0.0/24"}},
+			dataTime: generated,
+		}
+		h := NewHandler(mockProc, &config.Config{})
+
+		rr := httptest.NewRecorder()
+		http.HandlerFunc(h.getIpListHandler).ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/get?country=US", nil))
+
+		if got, want := rr.Header().Get("X-Data-Generated"), generated.UTC().Format(time.RFC3339); got != want {
+			t.Errorf("X-Data-Generated = %q, want %q", got, want)
+		}
+		age, err := strconv.Atoi(rr.Header().Get("X-Data-Age-Seconds"))
+		if err != nil {
+			t.Fatalf("X-Data-Age-Seconds is not an integer: %v", err)
+		}
+		if age < 90 || age > 95 {
+			t.Errorf("X-Data-Age-Seconds = %d, want about 90", age)
+		}
+	})
+
+	t.Run("Nothing downloaded", func(t *testing.T) {
+		mockProc := &MockProcessor{
+			ipLists: map[string][]string{"US": {"192.168.0.0/24"}},
+			source:  ipdata.DataSourceEmbedded,
+		}
+		h := NewHandler(mockProc, &config.Config{})
+
+		rr := httptest.NewRecorder()
+		http.HandlerFunc(h.getIpListHandler).ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/get?country=US", nil))
+
+		for _, header := range []string{"X-Data-Generated", "X-Data-Age-Seconds"} {
+			if got := rr.Header().Get(header); got != "" {
+				t.Errorf("%s = %q, want it to be absent", header, got)
+			}
+		}
+	})
+}
+
+func TestGetIpListHandlerMaxAge(t *testing.T) {
+	testCases := []struct {
+		name              string
+		query             string
+		dataAge           time.Duration
+		refreshErr        error
+		token             string
+		expectedStatus    int
+		expectedBody      string
+		expectedRefreshes int
+	}{
+		{
+			name:              "No max_age",
+			query:             "country=US",
+			dataAge:           48 * time.Hour,
+			expectedStatus:    http.StatusOK,
+			expectedBody:      "192.168.0.0/24\n",
+			expectedRefreshes: 0,
+		},
+		{
+			name:              "Fresh enough",
+			query:             "country=US&max_age=1h",
+			dataAge:           10 * time.Minute,
+			expectedStatus:    http.StatusOK,
+			expectedBody:      "192.168.0.0/24\n",
+			expectedRefreshes: 0,
+		},
+		{
+			name:              "Too old triggers refresh",
+			query:             "country=US&max_age=5m",
+			dataAge:           10 * time.Minute,
+			expectedStatus:    http.StatusOK,
+			expectedBody:      "192.168.0.0/24\n",
+			expectedRefreshes: 1,
+		},
+		{
+			name:              "Refresh failure",
+			query:             "country=US&max_age=5m",
+			dataAge:           10 * time.Minute,
+			refreshErr:        ipdata.ErrBadUpstreamData,
+			expectedStatus:    http.StatusServiceUnavailable,
+			expectedBody:      "Error refreshing data: " + ipdata.ErrBadUpstreamData.Error() + "\n",
+			expectedRefreshes: 1,
+		},
+		{
+			name:              "Invalid duration",
+			query:             "country=US&max_age=soon",
+			expectedStatus:    http.StatusBadRequest,
+			expectedBody:      "Invalid max_age parameter\n",
+			expectedRefreshes: 0,
+		},
+		{
+			name:              "Negative duration",
+			query:             "country=US&max_age=-1m",
+			expectedStatus:    http.StatusBadRequest,
+			expectedBody:      "Invalid max_age parameter\n",
+			expectedRefreshes: 0,
+		},
+		{
+			name:              "Unauthorized clients cannot force a refresh",
+			query:             "country=US&max_age=5m",
+			dataAge:           10 * time.Minute,
+			token:             "secret",
+			expectedStatus:    http.StatusUnauthorized,
+			expectedBody:      "Unauthorized\n",
+			expectedRefreshes: 0,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			mockProc := &MockProcessor{
+				ipLists:    map[string][]string{"US": {"192.168.0.0/24"}},
+				dataTime:   time.Now().Add(-tc.dataAge),
+				refreshErr: tc.refreshErr,
+			}
+			h := NewHandler(mockProc, &config.Config{AuthToken: tc.token, StrictQuery: true})
+
+			rr := httptest.NewRecorder()
+			http.HandlerFunc(h.getIpListHandler).ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/get?"+tc.query, nil))
+
+			if rr.Code != tc.expectedStatus {
+				t.Errorf("handler returned wrong status code: got %v want %v", rr.Code, tc.expectedStatus)
+			}
+			if rr.Body.String() != tc.expectedBody {
+				t.Errorf("handler returned unexpected body: got %q want %q", rr.Body.String(), tc.expectedBody)
+			}
+			if mockProc.refreshes != tc.expectedRefreshes {
+				t.Errorf("refreshes = %d, want %d", mockProc.refreshes, tc.expectedRefreshes)
+			}
+		})
+	}
+}
+
+func TestAsnsHandler(t *testing.T) {
+	testCases := []struct {
+		name           string
+		method         string
+		query          string
+		token          string
+		err            error
+		expectedStatus int
+		expectedBody   string
+	}{
+		{
+			name:           "Country with AS numbers",
+			method:         http.MethodGet,
+			query:          "country=de",
+			expectedStatus: http.StatusOK,
+			expectedBody:   "3320\n3321\n8881\n",
+		},
+		{
+			name:           "Country without AS numbers",
+			method:         http.MethodGet,
+			query:          "country=FR",
+			expectedStatus: http.StatusOK,
+			expectedBody:   "",
+		},
+		{
+			name:           "Missing country",
+			method:         http.MethodGet,
+			query:          "",
+			expectedStatus: http.StatusBadRequest,
+			expectedBody:   "Missing country parameter\n",
+		},
+		{
+			name:           "Unauthorized",
+			method:         http.MethodGet,
+			query:          "country=DE",
+			token:          "secret",
+			expectedStatus: http.StatusUnauthorized,
+			expectedBody:   "Unauthorized\n",
+		},
+		{
+			name:           "Processor error",
+			method:         http.MethodGet,
+			query:          "country=DE",
+			err:            ipdata.ErrBadUpstreamData,
+			expectedStatus: http.StatusBadGateway,
+			expectedBody:   "Error processing request: " + ipdata.ErrBadUpstreamData.Error() + "\n",
+		},
+		{
+			name:           "Wrong method",
+			method:         http.MethodPost,
+			query:          "country=DE",
+			expectedStatus: http.StatusMethodNotAllowed,
+			expectedBody:   "Method not allowed\n",
+		},
+		{
+			name:           "Unknown parameter",
+			method:         http.MethodGet,
+			query:          "country=DE&format=cidr",
+			expectedStatus: http.StatusBadRequest,
+			expectedBody:   "Unknown query parameters: format\n",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			mockProc := &MockProcessor{
+				asns: map[string][]uint32{"DE": {3320, 3321, 8881}},
+				err:  tc.err,
+			}
+			h := NewHandler(mockProc, &config.Config{AuthToken: tc.token, StrictQuery: true})
+
+			rr := httptest.NewRecorder()
+			http.HandlerFunc(h.asnsHandler).ServeHTTP(rr, httptest.NewRequest(tc.method, "/asns?"+tc.query, nil))
+
+			if rr.Code != tc.expectedStatus {
+				t.Errorf("handler returned wrong status code: got %v want %v", rr.Code, tc.expectedStatus)
+			}
+			if rr.Body.String() != tc.expectedBody {
+				t.Errorf("handler returned unexpected body: got %q want %q", rr.Body.String(), tc.expectedBody)
+			}
+		})
+	}
+}
+
+func TestStatsHandler(t *testing.T) {
+	mockProc := &MockProcessor{
+		stats: ipdata.Stats{
+			DataSource:   ipdata.DataSourceLive,
+			Generated:    time.Date(2026, 10, 17, 8, 0, 0, 0, time.UTC),
+			Countries:    2,
+			SkippedLines: ipdata.SkipStats{TooFewFields: 1, NonIPv4: 3},
+		},
+	}
+	h := NewHandler(mockProc, &config.Config{AuthToken: "secret"})
+
+	rr := httptest.NewRecorder()
+	http.HandlerFunc(h.statsHandler).ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/stats", nil))
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("handler returned wrong status code: got %v want %v", rr.Code, http.StatusOK)
+	}
+	if ct := rr.Header().Get("Content-Type"); ct != "application/json" {
+		t.Errorf("handler returned wrong Content-Type: got %q want %q", ct, "application/json")
+	}
+	expected := `{"data_source":"live","generated":"2026-10-17T08:00:00Z","countries":2,` +
+		`"skipped_lines":{"too_few_fields":1,"other_registry":0,"non_ipv4":3,"bad_count":0,"parse_error":0},"cache_hits":0,"cache_misses":0}` + "\n"
+	if rr.Body.String() != expected {
+		t.Errorf("handler returned unexpected body: got %s want %s", rr.Body.String(), expected)
+	}
+
+	mockProc.stats.Reassigned = []ipdata.Reassignment{{CIDR: "24.0.0.0/16", From: "US", To: "CA"}}
+	rr = httptest.NewRecorder()
+	http.HandlerFunc(h.statsHandler).ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/stats", nil))
+	expectedReassigned := `,"reassigned":[{"cidr":"24.0.0.0/16","from":"US","to":"CA"}]}` + "\n"
+	if !bytes.HasSuffix(rr.Body.Bytes(), []byte(expectedReassigned)) {
+		t.Errorf("handler returned unexpected body: got %s want suffix %s", rr.Body.String(), expectedReassigned)
+	}
+
+	rr = httptest.NewRecorder()
+	http.HandlerFunc(h.statsHandler).ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/stats", nil))
+	if rr.Code != http.StatusMethodNotAllowed {
+		t.Errorf("handler returned wrong status code: got %v want %v", rr.Code, http.StatusMethodNotAllowed)
+	}
+}
+
+func TestStatsHandler_Diagnostics(t *testing.T) {
+	mockProc := &MockProcessor{
+		stats: ipdata.Stats{DataSource: ipdata.DataSourceLive, Countries: 1},
+		diagnosed: ipdata.ParseDiagnostics{
+			TotalLines:   4,
+			IgnoredLines: 1,
+			IPv4Records:  2,
+			Skipped:      ipdata.SkipStats{NonIPv4: 1},
+			Statuses:     map[string]int{ipdata.StatusAllocated: 2},
+			Countries:    map[string]int{"DE": 2},
+		},
+	}
+	h := NewHandler(mockProc, &config.Config{StrictQuery: true})
+
+	testCases := []struct {
+		name           string
+		url            string
+		expectedStatus int
+		expectedSuffix string
+	}{
+		{
+			name:           "diagnostics requested",
+			url:            "/stats?diagnostics=true",
+			expectedStatus: http.StatusOK,
+			expectedSuffix: `"cache_misses":0,"diagnostics":{"total_lines":4,"ignored_lines":1,"ipv4_records":2,"asn_records":0,` +
+				`"skipped_lines":{"too_few_fields":0,"other_registry":0,"non_ipv4":1,"bad_count":0,"parse_error":0},` +
+				`"mask_mismatches":0,"statuses":{"allocated":2},"countries":{"DE":2}}}` + "\n",
+		},
+		{
+			name:           "diagnostics not requested",
+			url:            "/stats?diagnostics=false",
+			expectedStatus: http.StatusOK,
+			expectedSuffix: `"cache_misses":0}` + "\n",
+		},
+		{
+			name:           "invalid diagnostics",
+			url:            "/stats?diagnostics=maybe",
+			expectedStatus: http.StatusBadRequest,
+			expectedSuffix: "Invalid diagnostics parameter\n",
+		},
+		{
+			name:           "unknown parameter",
+			url:            "/stats?verbose=1",
+			expectedStatus: http.StatusBadRequest,
+			expectedSuffix: "Unknown query parameters: verbose\n",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			http.HandlerFunc(h.statsHandler).ServeHTTP(rr, httptest.NewRequest(http.MethodGet, tc.url, nil))
+
+			if rr.Code != tc.expectedStatus {
+				t.Errorf("handler returned wrong status code: got %v want %v", rr.Code, tc.expectedStatus)
+			}
+			if !bytes.HasSuffix(rr.Body.Bytes(), []byte(tc.expectedSuffix)) {
+				t.Errorf("handler returned unexpected body: got %s want suffix %s", rr.Body.String(), tc.expectedSuffix)
+			}
+		})
+	}
+}
+
+// writePerLine is the original per-entry response writer, kept as a reference.
+// A format's header is written as a line of its own.
+func writePerLine(w io.Writer, country string, ipList []string, format outputFormat, sep separator) {
+	if format.header != "" {
+		w.Write([]byte(format.header))
+		if sep.trailing || len(ipList) > 0 {
+			w.Write([]byte(sep.value))
+		}
+	}
+	for i, ip := range ipList {
+		ip = format.render(country, ip)
+		if sep.trailing {
+			w.Write([]byte(ip + sep.value))
+			continue
+		}
+		if i > 0 {
+			ip = sep.value + ip
+		}
+		w.Write([]byte(ip))
+	}
+}
+
+// syntheticCIDRs generates n distinct /24 CIDR blocks
+func syntheticCIDRs(n int) []string {
+	cidrs := make([]string, 0, n)
+	for i := range n {
+		cidrs = append(cidrs, strconv.Itoa(i>>16&255)+"."+strconv.Itoa(i>>8&255)+"."+strconv.Itoa(i&255)+".0/24")
+	}
+	return cidrs
+}
+
+func TestRenderListMatchesPerLineWrites(t *testing.T) {
+	lists := map[string][]string{
+		"Empty":  {},
+		"Single": {"192.168.0.0/24"},
+		"Large":  syntheticCIDRs(5000),
+	}
+
+	for listName, ipList := range lists {
+		for formatName, format := range outputFormats {
+			for sepName, sep := range separators {
+				for _, trailing := range []bool{true, false} {
+					sep := separator{value: sep.value, trailing: sep.trailing && trailing}
+					t.Run(fmt.Sprintf("%s/%s/%s/trailing=%v", listName, formatName, sepName, trailing), func(t *testing.T) {
+						var want bytes.Buffer
+						writePerLine(&want, "DE", ipList, format, sep)
+						if got := renderList("DE", ipList, format, sep); !bytes.Equal(got, want.Bytes()) {
+							t.Fatal("renderList output differs from per-line reference")
+						}
+					})
+				}
+			}
+		}
+	}
+}
+
+// countingResponseWriter counts Write calls on the wrapped ResponseWriter
+type countingResponseWriter struct {
+	http.ResponseWriter
+	writes int
+}
+
+func (w *countingResponseWriter) Write(b []byte) (int, error) {
+	w.writes++
+	return w.ResponseWriter.Write(b)
+}
+
+func TestGetIpListHandlerSingleWrite(t *testing.T) {
+	mockProc := &MockProcessor{ipLists: map[string][]string{"DE": syntheticCIDRs(1000)}}
+	h := NewHandler(mockProc, &config.Config{})
+
+	rr := httptest.NewRecorder()
+	w := &countingResponseWriter{ResponseWriter: rr}
+	http.HandlerFunc(h.getIpListHandler).ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/get?country=DE", nil))
+
+	if w.writes != 1 {
+		t.Errorf("handler made %d Write calls, want 1", w.writes)
+	}
+	if got, want := rr.Header().Get("Content-Length"), strconv.Itoa(rr.Body.Len()); got != want {
+		t.Errorf("Content-Length = %q, want %q", got, want)
+	}
+}
+
+func BenchmarkGetIpListResponse(b *testing.B) {
+	ipList := syntheticCIDRs(50000)
+	format := outputFormats["cidr"]
+	sep := separators["lf"]
+
+	b.Run("buffered", func(b *testing.B) {
+		b.ReportAllocs()
+		for b.Loop() {
+			rr := httptest.NewRecorder()
+			rr.Write(renderList("DE", ipList, format, sep))
+		}
+	})
+
+	b.Run("per-line", func(b *testing.B) {
+		b.ReportAllocs()
+		for b.Loop() {
+			writePerLine(httptest.NewRecorder(), "DE", ipList, format, sep)
+		}
+	})
+}
+
+func TestRequestsCountsDataEndpoints(t *testing.T) {
+	h := NewHandler(&MockProcessor{ipLists: map[string][]string{"DE": {"2.0.0.0/12"}}, ready: true}, &config.Config{})
+	mux := http.NewServeMux()
+	h.RegisterRoutesOn(mux)
+
+	for _, path := range []string{"/get?country=DE", "/get", "/count?country=DE", "/lookup?ip=2.0.0.1", "/livez", "/readyz", "/", "/stats"} {
+		mux.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, path, nil))
+	}
+
+	// Rejected requests count, probes, the index and management endpoints do not
+	if got := h.Requests(); got != 4 {
+		t.Errorf("Requests() = %d, want 4", got)
+	}
+}
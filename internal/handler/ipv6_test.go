@@ -0,0 +1,139 @@
+package handler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/anisimovdk/ip-whitelist-by-country/internal/config"
+	"github.com/anisimovdk/ip-whitelist-by-country/internal/ipdata"
+)
+
+func TestGetIpListHandlerIPv6Aggregate(t *testing.T) {
+	testCases := []struct {
+		name           string
+		query          string
+		err            error
+		expectedStatus int
+		expectedBody   string
+	}{
+		{
+			name:           "Without the parameter only IPv4 is served",
+			query:          "country=DE",
+			expectedStatus: http.StatusOK,
+			expectedBody:   "2.0.0.0/12\n",
+		},
+		{
+			name:           "Aggregated to /48",
+			query:          "country=DE&ipv6_aggregate=48",
+			expectedStatus: http.StatusOK,
+			expectedBody:   "2.0.0.0/12\n2001:db8::/32\n2a02:1:2::/48\n",
+		},
+		{
+			name:           "Aggregated to /56",
+			query:          "country=DE&ipv6_aggregate=56",
+			expectedStatus: http.StatusOK,
+			expectedBody:   "2.0.0.0/12\n2001:db8::/32\n2a02:1:2:300::/56\n",
+		},
+		{
+			name:           "Aggregated to /64",
+			query:          "country=DE&ipv6_aggregate=64",
+			expectedStatus: http.StatusOK,
+			expectedBody:   "2.0.0.0/12\n2001:db8::/32\n2a02:1:2:345::/64\n",
+		},
+		{
+			name:           "Per-country in ndjson",
+			query:          "country=FR,DE&format=ndjson&ipv6_aggregate=48",
+			expectedStatus: http.StatusOK,
+			expectedBody: "{\"country\":\"FR\",\"cidr\":\"5.0.0.0/16\"}\n" +
+				"{\"country\":\"DE\",\"cidr\":\"2.0.0.0/12\"}\n" +
+				"{\"country\":\"DE\",\"cidr\":\"2001:db8::/32\"}\n" +
+				"{\"country\":\"DE\",\"cidr\":\"2a02:1:2::/48\"}\n",
+		},
+		{
+			name:           "Filtered by an IPv6 super-net",
+			query:          "country=DE&ipv6_aggregate=48&within=" + url.QueryEscape("2a02::/16"),
+			expectedStatus: http.StatusOK,
+			expectedBody:   "2a02:1:2::/48\n",
+		},
+		{
+			name:           "Unsupported level",
+			query:          "country=DE&ipv6_aggregate=32",
+			expectedStatus: http.StatusBadRequest,
+			expectedBody:   "Invalid ipv6_aggregate parameter\n",
+		},
+		{
+			name:           "Not a number",
+			query:          "country=DE&ipv6_aggregate=wide",
+			expectedStatus: http.StatusBadRequest,
+			expectedBody:   "Invalid ipv6_aggregate parameter\n",
+		},
+		{
+			name:           "IPv4-only format",
+			query:          "country=DE&format=netmask&ipv6_aggregate=48",
+			expectedStatus: http.StatusBadRequest,
+			expectedBody:   "Invalid format parameter for ipv6_aggregate\n",
+		},
+		{
+			name:           "Grouped by registry",
+			query:          "country=DE&groupby=registry&ipv6_aggregate=48",
+			expectedStatus: http.StatusBadRequest,
+			expectedBody:   "Invalid groupby parameter for ipv6_aggregate\n",
+		},
+		{
+			name:           "Processor error",
+			query:          "country=DE&ipv6_aggregate=48",
+			err:            ipdata.ErrBadUpstreamData,
+			expectedStatus: http.StatusBadGateway,
+			expectedBody:   "Error processing request: " + ipdata.ErrBadUpstreamData.Error() + "\n",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			mockProc := &MockProcessor{
+				ipLists: map[string][]string{
+					"DE": {"2.0.0.0/12"},
+					"FR": {"5.0.0.0/16"},
+				},
+				ipv6Lists: map[string][]string{
+					"DE": {"2001:db8::/32", "2a02:1:2:345::/64"},
+				},
+			}
+			h := NewHandler(mockProc, &config.Config{MaxCountries: 3, StrictQuery: true})
+			mockProc.err = tc.err
+
+			rr := httptest.NewRecorder()
+			http.HandlerFunc(h.getIpListHandler).ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/get?"+tc.query, nil))
+
+			if rr.Code != tc.expectedStatus {
+				t.Errorf("handler returned wrong status code: got %v want %v", rr.Code, tc.expectedStatus)
+			}
+			if rr.Body.String() != tc.expectedBody {
+				t.Errorf("handler returned unexpected body: got %q want %q", rr.Body.String(), tc.expectedBody)
+			}
+		})
+	}
+}
+
+func TestGetIpListHandlerIPv6AggregateLookupError(t *testing.T) {
+	mockProc := &failingIPv6Processor{MockProcessor: MockProcessor{ipLists: map[string][]string{"DE": {"2.0.0.0/12"}}}}
+	h := NewHandler(mockProc, &config.Config{})
+
+	rr := httptest.NewRecorder()
+	http.HandlerFunc(h.getIpListHandler).ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/get?country=DE&ipv6_aggregate=48", nil))
+
+	if rr.Code != http.StatusBadGateway {
+		t.Errorf("handler returned wrong status code: got %v want %v", rr.Code, http.StatusBadGateway)
+	}
+}
+
+// failingIPv6Processor serves IPv4 lists but fails IPv6 lookups
+type failingIPv6Processor struct {
+	MockProcessor
+}
+
+func (m *failingIPv6Processor) GetIPv6ListForCountry(countryCode string) ([]string, error) {
+	return nil, ipdata.ErrBadUpstreamData
+}
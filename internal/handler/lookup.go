@@ -0,0 +1,67 @@
+package handler
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// lookupQueryParams lists the query parameters recognized by the /lookup endpoint
+var lookupQueryParams = []string{"ip", "auth"}
+
+// lookupResponse is the JSON body returned by the lookup endpoint
+type lookupResponse struct {
+	IP      string `json:"ip"`
+	Version string `json:"version"`
+	Country string `json:"country"`
+}
+
+// lookupHandler handles requests for the country an IPv4 or IPv6 address is allocated to
+func (h *Handler) lookupHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if !h.requireAuth(w, r) {
+		return
+	}
+
+	if !h.checkQueryParams(w, r, lookupQueryParams) {
+		return
+	}
+
+	value := strings.TrimSpace(r.URL.Query().Get("ip"))
+	if value == "" {
+		http.Error(w, "Missing ip parameter", http.StatusBadRequest)
+		return
+	}
+	ip := net.ParseIP(value)
+	if ip == nil {
+		http.Error(w, "Invalid ip parameter", http.StatusBadRequest)
+		return
+	}
+
+	country, found, err := h.processor.LookupCountry(ip)
+	if err != nil {
+		writeProcessingError(w, err)
+		return
+	}
+	if !found {
+		http.Error(w, "No allocation found for address", http.StatusNotFound)
+		return
+	}
+
+	version := "ipv6"
+	if ip.To4() != nil {
+		version = "ipv4"
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(lookupResponse{
+		IP:      ip.String(),
+		Version: version,
+		Country: country,
+	})
+}
@@ -0,0 +1,109 @@
+package handler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/anisimovdk/ip-whitelist-by-country/internal/config"
+	"github.com/anisimovdk/ip-whitelist-by-country/internal/ipdata"
+)
+
+func TestLookupHandler(t *testing.T) {
+	testCases := []struct {
+		name           string
+		method         string
+		query          string
+		token          string
+		err            error
+		expectedStatus int
+		expectedBody   string
+	}{
+		{
+			name:           "IPv4 address",
+			method:         http.MethodGet,
+			query:          "ip=192.0.2.10",
+			expectedStatus: http.StatusOK,
+			expectedBody:   "{\"ip\":\"192.0.2.10\",\"version\":\"ipv4\",\"country\":\"BR\"}\n",
+		},
+		{
+			name:           "IPv6 address",
+			method:         http.MethodGet,
+			query:          "ip=" + url.QueryEscape("2001:DB8::1"),
+			expectedStatus: http.StatusOK,
+			expectedBody:   "{\"ip\":\"2001:db8::1\",\"version\":\"ipv6\",\"country\":\"DE\"}\n",
+		},
+		{
+			name:           "Unallocated address",
+			method:         http.MethodGet,
+			query:          "ip=198.51.100.1",
+			expectedStatus: http.StatusNotFound,
+			expectedBody:   "No allocation found for address\n",
+		},
+		{
+			name:           "Malformed address",
+			method:         http.MethodGet,
+			query:          "ip=192.0.2.256",
+			expectedStatus: http.StatusBadRequest,
+			expectedBody:   "Invalid ip parameter\n",
+		},
+		{
+			name:           "Missing address",
+			method:         http.MethodGet,
+			query:          "",
+			expectedStatus: http.StatusBadRequest,
+			expectedBody:   "Missing ip parameter\n",
+		},
+		{
+			name:           "Unauthorized",
+			method:         http.MethodGet,
+			query:          "ip=192.0.2.10",
+			token:          "secret",
+			expectedStatus: http.StatusUnauthorized,
+			expectedBody:   "Unauthorized\n",
+		},
+		{
+			name:           "Processor error",
+			method:         http.MethodGet,
+			query:          "ip=192.0.2.10",
+			err:            ipdata.ErrBadUpstreamData,
+			expectedStatus: http.StatusBadGateway,
+			expectedBody:   "Error processing request: " + ipdata.ErrBadUpstreamData.Error() + "\n",
+		},
+		{
+			name:           "Wrong method",
+			method:         http.MethodPost,
+			query:          "ip=192.0.2.10",
+			expectedStatus: http.StatusMethodNotAllowed,
+			expectedBody:   "Method not allowed\n",
+		},
+		{
+			name:           "Unknown parameter",
+			method:         http.MethodGet,
+			query:          "ip=192.0.2.10&country=BR",
+			expectedStatus: http.StatusBadRequest,
+			expectedBody:   "Unknown query parameters: country\n",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			mockProc := &MockProcessor{
+				lookups: map[string]string{"192.0.2.10": "BR", "2001:db8::1": "DE"},
+				err:     tc.err,
+			}
+			h := NewHandler(mockProc, &config.Config{AuthToken: tc.token, StrictQuery: true})
+
+			rr := httptest.NewRecorder()
+			http.HandlerFunc(h.lookupHandler).ServeHTTP(rr, httptest.NewRequest(tc.method, "/lookup?"+tc.query, nil))
+
+			if rr.Code != tc.expectedStatus {
+				t.Errorf("handler returned wrong status code: got %v want %v", rr.Code, tc.expectedStatus)
+			}
+			if rr.Body.String() != tc.expectedBody {
+				t.Errorf("handler returned unexpected body: got %q want %q", rr.Body.String(), tc.expectedBody)
+			}
+		})
+	}
+}
@@ -0,0 +1,57 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+)
+
+// maintenanceRetryAfter is the Retry-After value, in seconds, sent while in maintenance mode
+const maintenanceRetryAfter = "300"
+
+// maintenanceQueryParams lists the query parameters recognized by the /maintenance endpoint
+var maintenanceQueryParams = []string{"enabled", "auth"}
+
+// maintenanceResponse is the JSON body returned by the maintenance endpoint
+type maintenanceResponse struct {
+	Maintenance bool `json:"maintenance"`
+}
+
+// writeMaintenance answers a request with the fixed maintenance response
+func writeMaintenance(w http.ResponseWriter) {
+	w.Header().Set("Retry-After", maintenanceRetryAfter)
+	http.Error(w, "Service under maintenance, please retry later", http.StatusServiceUnavailable)
+}
+
+// maintenanceHandler reports maintenance mode on GET and switches it on PUT or
+// POST with the enabled query parameter
+func (h *Handler) maintenanceHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet, http.MethodPut, http.MethodPost:
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if !h.requireAuth(w, r) {
+		return
+	}
+
+	if !h.checkQueryParams(w, r, maintenanceQueryParams) {
+		return
+	}
+
+	if r.Method != http.MethodGet {
+		enabled, err := strconv.ParseBool(r.URL.Query().Get("enabled"))
+		if err != nil {
+			http.Error(w, "Invalid enabled parameter", http.StatusBadRequest)
+			return
+		}
+		if h.maintenance.Swap(enabled) != enabled {
+			logRequestf(r, "Maintenance mode set to %t\n", enabled)
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(maintenanceResponse{Maintenance: h.maintenance.Load()})
+}
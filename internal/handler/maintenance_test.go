@@ -0,0 +1,168 @@
+package handler
+
+import (
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/anisimovdk/ip-whitelist-by-country/internal/config"
+)
+
+func TestGetIpListHandlerMaintenance(t *testing.T) {
+	testCases := []struct {
+		name           string
+		maintenance    bool
+		expectedStatus int
+		expectedBody   string
+		retryAfter     string
+	}{
+		{
+			name:           "Maintenance mode on",
+			maintenance:    true,
+			expectedStatus: http.StatusServiceUnavailable,
+			expectedBody:   "Service under maintenance, please retry later\n",
+			retryAfter:     maintenanceRetryAfter,
+		},
+		{
+			name:           "Maintenance mode off",
+			maintenance:    false,
+			expectedStatus: http.StatusOK,
+			expectedBody:   "192.168.1.0/24\n",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			mockProc := &MockProcessor{ipLists: map[string][]string{"US": {"192.168.1.0/24"}}, ready: true}
+			h := NewHandler(mockProc, &config.Config{Maintenance: tc.maintenance})
+			mux := http.NewServeMux()
+			h.RegisterRoutesOn(mux)
+
+			rr := httptest.NewRecorder()
+			mux.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/get?country=US", nil))
+
+			if rr.Code != tc.expectedStatus {
+				t.Errorf("handler returned wrong status code: got %v want %v", rr.Code, tc.expectedStatus)
+			}
+			if rr.Body.String() != tc.expectedBody {
+				t.Errorf("handler returned unexpected body: got %q want %q", rr.Body.String(), tc.expectedBody)
+			}
+			if got := rr.Header().Get("Retry-After"); got != tc.retryAfter {
+				t.Errorf("Retry-After = %q, want %q", got, tc.retryAfter)
+			}
+
+			// Probes and the index stay responsive either way
+			for _, path := range []string{"/livez", "/readyz", "/"} {
+				rr := httptest.NewRecorder()
+				mux.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, path, nil))
+				if rr.Code != http.StatusOK {
+					t.Errorf("%s returned status %d, want %d", path, rr.Code, http.StatusOK)
+				}
+			}
+		})
+	}
+}
+
+func TestMaintenanceHandler(t *testing.T) {
+	origOutput := log.Writer()
+	log.SetOutput(io.Discard)
+	t.Cleanup(func() { log.SetOutput(origOutput) })
+
+	mockProc := &MockProcessor{ipLists: map[string][]string{"US": {"192.168.1.0/24"}}}
+	h := NewHandler(mockProc, &config.Config{AuthToken: "secret", StrictQuery: true})
+
+	// Each step runs against the state left by the previous one
+	steps := []struct {
+		name           string
+		method         string
+		query          string
+		expectedStatus int
+		expectedBody   string
+		getStatus      int
+	}{
+		{
+			name:           "Initially off",
+			method:         http.MethodGet,
+			query:          "auth=secret",
+			expectedStatus: http.StatusOK,
+			expectedBody:   "{\"maintenance\":false}\n",
+			getStatus:      http.StatusOK,
+		},
+		{
+			name:           "Turn on",
+			method:         http.MethodPut,
+			query:          "enabled=true&auth=secret",
+			expectedStatus: http.StatusOK,
+			expectedBody:   "{\"maintenance\":true}\n",
+			getStatus:      http.StatusServiceUnavailable,
+		},
+		{
+			name:           "Turn on again",
+			method:         http.MethodPost,
+			query:          "enabled=1&auth=secret",
+			expectedStatus: http.StatusOK,
+			expectedBody:   "{\"maintenance\":true}\n",
+			getStatus:      http.StatusServiceUnavailable,
+		},
+		{
+			name:           "Unauthorized toggle",
+			method:         http.MethodPut,
+			query:          "enabled=false",
+			expectedStatus: http.StatusUnauthorized,
+			expectedBody:   "Unauthorized\n",
+			getStatus:      http.StatusServiceUnavailable,
+		},
+		{
+			name:           "Invalid enabled value",
+			method:         http.MethodPut,
+			query:          "enabled=maybe&auth=secret",
+			expectedStatus: http.StatusBadRequest,
+			expectedBody:   "Invalid enabled parameter\n",
+			getStatus:      http.StatusServiceUnavailable,
+		},
+		{
+			name:           "Unknown parameter",
+			method:         http.MethodPut,
+			query:          "enabled=false&auth=secret&for=1h",
+			expectedStatus: http.StatusBadRequest,
+			expectedBody:   "Unknown query parameters: for\n",
+			getStatus:      http.StatusServiceUnavailable,
+		},
+		{
+			name:           "Wrong method",
+			method:         http.MethodDelete,
+			query:          "auth=secret",
+			expectedStatus: http.StatusMethodNotAllowed,
+			expectedBody:   "Method not allowed\n",
+			getStatus:      http.StatusServiceUnavailable,
+		},
+		{
+			name:           "Turn off",
+			method:         http.MethodPut,
+			query:          "enabled=false&auth=secret",
+			expectedStatus: http.StatusOK,
+			expectedBody:   "{\"maintenance\":false}\n",
+			getStatus:      http.StatusOK,
+		},
+	}
+
+	for _, step := range steps {
+		rr := httptest.NewRecorder()
+		http.HandlerFunc(h.maintenanceHandler).ServeHTTP(rr, httptest.NewRequest(step.method, "/maintenance?"+step.query, nil))
+
+		if rr.Code != step.expectedStatus {
+			t.Errorf("%s: handler returned wrong status code: got %v want %v", step.name, rr.Code, step.expectedStatus)
+		}
+		if rr.Body.String() != step.expectedBody {
+			t.Errorf("%s: handler returned unexpected body: got %q want %q", step.name, rr.Body.String(), step.expectedBody)
+		}
+
+		rr = httptest.NewRecorder()
+		http.HandlerFunc(h.getIpListHandler).ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/get?country=US&auth=secret", nil))
+		if rr.Code != step.getStatus {
+			t.Errorf("%s: /get returned status %d, want %d", step.name, rr.Code, step.getStatus)
+		}
+	}
+}
@@ -0,0 +1,72 @@
+package handler
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"slices"
+	"time"
+)
+
+// manifestQueryParams lists the query parameters recognized by the /manifest endpoint
+var manifestQueryParams = []string{"country", "auth"}
+
+// manifestResponse is the JSON body returned by the manifest endpoint
+type manifestResponse struct {
+	Country    string    `json:"country"`
+	CIDRCount  int       `json:"cidr_count"`
+	SHA256     string    `json:"sha256"`
+	DataSource string    `json:"data_source"`
+	Generated  time.Time `json:"generated,omitzero"`
+}
+
+// manifestHandler handles requests for a verifiable fingerprint of a country's list
+func (h *Handler) manifestHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if !h.requireAuth(w, r) {
+		return
+	}
+
+	if !h.checkQueryParams(w, r, manifestQueryParams) {
+		return
+	}
+
+	country, ok := h.countryParam(w, r)
+	if !ok {
+		return
+	}
+
+	// One snapshot, so a refresh cannot pair the hash with another download's source and time
+	snapshot, err := h.processor.GetIPListSnapshot(country)
+	if err != nil {
+		writeProcessingError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(manifestResponse{
+		Country:    country,
+		CIDRCount:  len(snapshot.CIDRs),
+		SHA256:     listDigest(snapshot.CIDRs),
+		DataSource: snapshot.DataSource,
+		Generated:  snapshot.DataTime.UTC(),
+	})
+}
+
+// listDigest returns the hex SHA-256 of the lexically sorted CIDR list with
+// every entry terminated by a line feed, so the hash does not depend on the
+// order the blocks were served in
+func listDigest(ipList []string) string {
+	sorted := slices.Sorted(slices.Values(ipList))
+	hash := sha256.New()
+	for _, cidr := range sorted {
+		hash.Write([]byte(cidr))
+		hash.Write([]byte{'\n'})
+	}
+	return hex.EncodeToString(hash.Sum(nil))
+}
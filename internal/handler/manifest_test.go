@@ -0,0 +1,156 @@
+package handler
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/anisimovdk/ip-whitelist-by-country/internal/config"
+	"github.com/anisimovdk/ip-whitelist-by-country/internal/ipdata"
+)
+
+func TestListDigest(t *testing.T) {
+	base := listDigest([]string{"10.0.0.0/8", "1.2.3.0/24", "192.168.0.0/16"})
+
+	sum := sha256.Sum256([]byte("1.2.3.0/24\n10.0.0.0/8\n192.168.0.0/16\n"))
+	if want := hex.EncodeToString(sum[:]); base != want {
+		t.Errorf("listDigest() = %s, want %s", base, want)
+	}
+
+	testCases := []struct {
+		name   string
+		ipList []string
+		same   bool
+	}{
+		{name: "Identical data", ipList: []string{"10.0.0.0/8", "1.2.3.0/24", "192.168.0.0/16"}, same: true},
+		{name: "Reordered data", ipList: []string{"192.168.0.0/16", "10.0.0.0/8", "1.2.3.0/24"}, same: true},
+		{name: "Block removed", ipList: []string{"10.0.0.0/8", "1.2.3.0/24"}, same: false},
+		{name: "Block changed", ipList: []string{"10.0.0.0/8", "1.2.3.0/24", "192.168.0.0/17"}, same: false},
+		{name: "Empty list", ipList: nil, same: false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := listDigest(tc.ipList); (got == base) != tc.same {
+				t.Errorf("listDigest(%v) = %s, base %s, want same=%v", tc.ipList, got, base, tc.same)
+			}
+		})
+	}
+}
+
+func TestListDigestDoesNotReorderInput(t *testing.T) {
+	ipList := []string{"10.0.0.0/8", "1.2.3.0/24"}
+	listDigest(ipList)
+	if ipList[0] != "10.0.0.0/8" || ipList[1] != "1.2.3.0/24" {
+		t.Errorf("listDigest() modified its input: %v", ipList)
+	}
+}
+
+func TestManifestHandler(t *testing.T) {
+	generated := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	mockProc := &MockProcessor{
+		ipLists:  map[string][]string{"DE": {"10.0.0.0/8", "1.2.3.0/24"}},
+		source:   ipdata.DataSourceLive,
+		dataTime: generated,
+	}
+	h := NewHandler(mockProc, &config.Config{})
+
+	rr := httptest.NewRecorder()
+	http.HandlerFunc(h.manifestHandler).ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/manifest?country=de", nil))
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("handler returned wrong status code: got %v want %v", rr.Code, http.StatusOK)
+	}
+	if ct := rr.Header().Get("Content-Type"); ct != "application/json" {
+		t.Errorf("Content-Type = %q, want %q", ct, "application/json")
+	}
+
+	var got manifestResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &got); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	want := manifestResponse{
+		Country:    "DE",
+		CIDRCount:  2,
+		SHA256:     listDigest(mockProc.ipLists["DE"]),
+		DataSource: "live",
+		Generated:  generated,
+	}
+	if got != want {
+		t.Errorf("manifest = %+v, want %+v", got, want)
+	}
+}
+
+func TestManifestHandlerErrors(t *testing.T) {
+	testCases := []struct {
+		name           string
+		method         string
+		query          string
+		token          string
+		err            error
+		expectedStatus int
+		expectedBody   string
+	}{
+		{
+			name:           "Missing country",
+			method:         http.MethodGet,
+			query:          "",
+			expectedStatus: http.StatusBadRequest,
+			expectedBody:   "Missing country parameter\n",
+		},
+		{
+			name:           "Unauthorized",
+			method:         http.MethodGet,
+			query:          "country=DE",
+			token:          "secret",
+			expectedStatus: http.StatusUnauthorized,
+			expectedBody:   "Unauthorized\n",
+		},
+		{
+			name:           "Processor error",
+			method:         http.MethodGet,
+			query:          "country=DE",
+			err:            ipdata.ErrBadUpstreamData,
+			expectedStatus: http.StatusBadGateway,
+			expectedBody:   "Error processing request: " + ipdata.ErrBadUpstreamData.Error() + "\n",
+		},
+		{
+			name:           "Wrong method",
+			method:         http.MethodPost,
+			query:          "country=DE",
+			expectedStatus: http.StatusMethodNotAllowed,
+			expectedBody:   "Method not allowed\n",
+		},
+		{
+			name:           "Unknown parameter",
+			method:         http.MethodGet,
+			query:          "country=DE&format=cidr",
+			expectedStatus: http.StatusBadRequest,
+			expectedBody:   "Unknown query parameters: format\n",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			mockProc := &MockProcessor{
+				ipLists: map[string][]string{"DE": {"10.0.0.0/8"}},
+				err:     tc.err,
+			}
+			h := NewHandler(mockProc, &config.Config{AuthToken: tc.token, StrictQuery: true})
+
+			rr := httptest.NewRecorder()
+			http.HandlerFunc(h.manifestHandler).ServeHTTP(rr, httptest.NewRequest(tc.method, "/manifest?"+tc.query, nil))
+
+			if rr.Code != tc.expectedStatus {
+				t.Errorf("handler returned wrong status code: got %v want %v", rr.Code, tc.expectedStatus)
+			}
+			if rr.Body.String() != tc.expectedBody {
+				t.Errorf("handler returned unexpected body: got %q want %q", rr.Body.String(), tc.expectedBody)
+			}
+		})
+	}
+}
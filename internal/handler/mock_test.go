@@ -0,0 +1,54 @@
+package handler
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/anisimovdk/ip-whitelist-by-country/internal/ipdata"
+)
+
+// TestMockParity checks that every processor mock implements the interfaces
+// it stands in for and has no exported methods beyond them, so a method
+// renamed or dropped from an interface cannot linger in a mock
+func TestMockParity(t *testing.T) {
+	testCases := []struct {
+		name       string
+		mock       reflect.Type
+		interfaces []reflect.Type
+	}{
+		{
+			name:       "MockProcessor",
+			mock:       reflect.TypeFor[*MockProcessor](),
+			interfaces: []reflect.Type{reflect.TypeFor[ipdata.IPProcessor](), reflect.TypeFor[CountryLister]()},
+		},
+		{
+			name:       "listErrorProcessor",
+			mock:       reflect.TypeFor[listErrorProcessor](),
+			interfaces: []reflect.Type{reflect.TypeFor[CountryLister]()},
+		},
+		{
+			name:       "notifyingProcessor",
+			mock:       reflect.TypeFor[*notifyingProcessor](),
+			interfaces: []reflect.Type{reflect.TypeFor[CountryLister](), reflect.TypeFor[refreshNotifier]()},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			declared := make(map[string]bool)
+			for _, iface := range tc.interfaces {
+				if !tc.mock.Implements(iface) {
+					t.Errorf("%s does not implement %s", tc.mock, iface)
+				}
+				for method := range iface.Methods() {
+					declared[method.Name] = true
+				}
+			}
+			for method := range tc.mock.Methods() {
+				if !declared[method.Name] {
+					t.Errorf("%s has method %s that none of its interfaces declare", tc.mock, method.Name)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,45 @@
+package handler
+
+import (
+	_ "embed"
+	"encoding/json"
+	"net/http"
+
+	"github.com/anisimovdk/ip-whitelist-by-country/internal/version"
+)
+
+// openapiSpec is the OpenAPI 3 description of the routes registered by
+// RegisterRoutesOn and RegisterAdminRoutesOn. Keep it in step with the
+// handlers: the tests check it lists every route and query parameter.
+//
+//go:embed openapi.json
+var openapiSpec []byte
+
+// openapiDocument returns spec with its info.version set to the running version
+func openapiDocument(spec []byte) ([]byte, error) {
+	var doc map[string]any
+	if err := json.Unmarshal(spec, &doc); err != nil {
+		return nil, err
+	}
+	if info, ok := doc["info"].(map[string]any); ok {
+		info["version"] = version.GetVersion()
+	}
+	return json.Marshal(doc)
+}
+
+// openapiHandler serves the OpenAPI description of the API. Like the index it
+// needs no auth token.
+func (h *Handler) openapiHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	doc, err := openapiDocument(openapiSpec)
+	if err != nil {
+		http.Error(w, "Error processing request: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(doc)
+}
@@ -0,0 +1,205 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/anisimovdk/ip-whitelist-by-country/internal/config"
+	"github.com/anisimovdk/ip-whitelist-by-country/internal/version"
+)
+
+// openapiParameter is the subset of an OpenAPI parameter object the tests check
+type openapiParameter struct {
+	Ref      string `json:"$ref"`
+	Name     string `json:"name"`
+	In       string `json:"in"`
+	Required bool   `json:"required"`
+}
+
+// openapiOperation is the subset of an OpenAPI operation object the tests check
+type openapiOperation struct {
+	Parameters []openapiParameter         `json:"parameters"`
+	Responses  map[string]json.RawMessage `json:"responses"`
+}
+
+// openapiTestDocument is the subset of the OpenAPI document the tests check
+type openapiTestDocument struct {
+	OpenAPI string `json:"openapi"`
+	Info    struct {
+		Version string `json:"version"`
+	} `json:"info"`
+	Paths      map[string]map[string]openapiOperation `json:"paths"`
+	Components struct {
+		Parameters map[string]openapiParameter `json:"parameters"`
+	} `json:"components"`
+}
+
+// fetchOpenAPI requests /openapi.json and decodes the document
+func fetchOpenAPI(t *testing.T) openapiTestDocument {
+	t.Helper()
+
+	h := NewHandler(&MockProcessor{}, &config.Config{AuthToken: "secret", StrictQuery: true})
+	rr := httptest.NewRecorder()
+	h.openapiHandler(rr, httptest.NewRequest(http.MethodGet, "/openapi.json", nil))
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("/openapi.json returned status %d, want %d", rr.Code, http.StatusOK)
+	}
+	if ct := rr.Header().Get("Content-Type"); ct != "application/json" {
+		t.Errorf("Content-Type = %q, want application/json", ct)
+	}
+
+	var doc openapiTestDocument
+	if err := json.Unmarshal(rr.Body.Bytes(), &doc); err != nil {
+		t.Fatalf("/openapi.json is not valid JSON: %v", err)
+	}
+	return doc
+}
+
+// parameterNames returns the names of the operation's query parameters,
+// resolving references to the shared component parameters
+func (doc openapiTestDocument) parameterNames(t *testing.T, op openapiOperation) []string {
+	t.Helper()
+
+	var names []string
+	for _, param := range op.Parameters {
+		if param.Ref != "" {
+			resolved, ok := doc.Components.Parameters[strings.TrimPrefix(param.Ref, "#/components/parameters/")]
+			if !ok {
+				t.Fatalf("unresolved parameter reference %q", param.Ref)
+			}
+			param = resolved
+		}
+		if param.In != "query" {
+			t.Errorf("parameter %q is in %q, want query", param.Name, param.In)
+		}
+		names = append(names, param.Name)
+	}
+	slices.Sort(names)
+	return names
+}
+
+func TestOpenAPIHandler(t *testing.T) {
+	doc := fetchOpenAPI(t)
+
+	if !strings.HasPrefix(doc.OpenAPI, "3.") {
+		t.Errorf("openapi = %q, want a 3.x version", doc.OpenAPI)
+	}
+	if doc.Info.Version != version.GetVersion() {
+		t.Errorf("info.version = %q, want %q", doc.Info.Version, version.GetVersion())
+	}
+
+	get, ok := doc.Paths["/get"]["get"]
+	if !ok {
+		t.Fatal("document has no GET /get operation")
+	}
+	for _, status := range []string{"200", "400", "401", "503"} {
+		if _, ok := get.Responses[status]; !ok {
+			t.Errorf("GET /get does not document status %s", status)
+		}
+	}
+	for _, param := range get.Parameters {
+		if param.Name == "country" && !param.Required {
+			t.Error("country parameter of GET /get is not required")
+		}
+	}
+}
+
+func TestOpenAPIQueryParams(t *testing.T) {
+	doc := fetchOpenAPI(t)
+
+	testCases := []struct {
+		path    string
+		method  string
+		allowed []string
+	}{
+		{path: "/get", method: "get", allowed: getQueryParams},
+		{path: "/provenance", method: "get", allowed: provenanceQueryParams},
+		{path: "/asns", method: "get", allowed: asnsQueryParams},
+		{path: "/manifest", method: "get", allowed: manifestQueryParams},
+		{path: "/count", method: "get", allowed: countQueryParams},
+		{path: "/compare", method: "get", allowed: compareQueryParams},
+		{path: "/lookup", method: "get", allowed: lookupQueryParams},
+		{path: "/export", method: "get", allowed: exportQueryParams},
+		{path: "/healthz/upstream", method: "get", allowed: upstreamQueryParams},
+		{path: "/maintenance", method: "put", allowed: maintenanceQueryParams},
+		{path: "/config", method: "get", allowed: configQueryParams},
+		{path: "/stats", method: "get", allowed: statsQueryParams},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.path, func(t *testing.T) {
+			op, ok := doc.Paths[tc.path][tc.method]
+			if !ok {
+				t.Fatalf("document has no %s %s operation", strings.ToUpper(tc.method), tc.path)
+			}
+
+			want := slices.Sorted(slices.Values(tc.allowed))
+			if got := doc.parameterNames(t, op); !slices.Equal(got, want) {
+				t.Errorf("documented parameters = %v, want %v", got, want)
+			}
+		})
+	}
+}
+
+func TestOpenAPIListsEveryRoute(t *testing.T) {
+	doc := fetchOpenAPI(t)
+
+	mux := http.NewServeMux()
+	h := NewHandler(&MockProcessor{}, &config.Config{})
+	h.RegisterRoutesOn(mux)
+
+	rr := httptest.NewRecorder()
+	mux.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/", nil))
+	var index indexResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &index); err != nil {
+		t.Fatalf("failed to decode the index: %v", err)
+	}
+
+	for _, endpoint := range append(index.Endpoints, "/") {
+		if _, ok := doc.Paths[endpoint]; !ok {
+			t.Errorf("document does not describe %s", endpoint)
+		}
+	}
+	if len(doc.Paths) != len(index.Endpoints)+1 {
+		t.Errorf("document describes %d paths, the index lists %d endpoints plus /", len(doc.Paths), len(index.Endpoints))
+	}
+}
+
+func TestOpenAPIHandler_MethodNotAllowed(t *testing.T) {
+	h := NewHandler(&MockProcessor{}, &config.Config{})
+	rr := httptest.NewRecorder()
+	h.openapiHandler(rr, httptest.NewRequest(http.MethodPost, "/openapi.json", nil))
+
+	if rr.Code != http.StatusMethodNotAllowed {
+		t.Errorf("handler returned wrong status code: got %v want %v", rr.Code, http.StatusMethodNotAllowed)
+	}
+}
+
+func TestOpenAPIHandler_InvalidSpec(t *testing.T) {
+	oldSpec := openapiSpec
+	t.Cleanup(func() { openapiSpec = oldSpec })
+	openapiSpec = []byte("{")
+
+	h := NewHandler(&MockProcessor{}, &config.Config{})
+	rr := httptest.NewRecorder()
+	h.openapiHandler(rr, httptest.NewRequest(http.MethodGet, "/openapi.json", nil))
+
+	if rr.Code != http.StatusInternalServerError {
+		t.Errorf("handler returned wrong status code: got %v want %v", rr.Code, http.StatusInternalServerError)
+	}
+}
+
+func TestOpenAPIDocument_WithoutInfo(t *testing.T) {
+	doc, err := openapiDocument([]byte(`{"openapi":"3.0.3"}`))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if string(doc) != `{"openapi":"3.0.3"}` {
+		t.Errorf("document = %s, want it unchanged", doc)
+	}
+}
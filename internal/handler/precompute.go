@@ -0,0 +1,95 @@
+package handler
+
+import (
+	"context"
+	"log"
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/anisimovdk/ip-whitelist-by-country/internal/ipdata"
+)
+
+// refreshNotifier is an IP processor that reports when it has loaded new data
+type refreshNotifier interface {
+	OnRefresh(fn func())
+}
+
+// Ensure Processor implements refreshNotifier, NewHandler only precomputes for processors that do
+var _ refreshNotifier = (*ipdata.Processor)(nil)
+
+// precomputeTarget is a country and output format rendered after each refresh
+type precomputeTarget struct {
+	country string
+	format  string
+}
+
+// renderCache holds the /get bodies of the precompute targets, rendered with
+// the default options from the data loaded at dataTime
+type renderCache struct {
+	mu       sync.RWMutex
+	dataTime time.Time
+	bodies   map[precomputeTarget][]byte
+}
+
+// precomputeTargets parses a list of CC=format pairs, e.g. "DE=cidr,US=netmask".
+// Invalid entries are logged and skipped.
+func precomputeTargets(spec string, aliases map[string]string) []precomputeTarget {
+	var targets []precomputeTarget
+	for _, entry := range strings.Split(spec, ",") {
+		if strings.TrimSpace(entry) == "" {
+			continue
+		}
+		country, format, ok := strings.Cut(entry, "=")
+		country = normalizeCountry(country)
+		format = strings.TrimSpace(format)
+		if _, known := outputFormats[format]; !ok || !known || !isUpperAlpha2(country) {
+			log.Printf("Ignoring invalid precompute entry %q\n", strings.TrimSpace(entry))
+			continue
+		}
+		if canonical, ok := aliases[country]; ok {
+			country = canonical
+		}
+		targets = append(targets, precomputeTarget{country: country, format: format})
+	}
+	return targets
+}
+
+// precompute renders the precompute targets from the current data, replacing
+// the bodies rendered from earlier data. Targets that fail are left out and
+// rendered on demand.
+func (h *Handler) precompute() {
+	dataTime := h.processor.DataTime()
+	bodies := make(map[precomputeTarget][]byte, len(h.precomputeTargets))
+	for _, target := range h.precomputeTargets {
+		ipList, err := h.processor.GetIPListForCountry(target.country)
+		if err != nil {
+			slog.Error("Precomputing failed", "country", target.country, "format", target.format, "error", err)
+			continue
+		}
+		format := outputFormats[target.format]
+		if format.transform != nil {
+			ipList = format.transform(ipList)
+		}
+		bodies[target], _ = renderGroupsContext(context.Background(),
+			[]countryBlocks{{country: target.country, cidrs: ipList}}, format, separators["lf"])
+	}
+
+	h.rendered.mu.Lock()
+	defer h.rendered.mu.Unlock()
+	h.rendered.dataTime = dataTime
+	h.rendered.bodies = bodies
+}
+
+// precomputed returns the body rendered for the country and format after the
+// last refresh, unless the data has changed since
+func (h *Handler) precomputed(country, format string) ([]byte, bool) {
+	h.rendered.mu.RLock()
+	defer h.rendered.mu.RUnlock()
+	body, ok := h.rendered.bodies[precomputeTarget{country: country, format: format}]
+	if !ok || !h.rendered.dataTime.Equal(h.processor.DataTime()) {
+		return nil, false
+	}
+	return body, true
+}
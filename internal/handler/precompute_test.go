@@ -0,0 +1,201 @@
+package handler
+
+import (
+	"bytes"
+	"errors"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/anisimovdk/ip-whitelist-by-country/internal/config"
+)
+
+func TestPrecomputeTargets(t *testing.T) {
+	testCases := []struct {
+		name        string
+		spec        string
+		expected    []precomputeTarget
+		expectedLog string
+	}{
+		{name: "Empty", spec: ""},
+		{
+			name:     "Pairs",
+			spec:     "DE=cidr, us=netmask,DE=complement",
+			expected: []precomputeTarget{{"DE", "cidr"}, {"US", "netmask"}, {"DE", "complement"}},
+		},
+		{name: "Alias", spec: "UK=csv", expected: []precomputeTarget{{"GB", "csv"}}},
+		{name: "Unknown format", spec: "DE=xml,FR=cidr", expected: []precomputeTarget{{"FR", "cidr"}}, expectedLog: `"DE=xml"`},
+		{name: "Invalid country", spec: "DEU=cidr", expectedLog: `"DEU=cidr"`},
+		{name: "Missing format", spec: "DE,", expectedLog: `"DE"`},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var logBuf bytes.Buffer
+			origOutput := log.Writer()
+			log.SetOutput(&logBuf)
+			t.Cleanup(func() { log.SetOutput(origOutput) })
+
+			got := precomputeTargets(tc.spec, countryAliases(""))
+			if !reflect.DeepEqual(got, tc.expected) {
+				t.Errorf("precomputeTargets(%q) = %v, want %v", tc.spec, got, tc.expected)
+			}
+			if tc.expectedLog != "" && !strings.Contains(logBuf.String(), tc.expectedLog) {
+				t.Errorf("log = %q, want it to mention %s", logBuf.String(), tc.expectedLog)
+			}
+		})
+	}
+}
+
+// getBody returns the status, Content-Type and body of a /get request
+func getBody(h *Handler, query string) (int, string, string) {
+	rr := httptest.NewRecorder()
+	http.HandlerFunc(h.getIpListHandler).ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/get?"+query, nil))
+	return rr.Code, rr.Header().Get("Content-Type"), rr.Body.String()
+}
+
+func TestPrecomputedMatchesOnDemand(t *testing.T) {
+	for name := range outputFormats {
+		t.Run(name, func(t *testing.T) {
+			mockProc := &MockProcessor{
+				ipLists:  map[string][]string{"US": {"192.168.0.0/24", "10.0.0.0/16"}},
+				dataTime: time.Now(),
+			}
+			onDemand := NewHandler(mockProc, &config.Config{})
+			precomputing := NewHandler(mockProc, &config.Config{PrecomputeFormats: "US=" + name})
+			precomputing.precompute()
+			if _, ok := precomputing.precomputed("US", name); !ok {
+				t.Fatalf("US was not precomputed as %s", name)
+			}
+
+			query := "country=US&format=" + name + "&download=true"
+			wantStatus, wantType, wantBody := getBody(onDemand, query)
+			gotStatus, gotType, gotBody := getBody(precomputing, query)
+			if gotStatus != wantStatus || gotType != wantType || gotBody != wantBody {
+				t.Errorf("precomputed response = %d %q %q, want %d %q %q",
+					gotStatus, gotType, gotBody, wantStatus, wantType, wantBody)
+			}
+		})
+	}
+}
+
+func TestPrecomputedReused(t *testing.T) {
+	mockProc := &MockProcessor{
+		ipLists:  map[string][]string{"US": {"192.168.0.0/24"}},
+		dataTime: time.Now(),
+	}
+	h := NewHandler(mockProc, &config.Config{PrecomputeFormats: "US=netmask"})
+	h.precompute()
+
+	// The precomputed body is served as long as the data is unchanged, so
+	// changing the blocks behind its back shows whether it was reused
+	mockProc.ipLists["US"] = []string{"10.0.0.0/16"}
+
+	testCases := []struct {
+		name     string
+		query    string
+		expected string
+	}{
+		{name: "Precomputed", query: "country=US&format=netmask", expected: "192.168.0.0 255.255.255.0\n"},
+		{name: "Other format", query: "country=US", expected: "10.0.0.0/16\n"},
+		{name: "Other separator", query: "country=US&format=netmask&sep=crlf", expected: "10.0.0.0 255.255.0.0\r\n"},
+		{name: "No trailing newline", query: "country=US&format=netmask&trailing_newline=false", expected: "10.0.0.0 255.255.0.0"},
+		{name: "Within", query: "country=US&format=netmask&within=10.0.0.0/8", expected: "10.0.0.0 255.255.0.0\n"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if _, _, body := getBody(h, tc.query); body != tc.expected {
+				t.Errorf("body = %q, want %q", body, tc.expected)
+			}
+		})
+	}
+
+	// A refresh invalidates the precomputed body
+	mockProc.dataTime = mockProc.dataTime.Add(time.Hour)
+	if _, _, body := getBody(h, "country=US&format=netmask"); body != "10.0.0.0 255.255.0.0\n" {
+		t.Errorf("body after a refresh = %q, want the new blocks", body)
+	}
+	h.precompute()
+	mockProc.ipLists["US"] = []string{"172.16.0.0/12"}
+	if _, _, body := getBody(h, "country=US&format=netmask"); body != "10.0.0.0 255.255.0.0\n" {
+		t.Errorf("body = %q, want the body precomputed after the refresh", body)
+	}
+}
+
+func TestPrecomputedCisco(t *testing.T) {
+	mockProc := &MockProcessor{
+		ipLists:  map[string][]string{"US": {"192.168.0.0/24"}},
+		dataTime: time.Now(),
+	}
+	h := NewHandler(mockProc, &config.Config{PrecomputeFormats: "US=cisco"})
+	h.precompute()
+	mockProc.ipLists["US"] = []string{"10.0.0.0/16"}
+
+	testCases := []struct {
+		name     string
+		query    string
+		expected string
+	}{
+		{name: "Default ACL", query: "country=US&format=cisco", expected: "permit ip 192.168.0.0 0.0.0.255 any\n"},
+		{name: "Explicit default ACL", query: "country=US&format=cisco&acl_action=permit&acl_direction=source", expected: "permit ip 192.168.0.0 0.0.0.255 any\n"},
+		{name: "Other action", query: "country=US&format=cisco&acl_action=deny", expected: "deny ip 10.0.0.0 0.0.255.255 any\n"},
+		{name: "Other direction", query: "country=US&format=cisco&acl_direction=destination", expected: "permit ip any 10.0.0.0 0.0.255.255\n"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if _, _, body := getBody(h, tc.query); body != tc.expected {
+				t.Errorf("body = %q, want %q", body, tc.expected)
+			}
+		})
+	}
+}
+
+func TestPrecomputeFailure(t *testing.T) {
+	mockProc := &MockProcessor{err: errors.New("download failed")}
+	h := NewHandler(mockProc, &config.Config{PrecomputeFormats: "US=cidr"})
+	h.precompute()
+
+	if _, ok := h.precomputed("US", "cidr"); ok {
+		t.Error("a failed render was precomputed")
+	}
+}
+
+// notifyingProcessor records the callbacks registered with OnRefresh
+type notifyingProcessor struct {
+	*MockProcessor
+	callbacks []func()
+}
+
+func (p *notifyingProcessor) OnRefresh(fn func()) {
+	p.callbacks = append(p.callbacks, fn)
+}
+
+func TestPrecomputeOnRefresh(t *testing.T) {
+	mockProc := &notifyingProcessor{MockProcessor: &MockProcessor{
+		ipLists:  map[string][]string{"US": {"192.168.0.0/24"}},
+		dataTime: time.Now(),
+	}}
+
+	NewHandler(mockProc, &config.Config{})
+	if len(mockProc.callbacks) != 0 {
+		t.Fatalf("registered %d callbacks without precompute targets, want 0", len(mockProc.callbacks))
+	}
+
+	h := NewHandler(mockProc, &config.Config{PrecomputeFormats: "US=cidr"})
+	if len(mockProc.callbacks) != 1 {
+		t.Fatalf("registered %d callbacks, want 1", len(mockProc.callbacks))
+	}
+	if _, ok := h.precomputed("US", "cidr"); ok {
+		t.Fatal("US was precomputed before a refresh")
+	}
+	mockProc.callbacks[0]()
+	if body, ok := h.precomputed("US", "cidr"); !ok || string(body) != "192.168.0.0/24\n" {
+		t.Errorf("precomputed US = %q, %v after a refresh", body, ok)
+	}
+}
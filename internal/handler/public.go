@@ -0,0 +1,49 @@
+package handler
+
+import (
+	"log"
+	"net/http"
+	"strings"
+)
+
+// publicCountries parses a comma-separated list of country codes (e.g. "DE,FR")
+// that /get serves without a token. Aliases are resolved and malformed entries
+// are logged and skipped.
+func publicCountries(spec string, aliases map[string]string) map[string]bool {
+	public := make(map[string]bool)
+	for _, entry := range strings.Split(spec, ",") {
+		country := normalizeCountry(entry)
+		if country == "" {
+			continue
+		}
+		if !isUpperAlpha2(country) {
+			log.Printf("Ignoring invalid public country %q\n", strings.TrimSpace(entry))
+			continue
+		}
+		if canonical, ok := aliases[country]; ok {
+			country = canonical
+		}
+		public[country] = true
+	}
+	return public
+}
+
+// isPublicRequest reports whether every country requested from /get is public,
+// so the request needs no token. Malformed lists are not public; the request
+// is authenticated before they are rejected.
+func (h *Handler) isPublicRequest(r *http.Request) bool {
+	param := r.URL.Query().Get("country")
+	if len(h.public) == 0 || param == "" {
+		return false
+	}
+	for _, entry := range strings.Split(param, ",") {
+		country := normalizeCountry(entry)
+		if canonical, ok := h.aliases[country]; ok {
+			country = canonical
+		}
+		if !h.public[country] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,140 @@
+package handler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"testing"
+
+	"github.com/anisimovdk/ip-whitelist-by-country/internal/config"
+)
+
+func TestPublicCountries(t *testing.T) {
+	got := publicCountries(" de,fr ,,UK,DEU,1A", countryAliases(""))
+	want := map[string]bool{"DE": true, "FR": true, "GB": true}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("publicCountries = %v, want %v", got, want)
+	}
+}
+
+func TestGetIpListHandlerPublicCountries(t *testing.T) {
+	testCases := []struct {
+		name           string
+		public         string
+		query          string
+		expectedStatus int
+		expectedBody   string
+	}{
+		{
+			name:           "Public country without token",
+			public:         "DE,FR",
+			query:          "country=DE",
+			expectedStatus: http.StatusOK,
+			expectedBody:   "2.0.0.0/12\n",
+		},
+		{
+			name:           "Public country in lowercase",
+			public:         "DE,FR",
+			query:          "country=de",
+			expectedStatus: http.StatusOK,
+			expectedBody:   "2.0.0.0/12\n",
+		},
+		{
+			name:           "Public countries without token",
+			public:         "DE,FR",
+			query:          "country=" + url.QueryEscape("DE, FR"),
+			expectedStatus: http.StatusOK,
+			expectedBody:   "2.0.0.0/12\n5.0.0.0/16\n",
+		},
+		{
+			name:           "Public through alias",
+			public:         "GB",
+			query:          "country=UK",
+			expectedStatus: http.StatusOK,
+			expectedBody:   "81.2.69.0/24\n",
+		},
+		{
+			name:           "Alias listed as public",
+			public:         "UK",
+			query:          "country=GB",
+			expectedStatus: http.StatusOK,
+			expectedBody:   "81.2.69.0/24\n",
+		},
+		{
+			name:           "Gated country without token",
+			public:         "DE,FR",
+			query:          "country=RU",
+			expectedStatus: http.StatusUnauthorized,
+			expectedBody:   "Unauthorized\n",
+		},
+		{
+			name:           "Gated country with token",
+			public:         "DE,FR",
+			query:          "country=RU&auth=secret",
+			expectedStatus: http.StatusOK,
+			expectedBody:   "5.3.0.0/16\n",
+		},
+		{
+			name:           "Public and gated countries without token",
+			public:         "DE,FR",
+			query:          "country=DE,RU",
+			expectedStatus: http.StatusUnauthorized,
+			expectedBody:   "Unauthorized\n",
+		},
+		{
+			name:           "Wildcard without token",
+			public:         "DE,FR",
+			query:          "country=*",
+			expectedStatus: http.StatusUnauthorized,
+			expectedBody:   "Unauthorized\n",
+		},
+		{
+			name:           "Missing country without token",
+			public:         "DE,FR",
+			expectedStatus: http.StatusUnauthorized,
+			expectedBody:   "Unauthorized\n",
+		},
+		{
+			name:           "Every country gated by default",
+			query:          "country=DE",
+			expectedStatus: http.StatusUnauthorized,
+			expectedBody:   "Unauthorized\n",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			mockProc := &MockProcessor{
+				ipLists: map[string][]string{
+					"DE": {"2.0.0.0/12"},
+					"FR": {"5.0.0.0/16"},
+					"GB": {"81.2.69.0/24"},
+					"RU": {"5.3.0.0/16"},
+				},
+			}
+			h := NewHandler(mockProc, &config.Config{AuthToken: "secret", PublicCountries: tc.public, MaxCountries: 3})
+
+			rr := httptest.NewRecorder()
+			http.HandlerFunc(h.getIpListHandler).ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/get?"+tc.query, nil))
+
+			if rr.Code != tc.expectedStatus {
+				t.Errorf("handler returned wrong status code: got %v want %v", rr.Code, tc.expectedStatus)
+			}
+			if rr.Body.String() != tc.expectedBody {
+				t.Errorf("handler returned unexpected body: got %q want %q", rr.Body.String(), tc.expectedBody)
+			}
+		})
+	}
+}
+
+func TestPublicCountriesOnlyOpenGet(t *testing.T) {
+	h := NewHandler(&MockProcessor{asns: map[string][]uint32{"DE": {3320}}}, &config.Config{AuthToken: "secret", PublicCountries: "DE"})
+
+	rr := httptest.NewRecorder()
+	http.HandlerFunc(h.asnsHandler).ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/asns?country=DE", nil))
+
+	if rr.Code != http.StatusUnauthorized {
+		t.Errorf("/asns returned status %d for a public country without token, want %d", rr.Code, http.StatusUnauthorized)
+	}
+}
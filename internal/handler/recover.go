@@ -0,0 +1,27 @@
+package handler
+
+import (
+	"net/http"
+	"runtime/debug"
+)
+
+// recovered wraps an endpoint so a panic while serving a request is logged
+// with its stack and answered with 500 Internal Server Error, instead of
+// dropping the connection without a response. http.ErrAbortHandler is
+// re-panicked, as it is the standard way to abort a response on purpose.
+func recovered(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		defer func() {
+			err := recover()
+			if err == nil {
+				return
+			}
+			if err == http.ErrAbortHandler {
+				panic(err)
+			}
+			logRequestErrorf(r, "Panic serving %s %s: %v\n%s", r.Method, r.URL.Path, err, debug.Stack())
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		}()
+		next(w, r)
+	}
+}
@@ -0,0 +1,96 @@
+package handler
+
+import (
+	"bytes"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/anisimovdk/ip-whitelist-by-country/internal/config"
+)
+
+// panickingProcessor panics like a nil-map write would while serving /get
+type panickingProcessor struct {
+	MockProcessor
+}
+
+func (m *panickingProcessor) GetIPListForCountry(countryCode string) ([]string, error) {
+	var lists map[string][]string
+	lists[countryCode] = nil
+	return nil, nil
+}
+
+func TestRecovered_PanicAnswers500AndServerStaysUp(t *testing.T) {
+	var logs bytes.Buffer
+	origOutput := log.Writer()
+	log.SetOutput(&logs)
+	t.Cleanup(func() { log.SetOutput(origOutput) })
+
+	mux := http.NewServeMux()
+	NewHandler(&panickingProcessor{}, &config.Config{}).RegisterRoutesOn(mux)
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	for range 2 {
+		resp, err := http.Get(srv.URL + "/get?country=DE")
+		if err != nil {
+			t.Fatalf("request failed: %v", err)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusInternalServerError {
+			t.Errorf("status = %d, want %d", resp.StatusCode, http.StatusInternalServerError)
+		}
+		if string(body) != "Internal Server Error\n" {
+			t.Errorf("body = %q, want %q", body, "Internal Server Error\n")
+		}
+	}
+
+	// Other endpoints keep serving
+	resp, err := http.Get(srv.URL + "/livez")
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("/livez status = %d, want %d", resp.StatusCode, http.StatusOK)
+	}
+
+	out := logs.String()
+	if !strings.Contains(out, "Panic serving GET /get: assignment to entry in nil map") {
+		t.Errorf("panic not logged: %q", out)
+	}
+	if !strings.Contains(out, "GetIPListForCountry") {
+		t.Errorf("stack not logged: %q", out)
+	}
+}
+
+func TestRecovered_PassesThrough(t *testing.T) {
+	h := recovered(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTeapot)
+	})
+
+	rr := httptest.NewRecorder()
+	h(rr, httptest.NewRequest(http.MethodGet, "/", nil))
+
+	if rr.Code != http.StatusTeapot {
+		t.Errorf("status = %d, want %d", rr.Code, http.StatusTeapot)
+	}
+}
+
+func TestRecovered_RepanicsAbortHandler(t *testing.T) {
+	h := recovered(func(w http.ResponseWriter, r *http.Request) {
+		panic(http.ErrAbortHandler)
+	})
+
+	defer func() {
+		if err := recover(); err != http.ErrAbortHandler {
+			t.Errorf("recovered %v, want http.ErrAbortHandler", err)
+		}
+	}()
+	h(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+	t.Fatal("expected the panic to propagate")
+}
@@ -0,0 +1,43 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// exportQueryParams lists the query parameters recognized by the /export endpoint
+var exportQueryParams = []string{"auth"}
+
+// exportHandler serves the full parsed dataset as JSON, for replicas started
+// with an upstream peer to load instead of downloading from RIPE NCC. HEAD
+// requests get only the headers, which replicas use to check whether the
+// dataset changed since they copied it.
+func (h *Handler) exportHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if !h.requireAuth(w, r) {
+		return
+	}
+
+	if !h.checkQueryParams(w, r, exportQueryParams) {
+		return
+	}
+
+	export, err := h.processor.Export()
+	if err != nil {
+		writeProcessingError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if !export.Generated.IsZero() {
+		w.Header().Set("Last-Modified", export.Generated.UTC().Format(http.TimeFormat))
+	}
+	if r.Method == http.MethodHead {
+		return
+	}
+	json.NewEncoder(w).Encode(export)
+}
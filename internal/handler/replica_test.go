@@ -0,0 +1,137 @@
+package handler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/anisimovdk/ip-whitelist-by-country/internal/config"
+	"github.com/anisimovdk/ip-whitelist-by-country/internal/ipdata"
+)
+
+func TestExportHandler(t *testing.T) {
+	testCases := []struct {
+		name           string
+		method         string
+		query          string
+		token          string
+		err            error
+		expectedStatus int
+		expectedBody   string
+	}{
+		{
+			name:           "Dataset",
+			method:         http.MethodGet,
+			expectedStatus: http.StatusOK,
+			expectedBody: "{\"generated\":\"2026-10-17T08:00:00Z\",\"countries\":{\"DE\":[\"2.0.0.0/12\"]}," +
+				"\"provenance\":null,\"registries\":null,\"statuses\":null,\"addresses\":null,\"asns\":{\"DE\":[3320]},\"ipv6\":null," +
+				"\"skipped_lines\":{\"too_few_fields\":0,\"other_registry\":0,\"non_ipv4\":0,\"bad_count\":0,\"parse_error\":0}}\n",
+		},
+		{
+			name:           "Authorized",
+			method:         http.MethodGet,
+			query:          "auth=secret",
+			token:          "secret",
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "Unauthorized",
+			method:         http.MethodGet,
+			token:          "secret",
+			expectedStatus: http.StatusUnauthorized,
+			expectedBody:   "Unauthorized\n",
+		},
+		{
+			name:           "Processor error",
+			method:         http.MethodGet,
+			err:            ipdata.ErrDownloadFailed,
+			expectedStatus: http.StatusServiceUnavailable,
+			expectedBody:   "Error processing request: " + ipdata.ErrDownloadFailed.Error() + "\n",
+		},
+		{
+			name:           "Unknown parameter",
+			method:         http.MethodGet,
+			query:          "country=DE",
+			expectedStatus: http.StatusBadRequest,
+			expectedBody:   "Unknown query parameters: country\n",
+		},
+		{
+			name:           "Wrong method",
+			method:         http.MethodPost,
+			expectedStatus: http.StatusMethodNotAllowed,
+			expectedBody:   "Method not allowed\n",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			mockProc := &MockProcessor{
+				ipLists:  map[string][]string{"DE": {"2.0.0.0/12"}},
+				asns:     map[string][]uint32{"DE": {3320}},
+				dataTime: time.Date(2026, 10, 17, 8, 0, 0, 0, time.UTC),
+				err:      tc.err,
+			}
+			h := NewHandler(mockProc, &config.Config{AuthToken: tc.token, StrictQuery: true})
+
+			rr := httptest.NewRecorder()
+			http.HandlerFunc(h.exportHandler).ServeHTTP(rr, httptest.NewRequest(tc.method, "/export?"+tc.query, nil))
+
+			if rr.Code != tc.expectedStatus {
+				t.Errorf("handler returned wrong status code: got %v want %v", rr.Code, tc.expectedStatus)
+			}
+			if tc.expectedBody != "" && rr.Body.String() != tc.expectedBody {
+				t.Errorf("handler returned unexpected body: got %q want %q", rr.Body.String(), tc.expectedBody)
+			}
+		})
+	}
+}
+
+func TestExportHandler_LastModified(t *testing.T) {
+	testCases := []struct {
+		name         string
+		method       string
+		dataTime     time.Time
+		lastModified string
+		emptyBody    bool
+	}{
+		{
+			name:         "HEAD",
+			method:       http.MethodHead,
+			dataTime:     time.Date(2026, 10, 17, 8, 0, 0, 0, time.UTC),
+			lastModified: "Sat, 17 Oct 2026 08:00:00 GMT",
+			emptyBody:    true,
+		},
+		{
+			name:         "GET",
+			method:       http.MethodGet,
+			dataTime:     time.Date(2026, 10, 17, 8, 0, 0, 0, time.UTC),
+			lastModified: "Sat, 17 Oct 2026 08:00:00 GMT",
+		},
+		{
+			name:      "Nothing downloaded yet",
+			method:    http.MethodHead,
+			emptyBody: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			mockProc := &MockProcessor{ipLists: map[string][]string{"DE": {"2.0.0.0/12"}}, dataTime: tc.dataTime}
+			h := NewHandler(mockProc, &config.Config{})
+
+			rr := httptest.NewRecorder()
+			http.HandlerFunc(h.exportHandler).ServeHTTP(rr, httptest.NewRequest(tc.method, "/export", nil))
+
+			if rr.Code != http.StatusOK {
+				t.Errorf("handler returned wrong status code: got %v want %v", rr.Code, http.StatusOK)
+			}
+			if got := rr.Header().Get("Last-Modified"); got != tc.lastModified {
+				t.Errorf("Last-Modified = %q, want %q", got, tc.lastModified)
+			}
+			if (rr.Body.Len() == 0) != tc.emptyBody {
+				t.Errorf("body = %q, want empty: %v", rr.Body.String(), tc.emptyBody)
+			}
+		})
+	}
+}
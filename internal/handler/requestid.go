@@ -0,0 +1,91 @@
+package handler
+
+import (
+	"context"
+	"crypto/rand"
+	"fmt"
+	"log"
+	"log/slog"
+	"net/http"
+)
+
+// maxRequestIDLength is the longest incoming request ID that is propagated;
+// longer ones are replaced by a generated ID
+const maxRequestIDLength = 128
+
+// requestIDKey is the context key of the request ID
+type requestIDKey struct{}
+
+// instrumented wraps an endpoint with request ID propagation and panic
+// recovery, so the log line of a panic carries the request ID too
+func (h *Handler) instrumented(next http.HandlerFunc) http.HandlerFunc {
+	return h.withRequestID(recovered(next))
+}
+
+// withRequestID takes the request ID from the configured header, or generates
+// one if the request has none or an unusable one, echoes it in the response
+// and makes it available to requestID. It does nothing when no header is
+// configured.
+func (h *Handler) withRequestID(next http.HandlerFunc) http.HandlerFunc {
+	header := h.config.RequestIDHeader
+	if header == "" {
+		return next
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(header)
+		if !validRequestID(id) {
+			id = newRequestID()
+		}
+		w.Header().Set(header, id)
+		next(w, r.WithContext(context.WithValue(r.Context(), requestIDKey{}, id)))
+	}
+}
+
+// validRequestID reports whether an incoming request ID can be echoed and
+// logged as-is: printable ASCII without spaces, at most maxRequestIDLength
+// characters
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for i := range len(id) {
+		if id[i] <= ' ' || id[i] > '~' {
+			return false
+		}
+	}
+	return true
+}
+
+// newRequestID returns a random (version 4) UUID
+func newRequestID() string {
+	var b [16]byte
+	rand.Read(b[:])
+	b[6] = b[6]&0x0f | 0x40 // version 4
+	b[8] = b[8]&0x3f | 0x80 // RFC 9562 variant
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16])
+}
+
+// requestID returns the ID of the request, or "" if it has none
+func requestID(r *http.Request) string {
+	id, _ := r.Context().Value(requestIDKey{}).(string)
+	return id
+}
+
+// logRequestf logs a line about a request, prefixed with its request ID
+func logRequestf(r *http.Request, format string, args ...any) {
+	log.Printf(requestLogPrefix(r)+format, args...)
+}
+
+// logRequestErrorf logs a failure serving a request at error level, so it
+// reaches --error-log, prefixed with its request ID
+func logRequestErrorf(r *http.Request, format string, args ...any) {
+	slog.Error(requestLogPrefix(r) + fmt.Sprintf(format, args...))
+}
+
+// requestLogPrefix returns the prefix of the log lines about a request
+func requestLogPrefix(r *http.Request) string {
+	if id := requestID(r); id != "" {
+		return "[request_id=" + id + "] "
+	}
+	return ""
+}
@@ -0,0 +1,145 @@
+package handler
+
+import (
+	"bytes"
+	"errors"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/anisimovdk/ip-whitelist-by-country/internal/config"
+)
+
+// uuidPattern matches a version 4 UUID
+var uuidPattern = regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`)
+
+// serveWithRequestID sends a request to a mux with the handler's routes
+func serveWithRequestID(t *testing.T, proc *MockProcessor, cfg *config.Config, target string, header http.Header) *httptest.ResponseRecorder {
+	t.Helper()
+	mux := http.NewServeMux()
+	NewHandler(proc, cfg).RegisterRoutesOn(mux)
+
+	req := httptest.NewRequest(http.MethodGet, target, nil)
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	rr := httptest.NewRecorder()
+	mux.ServeHTTP(rr, req)
+	return rr
+}
+
+func TestRequestID(t *testing.T) {
+	longID := strings.Repeat("a", maxRequestIDLength+1)
+
+	testCases := []struct {
+		name       string
+		header     string
+		incoming   string
+		expectedID string // empty expects a generated ID
+	}{
+		{name: "Echoed", header: "X-Request-ID", incoming: "abc-123", expectedID: "abc-123"},
+		{name: "Generated when absent", header: "X-Request-ID"},
+		{name: "Generated for an ID with spaces", header: "X-Request-ID", incoming: "abc 123"},
+		{name: "Generated for a non-ASCII ID", header: "X-Request-ID", incoming: "abcé"},
+		{name: "Generated for a long ID", header: "X-Request-ID", incoming: longID},
+		{name: "Longest ID echoed", header: "X-Request-ID", incoming: longID[1:], expectedID: longID[1:]},
+		{name: "Custom header", header: "X-Correlation-ID", incoming: "corr-1", expectedID: "corr-1"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			header := http.Header{}
+			if tc.incoming != "" {
+				header.Set(tc.header, tc.incoming)
+			}
+			proc := &MockProcessor{ipLists: map[string][]string{"DE": {"2.0.0.0/12"}}, dataTime: time.Now()}
+
+			rr := serveWithRequestID(t, proc, &config.Config{RequestIDHeader: tc.header}, "/get?country=DE", header)
+
+			if rr.Code != http.StatusOK {
+				t.Fatalf("handler returned wrong status code: got %v want %v", rr.Code, http.StatusOK)
+			}
+			id := rr.Header().Get(tc.header)
+			if tc.expectedID != "" && id != tc.expectedID {
+				t.Errorf("%s = %q, want %q", tc.header, id, tc.expectedID)
+			}
+			if tc.expectedID == "" && !uuidPattern.MatchString(id) {
+				t.Errorf("%s = %q, want a generated UUID", tc.header, id)
+			}
+		})
+	}
+}
+
+func TestRequestID_GeneratedIDsDiffer(t *testing.T) {
+	cfg := &config.Config{RequestIDHeader: "X-Request-ID"}
+	first := serveWithRequestID(t, &MockProcessor{}, cfg, "/livez", nil).Header().Get("X-Request-ID")
+	second := serveWithRequestID(t, &MockProcessor{}, cfg, "/livez", nil).Header().Get("X-Request-ID")
+
+	if !uuidPattern.MatchString(first) || first == second {
+		t.Errorf("generated IDs %q and %q, want two different UUIDs", first, second)
+	}
+}
+
+func TestRequestID_Disabled(t *testing.T) {
+	header := http.Header{"X-Request-Id": {"abc-123"}}
+	rr := serveWithRequestID(t, &MockProcessor{}, &config.Config{}, "/livez", header)
+
+	if id := rr.Header().Get("X-Request-ID"); id != "" {
+		t.Errorf("X-Request-ID = %q, want none", id)
+	}
+}
+
+func TestRequestID_InLogLines(t *testing.T) {
+	var logs bytes.Buffer
+	origOutput := log.Writer()
+	log.SetOutput(&logs)
+	t.Cleanup(func() { log.SetOutput(origOutput) })
+
+	proc := &failingCountryProcessor{
+		MockProcessor: MockProcessor{ipLists: map[string][]string{"DE": {"2.0.0.0/12"}}, dataTime: time.Now()},
+		failing:       map[string]error{"FR": errors.New("download failed")},
+	}
+	mux := http.NewServeMux()
+	NewHandler(proc, &config.Config{RequestIDHeader: "X-Request-ID", MaxCountries: 2}).RegisterRoutesOn(mux)
+
+	req := httptest.NewRequest(http.MethodGet, "/get?country=DE,FR", nil)
+	req.Header.Set("X-Request-ID", "trace-42")
+	rr := httptest.NewRecorder()
+	mux.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("handler returned wrong status code: got %v want %v", rr.Code, http.StatusOK)
+	}
+	if want := "[request_id=trace-42] Serving a partial response without FR"; !strings.Contains(logs.String(), want) {
+		t.Errorf("log = %q, want it to contain %q", logs.String(), want)
+	}
+}
+
+func TestRequestID_InPanicLog(t *testing.T) {
+	var logs bytes.Buffer
+	origOutput := log.Writer()
+	log.SetOutput(&logs)
+	t.Cleanup(func() { log.SetOutput(origOutput) })
+
+	mux := http.NewServeMux()
+	NewHandler(&panickingProcessor{}, &config.Config{RequestIDHeader: "X-Request-ID"}).RegisterRoutesOn(mux)
+
+	req := httptest.NewRequest(http.MethodGet, "/get?country=DE", nil)
+	req.Header.Set("X-Request-ID", "trace-43")
+	rr := httptest.NewRecorder()
+	mux.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusInternalServerError {
+		t.Errorf("handler returned wrong status code: got %v want %v", rr.Code, http.StatusInternalServerError)
+	}
+	if id := rr.Header().Get("X-Request-ID"); id != "trace-43" {
+		t.Errorf("X-Request-ID = %q, want %q", id, "trace-43")
+	}
+	if want := "[request_id=trace-43] Panic serving GET /get"; !strings.Contains(logs.String(), want) {
+		t.Errorf("log = %q, want it to contain %q", logs.String(), want)
+	}
+}
@@ -0,0 +1,31 @@
+package handler
+
+import (
+	"net/netip"
+	"slices"
+)
+
+// sortOrders lists the values accepted by the sort query parameter
+var sortOrders = []string{"size"}
+
+// sortBySize returns a copy of the CIDR blocks ordered by the number of
+// addresses they cover, largest first. Blocks of equal size keep their order,
+// and an IPv6 prefix covers more addresses than an IPv4 block of the same
+// length. Unparseable entries go last.
+func sortBySize(cidrs []string) []string {
+	sorted := slices.Clone(cidrs)
+	slices.SortStableFunc(sorted, func(a, b string) int {
+		return hostBits(b) - hostBits(a)
+	})
+	return sorted
+}
+
+// hostBits returns the number of host bits of a CIDR block, i.e. the base-2
+// logarithm of its size, or -1 if it is unparseable
+func hostBits(cidr string) int {
+	prefix, err := netip.ParsePrefix(cidr)
+	if err != nil {
+		return -1
+	}
+	return prefix.Addr().BitLen() - prefix.Bits()
+}
@@ -0,0 +1,101 @@
+package handler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/anisimovdk/ip-whitelist-by-country/internal/config"
+)
+
+func TestSortBySize(t *testing.T) {
+	cidrs := []string{"5.1.0.0/24", "2.0.0.0/16", "9.0.0.0/32", "bad", "5.2.0.0/24", "2001:db8::/48", "3.0.0.0/8"}
+
+	got := sortBySize(cidrs)
+
+	// Equal sizes keep their order, the /48 covers more than the /8
+	want := []string{"2001:db8::/48", "3.0.0.0/8", "2.0.0.0/16", "5.1.0.0/24", "5.2.0.0/24", "9.0.0.0/32", "bad"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("sortBySize() = %v, want %v", got, want)
+	}
+	if cidrs[0] != "5.1.0.0/24" {
+		t.Errorf("input was modified: %v", cidrs)
+	}
+}
+
+func TestGetIpListHandlerSort(t *testing.T) {
+	testCases := []struct {
+		name           string
+		query          string
+		expectedStatus int
+		expectedBody   string
+	}{
+		{
+			name:           "Unsorted by default",
+			query:          "country=DE",
+			expectedStatus: http.StatusOK,
+			expectedBody:   "5.1.0.0/24\n2.0.0.0/16\n9.0.0.0/32\n",
+		},
+		{
+			name:           "Size puts the /16 before the /24",
+			query:          "country=DE&sort=size",
+			expectedStatus: http.StatusOK,
+			expectedBody:   "2.0.0.0/16\n5.1.0.0/24\n9.0.0.0/32\n",
+		},
+		{
+			name:           "Each country is sorted on its own",
+			query:          "country=DE,FR&sort=size&format=ndjson",
+			expectedStatus: http.StatusOK,
+			expectedBody: `{"country":"DE","cidr":"2.0.0.0/16"}` + "\n" +
+				`{"country":"DE","cidr":"5.1.0.0/24"}` + "\n" +
+				`{"country":"DE","cidr":"9.0.0.0/32"}` + "\n" +
+				`{"country":"FR","cidr":"81.0.0.0/8"}` + "\n" +
+				`{"country":"FR","cidr":"82.1.0.0/24"}` + "\n",
+		},
+		{
+			name:           "With within",
+			query:          "country=DE&sort=size&within=0.0.0.0/1",
+			expectedStatus: http.StatusOK,
+			expectedBody:   "2.0.0.0/16\n5.1.0.0/24\n9.0.0.0/32\n",
+		},
+		{
+			name:           "Grouped by registry",
+			query:          "country=DE&sort=size&groupby=registry",
+			expectedStatus: http.StatusOK,
+			expectedBody:   "{\"ripencc\":[\"2.0.0.0/16\",\"5.1.0.0/24\"]}\n",
+		},
+		{
+			name:           "Unknown order",
+			query:          "country=DE&sort=address",
+			expectedStatus: http.StatusBadRequest,
+			expectedBody:   "Invalid sort parameter\n",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			mockProc := &MockProcessor{
+				ipLists: map[string][]string{
+					"DE": {"5.1.0.0/24", "2.0.0.0/16", "9.0.0.0/32"},
+					"FR": {"82.1.0.0/24", "81.0.0.0/8"},
+				},
+				registries: map[string]map[string][]string{"DE": {"ripencc": {"5.1.0.0/24", "2.0.0.0/16"}}},
+				dataTime:   time.Now(),
+			}
+			h := NewHandler(mockProc, &config.Config{MaxCountries: 2, PrecomputeFormats: "DE=cidr"})
+			h.precompute()
+
+			rr := httptest.NewRecorder()
+			http.HandlerFunc(h.getIpListHandler).ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/get?"+tc.query, nil))
+
+			if rr.Code != tc.expectedStatus {
+				t.Errorf("handler returned wrong status code: got %v want %v", rr.Code, tc.expectedStatus)
+			}
+			if rr.Body.String() != tc.expectedBody {
+				t.Errorf("handler returned unexpected body: got %q want %q", rr.Body.String(), tc.expectedBody)
+			}
+		})
+	}
+}
@@ -0,0 +1,48 @@
+package handler
+
+import (
+	"slices"
+	"strings"
+
+	"github.com/anisimovdk/ip-whitelist-by-country/internal/ipdata"
+)
+
+// parseStatuses parses the comma-separated status query parameter into the
+// requested allocation statuses, in the order of ipdata.Statuses. It returns
+// nil for the default statuses, which are served from the country's list,
+// and reports false for unknown statuses.
+func parseStatuses(value string) ([]string, bool) {
+	requested := make(map[string]bool)
+	for status := range strings.SplitSeq(value, ",") {
+		status = strings.ToLower(strings.TrimSpace(status))
+		if !slices.Contains(ipdata.Statuses, status) {
+			return nil, false
+		}
+		requested[status] = true
+	}
+
+	statuses := make([]string, 0, len(requested))
+	for _, status := range ipdata.Statuses {
+		if requested[status] {
+			statuses = append(statuses, status)
+		}
+	}
+	if slices.Equal(statuses, ipdata.DefaultStatuses) {
+		return nil, true
+	}
+	return statuses, true
+}
+
+// blocksByStatus returns the country's CIDR blocks of the given statuses,
+// one status after the other
+func (h *Handler) blocksByStatus(country string, statuses []string) ([]string, error) {
+	groups, err := h.processor.GetIPListByStatus(country)
+	if err != nil {
+		return nil, err
+	}
+	blocks := []string{}
+	for _, status := range statuses {
+		blocks = append(blocks, groups[status]...)
+	}
+	return blocks, nil
+}
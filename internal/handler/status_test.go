@@ -0,0 +1,180 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/anisimovdk/ip-whitelist-by-country/internal/config"
+	"github.com/anisimovdk/ip-whitelist-by-country/internal/ipdata"
+)
+
+// newMixedStatusProcessor returns a mock holding DE blocks of every status
+func newMixedStatusProcessor() *MockProcessor {
+	return &MockProcessor{
+		ipLists: map[string][]string{"DE": {"2.0.0.0/12", "5.0.0.0/16"}},
+		statuses: map[string]map[string][]string{"DE": {
+			ipdata.StatusAllocated: {"2.0.0.0/12"},
+			ipdata.StatusAssigned:  {"5.0.0.0/16"},
+			ipdata.StatusAvailable: {"46.0.0.0/24"},
+			ipdata.StatusReserved:  {"31.0.0.0/24", "62.0.0.0/24"},
+		}},
+		dataTime: time.Now(),
+	}
+}
+
+func TestGetIpListHandlerStatus(t *testing.T) {
+	testCases := []struct {
+		name         string
+		query        string
+		expectedBody string
+	}{
+		{
+			name:         "Default",
+			query:        "country=DE",
+			expectedBody: "2.0.0.0/12\n5.0.0.0/16\n",
+		},
+		{
+			name:         "Allocated",
+			query:        "country=DE&status=allocated",
+			expectedBody: "2.0.0.0/12\n",
+		},
+		{
+			name:         "Assigned",
+			query:        "country=DE&status=assigned",
+			expectedBody: "5.0.0.0/16\n",
+		},
+		{
+			name:         "Available",
+			query:        "country=DE&status=available",
+			expectedBody: "46.0.0.0/24\n",
+		},
+		{
+			name:         "Reserved",
+			query:        "country=DE&status=reserved",
+			expectedBody: "31.0.0.0/24\n62.0.0.0/24\n",
+		},
+		{
+			name:         "Several statuses in status order",
+			query:        "country=DE&status=reserved,%20Allocated",
+			expectedBody: "2.0.0.0/12\n31.0.0.0/24\n62.0.0.0/24\n",
+		},
+		{
+			name:         "Default statuses spelled out",
+			query:        "country=DE&status=assigned,allocated",
+			expectedBody: "2.0.0.0/12\n5.0.0.0/16\n",
+		},
+		{
+			name:         "Every status",
+			query:        "country=DE&status=allocated,assigned,available,reserved",
+			expectedBody: "2.0.0.0/12\n5.0.0.0/16\n46.0.0.0/24\n31.0.0.0/24\n62.0.0.0/24\n",
+		},
+		{
+			name:         "Country without the status",
+			query:        "country=FR&status=reserved",
+			expectedBody: "",
+		},
+		{
+			name:         "With a format",
+			query:        "country=DE&status=reserved&format=netmask",
+			expectedBody: "31.0.0.0 255.255.255.0\n62.0.0.0 255.255.255.0\n",
+		},
+		{
+			name:         "With within",
+			query:        "country=DE&status=reserved&within=62.0.0.0/8",
+			expectedBody: "62.0.0.0/24\n",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			h := NewHandler(newMixedStatusProcessor(), &config.Config{})
+
+			rr := httptest.NewRecorder()
+			http.HandlerFunc(h.getIpListHandler).ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/get?"+tc.query, nil))
+
+			if rr.Code != http.StatusOK {
+				t.Fatalf("handler returned wrong status code: got %v want %v (%s)", rr.Code, http.StatusOK, rr.Body.String())
+			}
+			if rr.Body.String() != tc.expectedBody {
+				t.Errorf("handler returned unexpected body: got %q want %q", rr.Body.String(), tc.expectedBody)
+			}
+		})
+	}
+}
+
+func TestGetIpListHandlerStatusErrors(t *testing.T) {
+	testCases := []struct {
+		name           string
+		query          string
+		err            error
+		expectedStatus int
+		expectedBody   string
+	}{
+		{
+			name:           "Unknown status",
+			query:          "country=DE&status=revoked",
+			expectedStatus: http.StatusBadRequest,
+			expectedBody:   "Invalid status parameter\n",
+		},
+		{
+			name:           "Empty status in the list",
+			query:          "country=DE&status=reserved,",
+			expectedStatus: http.StatusBadRequest,
+			expectedBody:   "Invalid status parameter\n",
+		},
+		{
+			name:           "With groupby",
+			query:          "country=DE&status=reserved&groupby=registry",
+			expectedStatus: http.StatusBadRequest,
+			expectedBody:   "Invalid status parameter for groupby, ipv6_aggregate or date\n",
+		},
+		{
+			name:           "With ipv6_aggregate",
+			query:          "country=DE&status=reserved&ipv6_aggregate=48",
+			expectedStatus: http.StatusBadRequest,
+			expectedBody:   "Invalid status parameter for groupby, ipv6_aggregate or date\n",
+		},
+		{
+			name:           "Processor error",
+			query:          "country=DE&status=reserved",
+			err:            errors.New("download failed"),
+			expectedStatus: http.StatusInternalServerError,
+			expectedBody:   "Error processing request: internal error\n",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			mockProc := newMixedStatusProcessor()
+			mockProc.err = tc.err
+			h := NewHandler(mockProc, &config.Config{})
+
+			rr := httptest.NewRecorder()
+			http.HandlerFunc(h.getIpListHandler).ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/get?"+tc.query, nil))
+
+			if rr.Code != tc.expectedStatus {
+				t.Errorf("handler returned wrong status code: got %v want %v", rr.Code, tc.expectedStatus)
+			}
+			if rr.Body.String() != tc.expectedBody {
+				t.Errorf("handler returned unexpected body: got %q want %q", rr.Body.String(), tc.expectedBody)
+			}
+		})
+	}
+}
+
+func TestGetIpListHandlerStatusWithDate(t *testing.T) {
+	h := NewHandler(newMixedStatusProcessor(), &config.Config{ArchiveURL: "https://example.com/{date}"})
+
+	rr := httptest.NewRecorder()
+	http.HandlerFunc(h.getIpListHandler).ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/get?country=DE&status=reserved&date=20240101", nil))
+
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("handler returned wrong status code: got %v want %v", rr.Code, http.StatusBadRequest)
+	}
+	if want := "Invalid status parameter for groupby, ipv6_aggregate or date\n"; rr.Body.String() != want {
+		t.Errorf("handler returned unexpected body: got %q want %q", rr.Body.String(), want)
+	}
+}
@@ -0,0 +1,34 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// upstreamQueryParams lists the query parameters recognized by the /healthz/upstream endpoint
+var upstreamQueryParams = []string{"auth"}
+
+// upstreamHandler reports whether the data source is currently reachable. It
+// answers 200 when it is and 503 when it is not, independent of the cache.
+func (h *Handler) upstreamHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if !h.requireAuth(w, r) {
+		return
+	}
+
+	if !h.checkQueryParams(w, r, upstreamQueryParams) {
+		return
+	}
+
+	status := h.processor.CheckUpstream(r.Context())
+
+	w.Header().Set("Content-Type", "application/json")
+	if !status.Reachable {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	json.NewEncoder(w).Encode(status)
+}
@@ -0,0 +1,74 @@
+package handler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/anisimovdk/ip-whitelist-by-country/internal/config"
+	"github.com/anisimovdk/ip-whitelist-by-country/internal/ipdata"
+)
+
+func TestUpstreamHandler(t *testing.T) {
+	testCases := []struct {
+		name           string
+		method         string
+		query          string
+		token          string
+		upstream       ipdata.UpstreamStatus
+		expectedStatus int
+		expectedBody   string
+	}{
+		{
+			name:           "Reachable",
+			method:         http.MethodGet,
+			upstream:       ipdata.UpstreamStatus{URL: "https://upstream.test/latest", Reachable: true, StatusCode: http.StatusOK, LatencyMs: 42},
+			expectedStatus: http.StatusOK,
+			expectedBody:   "{\"url\":\"https://upstream.test/latest\",\"reachable\":true,\"status_code\":200,\"latency_ms\":42}\n",
+		},
+		{
+			name:           "Unreachable",
+			method:         http.MethodGet,
+			upstream:       ipdata.UpstreamStatus{URL: "https://upstream.test/latest", LatencyMs: 5000, Error: "context deadline exceeded"},
+			expectedStatus: http.StatusServiceUnavailable,
+			expectedBody:   "{\"url\":\"https://upstream.test/latest\",\"reachable\":false,\"latency_ms\":5000,\"error\":\"context deadline exceeded\"}\n",
+		},
+		{
+			name:           "Unauthorized",
+			method:         http.MethodGet,
+			token:          "secret",
+			expectedStatus: http.StatusUnauthorized,
+			expectedBody:   "Unauthorized\n",
+		},
+		{
+			name:           "Unknown parameter",
+			method:         http.MethodGet,
+			query:          "deep=true",
+			expectedStatus: http.StatusBadRequest,
+			expectedBody:   "Unknown query parameters: deep\n",
+		},
+		{
+			name:           "Wrong method",
+			method:         http.MethodPost,
+			expectedStatus: http.StatusMethodNotAllowed,
+			expectedBody:   "Method not allowed\n",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			mockProc := &MockProcessor{upstream: tc.upstream}
+			h := NewHandler(mockProc, &config.Config{AuthToken: tc.token, StrictQuery: true})
+
+			rr := httptest.NewRecorder()
+			http.HandlerFunc(h.upstreamHandler).ServeHTTP(rr, httptest.NewRequest(tc.method, "/healthz/upstream?"+tc.query, nil))
+
+			if rr.Code != tc.expectedStatus {
+				t.Errorf("handler returned wrong status code: got %v want %v", rr.Code, tc.expectedStatus)
+			}
+			if rr.Body.String() != tc.expectedBody {
+				t.Errorf("handler returned unexpected body: got %q want %q", rr.Body.String(), tc.expectedBody)
+			}
+		})
+	}
+}
@@ -0,0 +1,36 @@
+package handler
+
+import (
+	"net/netip"
+
+	"github.com/anisimovdk/ip-whitelist-by-country/internal/ipdata"
+)
+
+// parseWithin parses the within query parameter into its network prefix,
+// e.g. "10.1.2.3/8" becomes 10.0.0.0/8. It reports false for malformed CIDRs.
+func parseWithin(value string) (netip.Prefix, bool) {
+	if ipdata.ValidateIPCIDR(value) != nil {
+		return netip.Prefix{}, false
+	}
+	prefix, err := netip.ParsePrefix(value)
+	if err != nil {
+		return netip.Prefix{}, false
+	}
+	return prefix.Masked(), true
+}
+
+// filterWithin returns the CIDR blocks that lie entirely inside the super-net,
+// keeping their order. Blocks that only partially overlap it are dropped.
+func filterWithin(cidrs []string, within netip.Prefix) []string {
+	filtered := make([]string, 0, len(cidrs))
+	for _, cidr := range cidrs {
+		prefix, err := netip.ParsePrefix(cidr)
+		if err != nil {
+			continue
+		}
+		if prefix.Bits() >= within.Bits() && within.Contains(prefix.Addr()) {
+			filtered = append(filtered, cidr)
+		}
+	}
+	return filtered
+}
@@ -0,0 +1,99 @@
+package handler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"slices"
+	"testing"
+
+	"github.com/anisimovdk/ip-whitelist-by-country/internal/config"
+)
+
+func TestGetIpListHandlerWithin(t *testing.T) {
+	mockProc := &MockProcessor{
+		ipLists: map[string][]string{
+			"DE": {"2.0.0.0/12", "5.1.0.0/16", "5.1.128.0/17", "5.2.0.0/16", "46.0.0.0/8", "garbage"},
+		},
+		registries: map[string]map[string][]string{
+			"DE": {"ripencc": {"2.0.0.0/12", "5.1.0.0/16", "46.0.0.0/8"}},
+		},
+	}
+	h := NewHandler(mockProc, &config.Config{})
+
+	testCases := []struct {
+		name           string
+		query          string
+		expectedStatus int
+		expectedBody   string
+	}{
+		{
+			name:           "Blocks inside the super-net",
+			query:          "within=" + url.QueryEscape("5.0.0.0/14"),
+			expectedStatus: http.StatusOK,
+			expectedBody:   "5.1.0.0/16\n5.1.128.0/17\n5.2.0.0/16\n",
+		},
+		{
+			name:           "Super-net equal to a block",
+			query:          "within=" + url.QueryEscape("5.1.0.0/16"),
+			expectedStatus: http.StatusOK,
+			expectedBody:   "5.1.0.0/16\n5.1.128.0/17\n",
+		},
+		{
+			name:           "Host bits are ignored",
+			query:          "within=" + url.QueryEscape("5.1.200.1/17"),
+			expectedStatus: http.StatusOK,
+			expectedBody:   "5.1.128.0/17\n",
+		},
+		{
+			name:           "Partially overlapping blocks are dropped",
+			query:          "within=" + url.QueryEscape("46.1.0.0/16"),
+			expectedStatus: http.StatusOK,
+			expectedBody:   "",
+		},
+		{
+			name:           "Combined with another format",
+			query:          "within=" + url.QueryEscape("2.0.0.0/8") + "&format=netmask",
+			expectedStatus: http.StatusOK,
+			expectedBody:   "2.0.0.0 255.240.0.0\n",
+		},
+		{
+			name:           "Grouped by registry",
+			query:          "within=" + url.QueryEscape("5.0.0.0/8") + "&groupby=registry",
+			expectedStatus: http.StatusOK,
+			expectedBody:   "{\"ripencc\":[\"5.1.0.0/16\"]}\n",
+		},
+		{
+			name:           "Malformed CIDR",
+			query:          "within=5.0.0.0",
+			expectedStatus: http.StatusBadRequest,
+			expectedBody:   "Invalid within parameter\n",
+		},
+		{
+			name:           "Prefix length with leading zero",
+			query:          "within=" + url.QueryEscape("5.0.0.0/08"),
+			expectedStatus: http.StatusBadRequest,
+			expectedBody:   "Invalid within parameter\n",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/get?country=DE&"+tc.query, nil)
+			rr := httptest.NewRecorder()
+			http.HandlerFunc(h.getIpListHandler).ServeHTTP(rr, req)
+
+			if rr.Code != tc.expectedStatus {
+				t.Errorf("handler returned wrong status code: got %v want %v", rr.Code, tc.expectedStatus)
+			}
+			if rr.Body.String() != tc.expectedBody {
+				t.Errorf("handler returned unexpected body: got %q want %q", rr.Body.String(), tc.expectedBody)
+			}
+		})
+	}
+
+	// Filtering must not modify the processor's data
+	if want := []string{"2.0.0.0/12", "5.1.0.0/16", "46.0.0.0/8"}; !slices.Equal(mockProc.registries["DE"]["ripencc"], want) {
+		t.Errorf("registries were modified: %v", mockProc.registries["DE"]["ripencc"])
+	}
+}
@@ -0,0 +1,121 @@
+package ipdata
+
+import (
+	"encoding/binary"
+	"math/bits"
+	"net"
+	"slices"
+)
+
+// ipv4Space is the number of addresses in the IPv4 space
+const ipv4Space = 1 << 32
+
+// ipRange is an inclusive range of IPv4 addresses
+type ipRange struct {
+	start uint64
+	end   uint64
+}
+
+// parseRanges converts IPv4 CIDR blocks to address ranges, skipping invalid entries
+func parseRanges(cidrs []string) []ipRange {
+	ranges := make([]ipRange, 0, len(cidrs))
+	for _, cidr := range cidrs {
+		_, ipNet, err := net.ParseCIDR(cidr)
+		if err != nil {
+			continue
+		}
+		ip4 := ipNet.IP.To4()
+		if ip4 == nil {
+			continue
+		}
+		ones, _ := ipNet.Mask.Size()
+		start := uint64(binary.BigEndian.Uint32(ip4))
+		ranges = append(ranges, ipRange{start: start, end: start + prefixAddressCount(ones) - 1})
+	}
+	return ranges
+}
+
+// mergeRanges sorts ranges and merges overlapping and adjacent ones
+func mergeRanges(ranges []ipRange) []ipRange {
+	sorted := slices.Clone(ranges)
+	slices.SortFunc(sorted, func(a, b ipRange) int {
+		switch {
+		case a.start < b.start:
+			return -1
+		case a.start > b.start:
+			return 1
+		default:
+			return 0
+		}
+	})
+
+	merged := make([]ipRange, 0, len(sorted))
+	for _, r := range sorted {
+		if n := len(merged); n > 0 && r.start <= merged[n-1].end+1 {
+			merged[n-1].end = max(merged[n-1].end, r.end)
+			continue
+		}
+		merged = append(merged, r)
+	}
+	return merged
+}
+
+// rangeToCIDRs returns the minimal list of CIDR blocks covering an address range
+func rangeToCIDRs(r ipRange) []string {
+	var cidrs []string
+	for start := r.start; start <= r.end; {
+		// Largest block aligned at start that does not exceed the range end
+		size := uint64(ipv4Space)
+		if start != 0 {
+			size = 1 << bits.TrailingZeros64(start)
+		}
+		for size > r.end-start+1 {
+			size >>= 1
+		}
+
+		mask := 32 - (bits.Len64(size) - 1)
+		ip := make(net.IP, net.IPv4len)
+		binary.BigEndian.PutUint32(ip, uint32(start))
+		cidrs = append(cidrs, formatCIDR(ip.String(), mask))
+		start += size
+	}
+	return cidrs
+}
+
+// ComplementCIDRs returns the minimal set of CIDR blocks covering all IPv4
+// space not covered by the given blocks
+func ComplementCIDRs(cidrs []string) []string {
+	complement := []string{}
+	next := uint64(0)
+	for _, r := range mergeRanges(parseRanges(cidrs)) {
+		if r.start > next {
+			complement = append(complement, rangeToCIDRs(ipRange{start: next, end: r.start - 1})...)
+		}
+		next = r.end + 1
+	}
+	if next < ipv4Space {
+		complement = append(complement, rangeToCIDRs(ipRange{start: next, end: ipv4Space - 1})...)
+	}
+	return complement
+}
+
+// IntersectCIDRs returns the minimal set of CIDR blocks covering the IPv4
+// addresses covered by both lists of blocks
+func IntersectCIDRs(a, b []string) []string {
+	intersection := []string{}
+	left, right := mergeRanges(parseRanges(a)), mergeRanges(parseRanges(b))
+	for i, j := 0, 0; i < len(left) && j < len(right); {
+		start := max(left[i].start, right[j].start)
+		end := min(left[i].end, right[j].end)
+		if start <= end {
+			intersection = append(intersection, rangeToCIDRs(ipRange{start: start, end: end})...)
+		}
+		// Advance whichever range ends first; the other may overlap the next one
+		if left[i].end < right[j].end {
+			i++
+		} else {
+			j++
+		}
+	}
+	return intersection
+}
@@ -0,0 +1,164 @@
+package ipdata
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestMergeRanges(t *testing.T) {
+	ranges := []ipRange{
+		{start: 100, end: 199},
+		{start: 0, end: 9},
+		{start: 10, end: 19}, // adjacent to the first range
+		{start: 150, end: 300},
+		{start: 500, end: 500},
+	}
+
+	want := []ipRange{
+		{start: 0, end: 19},
+		{start: 100, end: 300},
+		{start: 500, end: 500},
+	}
+	if got := mergeRanges(ranges); !reflect.DeepEqual(got, want) {
+		t.Fatalf("mergeRanges = %#v, want %#v", got, want)
+	}
+}
+
+func TestRangeToCIDRs(t *testing.T) {
+	testCases := []struct {
+		name     string
+		r        ipRange
+		expected []string
+	}{
+		{name: "Whole space", r: ipRange{start: 0, end: ipv4Space - 1}, expected: []string{"0.0.0.0/0"}},
+		{name: "Single address", r: ipRange{start: 1, end: 1}, expected: []string{"0.0.0.1/32"}},
+		{name: "Unaligned", r: ipRange{start: 1, end: 6}, expected: []string{"0.0.0.1/32", "0.0.0.2/31", "0.0.0.4/31", "0.0.0.6/32"}},
+		{name: "Aligned /24", r: ipRange{start: 0xC0A80000, end: 0xC0A800FF}, expected: []string{"192.168.0.0/24"}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := rangeToCIDRs(tc.r); !reflect.DeepEqual(got, tc.expected) {
+				t.Errorf("rangeToCIDRs = %#v, want %#v", got, tc.expected)
+			}
+		})
+	}
+}
+
+func TestComplementCIDRs(t *testing.T) {
+	testCases := []struct {
+		name     string
+		cidrs    []string
+		expected []string
+	}{
+		{
+			name:     "Empty input",
+			cidrs:    nil,
+			expected: []string{"0.0.0.0/0"},
+		},
+		{
+			name:     "Whole space",
+			cidrs:    []string{"0.0.0.0/0"},
+			expected: []string{},
+		},
+		{
+			name:     "Lower half",
+			cidrs:    []string{"0.0.0.0/1"},
+			expected: []string{"128.0.0.0/1"},
+		},
+		{
+			name:  "Single /8",
+			cidrs: []string{"10.0.0.0/8"},
+			expected: []string{
+				"0.0.0.0/5", "8.0.0.0/7", "11.0.0.0/8", "12.0.0.0/6",
+				"16.0.0.0/4", "32.0.0.0/3", "64.0.0.0/2", "128.0.0.0/1",
+			},
+		},
+		{
+			name:     "Overlapping and unsorted input",
+			cidrs:    []string{"128.0.0.0/2", "192.0.0.0/2", "0.0.0.0/2", "0.0.0.0/3", "invalid", "2001:db8::/32"},
+			expected: []string{"64.0.0.0/2"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			got := ComplementCIDRs(tc.cidrs)
+			if !reflect.DeepEqual(got, tc.expected) {
+				t.Fatalf("ComplementCIDRs = %#v, want %#v", got, tc.expected)
+			}
+
+			// The complement must not overlap itself or the input, and together they cover all IPv4 space
+			complement := parseRanges(got)
+			input := mergeRanges(parseRanges(tc.cidrs))
+			var total uint64
+			for _, r := range complement {
+				total += r.end - r.start + 1
+			}
+			for _, r := range input {
+				total += r.end - r.start + 1
+			}
+			if merged := mergeRanges(append(complement, input...)); total != ipv4Space ||
+				len(merged) != 1 || merged[0] != (ipRange{start: 0, end: ipv4Space - 1}) {
+				t.Fatalf("complement and input do not partition the IPv4 space: total=%d merged=%#v", total, merged)
+			}
+		})
+	}
+}
+
+func TestIntersectCIDRs(t *testing.T) {
+	testCases := []struct {
+		name     string
+		a        []string
+		b        []string
+		expected []string
+	}{
+		{
+			name:     "Empty input",
+			a:        nil,
+			b:        []string{"10.0.0.0/8"},
+			expected: []string{},
+		},
+		{
+			name:     "Disjoint blocks",
+			a:        []string{"10.0.0.0/8"},
+			b:        []string{"11.0.0.0/8"},
+			expected: []string{},
+		},
+		{
+			name:     "One shared block",
+			a:        []string{"2.0.0.0/12", "5.0.0.0/16"},
+			b:        []string{"5.0.0.0/16", "81.2.69.0/24"},
+			expected: []string{"5.0.0.0/16"},
+		},
+		{
+			name:     "Block contained in a larger one",
+			a:        []string{"10.0.0.0/8"},
+			b:        []string{"10.1.2.0/24", "12.0.0.0/8"},
+			expected: []string{"10.1.2.0/24"},
+		},
+		{
+			name:     "Partial overlap of ranges",
+			a:        []string{"10.0.0.0/24", "10.0.1.0/24"},
+			b:        []string{"10.0.1.0/24", "10.0.2.0/24"},
+			expected: []string{"10.0.1.0/24"},
+		},
+		{
+			name:     "One range spanning several",
+			a:        []string{"10.0.0.0/16"},
+			b:        []string{"10.0.1.0/24", "10.0.3.0/24", "9.0.0.0/8", "invalid"},
+			expected: []string{"10.0.1.0/24", "10.0.3.0/24"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := IntersectCIDRs(tc.a, tc.b); !reflect.DeepEqual(got, tc.expected) {
+				t.Fatalf("IntersectCIDRs = %#v, want %#v", got, tc.expected)
+			}
+			if got := IntersectCIDRs(tc.b, tc.a); !reflect.DeepEqual(got, tc.expected) {
+				t.Fatalf("IntersectCIDRs reversed = %#v, want %#v", got, tc.expected)
+			}
+		})
+	}
+}
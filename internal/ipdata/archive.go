@@ -0,0 +1,166 @@
+package ipdata
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ArchiveDateLayout is the layout of the dates identifying archived files, e.g. 20240101
+const ArchiveDateLayout = "20060102"
+
+// defaultArchiveSnapshots is how many archived days are kept when MaxSnapshots is not positive
+const defaultArchiveSnapshots = 7
+
+// archiveFailureTTL is how long a day whose download failed or was not found
+// is answered with the same error before it is downloaded again
+const archiveFailureTTL = 10 * time.Minute
+
+// ArchiveFirstDate is the earliest day archived data can be requested for; the
+// RIPE NCC archive has no files before 2003
+var ArchiveFirstDate = time.Date(2003, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+// archiveEntry is an archived day, possibly still being downloaded
+type archiveEntry struct {
+	ready chan struct{} // closed once data or err is set
+	data  *parsedData
+	err   error
+}
+
+// archiveFailure is the error of an archived day that could not be loaded
+type archiveFailure struct {
+	err   error
+	until time.Time // when the day is downloaded again
+}
+
+// archiveStore keeps the parsed data of the most recently used archived days,
+// and the errors of the days that recently failed to load
+type archiveStore struct {
+	mu       sync.Mutex
+	entries  map[string]*archiveEntry  // date -> archived day
+	order    []string                  // dates from least to most recently used
+	failures map[string]archiveFailure // date -> error of its last download
+	size     int
+}
+
+func newArchiveStore(size int) *archiveStore {
+	if size <= 0 {
+		size = defaultArchiveSnapshots
+	}
+	return &archiveStore{
+		entries:  make(map[string]*archiveEntry),
+		failures: make(map[string]archiveFailure),
+		size:     size,
+	}
+}
+
+// get returns the data of date, calling fetch if it is not stored yet.
+// Concurrent requests for the same date share one download. Failed downloads
+// leave the store, but their error is returned for archiveFailureTTL before
+// the next request retries, so missing days cannot trigger a download each.
+func (s *archiveStore) get(date string, fetch func() (*parsedData, error)) (*parsedData, error) {
+	s.mu.Lock()
+	if failure, ok := s.failures[date]; ok && time.Now().Before(failure.until) {
+		s.mu.Unlock()
+		return nil, failure.err
+	}
+	e, ok := s.entries[date]
+	if !ok {
+		e = &archiveEntry{ready: make(chan struct{})}
+		s.entries[date] = e
+	}
+	s.touch(date)
+	s.mu.Unlock()
+
+	if !ok {
+		e.data, e.err = fetch()
+		if e.err != nil {
+			s.mu.Lock()
+			if s.entries[date] == e {
+				delete(s.entries, date)
+				s.order = slices.DeleteFunc(s.order, func(d string) bool { return d == date })
+			}
+			s.recordFailure(date, e.err)
+			s.mu.Unlock()
+		}
+		close(e.ready)
+	}
+
+	<-e.ready
+	return e.data, e.err
+}
+
+// touch marks date as the most recently used and evicts the least recently
+// used dates beyond the store size. Callers must hold s.mu.
+func (s *archiveStore) touch(date string) {
+	s.order = slices.DeleteFunc(s.order, func(d string) bool { return d == date })
+	s.order = append(s.order, date)
+	for len(s.order) > s.size {
+		delete(s.entries, s.order[0])
+		s.order = s.order[1:]
+	}
+}
+
+// recordFailure stores the error of date and drops the failures that have
+// expired, which keeps their number bounded by the days failing within
+// archiveFailureTTL. Callers must hold s.mu.
+func (s *archiveStore) recordFailure(date string, err error) {
+	now := time.Now()
+	for d, failure := range s.failures {
+		if !now.Before(failure.until) {
+			delete(s.failures, d)
+		}
+	}
+	s.failures[date] = archiveFailure{err: err, until: now.Add(archiveFailureTTL)}
+}
+
+// archiveURL fills the {date} and {year} placeholders of the archive URL template
+func archiveURL(template string, date time.Time) string {
+	return strings.NewReplacer(
+		"{date}", date.Format(ArchiveDateLayout),
+		"{year}", date.Format("2006"),
+	).Replace(template)
+}
+
+// GetIPListForCountryOn returns the CIDR blocks of a country in the archived
+// delegated-stats file of the given day. Archived files never change, so each
+// day is downloaded once and kept while it is among the most recently used.
+// Days before ArchiveFirstDate or in the future are not downloaded.
+func (p *Processor) GetIPListForCountryOn(countryCode string, date time.Time) ([]string, error) {
+	if p.config.ArchiveURL == "" {
+		return nil, ErrArchiveDisabled
+	}
+
+	day := date.Format(ArchiveDateLayout)
+	if date.Before(ArchiveFirstDate) || date.After(time.Now()) {
+		return nil, fmt.Errorf("%w: %s", ErrNoArchive, day)
+	}
+
+	p.archiveOnce.Do(func() {
+		p.archive = newArchiveStore(p.config.MaxSnapshots)
+	})
+
+	data, err := p.archive.get(day, func() (*parsedData, error) {
+		source := archiveURL(p.config.ArchiveURL, date)
+		log.Printf("Downloading archived IP data for %s from %s...\n", day, source)
+		data, err := p.fetchData(source)
+		var statusErr *UpstreamStatusError
+		if errors.As(err, &statusErr) && statusErr.StatusCode == http.StatusNotFound {
+			return nil, fmt.Errorf("%w: %s", ErrNoArchive, day)
+		}
+		return data, err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if ipList, ok := data.cache[strings.ToUpper(countryCode)]; ok {
+		return slices.Clone(ipList), nil
+	}
+	return []string{}, nil
+}
@@ -0,0 +1,267 @@
+package ipdata
+
+import (
+	"errors"
+	"net/http"
+	"reflect"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+const testArchiveURL = "http://archive.test/{year}/delegated-ripencc-extended-{date}"
+
+// bzip2Archive is "ripencc|DE|ipv4|2.0.0.0|1048576|20100101|allocated\n" compressed with bzip2 -9
+const bzip2Archive = "\x42\x5a\x68\x39\x31\x41\x59\x26\x53\x59\xe5\x4f\x6d\xf3\x00\x00\x15\x5d\x80\x00\x10\x00\x01\x77\xc0\x06\x00\x2e\x25\xd5\x04\x20\x00\x50\xa0\x00\x68\x19\x32\x06\xa9\xe1\x08\x6d\x4d\x01\x8f\x54\xb4\x9c\x38\x93\x32\x86\x50\x51\x02\x18\x8a\xd6\x7c\x27\x57\xba\xfa\x72\x69\x83\x34\x23\x0f\x4f\x2d\x98\xb9\xfc\x5d\xc9\x14\xe1\x42\x43\x95\x3d\xb7\xcc"
+
+// newArchiveTestProcessor returns a processor whose archive serves each day
+// of days at its URL and 404 for any other day
+func newArchiveTestProcessor(days map[string]string) (*Processor, map[string]*MockHTTPClient) {
+	p := createTestProcessor()
+	p.config.ArchiveURL = testArchiveURL
+	p.config.MaxSnapshots = 2
+
+	clients := make(map[string]*MockHTTPClient)
+	routes := routingHTTPClient{}
+	for _, day := range []string{"20240101", "20240102", "20240103", "20240104"} {
+		date, _ := time.Parse(ArchiveDateLayout, day)
+		client := &MockHTTPClient{StatusCode: http.StatusNotFound}
+		if body, ok := days[day]; ok {
+			client = &MockHTTPClient{ResponseBody: body}
+		}
+		clients[day] = client
+		routes[archiveURL(testArchiveURL, date)] = client
+	}
+	p.httpClient = routes
+	return p, clients
+}
+
+func archiveDate(t *testing.T, day string) time.Time {
+	t.Helper()
+	date, err := time.Parse(ArchiveDateLayout, day)
+	if err != nil {
+		t.Fatalf("parse %q: %v", day, err)
+	}
+	return date
+}
+
+func TestGetIPListForCountryOn(t *testing.T) {
+	p, clients := newArchiveTestProcessor(map[string]string{
+		"20240101": "ripencc|DE|ipv4|2.0.0.0|1048576|20100101|allocated\n",
+		"20240102": "ripencc|DE|ipv4|2.0.0.0|1048576|20100101|allocated\nripencc|DE|ipv4|5.0.0.0|65536|20240102|allocated\nripencc|FR|ipv4|81.2.69.0|256|20100101|allocated\n",
+	})
+
+	testCases := []struct {
+		day      string
+		country  string
+		expected []string
+	}{
+		{day: "20240101", country: "DE", expected: []string{"2.0.0.0/12"}},
+		{day: "20240102", country: "de", expected: []string{"2.0.0.0/12", "5.0.0.0/16"}},
+		{day: "20240101", country: "FR", expected: []string{}},
+		{day: "20240102", country: "FR", expected: []string{"81.2.69.0/24"}},
+	}
+	for _, tc := range testCases {
+		got, err := p.GetIPListForCountryOn(tc.country, archiveDate(t, tc.day))
+		if err != nil {
+			t.Fatalf("GetIPListForCountryOn(%s, %s): %v", tc.country, tc.day, err)
+		}
+		if !reflect.DeepEqual(got, tc.expected) {
+			t.Errorf("GetIPListForCountryOn(%s, %s) = %v, want %v", tc.country, tc.day, got, tc.expected)
+		}
+	}
+
+	// Each day is downloaded once, and the live data is not touched
+	for _, day := range []string{"20240101", "20240102"} {
+		if got := clients[day].CallCount; got != 1 {
+			t.Errorf("%s downloaded %d times, want 1", day, got)
+		}
+	}
+	if !p.DataTime().IsZero() {
+		t.Errorf("DataTime = %v, want the live data untouched", p.DataTime())
+	}
+}
+
+func TestGetIPListForCountryOn_Errors(t *testing.T) {
+	t.Run("Archive disabled", func(t *testing.T) {
+		p := createTestProcessor()
+		if _, err := p.GetIPListForCountryOn("DE", archiveDate(t, "20240101")); !errors.Is(err, ErrArchiveDisabled) {
+			t.Fatalf("expected ErrArchiveDisabled, got %v", err)
+		}
+	})
+
+	t.Run("Day not archived", func(t *testing.T) {
+		p, _ := newArchiveTestProcessor(nil)
+		_, err := p.GetIPListForCountryOn("DE", archiveDate(t, "20240103"))
+		if !errors.Is(err, ErrNoArchive) || err.Error() != "no archived data for date: 20240103" {
+			t.Fatalf("expected ErrNoArchive for 20240103, got %v", err)
+		}
+	})
+
+	t.Run("Failed download is retried once the failure expires", func(t *testing.T) {
+		p, clients := newArchiveTestProcessor(map[string]string{"20240101": "garbage"})
+		day := archiveDate(t, "20240101")
+		if _, err := p.GetIPListForCountryOn("DE", day); !errors.Is(err, ErrBadUpstreamData) {
+			t.Fatalf("expected ErrBadUpstreamData, got %v", err)
+		}
+		clients["20240101"].ResponseBody = "ripencc|DE|ipv4|2.0.0.0|1048576|20100101|allocated\n"
+		if _, err := p.GetIPListForCountryOn("DE", day); !errors.Is(err, ErrBadUpstreamData) {
+			t.Fatalf("expected the cached ErrBadUpstreamData, got %v", err)
+		}
+		if got := clients["20240101"].CallCount; got != 1 {
+			t.Fatalf("downloaded %d times before the failure expired, want 1", got)
+		}
+
+		expireArchiveFailures(p.archive)
+		got, err := p.GetIPListForCountryOn("DE", day)
+		if err != nil || !reflect.DeepEqual(got, []string{"2.0.0.0/12"}) {
+			t.Fatalf("retry = %v, %v, want [2.0.0.0/12]", got, err)
+		}
+	})
+
+	t.Run("Date out of range", func(t *testing.T) {
+		p, _ := newArchiveTestProcessor(nil)
+		for _, date := range []time.Time{ArchiveFirstDate.AddDate(0, 0, -1), time.Now().AddDate(0, 0, 1)} {
+			_, err := p.GetIPListForCountryOn("DE", date)
+			if !errors.Is(err, ErrNoArchive) {
+				t.Errorf("%s: expected ErrNoArchive, got %v", date.Format(ArchiveDateLayout), err)
+			}
+		}
+		if p.archive != nil {
+			t.Error("expected no archive lookup for dates out of range")
+		}
+	})
+}
+
+// expireArchiveFailures makes every stored failure due for a retry
+func expireArchiveFailures(s *archiveStore) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for date, failure := range s.failures {
+		failure.until = time.Now().Add(-time.Second)
+		s.failures[date] = failure
+	}
+}
+
+func TestGetIPListForCountryOn_RepeatedMisses(t *testing.T) {
+	p, clients := newArchiveTestProcessor(map[string]string{"20240102": "ripencc|DE|ipv4|2.0.0.0|1048576|20100101|allocated\n"})
+
+	// Missing days are answered from the failure cache, however often they
+	// are asked for and whatever other days are loaded in between
+	for range 3 {
+		for _, day := range []string{"20240101", "20240103", "20240104", "20240102"} {
+			_, err := p.GetIPListForCountryOn("DE", archiveDate(t, day))
+			if day != "20240102" && !errors.Is(err, ErrNoArchive) {
+				t.Fatalf("%s: expected ErrNoArchive, got %v", day, err)
+			}
+		}
+	}
+	for day, client := range clients {
+		if client.CallCount != 1 {
+			t.Errorf("%s downloaded %d times, want 1", day, client.CallCount)
+		}
+	}
+
+	// Expired failures are dropped when the next one is recorded
+	expireArchiveFailures(p.archive)
+	p.archive.mu.Lock()
+	p.archive.recordFailure("20240105", ErrNoArchive)
+	failures := len(p.archive.failures)
+	p.archive.mu.Unlock()
+	if failures != 1 {
+		t.Errorf("failures = %d, want only the new one", failures)
+	}
+}
+
+func TestGetIPListForCountryOn_Eviction(t *testing.T) {
+	record := "ripencc|DE|ipv4|2.0.0.0|1048576|20100101|allocated\n"
+	p, clients := newArchiveTestProcessor(map[string]string{"20240101": record, "20240102": record, "20240103": record})
+
+	// With room for two days, the least recently used one is dropped
+	for _, day := range []string{"20240101", "20240102", "20240101", "20240103", "20240101", "20240102"} {
+		if _, err := p.GetIPListForCountryOn("DE", archiveDate(t, day)); err != nil {
+			t.Fatalf("%s: %v", day, err)
+		}
+	}
+	want := map[string]int{"20240101": 1, "20240102": 2, "20240103": 1}
+	for day, count := range want {
+		if got := clients[day].CallCount; got != count {
+			t.Errorf("%s downloaded %d times, want %d", day, got, count)
+		}
+	}
+}
+
+func TestGetIPListForCountryOn_Bzip2(t *testing.T) {
+	p := createTestProcessor()
+	p.config.ArchiveURL = "http://archive.test/{year}/delegated-ripencc-extended-{date}.bz2"
+	p.httpClient = routingHTTPClient{
+		"http://archive.test/2024/delegated-ripencc-extended-20240101.bz2": {ResponseBody: bzip2Archive},
+	}
+
+	got, err := p.GetIPListForCountryOn("DE", archiveDate(t, "20240101"))
+	if err != nil || !reflect.DeepEqual(got, []string{"2.0.0.0/12"}) {
+		t.Fatalf("GetIPListForCountryOn = %v, %v, want [2.0.0.0/12]", got, err)
+	}
+}
+
+func TestArchiveStore_SharedDownload(t *testing.T) {
+	s := newArchiveStore(0)
+	if s.size != defaultArchiveSnapshots {
+		t.Errorf("size = %d, want %d", s.size, defaultArchiveSnapshots)
+	}
+
+	release := make(chan struct{})
+	var fetches atomic.Int32
+	fetch := func() (*parsedData, error) {
+		fetches.Add(1)
+		<-release
+		return &parsedData{cache: map[string][]string{"DE": {"2.0.0.0/12"}}}, nil
+	}
+
+	var wg sync.WaitGroup
+	results := make([]*parsedData, 4)
+	for i := range results {
+		wg.Go(func() {
+			results[i], _ = s.get("20240101", fetch)
+		})
+	}
+	// Let every goroutine find the pending entry before the download ends
+	for {
+		s.mu.Lock()
+		_, pending := s.entries["20240101"]
+		s.mu.Unlock()
+		if pending {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	time.Sleep(10 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	if got := fetches.Load(); got != 1 {
+		t.Errorf("fetched %d times, want 1", got)
+	}
+	for i, result := range results {
+		if result != results[0] || result == nil {
+			t.Errorf("result %d = %p, want the shared %p", i, result, results[0])
+		}
+	}
+}
+
+func TestArchiveStore_EvictedFailure(t *testing.T) {
+	s := newArchiveStore(1)
+
+	// The failing day is evicted by another day while its download runs
+	_, err := s.get("20240101", func() (*parsedData, error) {
+		s.get("20240102", func() (*parsedData, error) { return &parsedData{}, nil })
+		return nil, ErrDownloadFailed
+	})
+	if !errors.Is(err, ErrDownloadFailed) {
+		t.Fatalf("expected ErrDownloadFailed, got %v", err)
+	}
+	if _, ok := s.entries["20240102"]; !ok || !reflect.DeepEqual(s.order, []string{"20240102"}) {
+		t.Errorf("entries = %v, order = %v, want only 20240102", s.entries, s.order)
+	}
+}
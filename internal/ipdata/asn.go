@@ -0,0 +1,56 @@
+package ipdata
+
+import (
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// maxASNRecordCount caps how many AS numbers a single record may expand to,
+// guarding against corrupt counts
+const maxASNRecordCount = 1 << 16
+
+// parseASNRange parses the start AS number and count of an asn record
+// (e.g. "ripencc|DE|asn|3320|2|19930901|allocated")
+func parseASNRange(startStr, countStr string) (start uint32, count int, ok bool) {
+	start64, err := strconv.ParseUint(startStr, 10, 32)
+	if err != nil {
+		return 0, 0, false
+	}
+	count, err = strconv.Atoi(countStr)
+	if err != nil || count < 1 || count > maxASNRecordCount || start64+uint64(count)-1 > math.MaxUint32 {
+		return 0, 0, false
+	}
+	return uint32(start64), count, true
+}
+
+// appendASNRange appends count consecutive AS numbers starting at start
+func appendASNRange(asns []uint32, start uint32, count int) []uint32 {
+	for i := range count {
+		asns = append(asns, start+uint32(i))
+	}
+	return asns
+}
+
+// GetASNsForCountry returns the sorted AS numbers allocated to a country
+func (p *Processor) GetASNsForCountry(countryCode string) ([]uint32, error) {
+	countryCode = strings.ToUpper(countryCode)
+
+	if err := p.refreshIfOlderThan(p.ttlFor(countryCode)); err != nil {
+		return nil, err
+	}
+
+	p.mutex.RLock()
+	defer p.mutex.RUnlock()
+	if asns, ok := p.asns[countryCode]; ok {
+		return slices.Clone(asns), nil
+	}
+	return []uint32{}, nil
+}
+
+// sortedUniqueASNs sorts the AS numbers and removes duplicates
+func sortedUniqueASNs(asns []uint32) []uint32 {
+	slices.Sort(asns)
+	return slices.Compact(asns)
+}
@@ -0,0 +1,97 @@
+package ipdata
+
+import (
+	"errors"
+	"math"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestParseASNRange(t *testing.T) {
+	testCases := []struct {
+		name          string
+		start         string
+		count         string
+		expectedStart uint32
+		expectedCount int
+		expectedOK    bool
+	}{
+		{name: "Single", start: "3320", count: "1", expectedStart: 3320, expectedCount: 1, expectedOK: true},
+		{name: "Range", start: "196608", count: "1024", expectedStart: 196608, expectedCount: 1024, expectedOK: true},
+		{name: "Last AS number", start: strconv.FormatUint(math.MaxUint32, 10), count: "1", expectedStart: math.MaxUint32, expectedCount: 1, expectedOK: true},
+		{name: "Beyond 32 bits", start: strconv.FormatUint(math.MaxUint32, 10), count: "2", expectedOK: false},
+		{name: "Invalid start", start: "AS3320", count: "1", expectedOK: false},
+		{name: "Invalid count", start: "3320", count: "many", expectedOK: false},
+		{name: "Zero count", start: "3320", count: "0", expectedOK: false},
+		{name: "Count above cap", start: "1", count: strconv.Itoa(maxASNRecordCount + 1), expectedOK: false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			start, count, ok := parseASNRange(tc.start, tc.count)
+			if ok != tc.expectedOK {
+				t.Fatalf("parseASNRange(%q, %q) ok = %v, want %v", tc.start, tc.count, ok, tc.expectedOK)
+			}
+			if ok && (start != tc.expectedStart || count != tc.expectedCount) {
+				t.Errorf("parseASNRange(%q, %q) = (%d, %d), want (%d, %d)",
+					tc.start, tc.count, start, count, tc.expectedStart, tc.expectedCount)
+			}
+		})
+	}
+}
+
+func TestGetASNsForCountry(t *testing.T) {
+	data := strings.Join([]string{
+		"2|ripencc|20220101|5|19830705|20220101|+0100",
+		"ripencc|*|asn|*|4|summary",
+		"ripencc|DE|asn|8881|1|19970101|allocated",
+		"ripencc|DE|asn|3320|2|19930901|allocated",
+		"ripencc|de|asn|3321|1|19930901|allocated",
+		"ripencc|FR|asn|not-a-number|1|19930901|allocated",
+		"arin|US|asn|7018|1|19960101|allocated",
+		"ripencc|DE|ipv4|2.0.0.0|1048576|20220101|allocated",
+		"ripencc|FR|ipv4|5.0.0.0|65536|20220101|allocated",
+	}, "\n")
+
+	processor := createTestProcessorWithMockData(data)
+
+	de, err := processor.GetASNsForCountry("de")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if want := []uint32{3320, 3321, 8881}; !reflect.DeepEqual(de, want) {
+		t.Errorf("DE AS numbers = %v, want %v", de, want)
+	}
+
+	for _, country := range []string{"FR", "US"} {
+		asns, err := processor.GetASNsForCountry(country)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if len(asns) != 0 {
+			t.Errorf("%s AS numbers = %v, want none", country, asns)
+		}
+	}
+
+	// IPv4 parsing is unaffected by the asn records
+	if want := []string{"2.0.0.0/12"}; !reflect.DeepEqual(cachedEntries(processor)["DE"], want) {
+		t.Errorf("DE cache = %v, want %v", cachedEntries(processor)["DE"], want)
+	}
+	if want := []string{"5.0.0.0/16"}; !reflect.DeepEqual(cachedEntries(processor)["FR"], want) {
+		t.Errorf("FR cache = %v, want %v", cachedEntries(processor)["FR"], want)
+	}
+
+	if mc := processor.httpClient.(*MockHTTPClient); mc.CallCount != 1 {
+		t.Errorf("expected a single download, CallCount=%d", mc.CallCount)
+	}
+}
+
+func TestGetASNsForCountry_DownloadError(t *testing.T) {
+	processor := createTestProcessor()
+
+	if _, err := processor.GetASNsForCountry("DE"); !errors.Is(err, ErrDownloadFailed) {
+		t.Fatalf("expected ErrDownloadFailed, got %v", err)
+	}
+}
@@ -0,0 +1,58 @@
+package ipdata
+
+import (
+	"fmt"
+	"log"
+	"log/slog"
+	"time"
+)
+
+// defaultBreakerCooldown is used when BreakerCooldown is not a valid duration
+const defaultBreakerCooldown = time.Minute
+
+// ErrCircuitOpen is returned instead of attempting a download while the
+// circuit breaker is open
+var ErrCircuitOpen = fmt.Errorf("%w: circuit breaker open", ErrDownloadFailed)
+
+// circuitBreaker stops download attempts after repeated consecutive failures.
+// It is not safe for concurrent use; the processor guards it with its write lock.
+type circuitBreaker struct {
+	threshold int           // consecutive failures that open the breaker, 0 disables it
+	cooldown  time.Duration // how long the breaker stays open
+	failures  int           // consecutive failures so far
+	openedAt  time.Time     // when the breaker last opened, zero while closed
+}
+
+// newCircuitBreaker creates a circuit breaker from the configured threshold and cooldown
+func newCircuitBreaker(threshold int, cooldown string) *circuitBreaker {
+	d, err := time.ParseDuration(cooldown)
+	if err != nil || d <= 0 {
+		d = defaultBreakerCooldown
+	}
+	return &circuitBreaker{threshold: threshold, cooldown: d}
+}
+
+// allow reports whether a download may be attempted. Once the cooldown has
+// elapsed the breaker is half-open and lets a probe through.
+func (b *circuitBreaker) allow() bool {
+	return b.openedAt.IsZero() || time.Since(b.openedAt) >= b.cooldown
+}
+
+// recordFailure counts a failed download, (re)opening the breaker when the
+// threshold is reached
+func (b *circuitBreaker) recordFailure() {
+	b.failures++
+	if b.threshold > 0 && b.failures >= b.threshold {
+		b.openedAt = time.Now()
+		slog.Error("Circuit breaker open, pausing downloads", "failures", b.failures, "cooldown", b.cooldown)
+	}
+}
+
+// recordSuccess closes the breaker
+func (b *circuitBreaker) recordSuccess() {
+	if !b.openedAt.IsZero() {
+		log.Println("Circuit breaker closed, download succeeded")
+	}
+	b.failures = 0
+	b.openedAt = time.Time{}
+}
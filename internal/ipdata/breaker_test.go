@@ -0,0 +1,139 @@
+package ipdata
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestNewCircuitBreaker(t *testing.T) {
+	testCases := []struct {
+		name             string
+		cooldown         string
+		expectedCooldown time.Duration
+	}{
+		{name: "Valid cooldown", cooldown: "30s", expectedCooldown: 30 * time.Second},
+		{name: "Invalid cooldown", cooldown: "soon", expectedCooldown: defaultBreakerCooldown},
+		{name: "Non-positive cooldown", cooldown: "0s", expectedCooldown: defaultBreakerCooldown},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			b := newCircuitBreaker(3, tc.cooldown)
+			if b.threshold != 3 || b.cooldown != tc.expectedCooldown {
+				t.Errorf("newCircuitBreaker(3, %q) = %+v, want threshold 3 and cooldown %s", tc.cooldown, b, tc.expectedCooldown)
+			}
+		})
+	}
+}
+
+func TestCircuitBreakerDisabled(t *testing.T) {
+	b := newCircuitBreaker(0, "1m")
+	for range 10 {
+		b.recordFailure()
+	}
+	if !b.allow() {
+		t.Error("breaker with threshold 0 should never open")
+	}
+}
+
+func TestCircuitBreaker_OpenCooldownRecovery(t *testing.T) {
+	mockClient := &MockHTTPClient{ShouldError: true, ErrorMsg: "connection refused"}
+	processor := createTestProcessor()
+	processor.httpClient = mockClient
+	processor.config.BreakerThreshold = 2
+	processor.config.BreakerCooldown = "1m"
+
+	// Consecutive failures below and at the threshold still attempt downloads
+	for i := 1; i <= 2; i++ {
+		if _, err := processor.GetIPListForCountry("DE"); err == nil || errors.Is(err, ErrCircuitOpen) {
+			t.Fatalf("attempt %d: expected download error, got %v", i, err)
+		}
+		if mockClient.CallCount != i {
+			t.Fatalf("attempt %d: expected %d downloads, got %d", i, i, mockClient.CallCount)
+		}
+	}
+
+	// Open: a cold cache fails fast without a download
+	_, err := processor.GetIPListForCountry("DE")
+	if !errors.Is(err, ErrNotReady) || !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("expected ErrNotReady and ErrCircuitOpen while open, got %v", err)
+	}
+	if mockClient.CallCount != 2 {
+		t.Fatalf("expected no download while open, got %d downloads", mockClient.CallCount)
+	}
+
+	// Half-open after the cooldown: the probe succeeds and closes the breaker
+	processor.breaker.openedAt = time.Now().Add(-2 * time.Minute)
+	mockClient.ShouldError = false
+	mockClient.ResponseBody = "ripencc|DE|ipv4|2.0.0.0|1048576|20220101|allocated"
+
+	ipList, err := processor.GetIPListForCountry("DE")
+	if err != nil {
+		t.Fatalf("expected probe download to succeed, got %v", err)
+	}
+	if !reflect.DeepEqual(ipList, []string{"2.0.0.0/12"}) {
+		t.Errorf("unexpected IP list after recovery: %v", ipList)
+	}
+	if mockClient.CallCount != 3 {
+		t.Errorf("expected 3 downloads, got %d", mockClient.CallCount)
+	}
+	if processor.breaker.failures != 0 || !processor.breaker.openedAt.IsZero() {
+		t.Errorf("expected breaker to be closed, got %+v", processor.breaker)
+	}
+}
+
+func TestCircuitBreaker_ServesStaleDataWhileOpen(t *testing.T) {
+	mockClient := &MockHTTPClient{ShouldError: true, ErrorMsg: "connection refused"}
+	processor := createTestProcessor()
+	processor.httpClient = mockClient
+	processor.config.BreakerThreshold = 1
+	cachedEntries(processor)["DE"] = []string{"2.0.0.0/12"}
+	setCacheTime(processor, time.Now().Add(-2*processor.cacheTTL))
+
+	if _, err := processor.GetIPListForCountry("DE"); err == nil {
+		t.Fatal("expected the failure that opens the breaker to be reported")
+	}
+
+	ipList, err := processor.GetIPListForCountry("DE")
+	if err != nil {
+		t.Fatalf("expected stale data while open, got %v", err)
+	}
+	if !reflect.DeepEqual(ipList, []string{"2.0.0.0/12"}) {
+		t.Errorf("unexpected stale IP list: %v", ipList)
+	}
+	if mockClient.CallCount != 1 {
+		t.Errorf("expected 1 download, got %d", mockClient.CallCount)
+	}
+
+	// A failed probe reopens the breaker for another cooldown
+	processor.breaker.openedAt = time.Now().Add(-2 * processor.breaker.cooldown)
+	if _, err := processor.GetIPListForCountry("DE"); err == nil || errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("expected probe download error, got %v", err)
+	}
+	if _, err := processor.GetIPListForCountry("DE"); err != nil {
+		t.Fatalf("expected stale data after failed probe, got %v", err)
+	}
+	if mockClient.CallCount != 2 {
+		t.Errorf("expected 2 downloads, got %d", mockClient.CallCount)
+	}
+}
+
+func TestCircuitBreaker_FallbackFailureCounts(t *testing.T) {
+	client := routingHTTPClient{
+		ripeURL:         &MockHTTPClient{ShouldError: true, ErrorMsg: "connection refused"},
+		testFallbackURL: &MockHTTPClient{ShouldError: true, ErrorMsg: "connection refused"},
+	}
+	processor := createTestProcessor()
+	processor.httpClient = client
+	processor.config.FallbackDataURL = testFallbackURL
+	processor.config.BreakerThreshold = 1
+
+	if _, err := processor.GetIPListForCountry("DE"); err == nil {
+		t.Fatal("expected download error")
+	}
+	if _, err := processor.GetIPListForCountry("DE"); !errors.Is(err, ErrCircuitOpen) {
+		t.Errorf("expected ErrCircuitOpen after both sources failed, got %v", err)
+	}
+}
@@ -0,0 +1,80 @@
+package ipdata
+
+import (
+	"slices"
+	"sync/atomic"
+	"time"
+)
+
+// Cache stores the CIDR blocks of every country together with the time they
+// were loaded. Implementations must be safe for concurrent use; the default
+// is an in-memory map, but a shared backend lets several instances serve the
+// same warm data.
+type Cache interface {
+	// Get returns the CIDR blocks of a country and whether it is present.
+	// The slice may be shared with the cache, so callers must not modify it.
+	Get(country string) ([]string, bool)
+	// Set replaces all entries at once and records when they were loaded
+	Set(all map[string][]string, loadedAt time.Time)
+	// Countries returns the sorted country codes present in the cache
+	Countries() []string
+	// Info describes the cached data
+	Info() CacheInfo
+}
+
+// CacheInfo describes the data held by a Cache
+type CacheInfo struct {
+	LoadedAt  time.Time // zero while nothing has been loaded
+	Countries int       // number of countries present
+}
+
+// memoryCache is the default in-process Cache. Its entries and load time
+// are an immutable snapshot swapped atomically by Set, so reads take no lock.
+type memoryCache struct {
+	snapshot atomic.Pointer[cacheSnapshot]
+}
+
+// cacheSnapshot is the data held by a memoryCache at one point in time
+type cacheSnapshot struct {
+	entries  map[string][]string
+	loadedAt time.Time
+}
+
+// NewMemoryCache creates an empty in-memory cache
+func NewMemoryCache() Cache {
+	c := &memoryCache{}
+	c.snapshot.Store(&cacheSnapshot{entries: make(map[string][]string)})
+	return c
+}
+
+// Get returns the CIDR blocks of a country and whether it is present. The
+// slice is shared with the cache and must not be modified.
+func (c *memoryCache) Get(country string) ([]string, bool) {
+	cidrs, ok := c.snapshot.Load().entries[country]
+	return cidrs, ok
+}
+
+// Set replaces all entries at once. The map is owned by the cache afterwards.
+func (c *memoryCache) Set(all map[string][]string, loadedAt time.Time) {
+	if all == nil {
+		all = make(map[string][]string)
+	}
+	c.snapshot.Store(&cacheSnapshot{entries: all, loadedAt: loadedAt})
+}
+
+// Countries returns the sorted country codes present in the cache
+func (c *memoryCache) Countries() []string {
+	entries := c.snapshot.Load().entries
+	countries := make([]string, 0, len(entries))
+	for country := range entries {
+		countries = append(countries, country)
+	}
+	slices.Sort(countries)
+	return countries
+}
+
+// Info describes the cached data
+func (c *memoryCache) Info() CacheInfo {
+	s := c.snapshot.Load()
+	return CacheInfo{LoadedAt: s.loadedAt, Countries: len(s.entries)}
+}
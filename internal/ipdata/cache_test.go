@@ -0,0 +1,111 @@
+package ipdata
+
+import (
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+// newTestCache creates an in-memory cache holding entries loaded at loadedAt
+func newTestCache(entries map[string][]string, loadedAt time.Time) Cache {
+	cache := NewMemoryCache()
+	cache.Set(entries, loadedAt)
+	return cache
+}
+
+// cachedEntries returns the entries held by the processor's in-memory cache
+func cachedEntries(p *Processor) map[string][]string {
+	return p.cache.(*memoryCache).snapshot.Load().entries
+}
+
+// setCacheTime changes when the processor's cached data was loaded without replacing it
+func setCacheTime(p *Processor, loadedAt time.Time) {
+	c := p.cache.(*memoryCache)
+	c.snapshot.Store(&cacheSnapshot{entries: c.snapshot.Load().entries, loadedAt: loadedAt})
+	served := p.servedData()
+	p.served.Store(&servedData{entries: served.entries, source: served.source, loadedAt: loadedAt})
+}
+
+func TestMemoryCache_Empty(t *testing.T) {
+	cache := NewMemoryCache()
+
+	if cidrs, ok := cache.Get("DE"); ok || cidrs != nil {
+		t.Errorf("Get on empty cache = %v, %v; want nil, false", cidrs, ok)
+	}
+	if countries := cache.Countries(); len(countries) != 0 {
+		t.Errorf("Countries on empty cache = %v, want empty", countries)
+	}
+	if info := cache.Info(); !info.LoadedAt.IsZero() || info.Countries != 0 {
+		t.Errorf("Info on empty cache = %+v, want zero", info)
+	}
+}
+
+func TestMemoryCache_SetReplacesAllEntries(t *testing.T) {
+	cache := NewMemoryCache()
+	first := time.Now().Add(-time.Hour)
+	cache.Set(map[string][]string{"DE": {"2.0.0.0/12"}, "NL": {"31.0.0.0/24"}}, first)
+
+	if cidrs, ok := cache.Get("DE"); !ok || !reflect.DeepEqual(cidrs, []string{"2.0.0.0/12"}) {
+		t.Errorf("Get(DE) = %v, %v", cidrs, ok)
+	}
+	if countries := cache.Countries(); !reflect.DeepEqual(countries, []string{"DE", "NL"}) {
+		t.Errorf("Countries() = %v, want [DE NL]", countries)
+	}
+	if info := cache.Info(); !info.LoadedAt.Equal(first) || info.Countries != 2 {
+		t.Errorf("Info() = %+v, want loaded at %v with 2 countries", info, first)
+	}
+
+	// A country missing from the new data must not survive the replacement
+	second := time.Now()
+	cache.Set(map[string][]string{"FR": {"5.0.0.0/16"}, "DE": {}}, second)
+
+	if _, ok := cache.Get("NL"); ok {
+		t.Error("expected NL to be gone after Set")
+	}
+	if cidrs, ok := cache.Get("DE"); !ok || len(cidrs) != 0 {
+		t.Errorf("Get(DE) = %v, %v; want present and empty", cidrs, ok)
+	}
+	if countries := cache.Countries(); !reflect.DeepEqual(countries, []string{"DE", "FR"}) {
+		t.Errorf("Countries() = %v, want [DE FR]", countries)
+	}
+	if info := cache.Info(); !info.LoadedAt.Equal(second) || info.Countries != 2 {
+		t.Errorf("Info() = %+v, want loaded at %v with 2 countries", info, second)
+	}
+}
+
+func TestMemoryCache_SetNil(t *testing.T) {
+	cache := NewMemoryCache()
+	cache.Set(map[string][]string{"DE": {"2.0.0.0/12"}}, time.Now())
+	cache.Set(nil, time.Time{})
+
+	if _, ok := cache.Get("DE"); ok {
+		t.Error("expected Set(nil) to clear the cache")
+	}
+	if info := cache.Info(); !info.LoadedAt.IsZero() || info.Countries != 0 {
+		t.Errorf("Info() = %+v, want zero", info)
+	}
+}
+
+func TestMemoryCache_ConcurrentUse(t *testing.T) {
+	cache := NewMemoryCache()
+	var wg sync.WaitGroup
+	for i := range 8 {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			cache.Set(map[string][]string{"DE": {"2.0.0.0/12"}}, time.Now().Add(time.Duration(i)))
+		}()
+		go func() {
+			defer wg.Done()
+			cache.Get("DE")
+			cache.Countries()
+			cache.Info()
+		}()
+	}
+	wg.Wait()
+
+	if cidrs, ok := cache.Get("DE"); !ok || !reflect.DeepEqual(cidrs, []string{"2.0.0.0/12"}) {
+		t.Errorf("Get(DE) = %v, %v after concurrent use", cidrs, ok)
+	}
+}
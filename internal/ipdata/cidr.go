@@ -0,0 +1,80 @@
+package ipdata
+
+import (
+	"math/bits"
+	"net"
+	"strconv"
+)
+
+// formatCIDR returns the CIDR notation for a start address and mask
+func formatCIDR(ipStart string, mask int) string {
+	buf := make([]byte, 0, len(ipStart)+3)
+	buf = append(buf, ipStart...)
+	buf = append(buf, '/')
+	buf = strconv.AppendInt(buf, int64(mask), 10)
+	return string(buf)
+}
+
+// normalizeIPv4Network returns the canonical network address of an IPv4 block,
+// e.g. "192.168.0.5" with mask 24 becomes "192.168.0.0". IPv4-mapped IPv6
+// addresses are converted to dotted-decimal form. It reports false if the
+// address or mask is not a valid IPv4 prefix.
+func normalizeIPv4Network(ipStart string, mask int) (string, bool) {
+	ip4 := net.ParseIP(ipStart).To4()
+	if ip4 == nil {
+		return "", false
+	}
+
+	_, ipNet, err := net.ParseCIDR(formatCIDR(ip4.String(), mask))
+	if err != nil {
+		return "", false
+	}
+	return ipNet.IP.String(), true
+}
+
+// buildCIDRs converts IP allocation records to CIDR notation
+func buildCIDRs(ipDataList []IPData) []string {
+	cidrList := make([]string, 0, len(ipDataList))
+	for _, ipData := range ipDataList {
+		cidrList = append(cidrList, formatCIDR(ipData.IPStart, ipData.CIDRMask))
+	}
+	return cidrList
+}
+
+// dedupeIPData removes records that resolve to an already seen CIDR block,
+// keeping the first occurrence so the order stays deterministic
+func dedupeIPData(ipDataList []IPData) []IPData {
+	seen := make(map[string]struct{}, len(ipDataList))
+	unique := make([]IPData, 0, len(ipDataList))
+	for _, ipData := range ipDataList {
+		cidr := formatCIDR(ipData.IPStart, ipData.CIDRMask)
+		if _, ok := seen[cidr]; ok {
+			continue
+		}
+		seen[cidr] = struct{}{}
+		unique = append(unique, ipData)
+	}
+	return unique
+}
+
+// maskForCount returns the prefix length of an allocation of count addresses
+// (1..2^32). Counts that are not a power of two are rounded to the longer
+// prefix, the largest block that fits, so the block never covers more
+// addresses than were allocated: 3 addresses give a /31 (2 addresses), 768
+// give a /23 (512). The rest of such an allocation is not served.
+func maskForCount(count uint64) int {
+	return 32 - (bits.Len64(count) - 1)
+}
+
+// prefixAddressCount returns the number of addresses covered by an IPv4 prefix
+// length. A /0 covers 2^32 addresses, which overflows int on 32-bit platforms.
+func prefixAddressCount(mask int) uint64 {
+	return 1 << (32 - mask)
+}
+
+// hasMaskMismatch reports whether the CIDR derived from an allocation record
+// covers a different number of addresses than the source count
+// (e.g. non-power-of-two counts)
+func hasMaskMismatch(ipData IPData) bool {
+	return prefixAddressCount(ipData.CIDRMask) != ipData.Count
+}
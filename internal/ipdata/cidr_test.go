@@ -0,0 +1,190 @@
+package ipdata
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"testing"
+)
+
+// buildCIDRsSprintf is the original fmt.Sprintf based implementation, kept as a reference
+func buildCIDRsSprintf(ipDataList []IPData) []string {
+	cidrList := make([]string, 0, len(ipDataList))
+	for _, ipData := range ipDataList {
+		cidrList = append(cidrList, fmt.Sprintf("%s/%d", ipData.IPStart, ipData.CIDRMask))
+	}
+	return cidrList
+}
+
+// syntheticIPData generates n allocation records with varying addresses and masks
+func syntheticIPData(n int) []IPData {
+	list := make([]IPData, 0, n)
+	for i := 0; i < n; i++ {
+		mask := 8 + i%25
+		list = append(list, IPData{
+			Country:  "DE",
+			IPStart:  strconv.Itoa(i>>16&255) + "." + strconv.Itoa(i>>8&255) + "." + strconv.Itoa(i&255) + ".0",
+			Count:    1 << (32 - mask),
+			CIDRMask: mask,
+		})
+	}
+	return list
+}
+
+func TestFormatCIDR(t *testing.T) {
+	testCases := []struct {
+		ipStart  string
+		mask     int
+		expected string
+	}{
+		{ipStart: "192.168.0.0", mask: 24, expected: "192.168.0.0/24"},
+		{ipStart: "10.0.0.0", mask: 8, expected: "10.0.0.0/8"},
+		{ipStart: "1.2.3.4", mask: 32, expected: "1.2.3.4/32"},
+		{ipStart: "0.0.0.0", mask: 0, expected: "0.0.0.0/0"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.expected, func(t *testing.T) {
+			if got := formatCIDR(tc.ipStart, tc.mask); got != tc.expected {
+				t.Errorf("formatCIDR(%q, %d) = %q, want %q", tc.ipStart, tc.mask, got, tc.expected)
+			}
+		})
+	}
+}
+
+func TestBuildCIDRsMatchesSprintf(t *testing.T) {
+	data := syntheticIPData(10000)
+
+	got := buildCIDRs(data)
+	want := buildCIDRsSprintf(data)
+	if !reflect.DeepEqual(got, want) {
+		t.Fatal("buildCIDRs output differs from fmt.Sprintf reference")
+	}
+}
+
+func TestBuildCIDRsEmpty(t *testing.T) {
+	got := buildCIDRs(nil)
+	if got == nil || len(got) != 0 {
+		t.Fatalf("buildCIDRs(nil) = %#v, want empty non-nil slice", got)
+	}
+}
+
+func BenchmarkBuildCIDRs(b *testing.B) {
+	data := syntheticIPData(50000)
+
+	b.Run("append", func(b *testing.B) {
+		b.ReportAllocs()
+		for b.Loop() {
+			buildCIDRs(data)
+		}
+	})
+
+	b.Run("sprintf", func(b *testing.B) {
+		b.ReportAllocs()
+		for b.Loop() {
+			buildCIDRsSprintf(data)
+		}
+	})
+}
+
+func TestHasMaskMismatch(t *testing.T) {
+	testCases := []struct {
+		count    uint64
+		expected bool
+	}{
+		{count: 1, expected: false},
+		{count: 256, expected: false},
+		{count: 1024, expected: false},
+		{count: 65536, expected: false},
+		{count: 768, expected: true},
+		{count: 1536, expected: true},
+		{count: 3, expected: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(strconv.FormatUint(tc.count, 10), func(t *testing.T) {
+			ipData := IPData{
+				IPStart:  "2.0.0.0",
+				Count:    tc.count,
+				CIDRMask: maskForCount(tc.count),
+			}
+			if got := hasMaskMismatch(ipData); got != tc.expected {
+				t.Errorf("hasMaskMismatch(count=%d) = %v, want %v", tc.count, got, tc.expected)
+			}
+		})
+	}
+}
+
+func TestMaskForCount(t *testing.T) {
+	testCases := []struct {
+		count    uint64
+		expected int
+	}{
+		{count: 1, expected: 32},
+		{count: 2, expected: 31},
+		{count: 3, expected: 31},
+		{count: 5, expected: 30},
+		{count: 256, expected: 24},
+		{count: 768, expected: 23},
+		{count: 1023, expected: 23},
+		{count: 1 << 32, expected: 0},
+	}
+
+	for _, tc := range testCases {
+		t.Run(strconv.FormatUint(tc.count, 10), func(t *testing.T) {
+			mask := maskForCount(tc.count)
+			if mask != tc.expected {
+				t.Errorf("maskForCount(%d) = %d, want %d", tc.count, mask, tc.expected)
+			}
+			if size := prefixAddressCount(mask); size > tc.count {
+				t.Errorf("/%d covers %d addresses, more than the %d allocated", mask, size, tc.count)
+			}
+		})
+	}
+}
+
+func TestDedupeIPData(t *testing.T) {
+	list := []IPData{
+		{Registry: "ripencc", IPStart: "2.0.0.0", CIDRMask: 12},
+		{Registry: "ripencc", IPStart: "5.0.0.0", CIDRMask: 16},
+		{Registry: "arin", IPStart: "2.0.0.0", CIDRMask: 12},
+		{Registry: "ripencc", IPStart: "2.0.0.0", CIDRMask: 16},
+		{Registry: "ripencc", IPStart: "5.0.0.0", CIDRMask: 16},
+	}
+
+	got := buildCIDRs(dedupeIPData(list))
+	want := []string{"2.0.0.0/12", "5.0.0.0/16", "2.0.0.0/16"}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("dedupeIPData = %#v, want %#v", got, want)
+	}
+}
+
+func TestNormalizeIPv4Network(t *testing.T) {
+	testCases := []struct {
+		name     string
+		ipStart  string
+		mask     int
+		expected string
+		ok       bool
+	}{
+		{name: "Aligned", ipStart: "192.168.0.0", mask: 24, expected: "192.168.0.0", ok: true},
+		{name: "Misaligned", ipStart: "192.168.0.5", mask: 24, expected: "192.168.0.0", ok: true},
+		{name: "Misaligned wide", ipStart: "10.20.30.40", mask: 8, expected: "10.0.0.0", ok: true},
+		{name: "Host route", ipStart: "1.2.3.4", mask: 32, expected: "1.2.3.4", ok: true},
+		{name: "IPv4-mapped", ipStart: "::ffff:192.168.0.5", mask: 24, expected: "192.168.0.0", ok: true},
+		{name: "IPv6", ipStart: "2001:db8::", mask: 32, ok: false},
+		{name: "Invalid address", ipStart: "999.1.1.1", mask: 24, ok: false},
+		{name: "Invalid mask", ipStart: "192.168.0.0", mask: 33, ok: false},
+		{name: "Negative mask", ipStart: "192.168.0.0", mask: -1, ok: false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, ok := normalizeIPv4Network(tc.ipStart, tc.mask)
+			if ok != tc.ok || got != tc.expected {
+				t.Errorf("normalizeIPv4Network(%q, %d) = (%q, %v), want (%q, %v)",
+					tc.ipStart, tc.mask, got, ok, tc.expected, tc.ok)
+			}
+		})
+	}
+}
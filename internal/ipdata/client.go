@@ -0,0 +1,144 @@
+package ipdata
+
+import (
+	"context"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/anisimovdk/ip-whitelist-by-country/internal/config"
+)
+
+// dialFunc matches the signature of net.Dialer.DialContext
+type dialFunc func(ctx context.Context, network, addr string) (net.Conn, error)
+
+// newHTTPClient returns the HTTP client used for downloads.
+//
+// If HTTPProxy is set, requests go through that proxy (overriding the
+// environment) except for hosts matched by NoProxy. If DataHostIP is set,
+// direct connections to the RIPE NCC host are dialed to that IP instead of
+// resolving it, while the request keeps its original Host header and TLS
+// server name. Other hosts, such as the proxy, the fallback mirror, the
+// upstream peer or the archive, are resolved as usual.
+func newHTTPClient(cfg *config.Config) HTTPClient {
+	var proxyURL *url.URL
+	if cfg.HTTPProxy != "" {
+		parsed, err := url.Parse(cfg.HTTPProxy)
+		if err != nil || parsed.Host == "" {
+			log.Printf("Ignoring invalid HTTP proxy %q\n", cfg.HTTPProxy)
+		} else {
+			proxyURL = parsed
+		}
+	}
+
+	hostIP := cfg.DataHostIP
+	if hostIP != "" && net.ParseIP(hostIP) == nil {
+		log.Printf("Ignoring invalid data host IP %q\n", hostIP)
+		hostIP = ""
+	}
+
+	if proxyURL == nil && hostIP == "" {
+		return http.DefaultClient
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+
+	if proxyURL != nil {
+		transport.Proxy = proxyFunc(proxyURL, strings.Split(cfg.NoProxy, ","))
+	}
+
+	if hostIP != "" {
+		dialer := &net.Dialer{
+			Timeout:   30 * time.Second,
+			KeepAlive: 30 * time.Second,
+		}
+		transport.DialContext = pinnedDialContext(hostIP, ripeHost(), dialer.DialContext)
+	}
+
+	return &http.Client{Transport: transport}
+}
+
+// proxyFunc returns a Transport.Proxy function that sends every request through
+// proxyURL unless the target host matches a noProxy entry. Entries may be exact
+// host names, domain suffixes (".example.com" or "example.com"), IP addresses,
+// CIDR blocks, or "*" to bypass the proxy entirely.
+func proxyFunc(proxyURL *url.URL, noProxy []string) func(*http.Request) (*url.URL, error) {
+	return func(req *http.Request) (*url.URL, error) {
+		host := req.URL.Hostname()
+		for _, entry := range noProxy {
+			if matchesNoProxy(host, strings.TrimSpace(entry)) {
+				return nil, nil
+			}
+		}
+		return proxyURL, nil
+	}
+}
+
+// matchesNoProxy reports whether host is matched by a single NoProxy entry
+func matchesNoProxy(host, entry string) bool {
+	switch {
+	case entry == "":
+		return false
+	case entry == "*":
+		return true
+	}
+
+	if _, ipNet, err := net.ParseCIDR(entry); err == nil {
+		ip := net.ParseIP(host)
+		return ip != nil && ipNet.Contains(ip)
+	}
+
+	domain := strings.TrimPrefix(entry, ".")
+	return strings.EqualFold(host, domain) || strings.HasSuffix(strings.ToLower(host), "."+strings.ToLower(domain))
+}
+
+// pinnedDialContext wraps dial so that connections to pinHost go to hostIP on
+// the requested port. Connections to any other host are dialed unchanged.
+func pinnedDialContext(hostIP, pinHost string, dial dialFunc) dialFunc {
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		host, port, err := net.SplitHostPort(addr)
+		if err != nil {
+			return nil, err
+		}
+		if !strings.EqualFold(host, pinHost) {
+			return dial(ctx, network, addr)
+		}
+		return dial(ctx, network, net.JoinHostPort(hostIP, port))
+	}
+}
+
+// ripeHost returns the host name of the RIPE NCC download URL, the only host
+// DataHostIP applies to
+func ripeHost() string {
+	parsed, err := url.Parse(ripeURL)
+	if err != nil {
+		return ""
+	}
+	return parsed.Hostname()
+}
+
+// sizeLimitedReader fails with ErrDownloadTooLarge once more than limit bytes are read
+type sizeLimitedReader struct {
+	r     io.Reader
+	n     int64
+	limit int64
+}
+
+// limitBody wraps body so that reading past limit bytes returns ErrDownloadTooLarge
+func limitBody(body io.Reader, limit int64) io.Reader {
+	return &sizeLimitedReader{r: io.LimitReader(body, limit+1), limit: limit}
+}
+
+// Read implements io.Reader
+func (l *sizeLimitedReader) Read(p []byte) (int, error) {
+	n, err := l.r.Read(p)
+	l.n += int64(n)
+	if l.n > l.limit {
+		return n, ErrDownloadTooLarge
+	}
+	return n, err
+}
@@ -0,0 +1,248 @@
+package ipdata
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/anisimovdk/ip-whitelist-by-country/internal/config"
+)
+
+func TestNewHTTPClient_DefaultWithoutHostIP(t *testing.T) {
+	if got := newHTTPClient(&config.Config{}); got != http.DefaultClient {
+		t.Fatalf("expected http.DefaultClient, got %#v", got)
+	}
+}
+
+func TestNewHTTPClient_InvalidHostIPFallsBack(t *testing.T) {
+	if got := newHTTPClient(&config.Config{DataHostIP: "not-an-ip"}); got != http.DefaultClient {
+		t.Fatalf("expected http.DefaultClient, got %#v", got)
+	}
+}
+
+func TestNewHTTPClient_DialsPinnedIPAndKeepsHost(t *testing.T) {
+	hosts := make(chan string, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hosts <- r.Host
+		io.WriteString(w, "ok")
+	}))
+	defer srv.Close()
+
+	srvURL, err := url.Parse(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, port, err := net.SplitHostPort(srvURL.Host)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The hostname does not resolve; the request only succeeds through the pinned IP
+	host := net.JoinHostPort("data.example.invalid", port)
+	oldURL := ripeURL
+	t.Cleanup(func() { ripeURL = oldURL })
+	ripeURL = "http://" + host + "/ripe/stats/delegated-ripencc-extended-latest"
+	req, err := http.NewRequest(http.MethodGet, ripeURL, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	client := newHTTPClient(&config.Config{DataHostIP: "127.0.0.1"})
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", resp.StatusCode)
+	}
+	if got := <-hosts; got != host {
+		t.Fatalf("Host header = %q, want %q", got, host)
+	}
+}
+
+func TestNewHTTPClient_FallbackHostNotPinned(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "ripencc|DE|ipv4|2.0.0.0|256|20100101|allocated\n")
+	}))
+	defer srv.Close()
+
+	srvURL, err := url.Parse(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, port, err := net.SplitHostPort(srvURL.Host)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The primary download is pinned to an address nothing listens on, so
+	// the data only arrives if the fallback mirror is dialed at its own address
+	oldURL := ripeURL
+	t.Cleanup(func() { ripeURL = oldURL })
+	ripeURL = "http://" + net.JoinHostPort("data.example.invalid", port) + "/latest"
+
+	p := createTestProcessor()
+	p.httpClient = newHTTPClient(&config.Config{DataHostIP: "127.0.0.2"})
+	p.config.FallbackDataURL = srv.URL + "/latest"
+
+	if err := p.downloadAndProcessData(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cidrs := cachedEntries(p)["DE"]; len(cidrs) != 1 || cidrs[0] != "2.0.0.0/24" {
+		t.Fatalf("DE = %v, want [2.0.0.0/24]", cidrs)
+	}
+}
+
+func TestRipeHost(t *testing.T) {
+	if got := ripeHost(); got != "ftp.ripe.net" {
+		t.Errorf("ripeHost() = %q, want %q", got, "ftp.ripe.net")
+	}
+
+	oldURL := ripeURL
+	t.Cleanup(func() { ripeURL = oldURL })
+	ripeURL = "http://[::1" // invalid URL
+	if got := ripeHost(); got != "" {
+		t.Errorf("ripeHost() = %q, want empty", got)
+	}
+}
+
+func TestPinnedDialContext(t *testing.T) {
+	var dialedAddr string
+	dial := pinnedDialContext("192.0.2.10", "ftp.ripe.net", func(ctx context.Context, network, addr string) (net.Conn, error) {
+		dialedAddr = addr
+		return nil, errors.New("dial stub")
+	})
+
+	_, err := dial(context.Background(), "tcp", "ftp.ripe.net:443")
+	if err == nil || err.Error() != "dial stub" {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if dialedAddr != "192.0.2.10:443" {
+		t.Fatalf("dialed %q, want %q", dialedAddr, "192.0.2.10:443")
+	}
+
+	// The host name is matched case-insensitively
+	dial(context.Background(), "tcp", "FTP.RIPE.NET:443")
+	if dialedAddr != "192.0.2.10:443" {
+		t.Fatalf("dialed %q, want %q", dialedAddr, "192.0.2.10:443")
+	}
+
+	// Connections to other hosts, such as the proxy or a fallback mirror, are not pinned
+	for _, addr := range []string{"proxy.internal:3128", "mirror.example:443"} {
+		dial(context.Background(), "tcp", addr)
+		if dialedAddr != addr {
+			t.Fatalf("dialed %q, want %q", dialedAddr, addr)
+		}
+	}
+
+	if _, err := dial(context.Background(), "tcp", "missing-port"); err == nil {
+		t.Fatal("expected error for address without port")
+	}
+}
+
+func TestNewHTTPClient_InvalidProxyFallsBack(t *testing.T) {
+	if got := newHTTPClient(&config.Config{HTTPProxy: "not a url"}); got != http.DefaultClient {
+		t.Fatalf("expected http.DefaultClient, got %#v", got)
+	}
+}
+
+func TestNewHTTPClient_RoutesThroughProxy(t *testing.T) {
+	type proxied struct {
+		requestURI string
+		host       string
+	}
+	requests := make(chan proxied, 1)
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests <- proxied{requestURI: r.RequestURI, host: r.Host}
+		io.WriteString(w, "via proxy")
+	}))
+	defer proxy.Close()
+
+	// The environment proxy must be overridden by the configured one
+	t.Setenv("HTTP_PROXY", "http://env-proxy.invalid:1")
+
+	client := newHTTPClient(&config.Config{HTTPProxy: proxy.URL})
+	req, err := http.NewRequest(http.MethodGet, "http://data.example.invalid/ripe/stats/latest", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer resp.Body.Close()
+
+	body, _ := io.ReadAll(resp.Body)
+	if string(body) != "via proxy" {
+		t.Fatalf("unexpected body %q", body)
+	}
+
+	got := <-requests
+	if got.requestURI != "http://data.example.invalid/ripe/stats/latest" {
+		t.Fatalf("proxy saw request URI %q, want absolute upstream URL", got.requestURI)
+	}
+	if got.host != "data.example.invalid" {
+		t.Fatalf("proxy saw Host %q, want %q", got.host, "data.example.invalid")
+	}
+}
+
+func TestNewHTTPClient_ProxyWithPinnedIP(t *testing.T) {
+	client := newHTTPClient(&config.Config{HTTPProxy: "http://proxy.internal:3128", DataHostIP: "192.0.2.10"})
+
+	httpClient, ok := client.(*http.Client)
+	if !ok {
+		t.Fatalf("expected *http.Client, got %T", client)
+	}
+	transport := httpClient.Transport.(*http.Transport)
+	if transport.Proxy == nil || transport.DialContext == nil {
+		t.Fatal("expected both proxy and pinned dialer to be configured")
+	}
+}
+
+func TestProxyFuncNoProxy(t *testing.T) {
+	proxyURL, _ := url.Parse("http://proxy.internal:3128")
+	proxyFor := proxyFunc(proxyURL, []string{" .corp.example ", "mirror.local", "10.0.0.0/8", ""})
+
+	testCases := []struct {
+		target  string
+		proxied bool
+	}{
+		{target: "https://ftp.ripe.net/file", proxied: true},
+		{target: "https://data.corp.example/file", proxied: false},
+		{target: "https://corp.example/file", proxied: false},
+		{target: "https://MIRROR.local/file", proxied: false},
+		{target: "https://notmirror.local/file", proxied: true},
+		{target: "http://10.1.2.3:8080/file", proxied: false},
+		{target: "http://11.1.2.3/file", proxied: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.target, func(t *testing.T) {
+			req, err := http.NewRequest(http.MethodGet, tc.target, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := proxyFor(req)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if (got != nil) != tc.proxied {
+				t.Errorf("proxy for %s = %v, want proxied=%v", tc.target, got, tc.proxied)
+			}
+		})
+	}
+
+	bypassAll := proxyFunc(proxyURL, []string{"*"})
+	req, _ := http.NewRequest(http.MethodGet, "https://ftp.ripe.net/file", nil)
+	if got, _ := bypassAll(req); got != nil {
+		t.Errorf("expected '*' to bypass the proxy, got %v", got)
+	}
+}
@@ -0,0 +1,66 @@
+package ipdata
+
+import (
+	"log"
+	"time"
+)
+
+// coldLoad is the first download of a processor without data, shared by all
+// requests waiting for it
+type coldLoad struct {
+	done chan struct{} // closed when the download has finished
+	err  error         // the download's error, valid once done is closed
+}
+
+// parseColdStartWait parses the ColdStartWait setting. Empty, invalid and
+// non-positive values make requests wait for the whole first download.
+func parseColdStartWait(s string) time.Duration {
+	if s == "" {
+		return 0
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil || d <= 0 {
+		log.Printf("Warning: ignoring invalid cold start wait %q\n", s)
+		return 0
+	}
+	return d
+}
+
+// isCold reports whether requests should wait for the first download at most
+// the cold start wait: one is configured and the cache holds no data, neither
+// downloaded nor embedded. It reads the cache without the processor lock,
+// which the first download holds throughout.
+func (p *Processor) isCold() bool {
+	info := p.cache.Info()
+	return p.coldWait > 0 && info.LoadedAt.IsZero() && info.Countries == 0
+}
+
+// downloadCold runs the first download in the background, joining the one in
+// progress if there is one, and waits for it at most the cold start wait.
+// Requests that give up fail with ErrColdStart while the download carries on.
+func (p *Processor) downloadCold(ttl time.Duration) error {
+	p.coldMutex.Lock()
+	load := p.cold
+	if load == nil {
+		load = &coldLoad{done: make(chan struct{})}
+		p.cold = load
+		go func() {
+			load.err = p.downloadIfOlderThan(ttl)
+			close(load.done)
+
+			p.coldMutex.Lock()
+			p.cold = nil
+			p.coldMutex.Unlock()
+		}()
+	}
+	p.coldMutex.Unlock()
+
+	timer := time.NewTimer(p.coldWait)
+	defer timer.Stop()
+	select {
+	case <-load.done:
+		return load.err
+	case <-timer.C:
+		return ErrColdStart
+	}
+}
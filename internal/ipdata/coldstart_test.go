@@ -0,0 +1,144 @@
+package ipdata
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// slowClient serves exportTestData once release is closed, like a slow download
+type slowClient struct {
+	release chan struct{}
+	calls   atomic.Int32
+}
+
+func (c *slowClient) Do(req *http.Request) (*http.Response, error) {
+	c.calls.Add(1)
+	<-c.release
+	return &http.Response{StatusCode: http.StatusOK, Body: io.NopCloser(strings.NewReader(exportTestData))}, nil
+}
+
+func TestColdStartWait_SlowLoad(t *testing.T) {
+	client := &slowClient{release: make(chan struct{})}
+	p := createTestProcessor()
+	p.httpClient = client
+	p.coldWait = 50 * time.Millisecond
+
+	// A flood of requests arrives while the first download is stuck
+	const requests = 20
+	errs := make(chan error, requests)
+	start := time.Now()
+	var wg sync.WaitGroup
+	for range requests {
+		wg.Go(func() {
+			_, err := p.GetIPListForCountry("FR")
+			errs <- err
+		})
+	}
+	wg.Wait()
+	close(errs)
+
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("requests took %s to fail, want them to give up after the cold start wait", elapsed)
+	}
+	for err := range errs {
+		if !errors.Is(err, ErrColdStart) || !errors.Is(err, ErrNotReady) {
+			t.Errorf("expected ErrColdStart, got %v", err)
+		}
+	}
+	if got := client.calls.Load(); got != 1 {
+		t.Errorf("started %d downloads, want 1 shared by all requests", got)
+	}
+
+	// The download carries on and serves the requests once it completes
+	close(client.release)
+	deadline := time.Now().Add(5 * time.Second)
+	for p.DataTime().IsZero() {
+		if time.Now().After(deadline) {
+			t.Fatal("the first download did not complete")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	if got, err := p.GetIPListForCountry("FR"); err != nil || len(got) != 1 {
+		t.Errorf("GetIPListForCountry(FR) = %v, %v after the download", got, err)
+	}
+	if got := client.calls.Load(); got != 1 {
+		t.Errorf("started %d downloads, want 1", got)
+	}
+}
+
+func TestColdStartWait_FastLoad(t *testing.T) {
+	client := &slowClient{release: make(chan struct{})}
+	close(client.release)
+	p := createTestProcessor()
+	p.httpClient = client
+	p.coldWait = 5 * time.Second
+
+	if got, err := p.GetIPListForCountry("FR"); err != nil || len(got) != 1 {
+		t.Fatalf("GetIPListForCountry(FR) = %v, %v, want the downloaded blocks", got, err)
+	}
+}
+
+func TestColdStartWait_DownloadError(t *testing.T) {
+	p := createTestProcessor()
+	p.coldWait = 5 * time.Second
+
+	_, err := p.GetIPListForCountry("FR")
+	if !errors.Is(err, ErrDownloadFailed) || errors.Is(err, ErrColdStart) {
+		t.Fatalf("expected ErrDownloadFailed, got %v", err)
+	}
+}
+
+func TestIsCold(t *testing.T) {
+	testCases := []struct {
+		name     string
+		coldWait time.Duration
+		loaded   bool
+		embedded bool
+		expected bool
+	}{
+		{name: "Nothing downloaded", coldWait: time.Second, expected: true},
+		{name: "Wait not configured"},
+		{name: "Data downloaded", coldWait: time.Second, loaded: true},
+		{name: "Embedded snapshot served", coldWait: time.Second, embedded: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			p := createTestProcessor()
+			p.coldWait = tc.coldWait
+			if tc.loaded {
+				p.cache.Set(map[string][]string{"FR": {"81.2.69.0/24"}}, time.Now())
+			}
+			if tc.embedded {
+				p.cache.Set(map[string][]string{"FR": {"81.2.69.0/24"}}, time.Time{})
+			}
+			if got := p.isCold(); got != tc.expected {
+				t.Errorf("isCold() = %v, want %v", got, tc.expected)
+			}
+		})
+	}
+}
+
+func TestParseColdStartWait(t *testing.T) {
+	testCases := []struct {
+		value    string
+		expected time.Duration
+	}{
+		{value: "", expected: 0},
+		{value: "2s", expected: 2 * time.Second},
+		{value: "bogus", expected: 0},
+		{value: "-1s", expected: 0},
+	}
+
+	for _, tc := range testCases {
+		if got := parseColdStartWait(tc.value); got != tc.expected {
+			t.Errorf("parseColdStartWait(%q) = %s, want %s", tc.value, got, tc.expected)
+		}
+	}
+}
@@ -0,0 +1,45 @@
+package ipdata
+
+import "strings"
+
+// AllocationCount summarizes the IPv4 space allocated to a country
+type AllocationCount struct {
+	Addresses uint64 `json:"addresses"` // sum of the source address counts, adjusted for extra and excluded blocks
+	Blocks    int    `json:"blocks"`    // number of CIDR blocks served
+}
+
+// sumAddresses returns the total source address count of the records
+func sumAddresses(ipDataList []IPData) uint64 {
+	var total uint64
+	for _, ipData := range ipDataList {
+		total += ipData.Count
+	}
+	return total
+}
+
+// CoveredAddresses returns the number of IPv4 addresses in the blocks, counting
+// overlapping blocks once and skipping IPv6 and malformed entries
+func CoveredAddresses(cidrs []string) uint64 {
+	var total uint64
+	for _, r := range mergeRanges(parseRanges(cidrs)) {
+		total += r.end - r.start + 1
+	}
+	return total
+}
+
+// GetCountForCountry returns the number of IPv4 addresses and CIDR blocks allocated to a country
+func (p *Processor) GetCountForCountry(countryCode string) (AllocationCount, error) {
+	countryCode = strings.ToUpper(countryCode)
+
+	if err := p.refreshIfOlderThan(p.ttlFor(countryCode)); err != nil {
+		return AllocationCount{}, err
+	}
+
+	p.mutex.RLock()
+	defer p.mutex.RUnlock()
+	cidrs, _ := p.cache.Get(countryCode)
+	return AllocationCount{
+		Addresses: p.addresses[countryCode],
+		Blocks:    len(cidrs),
+	}, nil
+}
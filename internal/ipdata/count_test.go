@@ -0,0 +1,74 @@
+package ipdata
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestGetCountForCountry(t *testing.T) {
+	data := strings.Join([]string{
+		"2|ripencc|20220101|5|19830705|20220101|+0100",
+		"ripencc|BR|ipv4|2.0.0.0|1048576|20220101|allocated",
+		"ripencc|BR|ipv4|5.0.0.0|65536|20220101|allocated",
+		"ripencc|BR|ipv4|31.0.0.0|256|20220101|assigned",
+		"ripencc|BR|ipv4|31.0.0.0|256|20220101|assigned",
+		"ripencc|DE|ipv4|46.0.0.0|1024|20220101|allocated",
+		"arin|BR|ipv4|3.0.0.0|16777216|20220101|allocated",
+	}, "\n")
+
+	processor := createTestProcessorWithMockData(data)
+
+	testCases := []struct {
+		country  string
+		expected AllocationCount
+	}{
+		// The duplicated record is counted once and the ARIN record is not served
+		{country: "br", expected: AllocationCount{Addresses: 1048576 + 65536 + 256, Blocks: 3}},
+		{country: "DE", expected: AllocationCount{Addresses: 1024, Blocks: 1}},
+		{country: "FR", expected: AllocationCount{}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.country, func(t *testing.T) {
+			count, err := processor.GetCountForCountry(tc.country)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if count != tc.expected {
+				t.Errorf("GetCountForCountry(%q) = %+v, want %+v", tc.country, count, tc.expected)
+			}
+		})
+	}
+}
+
+func TestGetCountForCountry_DownloadError(t *testing.T) {
+	processor := createTestProcessor()
+
+	_, err := processor.GetCountForCountry("BR")
+	if !errors.Is(err, ErrDownloadFailed) {
+		t.Fatalf("expected ErrDownloadFailed, got %v", err)
+	}
+}
+
+func TestCoveredAddresses(t *testing.T) {
+	testCases := []struct {
+		name     string
+		cidrs    []string
+		expected uint64
+	}{
+		{name: "Empty", cidrs: nil, expected: 0},
+		{name: "Disjoint", cidrs: []string{"10.0.0.0/24", "10.0.2.0/23"}, expected: 256 + 512},
+		{name: "Overlapping", cidrs: []string{"10.0.0.0/16", "10.0.1.0/24"}, expected: 65536},
+		{name: "Whole space", cidrs: []string{"0.0.0.0/0"}, expected: 1 << 32},
+		{name: "IPv6 and malformed skipped", cidrs: []string{"2001:db8::/32", "10.0.0.0/33", "bogus", "10.0.0.0/30"}, expected: 4},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := CoveredAddresses(tc.cidrs); got != tc.expected {
+				t.Errorf("CoveredAddresses(%v) = %d, want %d", tc.cidrs, got, tc.expected)
+			}
+		})
+	}
+}
@@ -0,0 +1,52 @@
+package ipdata
+
+import (
+	"log"
+	"strings"
+	"time"
+)
+
+// parseCountryTTLs parses a comma-separated list of CC=duration pairs
+// (e.g. "DE=10m,FR=2h"). Malformed entries are logged and skipped, and
+// durations below the floor are raised to it.
+func parseCountryTTLs(spec string, floor time.Duration) map[string]time.Duration {
+	ttls := make(map[string]time.Duration)
+	for _, entry := range strings.Split(spec, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		country, value, ok := strings.Cut(entry, "=")
+		country = strings.ToUpper(strings.TrimSpace(country))
+		ttl, err := time.ParseDuration(strings.TrimSpace(value))
+		if !ok || country == "" || err != nil || ttl <= 0 {
+			log.Printf("Ignoring invalid country TTL override %q\n", entry)
+			continue
+		}
+
+		if ttl < floor {
+			log.Printf("Warning: cache duration %s for %s is below the minimum of %s, using %s\n",
+				ttl, country, floor, floor)
+			ttl = floor
+		}
+		ttls[country] = ttl
+	}
+	return ttls
+}
+
+// ttlFor returns the cache duration that applies to requests for the given country
+func (p *Processor) ttlFor(countryCode string) time.Duration {
+	if ttl, ok := p.countryTTLs[countryCode]; ok {
+		return ttl
+	}
+	return p.cacheTTL
+}
+
+// CountryLastSeen returns when the country last appeared in successfully
+// downloaded data. The zero time is returned if it never has.
+func (p *Processor) CountryLastSeen(countryCode string) time.Time {
+	p.mutex.RLock()
+	defer p.mutex.RUnlock()
+	return p.lastSeen[strings.ToUpper(countryCode)]
+}
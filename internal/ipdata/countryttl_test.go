@@ -0,0 +1,150 @@
+package ipdata
+
+import (
+	"bytes"
+	"log"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/anisimovdk/ip-whitelist-by-country/internal/config"
+)
+
+func TestParseCountryTTLs(t *testing.T) {
+	testCases := []struct {
+		name     string
+		spec     string
+		expected map[string]time.Duration
+	}{
+		{name: "Empty", spec: "", expected: map[string]time.Duration{}},
+		{
+			name:     "Multiple entries",
+			spec:     "DE=10m, fr=2h",
+			expected: map[string]time.Duration{"DE": 10 * time.Minute, "FR": 2 * time.Hour},
+		},
+		{
+			name:     "Raised to floor",
+			spec:     "DE=1m",
+			expected: map[string]time.Duration{"DE": 5 * time.Minute},
+		},
+		{
+			name:     "Invalid entries skipped",
+			spec:     "DE,=10m,FR=soon,NL=0s,IT=15m",
+			expected: map[string]time.Duration{"IT": 15 * time.Minute},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var logBuf bytes.Buffer
+			origOutput := log.Writer()
+			log.SetOutput(&logBuf)
+			t.Cleanup(func() { log.SetOutput(origOutput) })
+
+			if got := parseCountryTTLs(tc.spec, 5*time.Minute); !reflect.DeepEqual(got, tc.expected) {
+				t.Errorf("parseCountryTTLs(%q) = %v, want %v", tc.spec, got, tc.expected)
+			}
+		})
+	}
+}
+
+func TestGetIPListForCountry_ShorterCountryTTLTriggersEarlierRefresh(t *testing.T) {
+	data := strings.Join([]string{
+		"ripencc|DE|ipv4|2.0.0.0|1048576|20220101|allocated",
+		"ripencc|FR|ipv4|5.0.0.0|65536|20220101|allocated",
+	}, "\n")
+
+	processor := createTestProcessorWithMockData(data)
+	processor.countryTTLs = map[string]time.Duration{"DE": 10 * time.Minute}
+	mc := processor.httpClient.(*MockHTTPClient)
+
+	if _, err := processor.GetIPListForCountry("FR"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if mc.CallCount != 1 {
+		t.Fatalf("expected initial download, CallCount=%d", mc.CallCount)
+	}
+
+	// 30 minutes later the global 1h TTL still holds, but DE's 10m override has expired
+	setCacheTime(processor, time.Now().Add(-30*time.Minute))
+
+	if _, err := processor.GetIPListForCountry("FR"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if mc.CallCount != 1 {
+		t.Fatalf("expected FR to be served from cache, CallCount=%d", mc.CallCount)
+	}
+
+	if _, err := processor.GetIPListForCountry("de"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if mc.CallCount != 2 {
+		t.Fatalf("expected DE override to trigger a refresh, CallCount=%d", mc.CallCount)
+	}
+	if time.Since(processor.loadedAt()) > time.Minute {
+		t.Errorf("expected cache time to be refreshed, got %v", processor.loadedAt())
+	}
+}
+
+func TestGetProvenanceForCountry_UsesCountryTTL(t *testing.T) {
+	processor := createTestProcessorWithMockData("ripencc|DE|ipv4|2.0.0.0|1048576|20220101|allocated")
+	processor.countryTTLs = map[string]time.Duration{"DE": 10 * time.Minute}
+	processor.cache.Set(map[string][]string{"DE": {"2.0.0.0/12"}}, time.Now().Add(-30*time.Minute))
+
+	if _, err := processor.GetProvenanceForCountry("DE"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if mc := processor.httpClient.(*MockHTTPClient); mc.CallCount != 1 {
+		t.Fatalf("expected DE override to trigger a refresh, CallCount=%d", mc.CallCount)
+	}
+}
+
+func TestCountryLastSeen(t *testing.T) {
+	processor := createTestProcessorWithMockData("ripencc|DE|ipv4|2.0.0.0|1048576|20220101|allocated")
+
+	if got := processor.CountryLastSeen("DE"); !got.IsZero() {
+		t.Fatalf("expected zero time before any download, got %v", got)
+	}
+
+	before := time.Now()
+	if err := processor.downloadAndProcessData(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	first := processor.CountryLastSeen("de")
+	if first.Before(before) {
+		t.Fatalf("CountryLastSeen(DE) = %v, want after %v", first, before)
+	}
+	if got := processor.CountryLastSeen("FR"); !got.IsZero() {
+		t.Errorf("expected zero time for unseen country, got %v", got)
+	}
+
+	// A country that disappears keeps its last-seen time
+	processor.httpClient = &MockHTTPClient{ResponseBody: "ripencc|FR|ipv4|5.0.0.0|65536|20220101|allocated", StatusCode: http.StatusOK}
+	setCacheTime(processor, time.Time{})
+	if err := processor.downloadAndProcessData(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := processor.CountryLastSeen("DE"); !got.Equal(first) {
+		t.Errorf("CountryLastSeen(DE) = %v, want %v", got, first)
+	}
+	if got := processor.CountryLastSeen("FR"); got.IsZero() {
+		t.Error("expected FR to have a last-seen time")
+	}
+}
+
+func TestNewProcessorWithConfig_CountryTTLs(t *testing.T) {
+	processor := newProcessorWithConfig(&config.Config{
+		CacheDuration:    "1h",
+		MinCacheDuration: "5m",
+		CountryTTL:       "DE=10m",
+	}, &MockHTTPClient{})
+
+	if got := processor.ttlFor("DE"); got != 10*time.Minute {
+		t.Errorf("ttlFor(DE) = %v, want 10m", got)
+	}
+	if got := processor.ttlFor("FR"); got != time.Hour {
+		t.Errorf("ttlFor(FR) = %v, want 1h", got)
+	}
+}
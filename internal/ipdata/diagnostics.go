@@ -0,0 +1,65 @@
+package ipdata
+
+import (
+	"io"
+	"maps"
+
+	"github.com/anisimovdk/ip-whitelist-by-country/internal/config"
+)
+
+// ParseDiagnostics tallies the lines of a parsed delegated-stats file, to
+// explain why a country has fewer blocks than expected. Every line is counted
+// once: TotalLines is the sum of IgnoredLines, IPv4Records, ASNRecords and
+// the Skipped counters.
+type ParseDiagnostics struct {
+	TotalLines     int            `json:"total_lines"`
+	IgnoredLines   int            `json:"ignored_lines"`   // comments, blank lines, the version header and summary records
+	IPv4Records    int            `json:"ipv4_records"`    // IPv4 records of any status
+	ASNRecords     int            `json:"asn_records"`     // AS number records
+	Skipped        SkipStats      `json:"skipped_lines"`   // lines skipped by reason
+	MaskMismatches int            `json:"mask_mismatches"` // IPv4 records whose count is no power of two, with StrictParse
+	Statuses       map[string]int `json:"statuses"`        // allocation status -> IPv4 records
+	Countries      map[string]int `json:"countries"`       // country code -> allocated and assigned IPv4 records
+}
+
+// ParseDelegatedStatsWithDiagnostics is ParseDelegatedStats, also returning a
+// tally of the lines read. The per-country counts are records, before
+// duplicate blocks are removed.
+func ParseDelegatedStatsWithDiagnostics(r io.Reader) (map[string][]string, ParseDiagnostics, error) {
+	data, err := parseDelegatedStats(r, &config.Config{})
+	if err != nil {
+		return nil, ParseDiagnostics{}, err
+	}
+	return data.cache, data.diagnostics, nil
+}
+
+// diagnostics builds the tally of the parsed lines
+func (t *recordTables) diagnostics() ParseDiagnostics {
+	d := ParseDiagnostics{
+		TotalLines:     t.lines,
+		IgnoredLines:   t.ignored,
+		ASNRecords:     t.asnRecords,
+		Skipped:        t.skipped,
+		MaskMismatches: t.mismatches,
+		Statuses:       maps.Clone(t.statusRecords),
+		Countries:      make(map[string]int, len(t.ipData)),
+	}
+	for _, count := range t.statusRecords {
+		d.IPv4Records += count
+	}
+	for country, records := range t.ipData {
+		d.Countries[country] = len(records)
+	}
+	return d
+}
+
+// Diagnostics returns the tally of the lines parsed from the cached data.
+// It is empty for data loaded from a peer. It never triggers a download.
+func (p *Processor) Diagnostics() ParseDiagnostics {
+	p.mutex.RLock()
+	defer p.mutex.RUnlock()
+	d := p.diagnostics
+	d.Statuses = maps.Clone(d.Statuses)
+	d.Countries = maps.Clone(d.Countries)
+	return d
+}
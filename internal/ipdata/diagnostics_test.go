@@ -0,0 +1,99 @@
+package ipdata
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// diagnosticsData mixes records that are served with every kind of line the
+// parser ignores or skips
+var diagnosticsData = strings.Join([]string{
+	"2|ripencc|20240101|9|19830705|20240101|+0100",
+	"ripencc|*|ipv4|*|5|summary",
+	"# comment",
+	"",
+	"ripencc|DE|ipv4|2.0.0.0|256|20100101|allocated",
+	"ripencc|DE|ipv4|2.0.0.0|256|20100101|allocated",
+	"ripencc|DE|ipv4|5.0.0.0|65536|20100101|assigned",
+	"ripencc|FR|ipv4|31.0.0.0|1024|20100101|assigned",
+	"ripencc|ZZ|ipv4|185.0.0.0|1024|20100101|reserved|",
+	"ripencc|DE|asn|3320|1|20100101|allocated",
+	"ripencc|DE|ipv6|2001:db8::|32|20100101|allocated",
+	"arin|US|ipv4|3.0.0.0|256|20100101|allocated",
+	"ripencc|DE|ipv4",
+	"ripencc|DE|ipv4|2.0.1.0|0|20100101|allocated",
+	"ripencc|DE|ipv4|not-an-ip|256|20100101|allocated",
+	"ripencc|DE|asn|x|1|20100101|allocated",
+}, "\n")
+
+// wantDiagnostics is the tally of diagnosticsData
+var wantDiagnostics = ParseDiagnostics{
+	TotalLines:   16,
+	IgnoredLines: 4,
+	IPv4Records:  5,
+	ASNRecords:   1,
+	Skipped: SkipStats{
+		TooFewFields:  1,
+		OtherRegistry: 1,
+		NonIPv4:       1,
+		BadCount:      1,
+		ParseError:    2,
+	},
+	Statuses:  map[string]int{StatusAllocated: 2, StatusAssigned: 2, StatusReserved: 1},
+	Countries: map[string]int{"DE": 3, "FR": 1},
+}
+
+func TestParseDelegatedStatsWithDiagnostics(t *testing.T) {
+	cache, diagnostics, err := ParseDelegatedStatsWithDiagnostics(strings.NewReader(diagnosticsData))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if !reflect.DeepEqual(diagnostics, wantDiagnostics) {
+		t.Errorf("diagnostics = %+v, want %+v", diagnostics, wantDiagnostics)
+	}
+	// The country counts are records; the duplicate DE block is served once
+	if want := []string{"2.0.0.0/24", "5.0.0.0/16"}; !reflect.DeepEqual(cache["DE"], want) {
+		t.Errorf("DE blocks = %v, want %v", cache["DE"], want)
+	}
+
+	s := diagnostics.Skipped
+	skipped := s.TooFewFields + s.OtherRegistry + s.NonIPv4 + s.BadCount + s.ParseError
+	if sum := diagnostics.IgnoredLines + diagnostics.IPv4Records + diagnostics.ASNRecords + skipped; sum != diagnostics.TotalLines {
+		t.Errorf("tallied %d lines, want %d", sum, diagnostics.TotalLines)
+	}
+}
+
+func TestParseDelegatedStatsWithDiagnostics_ReadError(t *testing.T) {
+	_, diagnostics, err := ParseDelegatedStatsWithDiagnostics(errReadCloser{})
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+	if !reflect.DeepEqual(diagnostics, ParseDiagnostics{}) {
+		t.Errorf("diagnostics = %+v, want none", diagnostics)
+	}
+}
+
+func TestProcessorDiagnostics(t *testing.T) {
+	processor := createTestProcessorWithMockData(diagnosticsData)
+
+	if got := processor.Diagnostics(); !reflect.DeepEqual(got, ParseDiagnostics{}) {
+		t.Errorf("diagnostics before the first download = %+v, want none", got)
+	}
+
+	if _, err := processor.GetIPListForCountry("DE"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	got := processor.Diagnostics()
+	if !reflect.DeepEqual(got, wantDiagnostics) {
+		t.Errorf("diagnostics = %+v, want %+v", got, wantDiagnostics)
+	}
+
+	// The returned maps are copies
+	got.Statuses[StatusAllocated] = 0
+	got.Countries["DE"] = 0
+	if again := processor.Diagnostics(); !reflect.DeepEqual(again, wantDiagnostics) {
+		t.Errorf("diagnostics after modifying a copy = %+v, want %+v", again, wantDiagnostics)
+	}
+}
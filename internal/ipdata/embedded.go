@@ -0,0 +1,45 @@
+package ipdata
+
+import (
+	"bytes"
+	_ "embed"
+	"errors"
+	"log"
+	"time"
+)
+
+// embeddedSnapshot is a delegated-stats snapshot compiled into the binary.
+// Refresh it with `make update-snapshot`.
+//
+//go:embed snapshot/delegated-ripencc-extended.txt
+var embeddedSnapshot []byte
+
+// placeholderMarker starts the sample snapshot kept in the repository. A file
+// downloaded by `make update-snapshot` never carries it.
+const placeholderMarker = "# placeholder"
+
+// errPlaceholderSnapshot is returned when the binary was built without a real snapshot
+var errPlaceholderSnapshot = errors.New("embedded snapshot is a placeholder, run make update-snapshot before building")
+
+// loadEmbedded populates the cache from the embedded snapshot. The cache time is
+// left unset so the first request still triggers a live download. A placeholder
+// snapshot is never loaded: serving its handful of sample records as a
+// country's list would be worse than waiting for the first download.
+func (p *Processor) loadEmbedded() error {
+	if bytes.HasPrefix(embeddedSnapshot, []byte(placeholderMarker)) {
+		return errPlaceholderSnapshot
+	}
+
+	data, err := p.parseData(bytes.NewReader(embeddedSnapshot))
+	if err != nil {
+		return err
+	}
+	p.applyCustomCIDRs(data)
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.applyParsed(data, time.Time{}, DataSourceEmbedded)
+
+	log.Printf("Embedded IP data loaded. Found data for %d countries\n", len(data.cache))
+	return nil
+}
@@ -0,0 +1,181 @@
+package ipdata
+
+import (
+	"bytes"
+	"errors"
+	"log"
+	"net/http"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/anisimovdk/ip-whitelist-by-country/internal/config"
+)
+
+// testSnapshot stands in for a snapshot downloaded by make update-snapshot
+var testSnapshot = []byte(strings.Join([]string{
+	"2.3|ripencc|20261001|4|19830705|20261001|+0200",
+	"ripencc|*|ipv4|*|4|summary",
+	"ripencc|DE|ipv4|2.16.0.0|2048|20100712|allocated",
+	"ripencc|DE|ipv4|5.1.0.0|65536|20111215|allocated",
+	"ripencc|FR|ipv4|2.0.0.0|1048576|20100712|allocated",
+	"ripencc|ZZ|ipv4|185.0.0.0|1024|20100101|reserved|",
+}, "\n"))
+
+// useSnapshot replaces the embedded snapshot for the duration of the test
+func useSnapshot(t *testing.T, snapshot []byte) {
+	t.Helper()
+	origSnapshot := embeddedSnapshot
+	t.Cleanup(func() { embeddedSnapshot = origSnapshot })
+	embeddedSnapshot = snapshot
+}
+
+func TestEmbeddedSnapshotParses(t *testing.T) {
+	processor := createTestProcessor()
+
+	data, err := processor.parseData(bytes.NewReader(embeddedSnapshot))
+	if err != nil {
+		t.Fatalf("embedded snapshot failed to parse: %v", err)
+	}
+	if len(data.cache) == 0 {
+		t.Fatal("embedded snapshot produced no countries")
+	}
+	if _, ok := data.cache["*"]; ok {
+		t.Fatal("embedded snapshot summary line produced a '*' country")
+	}
+}
+
+func TestNewProcessorWithClient_EmbeddedFallback(t *testing.T) {
+	origArgs := os.Args
+	t.Cleanup(func() { os.Args = origArgs })
+
+	os.Args = []string{"app"}
+	t.Setenv("EMBEDDED_FALLBACK", "true")
+	useSnapshot(t, testSnapshot)
+
+	mockClient := &MockHTTPClient{ShouldError: true, ErrorMsg: "network down"}
+	processor := NewProcessorWithClient(mockClient)
+
+	if got := processor.DataSource(); got != DataSourceEmbedded {
+		t.Fatalf("DataSource() = %q, want %q", got, DataSourceEmbedded)
+	}
+	if !processor.Ready() {
+		t.Fatal("expected processor with embedded data to be ready")
+	}
+	waitForRefresh(t, processor)
+
+	// Embedded data is served while the live download fails
+	result, err := processor.GetIPListForCountry("DE")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if want := []string{"2.16.0.0/21", "5.1.0.0/16"}; !reflect.DeepEqual(result, want) {
+		t.Fatalf("embedded DE = %#v, want %#v", result, want)
+	}
+	if mockClient.CallCount == 0 {
+		t.Fatal("expected a live download attempt before serving embedded data")
+	}
+
+	// A successful live refresh supersedes the embedded data
+	processor.httpClient = &MockHTTPClient{
+		StatusCode:   http.StatusOK,
+		ResponseBody: "ripencc|DE|ipv4|31.0.0.0|256|20220101|allocated",
+	}
+	result, err = processor.GetIPListForCountry("DE")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if want := []string{"31.0.0.0/24"}; !reflect.DeepEqual(result, want) {
+		t.Fatalf("live DE = %#v, want %#v", result, want)
+	}
+	if got := processor.DataSource(); got != DataSourceLive {
+		t.Fatalf("DataSource() = %q, want %q", got, DataSourceLive)
+	}
+
+	// Once live data is loaded, download failures are reported again
+	setCacheTime(processor, time.Now().Add(-2*processor.cacheTTL))
+	processor.httpClient = mockClient
+	if _, err := processor.GetIPListForCountry("DE"); err == nil {
+		t.Fatal("expected error once embedded data has been superseded")
+	}
+}
+
+func TestNewProcessorWithClient_EmbeddedFallbackDisabled(t *testing.T) {
+	origArgs := os.Args
+	t.Cleanup(func() { os.Args = origArgs })
+
+	os.Args = []string{"app"}
+
+	processor := NewProcessorWithClient(&MockHTTPClient{ShouldError: true, ErrorMsg: "network down"})
+	if got := processor.DataSource(); got != "" {
+		t.Fatalf("DataSource() = %q, want empty", got)
+	}
+	if len(cachedEntries(processor)) != 0 {
+		t.Fatalf("expected empty cache, got %d countries", len(cachedEntries(processor)))
+	}
+}
+
+func TestLoadEmbedded_InvalidSnapshot(t *testing.T) {
+	useSnapshot(t, []byte("# nothing useful\n"))
+
+	processor := createTestProcessor()
+	if err := processor.loadEmbedded(); err == nil {
+		t.Fatal("expected error for snapshot without records")
+	}
+	if processor.DataSource() != "" {
+		t.Fatalf("DataSource() = %q, want empty", processor.DataSource())
+	}
+}
+
+func TestNewProcessorWithConfig_InvalidEmbeddedSnapshotLogged(t *testing.T) {
+	useSnapshot(t, []byte("# nothing useful\n"))
+
+	var logBuf bytes.Buffer
+	origOutput := log.Writer()
+	log.SetOutput(&logBuf)
+	t.Cleanup(func() { log.SetOutput(origOutput) })
+
+	processor := newProcessorWithConfig(&config.Config{CacheDuration: "1h", EmbeddedFallback: true}, &MockHTTPClient{})
+	if processor.DataSource() != "" {
+		t.Fatalf("DataSource() = %q, want empty", processor.DataSource())
+	}
+	if !strings.Contains(logBuf.String(), "Failed to load embedded IP data") {
+		t.Errorf("expected load failure to be logged, got %q", logBuf.String())
+	}
+}
+
+func TestLoadEmbedded_Placeholder(t *testing.T) {
+	useSnapshot(t, append([]byte(placeholderMarker+": sample records\n"), testSnapshot...))
+
+	processor := createTestProcessor()
+	if err := processor.loadEmbedded(); !errors.Is(err, errPlaceholderSnapshot) {
+		t.Fatalf("expected errPlaceholderSnapshot, got %v", err)
+	}
+	if processor.DataSource() != "" {
+		t.Fatalf("DataSource() = %q, want empty", processor.DataSource())
+	}
+	if processor.Ready() {
+		t.Fatal("expected processor without a real snapshot not to be ready")
+	}
+	if len(cachedEntries(processor)) != 0 {
+		t.Fatalf("expected empty cache, got %d countries", len(cachedEntries(processor)))
+	}
+}
+
+func TestLoadEmbedded_AppliesAllTables(t *testing.T) {
+	useSnapshot(t, testSnapshot)
+
+	processor := createTestProcessor()
+	if err := processor.loadEmbedded(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if want := []string{"185.0.0.0/22"}; !reflect.DeepEqual(processor.statuses["ZZ"][StatusReserved], want) {
+		t.Errorf("ZZ reserved = %v, want %v", processor.statuses["ZZ"][StatusReserved], want)
+	}
+	if got := processor.Diagnostics(); got.IPv4Records != 4 || got.Countries["DE"] != 2 {
+		t.Errorf("diagnostics = %+v, want 4 IPv4 records and 2 for DE", got)
+	}
+}
@@ -0,0 +1,69 @@
+package ipdata
+
+import (
+	"errors"
+	"fmt"
+)
+
+var (
+	// ErrDownloadFailed indicates the upstream registry could not be reached or
+	// returned an unusable response (temporary condition)
+	ErrDownloadFailed = errors.New("upstream download failed")
+
+	// ErrBadUpstreamData indicates the upstream registry returned data that
+	// could not be processed
+	ErrBadUpstreamData = errors.New("bad upstream data")
+
+	// ErrDownloadTooLarge indicates the upstream response exceeded the configured size limit
+	ErrDownloadTooLarge = fmt.Errorf("%w: download exceeds size limit", ErrBadUpstreamData)
+
+	// ErrNotReady indicates no IP data is available yet
+	ErrNotReady = errors.New("ip data not ready")
+
+	// ErrColdStart indicates a request gave up waiting for the first download
+	ErrColdStart = fmt.Errorf("%w: initial download still in progress", ErrNotReady)
+
+	// ErrArchiveDisabled indicates archived data was requested but no archive URL is configured
+	ErrArchiveDisabled = errors.New("archived data is not enabled")
+
+	// ErrNoArchive indicates the archive has no file for the requested day
+	ErrNoArchive = errors.New("no archived data for date")
+)
+
+// UpstreamStatusError is returned when the upstream registry responds with a
+// non-200 status code
+type UpstreamStatusError struct {
+	StatusCode int
+}
+
+// Error implements the error interface
+func (e *UpstreamStatusError) Error() string {
+	return fmt.Sprintf("received non-200 response: %d", e.StatusCode)
+}
+
+// Unwrap allows errors.Is to match ErrDownloadFailed
+func (e *UpstreamStatusError) Unwrap() error {
+	return ErrDownloadFailed
+}
+
+// parseError marks a failure to read or parse downloaded data, as opposed to a
+// failure to download it. It keeps the message of the wrapped error.
+type parseError struct {
+	err error
+}
+
+// Error implements the error interface
+func (e *parseError) Error() string {
+	return e.err.Error()
+}
+
+// Unwrap allows errors.Is to match the wrapped error
+func (e *parseError) Unwrap() error {
+	return e.err
+}
+
+// isParseError reports whether err includes a failure to read or parse downloaded data
+func isParseError(err error) bool {
+	var pe *parseError
+	return errors.As(err, &pe)
+}
@@ -0,0 +1,131 @@
+package ipdata
+
+import (
+	"log"
+	"net/netip"
+)
+
+// parseExcludeCIDRs parses the ExcludeCIDRs setting: CIDR blocks of either
+// address family (e.g. 198.51.100.0/28,2001:db8::/48), or "@path" to read
+// them from a file. Invalid entries are logged and skipped.
+func parseExcludeCIDRs(spec string) []netip.Prefix {
+	var excluded []netip.Prefix
+	for _, entry := range specEntries(spec, "excluded CIDRs") {
+		prefix, err := netip.ParsePrefix(entry)
+		if ValidateIPCIDR(entry) != nil || err != nil {
+			log.Printf("Ignoring invalid excluded CIDR %q\n", entry)
+			continue
+		}
+		excluded = append(excluded, prefix.Masked())
+	}
+	return excluded
+}
+
+// subtractPrefixes returns the parts of prefix not covered by any of the
+// excluded prefixes, as the minimal list of blocks in address order. A block
+// overlapping an excluded prefix is split in halves until every half lies
+// entirely inside or outside of it, so excluding a /28 from a /24 leaves a
+// /25, /26, /27 and /28.
+func subtractPrefixes(prefix netip.Prefix, excluded []netip.Prefix) []netip.Prefix {
+	for _, x := range excluded {
+		if !prefix.Overlaps(x) {
+			continue
+		}
+		if x.Bits() <= prefix.Bits() {
+			return nil // fully excluded
+		}
+		lower, upper := splitPrefix(prefix)
+		return append(subtractPrefixes(lower, excluded), subtractPrefixes(upper, excluded)...)
+	}
+	return []netip.Prefix{prefix}
+}
+
+// splitPrefix returns the lower and upper half of a prefix
+func splitPrefix(prefix netip.Prefix) (netip.Prefix, netip.Prefix) {
+	bits := prefix.Bits()
+	addr := prefix.Addr().AsSlice()
+	addr[bits/8] |= 0x80 >> (bits % 8)
+	upper, _ := netip.AddrFromSlice(addr)
+	return netip.PrefixFrom(prefix.Addr(), bits+1), netip.PrefixFrom(upper, bits+1)
+}
+
+// subtractCIDRs removes the excluded space from a list of blocks, replacing
+// each partly excluded block by its remaining sub-blocks in place.
+// Unparseable entries are kept as they are.
+func subtractCIDRs(cidrs []string, excluded []netip.Prefix) []string {
+	result := make([]string, 0, len(cidrs))
+	for _, cidr := range cidrs {
+		prefix, err := netip.ParsePrefix(cidr)
+		if err != nil {
+			result = append(result, cidr)
+			continue
+		}
+		result = append(result, prefixStrings(subtractPrefixes(prefix, excluded))...)
+	}
+	return result
+}
+
+// excludeCIDRs removes the excluded space from every country's IPv4 blocks,
+// registry and status groups and IPv6 prefixes, and rebuilds the lookup index so
+// excluded addresses are not found either.
+func (d *parsedData) excludeCIDRs(excluded []netip.Prefix) {
+	if len(excluded) == 0 {
+		return
+	}
+
+	for country, cidrs := range d.cache {
+		d.cache[country] = subtractCIDRs(cidrs, excluded)
+	}
+	for country, groups := range d.registries {
+		for registry, cidrs := range groups {
+			groups[registry] = subtractCIDRs(cidrs, excluded)
+			if d.provenance[country] != nil {
+				d.provenance[country][registry] = len(groups[registry])
+			}
+		}
+	}
+	for _, groups := range d.statuses {
+		for status, cidrs := range groups {
+			groups[status] = subtractCIDRs(cidrs, excluded)
+		}
+	}
+
+	v6 := make(map[string][]netip.Prefix, len(d.ipv6))
+	for country, prefixes := range d.ipv6 {
+		d.ipv6[country] = subtractCIDRs(prefixes, excluded)
+		for _, s := range d.ipv6[country] {
+			v6[country] = append(v6[country], netip.MustParsePrefix(s))
+		}
+	}
+	d.lookup = newLookupIndex(d.cache, v6)
+}
+
+// applyCustomCIDRs adds the operator's extra blocks to freshly fetched data
+// and then removes the excluded ones, so an exclusion also wins over an
+// extra block. Each country's address count changes by the addresses its
+// list gained or lost, so it keeps matching the served blocks.
+func (p *Processor) applyCustomCIDRs(data *parsedData) {
+	if len(p.extraCIDRs) == 0 && len(p.excluded) == 0 {
+		return
+	}
+
+	before := make(map[string]uint64, len(data.cache))
+	for country, cidrs := range data.cache {
+		before[country] = CoveredAddresses(cidrs)
+	}
+
+	data.addExtraCIDRs(p.extraCIDRs)
+	data.excludeCIDRs(p.excluded)
+
+	if data.addresses == nil {
+		data.addresses = make(map[string]uint64, len(data.cache))
+	}
+	for country, cidrs := range data.cache {
+		after := CoveredAddresses(cidrs)
+		if after >= before[country] {
+			data.addresses[country] += after - before[country]
+		} else {
+			data.addresses[country] -= min(before[country]-after, data.addresses[country])
+		}
+	}
+}
@@ -0,0 +1,263 @@
+package ipdata
+
+import (
+	"bytes"
+	"log"
+	"maps"
+	"net"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseExcludeCIDRs(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "exclude.txt")
+	if err := os.WriteFile(file, []byte("# scanners\n198.51.100.0/28\n2001:db8::1/48\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	testCases := []struct {
+		name     string
+		spec     string
+		expected []netip.Prefix
+		logged   string
+	}{
+		{name: "Empty", spec: ""},
+		{
+			name:     "List",
+			spec:     "198.51.100.5/28, 192.0.2.0/24",
+			expected: []netip.Prefix{netip.MustParsePrefix("198.51.100.0/28"), netip.MustParsePrefix("192.0.2.0/24")},
+		},
+		{
+			name:     "Invalid entries skipped",
+			spec:     "bogus,10.0.0.0/33,192.0.2.0/24",
+			expected: []netip.Prefix{netip.MustParsePrefix("192.0.2.0/24")},
+			logged:   `Ignoring invalid excluded CIDR "bogus"`,
+		},
+		{
+			name:     "File",
+			spec:     "@" + file,
+			expected: []netip.Prefix{netip.MustParsePrefix("198.51.100.0/28"), netip.MustParsePrefix("2001:db8::/48")},
+		},
+		{
+			name:   "Missing file",
+			spec:   "@" + filepath.Join(t.TempDir(), "missing.txt"),
+			logged: "Ignoring excluded CIDRs file",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var logBuf bytes.Buffer
+			origOutput := log.Writer()
+			log.SetOutput(&logBuf)
+			t.Cleanup(func() { log.SetOutput(origOutput) })
+
+			if got := parseExcludeCIDRs(tc.spec); !slices.Equal(got, tc.expected) {
+				t.Errorf("parseExcludeCIDRs(%q) = %v, want %v", tc.spec, got, tc.expected)
+			}
+			if !strings.Contains(logBuf.String(), tc.logged) {
+				t.Errorf("log = %q, want it to contain %q", logBuf.String(), tc.logged)
+			}
+		})
+	}
+}
+
+func TestSubtractCIDRs(t *testing.T) {
+	testCases := []struct {
+		name     string
+		cidrs    []string
+		excluded []string
+		expected []string
+	}{
+		{
+			name:     "Sub-range carved out",
+			cidrs:    []string{"198.51.100.0/24"},
+			excluded: []string{"198.51.100.16/28"},
+			expected: []string{"198.51.100.0/28", "198.51.100.32/27", "198.51.100.64/26", "198.51.100.128/25"},
+		},
+		{
+			name:     "Matching block removed",
+			cidrs:    []string{"192.0.2.0/24", "198.51.100.0/24"},
+			excluded: []string{"198.51.100.0/24"},
+			expected: []string{"192.0.2.0/24"},
+		},
+		{
+			name:     "Contained block removed",
+			cidrs:    []string{"198.51.100.0/26", "203.0.113.0/24"},
+			excluded: []string{"198.51.100.0/24"},
+			expected: []string{"203.0.113.0/24"},
+		},
+		{
+			name:     "Several exclusions in one block",
+			cidrs:    []string{"198.51.100.0/24"},
+			excluded: []string{"198.51.100.0/26", "198.51.100.192/26"},
+			expected: []string{"198.51.100.64/26", "198.51.100.128/26"},
+		},
+		{
+			name:     "Other family untouched",
+			cidrs:    []string{"2001:db8::/32", "198.51.100.0/24"},
+			excluded: []string{"198.51.100.0/25", "2001:db8:8000::/33"},
+			expected: []string{"2001:db8::/33", "198.51.100.128/25"},
+		},
+		{
+			name:     "Unparseable entry kept",
+			cidrs:    []string{"bogus"},
+			excluded: []string{"0.0.0.0/0"},
+			expected: []string{"bogus"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var excluded []netip.Prefix
+			for _, s := range tc.excluded {
+				excluded = append(excluded, netip.MustParsePrefix(s))
+			}
+			if got := subtractCIDRs(tc.cidrs, excluded); !slices.Equal(got, tc.expected) {
+				t.Errorf("subtractCIDRs(%v, %v) = %v, want %v", tc.cidrs, tc.excluded, got, tc.expected)
+			}
+		})
+	}
+}
+
+func TestExcludeCIDRs_AppliedOnEveryRefresh(t *testing.T) {
+	data := strings.Join([]string{
+		"ripencc|DE|ipv4|198.51.100.0|256|20220101|allocated",
+		"ripencc|DE|ipv4|203.0.113.0|256|20220101|allocated",
+		"ripencc|FR|ipv4|192.0.2.0|256|20220101|allocated",
+		"ripencc|DE|ipv6|2001:db8::|32|20220101|allocated",
+	}, "\n")
+	processor := createTestProcessorWithMockData(data)
+	processor.excluded = parseExcludeCIDRs("198.51.100.128/25,203.0.113.0/24,2001:db8:8000::/33,192.0.2.64/26")
+	processor.extraCIDRs = parseExtraCIDRs("NL=192.0.2.100/32,NL=10.0.0.0/8")
+	mc := processor.httpClient.(*MockHTTPClient)
+
+	for refresh := 1; refresh <= 2; refresh++ {
+		if refresh == 2 {
+			setCacheTime(processor, time.Now().Add(-2*time.Hour))
+		}
+
+		de, err := processor.GetIPListForCountry("DE")
+		if err != nil {
+			t.Fatalf("refresh %d: unexpected error: %v", refresh, err)
+		}
+		if mc.CallCount != refresh {
+			t.Fatalf("refresh %d: CallCount = %d", refresh, mc.CallCount)
+		}
+		if want := []string{"198.51.100.0/25"}; !slices.Equal(de, want) {
+			t.Errorf("refresh %d: DE = %v, want %v", refresh, de, want)
+		}
+	}
+
+	fr, _ := processor.GetIPListForCountry("FR")
+	if want := []string{"192.0.2.0/26", "192.0.2.128/25"}; !slices.Equal(fr, want) {
+		t.Errorf("FR = %v, want %v", fr, want)
+	}
+	// An exclusion wins over an extra block
+	nl, _ := processor.GetIPListForCountry("NL")
+	if want := []string{"10.0.0.0/8"}; !slices.Equal(nl, want) {
+		t.Errorf("NL = %v, want %v", nl, want)
+	}
+
+	registries, _ := processor.GetIPListByRegistry("DE")
+	if want := []string{"198.51.100.0/25"}; !slices.Equal(registries["ripencc"], want) {
+		t.Errorf("DE ripencc registry = %v, want %v", registries["ripencc"], want)
+	}
+	provenance, _ := processor.GetProvenanceForCountry("FR")
+	if provenance["ripencc"] != 2 {
+		t.Errorf("FR ripencc provenance = %d, want 2", provenance["ripencc"])
+	}
+	v6, _ := processor.GetIPv6ListForCountry("DE")
+	if want := []string{"2001:db8::/33"}; !slices.Equal(v6, want) {
+		t.Errorf("DE IPv6 = %v, want %v", v6, want)
+	}
+
+	// Address counts follow the served blocks
+	for country, want := range map[string]AllocationCount{
+		"DE": {Addresses: 128, Blocks: 1},
+		"FR": {Addresses: 192, Blocks: 2},
+		"NL": {Addresses: 1 << 24, Blocks: 1},
+	} {
+		if count, err := processor.GetCountForCountry(country); err != nil || count != want {
+			t.Errorf("GetCountForCountry(%s) = %+v, %v; want %+v", country, count, err, want)
+		}
+	}
+
+	for ip, want := range map[string]bool{"198.51.100.1": true, "198.51.100.200": false, "203.0.113.1": false, "2001:db8::1": true, "2001:db8:8000::1": false} {
+		if _, found, err := processor.LookupCountry(net.ParseIP(ip)); err != nil || found != want {
+			t.Errorf("LookupCountry(%s) found = %v, %v; want %v", ip, found, err, want)
+		}
+	}
+}
+
+func TestExcludeCIDRs_MissingProvenance(t *testing.T) {
+	data := &parsedData{
+		cache:      map[string][]string{"DE": {"198.51.100.0/24"}},
+		registries: map[string]map[string][]string{"DE": {"ripencc": {"198.51.100.0/24"}}},
+		provenance: map[string]map[string]int{},
+		ipv6:       map[string][]string{},
+	}
+	data.excludeCIDRs([]netip.Prefix{netip.MustParsePrefix("198.51.100.0/25")})
+
+	if want := []string{"198.51.100.128/25"}; !slices.Equal(data.registries["DE"]["ripencc"], want) {
+		t.Errorf("DE ripencc registry = %v, want %v", data.registries["DE"]["ripencc"], want)
+	}
+	if len(data.provenance) != 0 {
+		t.Errorf("provenance = %v, want it untouched", data.provenance)
+	}
+}
+
+func TestApplyCustomCIDRs_Addresses(t *testing.T) {
+	testCases := []struct {
+		name      string
+		addresses map[string]uint64
+		extra     string
+		exclude   string
+		want      map[string]uint64
+	}{
+		{
+			name:      "Extra block nested in an existing one adds nothing",
+			addresses: map[string]uint64{"DE": 256},
+			extra:     "DE=198.51.100.0/28",
+			want:      map[string]uint64{"DE": 256},
+		},
+		{
+			name:    "Peer export without address counts",
+			extra:   "DE=203.0.113.0/24",
+			exclude: "198.51.100.0/25",
+			want:    map[string]uint64{"DE": 128}, // net change of the list
+		},
+		{
+			name:      "Source count below the excluded space",
+			addresses: map[string]uint64{"DE": 100},
+			exclude:   "198.51.100.0/25",
+			want:      map[string]uint64{"DE": 0},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			p := createTestProcessor()
+			p.extraCIDRs = parseExtraCIDRs(tc.extra)
+			p.excluded = parseExcludeCIDRs(tc.exclude)
+			data := &parsedData{
+				cache:      map[string][]string{"DE": {"198.51.100.0/24"}},
+				provenance: map[string]map[string]int{},
+				registries: map[string]map[string][]string{},
+				addresses:  tc.addresses,
+				lookup:     &lookupIndex{},
+				ipv6:       map[string][]string{},
+			}
+			p.applyCustomCIDRs(data)
+
+			if !maps.Equal(data.addresses, tc.want) {
+				t.Errorf("addresses = %v, want %v", data.addresses, tc.want)
+			}
+		})
+	}
+}
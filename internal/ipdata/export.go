@@ -0,0 +1,131 @@
+package ipdata
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Export is the parsed dataset in serialized form. Instances serve it on
+// /export and replicas started with an upstream peer load it instead of
+// downloading from RIPE NCC.
+type Export struct {
+	Generated  time.Time                      `json:"generated,omitzero"`
+	Countries  map[string][]string            `json:"countries"`  // country code -> CIDR blocks
+	Provenance map[string]map[string]int      `json:"provenance"` // country code -> registry -> block count
+	Registries map[string]map[string][]string `json:"registries"` // country code -> registry -> CIDR blocks
+	Statuses   map[string]map[string][]string `json:"statuses"`   // country code -> allocation status -> CIDR blocks
+	Addresses  map[string]uint64              `json:"addresses"`  // country code -> allocated address count
+	ASNs       map[string][]uint32            `json:"asns"`       // country code -> sorted AS numbers
+	IPv6       map[string][]string            `json:"ipv6"`       // country code -> IPv6 prefixes for lookups
+	Skipped    SkipStats                      `json:"skipped_lines"`
+}
+
+// Export returns the cached dataset, downloading the data first if the cache
+// has expired. The blocks and tables are shared with the cache rather than
+// copied, so callers must not modify them.
+func (p *Processor) Export() (Export, error) {
+	if err := p.refreshIfStale(); err != nil {
+		return Export{}, err
+	}
+
+	p.mutex.RLock()
+	defer p.mutex.RUnlock()
+
+	countries := p.cache.Countries()
+	export := Export{
+		Generated:  p.loadedAt(),
+		Countries:  make(map[string][]string, len(countries)),
+		Provenance: p.provenance,
+		Registries: p.registries,
+		Statuses:   p.statuses,
+		Addresses:  p.addresses,
+		ASNs:       p.asns,
+		IPv6:       p.ipv6,
+		Skipped:    p.skipped,
+	}
+	for _, country := range countries {
+		export.Countries[country], _ = p.cache.Get(country)
+	}
+	return export, nil
+}
+
+// exportURL returns the /export URL of the peer instance at base, carrying
+// the auth token if one is configured
+func (p *Processor) exportURL(base string) string {
+	u := strings.TrimSuffix(base, "/") + "/export"
+	if p.config.AuthToken != "" {
+		u += "?auth=" + url.QueryEscape(p.config.AuthToken)
+	}
+	return u
+}
+
+// fetchPeer downloads the parsed dataset from the /export endpoint of the
+// peer instance at base
+func (p *Processor) fetchPeer(base string) (*parsedData, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), downloadTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, p.exportURL(base), nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", redactURLError(err))
+	}
+
+	resp, err := p.doRequest(req)
+	if err != nil {
+		return nil, fmt.Errorf("%w: failed to download data from peer: %w", ErrDownloadFailed, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, &UpstreamStatusError{StatusCode: resp.StatusCode}
+	}
+
+	var body io.Reader = resp.Body
+	if p.config.MaxDownloadBytes > 0 {
+		body = limitBody(resp.Body, p.config.MaxDownloadBytes)
+	}
+
+	var export Export
+	if err := json.NewDecoder(body).Decode(&export); err != nil {
+		return nil, &parseError{fmt.Errorf("%w: invalid peer export: %w", ErrBadUpstreamData, err)}
+	}
+	if len(export.Countries) == 0 {
+		return nil, &parseError{fmt.Errorf("%w: peer export contains no countries", ErrBadUpstreamData)}
+	}
+	return export.parsedData(), nil
+}
+
+// parsedData rebuilds the lookup tables from the serialized dataset.
+// Unparseable IPv6 prefixes are dropped. The generation time stands in for
+// the Last-Modified time, which the peer sends on /export.
+func (e Export) parsedData() *parsedData {
+	ipv6 := make(map[string][]netip.Prefix, len(e.IPv6))
+	ipv6Strings := make(map[string][]string, len(e.IPv6))
+	for country, prefixes := range e.IPv6 {
+		for _, s := range prefixes {
+			if prefix, err := netip.ParsePrefix(s); err == nil {
+				ipv6[country] = append(ipv6[country], prefix)
+			}
+		}
+		ipv6Strings[country] = prefixStrings(sortedUniquePrefixes(ipv6[country]))
+	}
+	return &parsedData{
+		cache:        e.Countries,
+		provenance:   e.Provenance,
+		registries:   e.Registries,
+		statuses:     e.Statuses,
+		addresses:    e.Addresses,
+		lookup:       newLookupIndex(e.Countries, ipv6),
+		asns:         e.ASNs,
+		ipv6:         ipv6Strings,
+		skipped:      e.Skipped,
+		lastModified: e.Generated,
+	}
+}
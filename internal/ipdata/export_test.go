@@ -0,0 +1,265 @@
+package ipdata
+
+import (
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/anisimovdk/ip-whitelist-by-country/internal/config"
+)
+
+const exportTestData = `2|ripencc|20240101|5|19830705|20240101|+0100
+ripencc|DE|ipv4|2.0.0.0|1048576|20100101|allocated
+ripencc|DE|ipv4|5.0.0.0|65536|20100101|allocated
+ripencc|FR|ipv4|81.2.69.0|256|20100101|allocated
+ripencc|DE|ipv6|2001:db8::|32|20100101|allocated
+ripencc|DE|asn|3320|2|20100101|allocated
+ripencc|DE|ipv4|10.0.0.0|0|20100101|allocated
+`
+
+// newStubLeader serves the dataset of a leader processor on /export, like a
+// leader instance would, and records the auth token of each request
+func newStubLeader(t *testing.T, leader *Processor, tokens *[]string) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/export" {
+			http.NotFound(w, r)
+			return
+		}
+		export, err := leader.Export()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusServiceUnavailable)
+			return
+		}
+		w.Header().Set("Last-Modified", export.Generated.UTC().Format(http.TimeFormat))
+		if r.Method == http.MethodHead {
+			return
+		}
+		*tokens = append(*tokens, r.URL.Query().Get("auth"))
+		json.NewEncoder(w).Encode(export)
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestReplicaLoadsDatasetFromPeer(t *testing.T) {
+	leader := createTestProcessorWithMockData(exportTestData)
+	var tokens []string
+	srv := newStubLeader(t, leader, &tokens)
+
+	cfg := &config.Config{CacheDuration: "1h", AuthToken: "peer-token", UpstreamPeer: srv.URL + "/"}
+	replica := newProcessorWithConfig(cfg, srv.Client())
+
+	for _, country := range []string{"DE", "FR"} {
+		want, err := leader.GetIPListForCountry(country)
+		if err != nil {
+			t.Fatalf("leader GetIPListForCountry(%s): %v", country, err)
+		}
+		got, err := replica.GetIPListForCountry(country)
+		if err != nil {
+			t.Fatalf("replica GetIPListForCountry(%s): %v", country, err)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("replica %s = %v, want %v", country, got, want)
+		}
+	}
+
+	if got, want := replica.DataSource(), DataSourcePeer; got != want {
+		t.Errorf("DataSource = %q, want %q", got, want)
+	}
+	if !reflect.DeepEqual(tokens, []string{"peer-token"}) {
+		t.Errorf("leader saw auth tokens %v, want exactly one request with peer-token", tokens)
+	}
+
+	asns, err := replica.GetASNsForCountry("DE")
+	if err != nil || !reflect.DeepEqual(asns, []uint32{3320, 3321}) {
+		t.Errorf("GetASNsForCountry(DE) = %v, %v, want [3320 3321]", asns, err)
+	}
+	count, err := replica.GetCountForCountry("DE")
+	if err != nil || count.Addresses != 1048576+65536 {
+		t.Errorf("GetCountForCountry(DE) = %+v, %v, want %d addresses", count, err, 1048576+65536)
+	}
+	provenance, err := replica.GetProvenanceForCountry("DE")
+	if err != nil || !reflect.DeepEqual(provenance, map[string]int{"ripencc": 2}) {
+		t.Errorf("GetProvenanceForCountry(DE) = %v, %v", provenance, err)
+	}
+	registries, err := replica.GetIPListByRegistry("FR")
+	if err != nil || !reflect.DeepEqual(registries, map[string][]string{"ripencc": {"81.2.69.0/24"}}) {
+		t.Errorf("GetIPListByRegistry(FR) = %v, %v", registries, err)
+	}
+	statuses, err := replica.GetIPListByStatus("FR")
+	if err != nil || !reflect.DeepEqual(statuses, map[string][]string{StatusAllocated: {"81.2.69.0/24"}}) {
+		t.Errorf("GetIPListByStatus(FR) = %v, %v", statuses, err)
+	}
+	if country, found, err := replica.LookupCountry(net.ParseIP("2001:db8::1")); err != nil || !found || country != "DE" {
+		t.Errorf("LookupCountry(2001:db8::1) = %q, %v, %v, want DE", country, found, err)
+	}
+	if got := replica.Stats().SkippedLines; got != leader.Stats().SkippedLines {
+		t.Errorf("SkippedLines = %+v, want %+v", got, leader.Stats().SkippedLines)
+	}
+}
+
+func TestReplicaPeerErrors(t *testing.T) {
+	testCases := []struct {
+		name        string
+		client      *MockHTTPClient
+		peer        string
+		maxBytes    int64
+		expectedErr error
+	}{
+		{
+			name:        "Peer unreachable",
+			client:      &MockHTTPClient{ShouldError: true, ErrorMsg: "connection refused"},
+			expectedErr: ErrDownloadFailed,
+		},
+		{
+			name:   "Peer returns an error status",
+			client: &MockHTTPClient{StatusCode: http.StatusServiceUnavailable},
+		},
+		{
+			name:        "Peer returns invalid JSON",
+			client:      &MockHTTPClient{ResponseBody: "<html>maintenance</html>"},
+			expectedErr: ErrBadUpstreamData,
+		},
+		{
+			name:        "Peer returns an empty dataset",
+			client:      &MockHTTPClient{ResponseBody: `{"countries":{}}`},
+			expectedErr: ErrBadUpstreamData,
+		},
+		{
+			name:        "Peer response too large",
+			client:      &MockHTTPClient{ResponseBody: `{"countries":{"DE":["2.0.0.0/12"]}}`},
+			maxBytes:    10,
+			expectedErr: ErrBadUpstreamData,
+		},
+		{
+			name:   "Invalid peer URL",
+			client: &MockHTTPClient{},
+			peer:   "http://leader\x7f",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			peer := tc.peer
+			if peer == "" {
+				peer = "http://leader:8080"
+			}
+			p := createTestProcessor()
+			p.httpClient = tc.client
+			p.config.UpstreamPeer = peer
+			p.config.MaxDownloadBytes = tc.maxBytes
+
+			err := p.downloadAndProcessData()
+			if err == nil {
+				t.Fatal("expected an error")
+			}
+			if tc.expectedErr != nil && !errors.Is(err, tc.expectedErr) {
+				t.Fatalf("expected %v, got %v", tc.expectedErr, err)
+			}
+			if got := p.DataSource(); got != "" {
+				t.Errorf("DataSource = %q, want empty", got)
+			}
+		})
+	}
+}
+
+func TestReplicaStatusError(t *testing.T) {
+	p := createTestProcessor()
+	p.httpClient = &MockHTTPClient{StatusCode: http.StatusNotFound}
+	p.config.UpstreamPeer = "http://leader:8080"
+
+	var statusErr *UpstreamStatusError
+	if err := p.downloadAndProcessData(); !errors.As(err, &statusErr) || statusErr.StatusCode != http.StatusNotFound {
+		t.Fatalf("expected an UpstreamStatusError with status 404, got %v", err)
+	}
+}
+
+func TestReplicaFallsBackToMirror(t *testing.T) {
+	p := createTestProcessor()
+	p.config.UpstreamPeer = "http://leader:8080"
+	p.config.FallbackDataURL = testFallbackURL
+	p.httpClient = routingHTTPClient{
+		"http://leader:8080/export?auth=test-token": {ShouldError: true, ErrorMsg: "connection refused"},
+		testFallbackURL: {ResponseBody: exportTestData},
+	}
+
+	if err := p.downloadAndProcessData(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := p.DataSource(); got != DataSourceLive {
+		t.Errorf("DataSource = %q, want %q", got, DataSourceLive)
+	}
+}
+
+func TestExport(t *testing.T) {
+	p := createTestProcessorWithMockData(exportTestData)
+
+	export, err := p.Export()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if export.Generated.IsZero() {
+		t.Error("Generated is zero, want the download time")
+	}
+	expectedCountries := map[string][]string{
+		"DE": {"2.0.0.0/12", "5.0.0.0/16"},
+		"FR": {"81.2.69.0/24"},
+	}
+	if !reflect.DeepEqual(export.Countries, expectedCountries) {
+		t.Errorf("Countries = %v, want %v", export.Countries, expectedCountries)
+	}
+	if !reflect.DeepEqual(export.IPv6, map[string][]string{"DE": {"2001:db8::/32"}}) {
+		t.Errorf("IPv6 = %v", export.IPv6)
+	}
+	if export.Skipped.BadCount != 1 || export.Skipped.NonIPv4 != 1 {
+		t.Errorf("Skipped = %+v, want one bad count and one non-IPv4 record", export.Skipped)
+	}
+
+	body, err := json.Marshal(export)
+	if err != nil {
+		t.Fatalf("marshal: %v", err)
+	}
+	for _, field := range []string{`"generated"`, `"countries"`, `"provenance"`, `"registries"`, `"statuses"`, `"addresses"`, `"asns"`, `"ipv6"`, `"skipped_lines"`} {
+		if !strings.Contains(string(body), field) {
+			t.Errorf("serialized export lacks %s: %s", field, body)
+		}
+	}
+}
+
+func TestExport_DownloadError(t *testing.T) {
+	p := createTestProcessor()
+	if _, err := p.Export(); !errors.Is(err, ErrDownloadFailed) {
+		t.Fatalf("expected ErrDownloadFailed, got %v", err)
+	}
+}
+
+func TestExport_WithoutIPv6(t *testing.T) {
+	p := createTestProcessor()
+	p.cache.Set(map[string][]string{"DE": {"2.0.0.0/12"}}, time.Now())
+
+	export, err := p.Export()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(export.IPv6) != 0 {
+		t.Errorf("IPv6 = %v, want empty", export.IPv6)
+	}
+}
+
+func TestExportParsedData_SkipsInvalidIPv6(t *testing.T) {
+	export := Export{
+		Countries: map[string][]string{"DE": {"2.0.0.0/12"}},
+		IPv6:      map[string][]string{"DE": {"2001:db8::/32", "bogus"}},
+	}
+	data := export.parsedData()
+	if got := len(data.lookup.v6); got != 1 {
+		t.Fatalf("indexed %d IPv6 prefixes, want 1", got)
+	}
+}
@@ -0,0 +1,106 @@
+package ipdata
+
+import (
+	"log"
+	"net/netip"
+	"os"
+	"slices"
+	"strings"
+)
+
+// extraRegistry is the registry the blocks added by ExtraCIDRs are grouped under
+const extraRegistry = "extra"
+
+// specEntries splits a list setting into its trimmed, non-empty entries. The
+// entries are separated by commas or newlines; "@path" reads them from a file,
+// where lines starting with # are comments. An unreadable file is logged as
+// the named setting and yields no entries.
+func specEntries(spec, name string) []string {
+	if path, ok := strings.CutPrefix(spec, "@"); ok {
+		content, err := os.ReadFile(path)
+		if err != nil {
+			log.Printf("Ignoring %s file: %v\n", name, err)
+			return nil
+		}
+		spec = string(content)
+	}
+
+	var entries []string
+	for line := range strings.Lines(spec) {
+		if strings.HasPrefix(strings.TrimSpace(line), "#") {
+			continue
+		}
+		for _, entry := range strings.Split(line, ",") {
+			if entry = strings.TrimSpace(entry); entry != "" {
+				entries = append(entries, entry)
+			}
+		}
+	}
+	return entries
+}
+
+// parseExtraCIDRs parses the ExtraCIDRs setting: CC=CIDR pairs (e.g.
+// DE=198.51.100.0/24,DE=2001:db8::/48), or "@path" to read them from a file.
+// Invalid entries are logged and skipped.
+func parseExtraCIDRs(spec string) map[string][]netip.Prefix {
+	extra := make(map[string][]netip.Prefix)
+	for _, entry := range specEntries(spec, "extra CIDRs") {
+		country, value, ok := strings.Cut(entry, "=")
+		country = strings.ToUpper(strings.TrimSpace(country))
+		value = strings.TrimSpace(value)
+		prefix, err := netip.ParsePrefix(value)
+		if !ok || country == "" || ValidateIPCIDR(value) != nil || err != nil {
+			log.Printf("Ignoring invalid extra CIDR %q\n", entry)
+			continue
+		}
+		extra[country] = append(extra[country], prefix.Masked())
+	}
+	return extra
+}
+
+// addExtraCIDRs merges operator-supplied blocks into freshly fetched data.
+// IPv4 blocks are appended to the country's list and grouped under the
+// "extra" registry, IPv6 prefixes join its IPv6 allocations, and both are
+// found by lookups. Blocks the country already has are skipped.
+func (d *parsedData) addExtraCIDRs(extra map[string][]netip.Prefix) {
+	if len(extra) == 0 {
+		return
+	}
+
+	for country, prefixes := range extra {
+		var v6 []netip.Prefix
+		for _, prefix := range prefixes {
+			cidr := prefix.String()
+			if !prefix.Addr().Is4() {
+				if !slices.Contains(d.ipv6[country], cidr) {
+					v6 = append(v6, prefix)
+					d.lookup.v6 = append(d.lookup.v6, countryPrefix{prefix: prefix, country: country})
+				}
+				continue
+			}
+			if slices.Contains(d.cache[country], cidr) {
+				continue
+			}
+
+			d.cache[country] = append(d.cache[country], cidr)
+			if d.registries[country] == nil {
+				d.registries[country] = make(map[string][]string)
+			}
+			d.registries[country][extraRegistry] = append(d.registries[country][extraRegistry], cidr)
+			if d.provenance[country] == nil {
+				d.provenance[country] = make(map[string]int)
+			}
+			d.provenance[country][extraRegistry]++
+			d.lookup.v4 = append(d.lookup.v4, countryPrefix{prefix: prefix, country: country})
+		}
+
+		if len(v6) > 0 {
+			for _, s := range d.ipv6[country] {
+				v6 = append(v6, netip.MustParsePrefix(s))
+			}
+			d.ipv6[country] = prefixStrings(sortedUniquePrefixes(v6))
+		}
+	}
+	sortCountryPrefixes(d.lookup.v4)
+	sortCountryPrefixes(d.lookup.v6)
+}
@@ -0,0 +1,181 @@
+package ipdata
+
+import (
+	"bytes"
+	"log"
+	"net"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/anisimovdk/ip-whitelist-by-country/internal/config"
+)
+
+func TestParseExtraCIDRs(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "extra.txt")
+	content := "# VPN endpoints\nDE=198.51.100.0/24\n\nfr=203.0.113.7/32, FR=2001:db8:1::/48\n"
+	if err := os.WriteFile(file, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	testCases := []struct {
+		name     string
+		spec     string
+		expected map[string][]netip.Prefix
+		logged   string
+	}{
+		{name: "Empty", spec: "", expected: map[string][]netip.Prefix{}},
+		{
+			name: "Pairs",
+			spec: "DE=198.51.100.0/24, de=192.0.2.1/24,FR=2001:db8::/32",
+			expected: map[string][]netip.Prefix{
+				"DE": {netip.MustParsePrefix("198.51.100.0/24"), netip.MustParsePrefix("192.0.2.0/24")},
+				"FR": {netip.MustParsePrefix("2001:db8::/32")},
+			},
+		},
+		{
+			name:     "Invalid entries skipped",
+			spec:     "DE,=198.51.100.0/24,FR=bogus,NL=10.0.0.0/33,IT=192.0.2.0/24",
+			expected: map[string][]netip.Prefix{"IT": {netip.MustParsePrefix("192.0.2.0/24")}},
+			logged:   `Ignoring invalid extra CIDR "FR=bogus"`,
+		},
+		{
+			name: "File",
+			spec: "@" + file,
+			expected: map[string][]netip.Prefix{
+				"DE": {netip.MustParsePrefix("198.51.100.0/24")},
+				"FR": {netip.MustParsePrefix("203.0.113.7/32"), netip.MustParsePrefix("2001:db8:1::/48")},
+			},
+		},
+		{
+			name:     "Missing file",
+			spec:     "@" + filepath.Join(t.TempDir(), "missing.txt"),
+			expected: map[string][]netip.Prefix{},
+			logged:   "Ignoring extra CIDRs file",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var logBuf bytes.Buffer
+			origOutput := log.Writer()
+			log.SetOutput(&logBuf)
+			t.Cleanup(func() { log.SetOutput(origOutput) })
+
+			if got := parseExtraCIDRs(tc.spec); !reflect.DeepEqual(got, tc.expected) {
+				t.Errorf("parseExtraCIDRs(%q) = %v, want %v", tc.spec, got, tc.expected)
+			}
+			if !strings.Contains(logBuf.String(), tc.logged) {
+				t.Errorf("log = %q, want it to contain %q", logBuf.String(), tc.logged)
+			}
+		})
+	}
+}
+
+func TestExtraCIDRs_MergedAndKeptAcrossRefreshes(t *testing.T) {
+	processor := createTestProcessorWithMockData(exportTestData)
+	processor.extraCIDRs = parseExtraCIDRs("DE=198.51.100.0/24,DE=5.0.0.0/16,NL=192.0.2.0/24,DE=2001:db8:1::/48,FR=2a00::/16")
+	mc := processor.httpClient.(*MockHTTPClient)
+
+	for refresh := 1; refresh <= 2; refresh++ {
+		if refresh == 2 {
+			setCacheTime(processor, time.Now().Add(-2*time.Hour))
+		}
+
+		de, err := processor.GetIPListForCountry("DE")
+		if err != nil {
+			t.Fatalf("refresh %d: unexpected error: %v", refresh, err)
+		}
+		if mc.CallCount != refresh {
+			t.Fatalf("refresh %d: CallCount = %d", refresh, mc.CallCount)
+		}
+		if want := []string{"2.0.0.0/12", "5.0.0.0/16", "198.51.100.0/24"}; !slices.Equal(de, want) {
+			t.Errorf("refresh %d: DE = %v, want %v", refresh, de, want)
+		}
+
+		nl, _ := processor.GetIPListForCountry("NL")
+		if want := []string{"192.0.2.0/24"}; !slices.Equal(nl, want) {
+			t.Errorf("refresh %d: NL = %v, want %v", refresh, nl, want)
+		}
+	}
+
+	registries, _ := processor.GetIPListByRegistry("DE")
+	if want := []string{"198.51.100.0/24"}; !slices.Equal(registries[extraRegistry], want) {
+		t.Errorf("DE extra registry = %v, want %v", registries[extraRegistry], want)
+	}
+	provenance, _ := processor.GetProvenanceForCountry("DE")
+	if provenance[extraRegistry] != 1 {
+		t.Errorf("DE extra provenance = %d, want 1", provenance[extraRegistry])
+	}
+
+	v6, _ := processor.GetIPv6ListForCountry("DE")
+	if want := []string{"2001:db8::/32", "2001:db8:1::/48"}; !slices.Equal(v6, want) {
+		t.Errorf("DE IPv6 = %v, want %v", v6, want)
+	}
+
+	for ip, want := range map[string]string{"198.51.100.9": "DE", "192.0.2.1": "NL", "2a00::1": "FR", "2.0.0.1": "DE"} {
+		if country, found, err := processor.LookupCountry(net.ParseIP(ip)); err != nil || !found || country != want {
+			t.Errorf("LookupCountry(%s) = %q, %v, %v; want %s", ip, country, found, err, want)
+		}
+	}
+}
+
+func TestExtraCIDRs_NestedLookup(t *testing.T) {
+	processor := createTestProcessorWithMockData(exportTestData)
+	// NL inside DE's 2.0.0.0/12, NL around DE's 5.0.0.0/16, and FR inside DE's 2001:db8::/32
+	processor.extraCIDRs = parseExtraCIDRs("NL=2.1.0.0/16,NL=5.0.0.0/8,FR=2001:db8:1::/48")
+
+	testCases := map[string]string{
+		"2.0.0.1":       "DE", // enclosing block before the nested extra
+		"2.1.0.0":       "NL", // start of the nested extra
+		"2.1.255.255":   "NL",
+		"2.2.0.1":       "DE", // enclosing block past the nested extra
+		"2.15.255.255":  "DE",
+		"5.0.0.1":       "DE", // existing block nested in the extra
+		"5.1.0.1":       "NL", // enclosing extra past the existing block
+		"5.255.255.255": "NL",
+		"2001:db8::1":   "DE",
+		"2001:db8:1::1": "FR",
+		"2001:db8:2::1": "DE",
+	}
+	for ip, want := range testCases {
+		if country, found, err := processor.LookupCountry(net.ParseIP(ip)); err != nil || !found || country != want {
+			t.Errorf("LookupCountry(%s) = %q, %v, %v; want %s", ip, country, found, err, want)
+		}
+	}
+	if _, found, _ := processor.LookupCountry(net.ParseIP("6.0.0.1")); found {
+		t.Error("LookupCountry(6.0.0.1) found a country, want none")
+	}
+}
+
+func TestExtraCIDRs_DuplicateIPv6Skipped(t *testing.T) {
+	processor := createTestProcessorWithMockData(exportTestData)
+	processor.extraCIDRs = parseExtraCIDRs("DE=2001:db8::/32")
+
+	v6, err := processor.GetIPv6ListForCountry("DE")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if want := []string{"2001:db8::/32"}; !slices.Equal(v6, want) {
+		t.Errorf("DE IPv6 = %v, want %v", v6, want)
+	}
+}
+
+func TestExtraCIDRs_EmbeddedSnapshot(t *testing.T) {
+	useSnapshot(t, testSnapshot)
+	processor := newProcessorWithConfig(&config.Config{
+		CacheDuration:    "1h",
+		EmbeddedFallback: true,
+		ExtraCIDRs:       "DE=198.51.100.0/24",
+	}, &MockHTTPClient{})
+
+	countries, _ := processor.Snapshot()
+	if !slices.Contains(countries["DE"], "198.51.100.0/24") {
+		t.Errorf("embedded DE list = %v, want it to contain 198.51.100.0/24", countries["DE"])
+	}
+}
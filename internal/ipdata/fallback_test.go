@@ -0,0 +1,139 @@
+package ipdata
+
+import (
+	"bytes"
+	"errors"
+	"log"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const testFallbackURL = "https://mirror.example.net/delegated-ripencc-extended-latest"
+
+// routingHTTPClient dispatches requests to a mock client per URL
+type routingHTTPClient map[string]*MockHTTPClient
+
+func (c routingHTTPClient) Do(req *http.Request) (*http.Response, error) {
+	return c[req.URL.String()].Do(req)
+}
+
+func TestDownloadAndProcessData_FallbackURL(t *testing.T) {
+	data := "ripencc|DE|ipv4|2.0.0.0|1048576|20220101|allocated"
+
+	testCases := []struct {
+		name              string
+		primary           *MockHTTPClient
+		fallback          *MockHTTPClient
+		fallbackURL       string
+		expectedErr       error
+		expectedFallbacks int
+		expectedSource    string
+	}{
+		{
+			name:              "Primary succeeds",
+			primary:           &MockHTTPClient{ResponseBody: data},
+			fallback:          &MockHTTPClient{ResponseBody: data},
+			fallbackURL:       testFallbackURL,
+			expectedFallbacks: 0,
+			expectedSource:    ripeURL,
+		},
+		{
+			name:              "Primary errors, fallback succeeds",
+			primary:           &MockHTTPClient{ShouldError: true, ErrorMsg: "connection refused"},
+			fallback:          &MockHTTPClient{ResponseBody: data},
+			fallbackURL:       testFallbackURL,
+			expectedFallbacks: 1,
+			expectedSource:    testFallbackURL,
+		},
+		{
+			name:              "Primary returns bad data, fallback succeeds",
+			primary:           &MockHTTPClient{ResponseBody: "<html>maintenance</html>"},
+			fallback:          &MockHTTPClient{ResponseBody: data},
+			fallbackURL:       testFallbackURL,
+			expectedFallbacks: 1,
+			expectedSource:    testFallbackURL,
+		},
+		{
+			name:              "Both fail",
+			primary:           &MockHTTPClient{StatusCode: http.StatusServiceUnavailable},
+			fallback:          &MockHTTPClient{ShouldError: true, ErrorMsg: "connection refused"},
+			fallbackURL:       testFallbackURL,
+			expectedErr:       ErrDownloadFailed,
+			expectedFallbacks: 1,
+		},
+		{
+			name:              "No fallback configured",
+			primary:           &MockHTTPClient{ShouldError: true, ErrorMsg: "connection refused"},
+			fallback:          &MockHTTPClient{ResponseBody: data},
+			fallbackURL:       "",
+			expectedErr:       ErrDownloadFailed,
+			expectedFallbacks: 0,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			processor := createTestProcessorWithMockData("")
+			processor.config.FallbackDataURL = tc.fallbackURL
+			processor.httpClient = routingHTTPClient{ripeURL: tc.primary, testFallbackURL: tc.fallback}
+
+			var logBuf bytes.Buffer
+			origOutput := log.Writer()
+			log.SetOutput(&logBuf)
+			t.Cleanup(func() { log.SetOutput(origOutput) })
+
+			err := processor.downloadAndProcessData()
+
+			if tc.primary.CallCount != 1 {
+				t.Errorf("primary CallCount = %d, want 1", tc.primary.CallCount)
+			}
+			if tc.fallback.CallCount != tc.expectedFallbacks {
+				t.Errorf("fallback CallCount = %d, want %d", tc.fallback.CallCount, tc.expectedFallbacks)
+			}
+
+			if tc.expectedErr != nil {
+				if !errors.Is(err, tc.expectedErr) {
+					t.Fatalf("expected %v, got %v", tc.expectedErr, err)
+				}
+				if len(cachedEntries(processor)) != 0 {
+					t.Errorf("expected cache to stay empty, got %v", cachedEntries(processor))
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if want := []string{"2.0.0.0/12"}; !reflect.DeepEqual(cachedEntries(processor)["DE"], want) {
+				t.Errorf("DE cache = %v, want %v", cachedEntries(processor)["DE"], want)
+			}
+			if want := "IP data processed from " + tc.expectedSource + "."; !strings.Contains(logBuf.String(), want) {
+				t.Errorf("expected log to contain %q, got %q", want, logBuf.String())
+			}
+		})
+	}
+}
+
+func TestDownloadAndProcessData_FallbackErrorKeepsPrimaryStatus(t *testing.T) {
+	processor := createTestProcessorWithMockData("")
+	processor.config.FallbackDataURL = testFallbackURL
+	processor.httpClient = routingHTTPClient{
+		ripeURL:         &MockHTTPClient{StatusCode: http.StatusServiceUnavailable},
+		testFallbackURL: &MockHTTPClient{ResponseBody: "garbage"},
+	}
+
+	err := processor.downloadAndProcessData()
+
+	var statusErr *UpstreamStatusError
+	if !errors.As(err, &statusErr) || statusErr.StatusCode != http.StatusServiceUnavailable {
+		t.Fatalf("expected primary UpstreamStatusError 503, got %v", err)
+	}
+	if !errors.Is(err, ErrBadUpstreamData) {
+		t.Fatalf("expected fallback ErrBadUpstreamData to be wrapped too, got %v", err)
+	}
+	if !strings.Contains(err.Error(), "fallback download failed") {
+		t.Errorf("unexpected error message: %v", err)
+	}
+}
@@ -1,8 +1,32 @@
 package ipdata
 
+import (
+	"context"
+	"net"
+	"time"
+)
+
 // IPProcessor defines the interface for IP data processing
 type IPProcessor interface {
 	GetIPListForCountry(countryCode string) ([]string, error)
+	GetIPListSnapshot(countryCode string) (ListSnapshot, error)
+	GetIPListForCountryOn(countryCode string, date time.Time) ([]string, error)
+	GetAllCountries() (map[string][]string, error)
+	GetProvenanceForCountry(countryCode string) (map[string]int, error)
+	GetIPListByRegistry(countryCode string) (map[string][]string, error)
+	GetIPListByStatus(countryCode string) (map[string][]string, error)
+	GetASNsForCountry(countryCode string) ([]uint32, error)
+	GetIPv6ListForCountry(countryCode string) ([]string, error)
+	GetCountForCountry(countryCode string) (AllocationCount, error)
+	LookupCountry(ip net.IP) (country string, found bool, err error)
+	Ready() bool
+	DataSource() string
+	DataTime() time.Time
+	RefreshIfOlderThan(maxAge time.Duration) error
+	Stats() Stats
+	Diagnostics() ParseDiagnostics
+	CheckUpstream(ctx context.Context) UpstreamStatus
+	Export() (Export, error)
 }
 
 // Ensure Processor implements IPProcessor
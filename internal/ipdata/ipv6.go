@@ -0,0 +1,72 @@
+package ipdata
+
+import (
+	"cmp"
+	"net/netip"
+	"slices"
+	"strings"
+)
+
+// sortedUniquePrefixes orders prefixes by first address, shorter prefixes
+// first, and removes duplicates
+func sortedUniquePrefixes(prefixes []netip.Prefix) []netip.Prefix {
+	slices.SortFunc(prefixes, func(a, b netip.Prefix) int {
+		return cmp.Or(a.Addr().Compare(b.Addr()), cmp.Compare(a.Bits(), b.Bits()))
+	})
+	return slices.Compact(prefixes)
+}
+
+// prefixStrings formats prefixes in CIDR notation
+func prefixStrings(prefixes []netip.Prefix) []string {
+	strs := make([]string, 0, len(prefixes))
+	for _, prefix := range prefixes {
+		strs = append(strs, prefix.String())
+	}
+	return strs
+}
+
+// GetIPv6ListForCountry returns the IPv6 prefixes allocated to a country,
+// sorted by address
+func (p *Processor) GetIPv6ListForCountry(countryCode string) ([]string, error) {
+	countryCode = strings.ToUpper(countryCode)
+
+	if err := p.refreshIfOlderThan(p.ttlFor(countryCode)); err != nil {
+		return nil, err
+	}
+
+	p.mutex.RLock()
+	defer p.mutex.RUnlock()
+	if prefixes, ok := p.ipv6[countryCode]; ok {
+		return slices.Clone(prefixes), nil
+	}
+	return []string{}, nil
+}
+
+// AggregateIPv6Prefixes rolls IPv6 prefixes longer than bits up to their
+// covering /bits prefix and drops prefixes covered by another one. Prefixes
+// of bits or shorter are kept as allocated, not split. The result is sorted
+// by address; invalid and IPv4 entries are skipped.
+func AggregateIPv6Prefixes(prefixes []string, bits int) []string {
+	rolled := make([]netip.Prefix, 0, len(prefixes))
+	for _, s := range prefixes {
+		prefix, err := netip.ParsePrefix(s)
+		if err != nil || !prefix.Addr().Is6() {
+			continue
+		}
+		if prefix.Bits() > bits {
+			prefix = netip.PrefixFrom(prefix.Addr(), bits)
+		}
+		rolled = append(rolled, prefix.Masked())
+	}
+
+	// Prefixes either nest or are disjoint, so in address order a covered
+	// prefix always follows the last kept one that covers it
+	aggregated := []netip.Prefix{}
+	for _, prefix := range sortedUniquePrefixes(rolled) {
+		if n := len(aggregated); n > 0 && aggregated[n-1].Contains(prefix.Addr()) {
+			continue
+		}
+		aggregated = append(aggregated, prefix)
+	}
+	return prefixStrings(aggregated)
+}
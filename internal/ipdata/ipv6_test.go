@@ -0,0 +1,109 @@
+package ipdata
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestAggregateIPv6Prefixes(t *testing.T) {
+	testCases := []struct {
+		name     string
+		prefixes []string
+		bits     int
+		expected []string
+	}{
+		{
+			name:     "Empty input",
+			prefixes: nil,
+			bits:     48,
+			expected: []string{},
+		},
+		{
+			name:     "Allocation shorter than the level is kept whole",
+			prefixes: []string{"2001:db8::/32"},
+			bits:     48,
+			expected: []string{"2001:db8::/32"},
+		},
+		{
+			name:     "Allocation shorter than the finest level is kept whole",
+			prefixes: []string{"2a00::/29"},
+			bits:     64,
+			expected: []string{"2a00::/29"},
+		},
+		{
+			name:     "Longer prefix rolled up to its covering /48",
+			prefixes: []string{"2001:db8:1:ff00::/56"},
+			bits:     48,
+			expected: []string{"2001:db8:1::/48"},
+		},
+		{
+			name:     "Host route rolled up to its /64",
+			prefixes: []string{"2001:db8:1:2::1/128"},
+			bits:     64,
+			expected: []string{"2001:db8:1:2::/64"},
+		},
+		{
+			name:     "Prefix at the level unchanged",
+			prefixes: []string{"2001:db8:1:100::/56"},
+			bits:     56,
+			expected: []string{"2001:db8:1:100::/56"},
+		},
+		{
+			name:     "Prefixes rolling up to the same block are de-duplicated",
+			prefixes: []string{"2001:db8:1:100::/56", "2001:db8:1:200::/56", "2001:db8:2::/56"},
+			bits:     48,
+			expected: []string{"2001:db8:1::/48", "2001:db8:2::/48"},
+		},
+		{
+			name:     "Prefixes inside a covering allocation are dropped",
+			prefixes: []string{"2001:db8:5::/48", "2001:db8::/32", "2001:db9:1::/56"},
+			bits:     48,
+			expected: []string{"2001:db8::/32", "2001:db9:1::/48"},
+		},
+		{
+			name:     "IPv4 and invalid entries skipped",
+			prefixes: []string{"2.0.0.0/12", "bogus", "2001:db8::/32"},
+			bits:     64,
+			expected: []string{"2001:db8::/32"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := AggregateIPv6Prefixes(tc.prefixes, tc.bits); !reflect.DeepEqual(got, tc.expected) {
+				t.Fatalf("AggregateIPv6Prefixes = %#v, want %#v", got, tc.expected)
+			}
+		})
+	}
+}
+
+func TestGetIPv6ListForCountry(t *testing.T) {
+	data := `ripencc|DE|ipv4|2.0.0.0|1048576|20100101|allocated
+ripencc|DE|ipv6|2001:db8:8000::|33|20100101|allocated
+ripencc|DE|ipv6|2001:db8::|32|20100101|allocated
+ripencc|DE|ipv6|2001:db8::|32|20100101|allocated
+ripencc|FR|ipv6|2a01::|16|20100101|allocated
+`
+	p := createTestProcessorWithMockData(data)
+
+	got, err := p.GetIPv6ListForCountry("de")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if expected := []string{"2001:db8::/32", "2001:db8:8000::/33"}; !reflect.DeepEqual(got, expected) {
+		t.Errorf("GetIPv6ListForCountry(de) = %v, want %v", got, expected)
+	}
+
+	got, err = p.GetIPv6ListForCountry("US")
+	if err != nil || got == nil || len(got) != 0 {
+		t.Errorf("GetIPv6ListForCountry(US) = %#v, %v, want empty list", got, err)
+	}
+}
+
+func TestGetIPv6ListForCountry_DownloadError(t *testing.T) {
+	p := createTestProcessor()
+	if _, err := p.GetIPv6ListForCountry("DE"); !errors.Is(err, ErrDownloadFailed) {
+		t.Fatalf("expected ErrDownloadFailed, got %v", err)
+	}
+}
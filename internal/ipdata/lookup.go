@@ -0,0 +1,132 @@
+package ipdata
+
+import (
+	"cmp"
+	"net"
+	"net/netip"
+	"slices"
+	"sort"
+	"strconv"
+)
+
+// countryPrefix maps a network prefix to the country it is allocated to
+type countryPrefix struct {
+	prefix  netip.Prefix
+	country string
+	parent  int // index of the closest prefix containing this one, -1 if none
+}
+
+// lookupIndex finds the country of an address. Prefixes are kept per address
+// family, sorted by their first address, so a lookup is a binary search.
+// Prefixes may be nested, e.g. an extra block inside another country's
+// allocation, so each one links to the prefix enclosing it.
+type lookupIndex struct {
+	v4 []countryPrefix
+	v6 []countryPrefix
+}
+
+// parseIPv6Prefix converts the start address and prefix length of an ipv6
+// record (delegated-stats stores the prefix length in the count field)
+func parseIPv6Prefix(start, length string) (netip.Prefix, bool) {
+	addr, err := netip.ParseAddr(start)
+	if err != nil || !addr.Is6() || addr.Is4In6() {
+		return netip.Prefix{}, false
+	}
+	bits, err := strconv.Atoi(length)
+	if err != nil || bits < 0 || bits > 128 {
+		return netip.Prefix{}, false
+	}
+	return netip.PrefixFrom(addr, bits).Masked(), true
+}
+
+// newLookupIndex builds the index from the IPv4 CIDR blocks and IPv6 prefixes of every country
+func newLookupIndex(cidrs map[string][]string, v6 map[string][]netip.Prefix) *lookupIndex {
+	index := &lookupIndex{}
+	for country, blocks := range cidrs {
+		for _, cidr := range blocks {
+			if prefix, err := netip.ParsePrefix(cidr); err == nil {
+				index.v4 = append(index.v4, countryPrefix{prefix: prefix, country: country})
+			}
+		}
+	}
+	for country, prefixes := range v6 {
+		for _, prefix := range prefixes {
+			index.v6 = append(index.v6, countryPrefix{prefix: prefix, country: country})
+		}
+	}
+	sortCountryPrefixes(index.v4)
+	sortCountryPrefixes(index.v6)
+	return index
+}
+
+// sortCountryPrefixes orders prefixes by first address, enclosing prefixes
+// before the ones they contain, then country for determinism, and links each
+// prefix to the closest one containing it
+func sortCountryPrefixes(prefixes []countryPrefix) {
+	slices.SortFunc(prefixes, func(a, b countryPrefix) int {
+		return cmp.Or(
+			a.prefix.Addr().Compare(b.prefix.Addr()),
+			cmp.Compare(a.prefix.Bits(), b.prefix.Bits()),
+			cmp.Compare(a.country, b.country),
+		)
+	})
+
+	// CIDR prefixes are either disjoint or nested, so the prefixes enclosing
+	// the current one are a stack of the earlier ones still containing it
+	var enclosing []int
+	for i := range prefixes {
+		for len(enclosing) > 0 && !prefixes[enclosing[len(enclosing)-1]].prefix.Contains(prefixes[i].prefix.Addr()) {
+			enclosing = enclosing[:len(enclosing)-1]
+		}
+		prefixes[i].parent = -1
+		if len(enclosing) > 0 {
+			prefixes[i].parent = enclosing[len(enclosing)-1]
+		}
+		enclosing = append(enclosing, i)
+	}
+}
+
+// find returns the country of the most specific prefix containing addr. It
+// starts at the prefix with the closest start address at or below addr; if
+// that one ends before addr, only a prefix enclosing it can contain addr.
+func (index *lookupIndex) find(addr netip.Addr) (string, bool) {
+	prefixes := index.v6
+	if addr.Is4() {
+		prefixes = index.v4
+	}
+
+	// The last prefix starting at or below addr, the most specific of those
+	// sharing its start address
+	i := sort.Search(len(prefixes), func(j int) bool {
+		return prefixes[j].prefix.Addr().Compare(addr) > 0
+	}) - 1
+	for i >= 0 && !prefixes[i].prefix.Contains(addr) {
+		i = prefixes[i].parent
+	}
+	if i < 0 {
+		return "", false
+	}
+	return prefixes[i].country, true
+}
+
+// LookupCountry returns the country whose allocations contain ip. IPv4 and
+// IPv6 addresses are searched in their own family's allocations; found is
+// false if no allocation contains the address.
+func (p *Processor) LookupCountry(ip net.IP) (country string, found bool, err error) {
+	if err := p.refreshIfStale(); err != nil {
+		return "", false, err
+	}
+
+	addr, ok := netip.AddrFromSlice(ip)
+	if !ok {
+		return "", false, nil
+	}
+
+	p.mutex.RLock()
+	defer p.mutex.RUnlock()
+	if p.lookup == nil {
+		return "", false, nil
+	}
+	country, found = p.lookup.find(addr.Unmap())
+	return country, found, nil
+}
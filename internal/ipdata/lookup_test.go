@@ -0,0 +1,94 @@
+package ipdata
+
+import (
+	"errors"
+	"net"
+	"net/netip"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLookupCountry(t *testing.T) {
+	data := strings.Join([]string{
+		"2|ripencc|20220101|6|19830705|20220101|+0100",
+		"ripencc|DE|ipv4|2.0.0.0|1048576|20220101|allocated",
+		"ripencc|FR|ipv4|5.0.0.0|256|20220101|allocated",
+		"ripencc|DE|ipv6|2001:db8::|32|20220101|allocated",
+		"ripencc|FR|ipv6|2a00:1450::|29|20220101|allocated",
+		"ripencc|NL|ipv6|not-an-address|32|20220101|allocated",
+		"ripencc|NL|ipv6|2a01::|129|20220101|allocated",
+	}, "\n")
+
+	processor := createTestProcessorWithMockData(data)
+
+	testCases := []struct {
+		ip      string
+		country string
+		found   bool
+	}{
+		{ip: "2.0.0.0", country: "DE", found: true},
+		{ip: "2.15.255.255", country: "DE", found: true},
+		{ip: "5.0.0.128", country: "FR", found: true},
+		{ip: "::ffff:5.0.0.1", country: "FR", found: true},
+		{ip: "2001:db8:ffff::1", country: "DE", found: true},
+		{ip: "2a00:1457:1::", country: "FR", found: true},
+		{ip: "1.255.255.255"},
+		{ip: "2.16.0.0"},
+		{ip: "5.0.1.0"},
+		{ip: "::1"},
+		{ip: "2001:db9::"},
+		{ip: "2a01::1"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.ip, func(t *testing.T) {
+			country, found, err := processor.LookupCountry(net.ParseIP(tc.ip))
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if country != tc.country || found != tc.found {
+				t.Errorf("LookupCountry(%s) = %q, %v; want %q, %v", tc.ip, country, found, tc.country, tc.found)
+			}
+		})
+	}
+
+	// IPv6 records are still reported as skipped, since they are not served by /get
+	if skipped := processor.Stats().SkippedLines.NonIPv4; skipped != 4 {
+		t.Errorf("SkippedLines.NonIPv4 = %d, want 4", skipped)
+	}
+}
+
+func TestLookupCountry_InvalidIP(t *testing.T) {
+	processor := createTestProcessorWithMockData("ripencc|DE|ipv4|2.0.0.0|256|20220101|allocated")
+
+	if country, found, err := processor.LookupCountry(net.IP{1, 2, 3}); err != nil || found || country != "" {
+		t.Errorf("LookupCountry(invalid) = %q, %v, %v; want no match", country, found, err)
+	}
+}
+
+func TestLookupCountry_NoIndex(t *testing.T) {
+	processor := createTestProcessor()
+	processor.cache = newTestCache(map[string][]string{"DE": {"2.0.0.0/24"}}, time.Now())
+
+	if country, found, err := processor.LookupCountry(net.ParseIP("2.0.0.1")); err != nil || found || country != "" {
+		t.Errorf("LookupCountry without index = %q, %v, %v; want no match", country, found, err)
+	}
+}
+
+func TestLookupCountry_DownloadError(t *testing.T) {
+	processor := createTestProcessor()
+
+	_, _, err := processor.LookupCountry(net.ParseIP("2.0.0.1"))
+	if !errors.Is(err, ErrDownloadFailed) {
+		t.Fatalf("expected ErrDownloadFailed, got %v", err)
+	}
+}
+
+func TestNewLookupIndex_SkipsInvalidCIDR(t *testing.T) {
+	index := newLookupIndex(map[string][]string{"DE": {"2.0.0.0/24", "bogus"}}, nil)
+
+	if len(index.v4) != 1 || index.v4[0].prefix != netip.MustParsePrefix("2.0.0.0/24") {
+		t.Errorf("index.v4 = %v, want only 2.0.0.0/24", index.v4)
+	}
+}
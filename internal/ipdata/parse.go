@@ -0,0 +1,259 @@
+package ipdata
+
+import (
+	"bufio"
+	"io"
+	"log"
+	"net/netip"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// parseChunkLines is the number of lines handed to a parse worker at a time
+const parseChunkLines = 4096
+
+// recordTables collects the records of delegated-stats lines, keyed by country,
+// in the order the lines were read
+type recordTables struct {
+	ipData     map[string][]IPData
+	asns       map[string][]uint32
+	ipv6       map[string][]netip.Prefix
+	statuses   map[string]map[string][]IPData // status -> country code -> records not served by default
+	skipped    SkipStats
+	mismatches int
+
+	// Diagnostics counters, see ParseDiagnostics
+	lines         int
+	ignored       int
+	asnRecords    int
+	statusRecords map[string]int // status -> IPv4 records
+}
+
+func newRecordTables() *recordTables {
+	return &recordTables{
+		ipData:   make(map[string][]IPData),
+		asns:     make(map[string][]uint32),
+		ipv6:     make(map[string][]netip.Prefix),
+		statuses: make(map[string]map[string][]IPData),
+
+		statusRecords: make(map[string]int),
+	}
+}
+
+// scanLines calls fn with every line of r, trimmed of surrounding whitespace
+// and of a leading byte order mark
+func scanLines(r io.Reader, fn func(line string)) error {
+	scanner := bufio.NewScanner(r)
+	for lineNum := 1; scanner.Scan(); lineNum++ {
+		line := scanner.Text()
+		if lineNum == 1 {
+			line = strings.TrimPrefix(line, utf8BOM)
+		}
+		fn(strings.TrimSpace(line))
+	}
+	return scanner.Err()
+}
+
+// parseRecords reads all records of r on the calling goroutine
+func parseRecords(r io.Reader, strict bool) (*recordTables, error) {
+	tables := newRecordTables()
+	err := scanLines(r, func(line string) {
+		tables.add(line, strict)
+	})
+	return tables, err
+}
+
+// parseRecordsParallel reads r in chunks of lines that are parsed by a pool
+// of workers. The per-chunk tables are merged in input order, so the result
+// is identical to parseRecords whatever the chunk boundaries.
+func parseRecordsParallel(r io.Reader, strict bool, workers int) (*recordTables, error) {
+	type chunk struct {
+		index int
+		lines []string
+	}
+
+	chunks := make(chan chunk)
+	var mu sync.Mutex
+	results := make(map[int]*recordTables)
+	var wg sync.WaitGroup
+	for range workers {
+		wg.Go(func() {
+			for c := range chunks {
+				tables := newRecordTables()
+				for _, line := range c.lines {
+					tables.add(line, strict)
+				}
+				mu.Lock()
+				results[c.index] = tables
+				mu.Unlock()
+			}
+		})
+	}
+
+	count := 0
+	lines := make([]string, 0, parseChunkLines)
+	err := scanLines(r, func(line string) {
+		lines = append(lines, line)
+		if len(lines) == parseChunkLines {
+			chunks <- chunk{index: count, lines: lines}
+			count++
+			lines = make([]string, 0, parseChunkLines)
+		}
+	})
+	if len(lines) > 0 {
+		chunks <- chunk{index: count, lines: lines}
+		count++
+	}
+	close(chunks)
+	wg.Wait()
+
+	if err != nil {
+		return nil, err
+	}
+
+	merged := newRecordTables()
+	for i := range count {
+		merged.merge(results[i])
+	}
+	return merged, nil
+}
+
+// merge appends the records of other after those already collected
+func (t *recordTables) merge(other *recordTables) {
+	for country, list := range other.ipData {
+		t.ipData[country] = append(t.ipData[country], list...)
+	}
+	for country, list := range other.asns {
+		t.asns[country] = append(t.asns[country], list...)
+	}
+	for country, list := range other.ipv6 {
+		t.ipv6[country] = append(t.ipv6[country], list...)
+	}
+	for status, byCountry := range other.statuses {
+		for country, list := range byCountry {
+			t.addStatusRecords(status, country, list...)
+		}
+	}
+	t.skipped.TooFewFields += other.skipped.TooFewFields
+	t.skipped.OtherRegistry += other.skipped.OtherRegistry
+	t.skipped.NonIPv4 += other.skipped.NonIPv4
+	t.skipped.BadCount += other.skipped.BadCount
+	t.skipped.ParseError += other.skipped.ParseError
+	t.mismatches += other.mismatches
+	t.lines += other.lines
+	t.ignored += other.ignored
+	t.asnRecords += other.asnRecords
+	for status, count := range other.statusRecords {
+		t.statusRecords[status] += count
+	}
+}
+
+// add parses a single trimmed delegated-stats line
+func (t *recordTables) add(line string, strict bool) {
+	t.lines++
+
+	// Skip comments and empty lines
+	if strings.HasPrefix(line, "#") || line == "" {
+		t.ignored++
+		return
+	}
+
+	parts := strings.Split(line, "|")
+	for i := range parts {
+		parts[i] = strings.TrimSpace(parts[i])
+	}
+
+	// Skip the version header and per-type summary records
+	if isVersionHeader(parts) || isSummaryRecord(parts) {
+		t.ignored++
+		return
+	}
+
+	if len(parts) < 6 {
+		t.skipped.TooFewFields++
+		return
+	}
+
+	// Only RIPE NCC records are served
+	if parts[0] != "ripencc" {
+		t.skipped.OtherRegistry++
+		return
+	}
+
+	country := strings.ToUpper(parts[1])
+
+	switch parts[2] {
+	case "ipv4":
+	case "asn":
+		start, count, ok := parseASNRange(parts[3], parts[4])
+		if !ok {
+			t.skipped.ParseError++
+			return
+		}
+		t.asns[country] = appendASNRange(t.asns[country], start, count)
+		t.asnRecords++
+		return
+	default:
+		// IPv6 blocks are not served, but indexed for address lookups
+		if parts[2] == "ipv6" {
+			if prefix, ok := parseIPv6Prefix(parts[3], parts[4]); ok {
+				t.ipv6[country] = append(t.ipv6[country], prefix)
+			}
+		}
+		t.skipped.NonIPv4++
+		return
+	}
+
+	ipStart := parts[3]
+	countStr := parts[4]
+
+	// A count outside 1..2^32 has no IPv4 prefix length and would make the
+	// mask calculation below produce an invalid CIDR block
+	count, err := strconv.ParseUint(countStr, 10, 64)
+	if err != nil || count < 1 || count > maxIPv4Count {
+		log.Printf("Skipping %s record %s with invalid address count %q\n", country, ipStart, countStr)
+		t.skipped.BadCount++
+		return
+	}
+
+	mask := maskForCount(count)
+
+	// Align the start address to its network boundary
+	network, ok := normalizeIPv4Network(ipStart, mask)
+	if !ok {
+		t.skipped.ParseError++
+		return
+	}
+
+	ipData := IPData{
+		Registry: parts[0],
+		Country:  country,
+		IPStart:  network,
+		Count:    count,
+		CIDRMask: mask,
+		Status:   recordStatus(parts),
+	}
+
+	if strict && hasMaskMismatch(ipData) {
+		t.mismatches++
+		log.Printf("Mask mismatch: %s/%d covers %d addresses, source count is %d (%s)\n",
+			ipStart, mask, prefixAddressCount(mask), count, country)
+	}
+
+	t.statusRecords[ipData.Status]++
+	if !slices.Contains(DefaultStatuses, ipData.Status) {
+		t.addStatusRecords(ipData.Status, country, ipData)
+		return
+	}
+	t.ipData[country] = append(t.ipData[country], ipData)
+}
+
+// addStatusRecords appends records of a status that is not served by default
+func (t *recordTables) addStatusRecords(status, country string, records ...IPData) {
+	if t.statuses[status] == nil {
+		t.statuses[status] = make(map[string][]IPData)
+	}
+	t.statuses[status][country] = append(t.statuses[status][country], records...)
+}
@@ -0,0 +1,102 @@
+package ipdata
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/anisimovdk/ip-whitelist-by-country/internal/config"
+)
+
+// syntheticDelegatedStats builds a delegated-stats file of about n lines
+// mixing IPv4, IPv6 and ASN records with lines that are skipped, and blocks
+// repeated far apart so duplicates straddle chunk boundaries
+func syntheticDelegatedStats(n int) string {
+	countries := []string{"DE", "FR", "GB", "NL", "SE", "PL", "IT", "ES", "RU", "UA"}
+	var b strings.Builder
+	b.WriteString(utf8BOM + "2|ripencc|20240101|100|19830705|20240101|+0100\n")
+	b.WriteString("ripencc|*|ipv4|*|100|summary\n")
+	for i := range n {
+		country := countries[i%len(countries)]
+		switch i % 50 {
+		case 7:
+			fmt.Fprintf(&b, "ripencc|%s|asn|%d|2|20100101|allocated\n", country, 64512+i%1000)
+		case 13:
+			fmt.Fprintf(&b, "ripencc|%s|ipv6|2001:%x::|32|20100101|allocated\n", country, i%0xffff)
+		case 21:
+			fmt.Fprintf(&b, "arin|US|ipv4|%d.0.0.0|256|20100101|allocated\n", 1+i%200)
+		case 37:
+			b.WriteString("# comment\n\n")
+		case 43:
+			fmt.Fprintf(&b, "ripencc|ZZ|ipv4|%d.0.0.0|256|20100101|reserved\n", 100+i%100)
+		default:
+			// The modulus repeats each block every 40000 lines
+			block := i % 40000
+			fmt.Fprintf(&b, "ripencc|%s|ipv4|%d.%d.%d.0|256|20100101|allocated\n",
+				country, 2+block/65536, block/256%256, block%256)
+		}
+	}
+	return b.String()
+}
+
+func TestParseDelegatedStats_ParallelMatchesSerial(t *testing.T) {
+	data := syntheticDelegatedStats(5*parseChunkLines + 123)
+
+	serial, err := parseDelegatedStats(strings.NewReader(data), &config.Config{ParseWorkers: 1, StrictParse: true})
+	if err != nil {
+		t.Fatalf("serial parse: %v", err)
+	}
+
+	for _, workers := range []int{2, 3, 8} {
+		t.Run(fmt.Sprintf("%d workers", workers), func(t *testing.T) {
+			parallel, err := parseDelegatedStats(strings.NewReader(data), &config.Config{ParseWorkers: workers, StrictParse: true})
+			if err != nil {
+				t.Fatalf("parallel parse: %v", err)
+			}
+			if !reflect.DeepEqual(parallel, serial) {
+				t.Fatal("parallel parse differs from serial parse")
+			}
+		})
+	}
+}
+
+func TestParseDelegatedStats_ParallelShortInput(t *testing.T) {
+	data := "ripencc|DE|ipv4|2.0.0.0|256|20100101|allocated\n"
+	parsed, err := parseDelegatedStats(strings.NewReader(data), &config.Config{ParseWorkers: 4})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := parsed.cache["DE"]; !reflect.DeepEqual(got, []string{"2.0.0.0/24"}) {
+		t.Fatalf("DE = %v, want [2.0.0.0/24]", got)
+	}
+}
+
+func TestParseDelegatedStats_ParallelReadError(t *testing.T) {
+	data := syntheticDelegatedStats(2 * parseChunkLines)
+	r := io.MultiReader(strings.NewReader(data), errReadCloser{})
+
+	_, err := parseDelegatedStats(r, &config.Config{ParseWorkers: 4})
+	if !errors.Is(err, ErrDownloadFailed) {
+		t.Fatalf("expected ErrDownloadFailed, got %v", err)
+	}
+}
+
+func BenchmarkParseDelegatedStats(b *testing.B) {
+	data := syntheticDelegatedStats(200000)
+
+	for _, workers := range []int{1, 2, 4, 8} {
+		b.Run(fmt.Sprintf("workers=%d", workers), func(b *testing.B) {
+			cfg := &config.Config{ParseWorkers: workers}
+			b.SetBytes(int64(len(data)))
+			b.ReportAllocs()
+			for b.Loop() {
+				if _, err := parseDelegatedStats(strings.NewReader(data), cfg); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
@@ -1,17 +1,22 @@
 package ipdata
 
 import (
-	"bufio"
+	"compress/bzip2"
 	"context"
 	"errors"
 	"fmt"
+	"io"
 	"log"
-	"math"
+	"log/slog"
+	"math/rand/v2"
 	"net"
 	"net/http"
+	"net/netip"
+	"slices"
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/anisimovdk/ip-whitelist-by-country/internal/config"
@@ -19,8 +24,27 @@ import (
 
 const (
 	downloadTimeout = 60 * time.Second
+
+	// defaultMinCacheDuration is the TTL floor used when MinCacheDuration is not a valid duration
+	defaultMinCacheDuration = 5 * time.Minute
+
+	// readyStaleFactor is how many cache TTLs old the data may get before the processor reports not ready
+	readyStaleFactor = 2
+
+	// maxIPv4Count is the largest address count an IPv4 record can carry (a /0)
+	maxIPv4Count = 1 << 32
+)
+
+// Data sources reported by DataSource
+const (
+	DataSourceLive     = "live"
+	DataSourceEmbedded = "embedded"
+	DataSourcePeer     = "peer"
 )
 
+// utf8BOM is the byte order mark some mirrors prepend to the data file
+const utf8BOM = "\ufeff"
+
 var ripeURL = "https://ftp.ripe.net/ripe/stats/delegated-ripencc-extended-latest"
 
 // HTTPClient interface for making HTTP requests (allows mocking)
@@ -30,180 +54,680 @@ type HTTPClient interface {
 
 // IPData represents a single IP allocation record
 type IPData struct {
+	Registry string
 	Country  string
 	IPStart  string
-	Count    int
+	Count    uint64
 	CIDRMask int
+	Status   string
+}
+
+// servedData describes the cached data. It is replaced as a whole whenever the
+// cache is, so readers get entries, a source and a load time that belong
+// together without waiting for the mutex held by a download.
+type servedData struct {
+	entries  map[string][]string // country code -> CIDR blocks, as passed to the cache
+	source   string              // one of the DataSource constants, empty while nothing is loaded
+	loadedAt time.Time           // when the data was downloaded, zero if never
+}
+
+// ListSnapshot is the CIDR list of a country together with the source and
+// download time of the data it was taken from
+type ListSnapshot struct {
+	CIDRs      []string
+	DataSource string
+	DataTime   time.Time // zero while only the embedded snapshot has been loaded
 }
 
 // Processor handles IP data processing
 type Processor struct {
-	cache      map[string][]string // country code -> list of CIDR blocks
-	cacheTime  time.Time
-	config     *config.Config
-	cacheTTL   time.Duration
-	mutex      sync.RWMutex
-	httpClient HTTPClient
+	cache       Cache                          // country code -> list of CIDR blocks, with the load time
+	provenance  map[string]map[string]int      // country code -> registry -> block count
+	registries  map[string]map[string][]string // country code -> registry -> CIDR blocks
+	statuses    map[string]map[string][]string // country code -> allocation status -> CIDR blocks
+	addresses   map[string]uint64              // country code -> allocated address count
+	asns        map[string][]uint32            // country code -> sorted AS numbers
+	ipv6        map[string][]string            // country code -> sorted IPv6 prefixes
+	lookup      *lookupIndex                   // address -> country index
+	skipped     SkipStats                      // lines skipped while parsing the cached data
+	diagnostics ParseDiagnostics               // tally of the lines parsed into the cached data
+	reassigned  []Reassignment                 // blocks whose country changed in the last refresh
+	modifiedAt  time.Time                      // upstream Last-Modified of the cached data, zero if unknown
+	fileSize    int64                          // upstream Content-Length of the cached data, 0 or less if unknown
+	config      *config.Config
+	cacheTTL    time.Duration
+	minTTL      time.Duration             // floor of every cache duration, including RefreshIfOlderThan's
+	maxStaleAge time.Duration             // how old stale data may get while refreshes fail, 0 if unbounded
+	coldWait    time.Duration             // how long requests wait for the first download, 0 if unbounded
+	countryTTLs map[string]time.Duration  // country code -> cache duration override
+	extraCIDRs  map[string][]netip.Prefix // country code -> blocks merged into every refresh
+	excluded    []netip.Prefix            // blocks removed from every refresh
+	lastSeen    map[string]time.Time      // country code -> last successful download containing it
+	onRefresh   []func()                  // called after each successful refresh
+	cold        *coldLoad                 // first download in progress, nil if none
+	coldMutex   sync.Mutex
+	mutex       sync.RWMutex
+	httpClient  HTTPClient
+	refreshing  atomic.Bool
+	served      atomic.Pointer[servedData] // entries, source and load time of the cached data, read without the mutex
+	breaker     *circuitBreaker
+	cacheHits   atomic.Uint64 // lookups served without needing a refresh
+	cacheMisses atomic.Uint64 // lookups that found the cache expired
+	archive     *archiveStore // archived days served by GetIPListForCountryOn
+	archiveOnce sync.Once
 }
 
 // NewProcessor creates a new processor
 func NewProcessor() *Processor {
 	cfg := config.NewConfig()
-	cacheDuration, err := time.ParseDuration(cfg.CacheDuration)
-	if err != nil {
-		cacheDuration = 1 * time.Hour // Default to 1 hour if parsing fails
-	}
-
-	return &Processor{
-		cache:      make(map[string][]string),
-		cacheTime:  time.Time{},
-		config:     cfg,
-		cacheTTL:   cacheDuration,
-		httpClient: http.DefaultClient,
-	}
+	return newProcessorWithConfig(cfg, newHTTPClient(cfg))
 }
 
 // NewProcessorWithClient creates a new processor with a custom HTTP client (useful for testing)
 func NewProcessorWithClient(httpClient HTTPClient) *Processor {
-	cfg := config.NewConfig()
+	return newProcessorWithConfig(config.NewConfig(), httpClient)
+}
+
+// newProcessorWithConfig creates a new processor from the given configuration and HTTP client
+func newProcessorWithConfig(cfg *config.Config, httpClient HTTPClient) *Processor {
 	cacheDuration, err := time.ParseDuration(cfg.CacheDuration)
 	if err != nil {
 		cacheDuration = 1 * time.Hour // Default to 1 hour if parsing fails
 	}
 
-	return &Processor{
-		cache:      make(map[string][]string),
-		cacheTime:  time.Time{},
-		config:     cfg,
-		cacheTTL:   cacheDuration,
-		httpClient: httpClient,
+	minCacheDuration, err := time.ParseDuration(cfg.MinCacheDuration)
+	if err != nil {
+		minCacheDuration = defaultMinCacheDuration
+	}
+	if cacheDuration < minCacheDuration {
+		log.Printf("Warning: cache duration %s is below the minimum of %s, using %s\n",
+			cacheDuration, minCacheDuration, minCacheDuration)
+		cacheDuration = minCacheDuration
+	}
+
+	if cfg.CacheJitter > 0 {
+		cacheDuration = max(jitterDuration(cacheDuration, cfg.CacheJitter, rand.Float64()), minCacheDuration)
+	}
+
+	p := &Processor{
+		cache:       NewMemoryCache(),
+		config:      cfg,
+		cacheTTL:    cacheDuration,
+		minTTL:      minCacheDuration,
+		maxStaleAge: parseMaxStaleAge(cfg.MaxStaleAge),
+		coldWait:    parseColdStartWait(cfg.ColdStartWait),
+		countryTTLs: parseCountryTTLs(cfg.CountryTTL, minCacheDuration),
+		extraCIDRs:  parseExtraCIDRs(cfg.ExtraCIDRs),
+		excluded:    parseExcludeCIDRs(cfg.ExcludeCIDRs),
+		lastSeen:    make(map[string]time.Time),
+		httpClient:  httpClient,
+		breaker:     newCircuitBreaker(cfg.BreakerThreshold, cfg.BreakerCooldown),
 	}
+
+	if cfg.EmbeddedFallback {
+		if err := p.loadEmbedded(); err != nil {
+			slog.Error("Failed to load embedded IP data", "error", err)
+		}
+	}
+
+	return p
+}
+
+// jitterDuration scales d by a factor within ±percent%, picked linearly from r in [0, 1).
+// Percentages above 100 are capped so the result is never negative.
+func jitterDuration(d time.Duration, percent int, r float64) time.Duration {
+	percent = min(max(percent, 0), 100)
+	factor := 1 + float64(percent)/100*(2*r-1)
+	return time.Duration(float64(d) * factor)
 }
 
 // GetIPListForCountry returns a list of IP CIDR blocks for a country
 func (p *Processor) GetIPListForCountry(countryCode string) ([]string, error) {
 	countryCode = strings.ToUpper(countryCode)
-
-	// Check cache first
-	p.mutex.RLock()
-	if time.Since(p.cacheTime) < p.cacheTTL {
-		if ipList, ok := p.cache[countryCode]; ok {
-			p.mutex.RUnlock()
-			return ipList, nil
+	ttl := p.ttlFor(countryCode)
+
+	// Check cache first. The cache swaps its data atomically, so this needs
+	// no processor lock; reading the load time before the entries means
+	// a concurrent refresh can only make the entries newer than checked.
+	if time.Since(p.loadedAt()) < ttl {
+		if ipList, ok := p.cache.Get(countryCode); ok {
+			p.cacheHits.Add(1)
+			return slices.Clone(ipList), nil
 		}
 	}
-	p.mutex.RUnlock()
 
 	// Need to download and process data
-	err := p.downloadAndProcessData()
-	if err != nil {
-		return nil, fmt.Errorf("failed to download and process data: %w", err)
+	if err := p.refreshIfOlderThan(ttl); err != nil {
+		return nil, err
 	}
 
 	// Check cache again
+	if ipList, ok := p.cache.Get(countryCode); ok {
+		return slices.Clone(ipList), nil
+	}
+
+	return []string{}, nil // Return empty list if country not found
+}
+
+// GetIPListSnapshot returns the CIDR list of a country with the source and
+// download time of the same data, which separate calls to GetIPListForCountry,
+// DataSource and DataTime cannot guarantee while a refresh runs
+func (p *Processor) GetIPListSnapshot(countryCode string) (ListSnapshot, error) {
+	countryCode = strings.ToUpper(countryCode)
+
+	if err := p.refreshIfOlderThan(p.ttlFor(countryCode)); err != nil {
+		return ListSnapshot{}, err
+	}
+
+	served := p.servedData()
+	ipList := served.entries[countryCode]
+	if ipList == nil {
+		ipList = []string{}
+	}
+	return ListSnapshot{
+		CIDRs:      slices.Clone(ipList),
+		DataSource: served.source,
+		DataTime:   served.loadedAt,
+	}, nil
+}
+
+// GetProvenanceForCountry returns the number of CIDR blocks per source registry for a country
+func (p *Processor) GetProvenanceForCountry(countryCode string) (map[string]int, error) {
+	countryCode = strings.ToUpper(countryCode)
+
+	if err := p.refreshIfOlderThan(p.ttlFor(countryCode)); err != nil {
+		return nil, err
+	}
+
 	p.mutex.RLock()
 	defer p.mutex.RUnlock()
-	if ipList, ok := p.cache[countryCode]; ok {
-		return ipList, nil
+	result := make(map[string]int, len(p.provenance[countryCode]))
+	for registry, count := range p.provenance[countryCode] {
+		result[registry] = count
 	}
+	return result, nil
+}
 
-	return []string{}, nil // Return empty list if country not found
+// Snapshot returns a deep copy of the cached CIDR blocks of all countries together
+// with the time the data was loaded. The copy is taken under a single read lock,
+// so it is consistent even if a refresh runs concurrently. It never triggers a download.
+func (p *Processor) Snapshot() (map[string][]string, time.Time) {
+	p.mutex.RLock()
+	defer p.mutex.RUnlock()
+
+	countries := p.cache.Countries()
+	snapshot := make(map[string][]string, len(countries))
+	for _, country := range countries {
+		cidrs, _ := p.cache.Get(country)
+		snapshot[country] = slices.Clone(cidrs)
+	}
+	return snapshot, p.loadedAt()
+}
+
+// GetAllCountries returns a deep copy of the CIDR blocks of every country,
+// downloading the data first if the cache has expired
+func (p *Processor) GetAllCountries() (map[string][]string, error) {
+	if err := p.refreshIfStale(); err != nil {
+		return nil, err
+	}
+
+	all, _ := p.Snapshot()
+	return all, nil
+}
+
+// Countries returns the sorted country codes present in the IP data
+func (p *Processor) Countries() ([]string, error) {
+	if err := p.refreshIfStale(); err != nil {
+		return nil, err
+	}
+
+	p.mutex.RLock()
+	defer p.mutex.RUnlock()
+	return p.cache.Countries(), nil
+}
+
+// Ready reports whether IP data is loaded and not excessively stale.
+// If the data is missing or expired, a background refresh is started so that
+// readiness probes alone can warm the cache.
+func (p *Processor) Ready() bool {
+	// A refresh holds the write lock for the whole download, so probes read
+	// the atomically swapped served data instead of waiting for it
+	served := p.servedData()
+	loaded := !served.loadedAt.IsZero()
+	age := time.Since(served.loadedAt)
+
+	if age >= p.cacheTTL && p.refreshing.CompareAndSwap(false, true) {
+		go func() {
+			defer p.refreshing.Store(false)
+			if err := p.refreshIfStale(); err != nil {
+				slog.Error("Background refresh failed", "error", err)
+			}
+		}()
+	}
+
+	return served.source == DataSourceEmbedded || (loaded && age < readyStaleFactor*p.cacheTTL)
+}
+
+// refreshIfStale downloads and processes data if the cache has expired
+func (p *Processor) refreshIfStale() error {
+	return p.refreshIfOlderThan(p.cacheTTL)
+}
+
+// refreshIfOlderThan downloads and processes data if the cache is older than ttl
+func (p *Processor) refreshIfOlderThan(ttl time.Duration) error {
+	// Without data there is nothing fresh, and requests must not queue on
+	// the lock held by the first download
+	download := p.downloadIfOlderThan
+	if p.isCold() {
+		download = p.downloadCold
+	} else {
+		p.mutex.RLock()
+		fresh := time.Since(p.loadedAt()) < ttl
+		p.mutex.RUnlock()
+		if fresh {
+			p.cacheHits.Add(1)
+			return nil
+		}
+	}
+	p.cacheMisses.Add(1)
+
+	if err := download(ttl); err != nil {
+		if errors.Is(err, ErrColdStart) {
+			return err
+		}
+		if p.DataSource() == DataSourceEmbedded {
+			log.Printf("Serving embedded IP data, live download failed: %v\n", err)
+			return nil
+		}
+		if handled, err := p.serveStale(err); handled {
+			return err
+		}
+		if p.config.StaleOnParseError && isParseError(err) && !p.DataTime().IsZero() {
+			log.Printf("Serving previous IP data, refreshed data failed to parse: %v\n", err)
+			return nil
+		}
+		if errors.Is(err, ErrCircuitOpen) {
+			// Serve stale data rather than waiting on a doomed download
+			if !p.DataTime().IsZero() {
+				return nil
+			}
+			return fmt.Errorf("%w: %w", ErrNotReady, err)
+		}
+		return fmt.Errorf("failed to download and process data: %w", err)
+	}
+	return nil
+}
+
+// RefreshIfOlderThan synchronously downloads fresh data if the cached data is
+// older than maxAge. Unlike regular refreshes, a failure is reported even while
+// the embedded snapshot is being served, since that cannot satisfy maxAge.
+// maxAge is raised to the minimum cache duration, so callers cannot force a
+// download more often than the configured TTL floor allows.
+func (p *Processor) RefreshIfOlderThan(maxAge time.Duration) error {
+	maxAge = max(maxAge, p.minTTL)
+	p.mutex.RLock()
+	fresh := time.Since(p.loadedAt()) < maxAge
+	p.mutex.RUnlock()
+	if fresh {
+		return nil
+	}
+
+	if err := p.downloadIfOlderThan(maxAge); err != nil {
+		return fmt.Errorf("failed to download and process data: %w", err)
+	}
+	return nil
+}
+
+// loadedAt returns when the cached data was downloaded, the zero time if never.
+// The cache swaps its data and load time atomically, so it needs no lock.
+func (p *Processor) loadedAt() time.Time {
+	return p.cache.Info().LoadedAt
+}
+
+// servedData returns the entries, source and load time of the cached data. It needs no lock.
+func (p *Processor) servedData() servedData {
+	if served := p.served.Load(); served != nil {
+		return *served
+	}
+	return servedData{}
+}
+
+// DataSource returns where the currently cached IP data came from. Like
+// DataTime it reads the served data without the mutex, so it does not wait
+// for a download in progress.
+func (p *Processor) DataSource() string {
+	return p.servedData().source
+}
+
+// DataTime returns when the cached IP data was last downloaded successfully.
+// It is the zero time while nothing has been downloaded yet, including when
+// only the embedded snapshot is being served.
+func (p *Processor) DataTime() time.Time {
+	return p.servedData().loadedAt
+}
+
+// OnRefresh registers fn to be called after each successful refresh, also one
+// that only renewed the load time of unchanged data. It runs in its own
+// goroutine once the new data is being served.
+func (p *Processor) OnRefresh(fn func()) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.onRefresh = append(p.onRefresh, fn)
+}
+
+// countByRegistry returns the number of allocation records per registry
+func countByRegistry(ipDataList []IPData) map[string]int {
+	counts := make(map[string]int)
+	for _, ipData := range ipDataList {
+		counts[ipData.Registry]++
+	}
+	return counts
 }
 
 // downloadAndProcessData downloads and processes the RIPE data
 func (p *Processor) downloadAndProcessData() error {
+	return p.downloadIfOlderThan(p.cacheTTL)
+}
+
+// downloadIfOlderThan downloads and processes the RIPE data unless the cache
+// became younger than ttl while waiting for the write lock
+func (p *Processor) downloadIfOlderThan(ttl time.Duration) error {
+	_, err := p.refreshData(ttl)
+	return err
+}
+
+// refreshData is downloadIfOlderThan, also reporting whether data was
+// downloaded. The download is skipped if the upstream file is unchanged since
+// the cached copy, by its Last-Modified time or with HeadSizeCheck by its size,
+// and the cached data counts as freshly loaded.
+func (p *Processor) refreshData(ttl time.Duration) (bool, error) {
 	p.mutex.Lock()
 	defer p.mutex.Unlock()
 
 	// Check cache again after obtaining write lock
-	if time.Since(p.cacheTime) < p.cacheTTL {
-		return nil
+	if time.Since(p.loadedAt()) < ttl {
+		return false, nil
+	}
+
+	if p.breaker == nil {
+		p.breaker = newCircuitBreaker(p.config.BreakerThreshold, p.config.BreakerCooldown)
+	}
+	if !p.breaker.allow() {
+		return false, ErrCircuitOpen
 	}
 
-	log.Println("Downloading IP data from RIPE NCC...")
+	if p.upstreamUnchanged() {
+		p.renewCache()
+		return false, nil
+	}
+
+	source, fetch, dataSource := ripeURL, p.fetchData, DataSourceLive
+	if p.config.UpstreamPeer != "" {
+		// Replicas load the dataset parsed by their peer instead of hitting RIPE NCC
+		source, fetch, dataSource = p.config.UpstreamPeer, p.fetchPeer, DataSourcePeer
+		log.Printf("Downloading IP data from peer %s...\n", source)
+	} else {
+		log.Println("Downloading IP data from RIPE NCC...")
+	}
+
+	// Nothing below replaces the cached data or its load time until a download
+	// has been parsed successfully. On failure the previous data stays in
+	// place and is still stale, so the next request retries, and the breaker
+	// counts the failure.
+	data, err := fetch(source)
+	if err != nil {
+		if p.config.FallbackDataURL == "" {
+			slog.Error("IP data download failed", "source", source, "error", err)
+			p.breaker.recordFailure()
+			return false, err
+		}
 
+		slog.Error("Primary data download failed, trying fallback", "fallback", p.config.FallbackDataURL, "error", err)
+		fallbackData, fallbackErr := p.fetchData(p.config.FallbackDataURL)
+		if fallbackErr != nil {
+			slog.Error("Fallback data download failed", "source", p.config.FallbackDataURL, "error", fallbackErr)
+			p.breaker.recordFailure()
+			return false, fmt.Errorf("%w; fallback download failed: %w", err, fallbackErr)
+		}
+		// The mirror's Last-Modified says nothing about the primary file
+		fallbackData.lastModified = time.Time{}
+		source, data, dataSource = p.config.FallbackDataURL, fallbackData, DataSourceLive
+	}
+	p.breaker.recordSuccess()
+
+	p.applyCustomCIDRs(data)
+	p.trackReassignments(data.cache)
+
+	// Update cache
+	loadedAt := time.Now()
+	p.applyParsed(data, loadedAt, dataSource)
+	p.fileSize = 0
+	if source == ripeURL {
+		p.fileSize = data.size
+	}
+	if p.lastSeen == nil {
+		p.lastSeen = make(map[string]time.Time)
+	}
+	for country := range data.cache {
+		p.lastSeen[country] = loadedAt
+	}
+
+	log.Printf("IP data processed from %s. Found data for %d countries, skipped lines: %s\n",
+		source, len(data.cache), p.skipped)
+
+	if p.config.RefreshWebhookURL != "" {
+		go notifyRefresh(p.config.RefreshWebhookURL, newRefreshSummary(data.cache, loadedAt, dataSource))
+	}
+	p.runRefreshHooks()
+	return true, nil
+}
+
+// runRefreshHooks starts the OnRefresh callbacks. The caller must hold the mutex.
+func (p *Processor) runRefreshHooks() {
+	for _, fn := range p.onRefresh {
+		go fn()
+	}
+}
+
+// applyParsed replaces the cached data and every lookup table with the ones
+// parsed into data. Every load path goes through it, so a table added to
+// parsedData cannot be left stale by one of them. The caller must hold the mutex.
+func (p *Processor) applyParsed(data *parsedData, loadedAt time.Time, dataSource string) {
+	p.cache.Set(data.cache, loadedAt)
+	p.provenance = data.provenance
+	p.registries = data.registries
+	p.statuses = data.statuses
+	p.addresses = data.addresses
+	p.lookup = data.lookup
+	p.asns = data.asns
+	p.ipv6 = data.ipv6
+	p.skipped = data.skipped
+	p.diagnostics = data.diagnostics
+	p.served.Store(&servedData{entries: data.cache, source: dataSource, loadedAt: loadedAt})
+	p.modifiedAt = data.lastModified
+}
+
+// fetchData downloads delegated-stats data from url and parses it
+func (p *Processor) fetchData(url string) (*parsedData, error) {
 	// Create context with timeout for the HTTP request
 	ctx, cancel := context.WithTimeout(context.Background(), downloadTimeout)
 	defer cancel()
 
 	// Create HTTP request with context
-	req, err := http.NewRequestWithContext(ctx, http.MethodGet, ripeURL, nil)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
 	if err != nil {
-		return fmt.Errorf("failed to create request: %w", err)
+		return nil, fmt.Errorf("failed to create request: %w", redactURLError(err))
 	}
 
 	// Perform the request
-	resp, err := p.httpClient.Do(req)
+	resp, err := p.doRequest(req)
 	if err != nil {
-		return fmt.Errorf("failed to download data: %w", err)
+		return nil, fmt.Errorf("%w: failed to download data: %w", ErrDownloadFailed, err)
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("received non-200 response: %d", resp.StatusCode)
+		return nil, &UpstreamStatusError{StatusCode: resp.StatusCode}
 	}
 
-	// Process the data
-	ipDataByCountry := make(map[string][]IPData)
-	scanner := bufio.NewScanner(resp.Body)
+	var body io.Reader = resp.Body
+	if p.config.MaxDownloadBytes > 0 {
+		body = limitBody(resp.Body, p.config.MaxDownloadBytes)
+	}
+	// Archived files are bzip2 compressed
+	if strings.HasSuffix(url, ".bz2") {
+		body = bzip2.NewReader(body)
+	}
 
-	for scanner.Scan() {
-		line := scanner.Text()
+	data, err := p.parseData(body)
+	if err != nil {
+		return nil, err
+	}
+	if modified, err := http.ParseTime(resp.Header.Get("Last-Modified")); err == nil {
+		data.lastModified = modified
+	}
+	data.size = resp.ContentLength
+	return data, nil
+}
 
-		// Skip comments and empty lines
-		if strings.HasPrefix(line, "#") || strings.TrimSpace(line) == "" {
-			continue
-		}
+// isVersionHeader reports whether the fields form the RIR statistics exchange
+// version line (e.g. "2|ripencc|20220101|...", "2.3|ripencc|...")
+func isVersionHeader(parts []string) bool {
+	_, err := strconv.ParseFloat(parts[0], 64)
+	return err == nil
+}
 
-		parts := strings.Split(line, "|")
-		if len(parts) < 6 {
-			continue
-		}
+// isSummaryRecord reports whether the fields form a per-type summary line
+// (e.g. "ripencc|*|ipv4|*|12345|summary")
+func isSummaryRecord(parts []string) bool {
+	if len(parts) > 5 && parts[5] == "summary" {
+		return true
+	}
+	return len(parts) > 1 && parts[1] == "*"
+}
 
-		// We're only interested in IPv4 records
-		if parts[0] == "ripencc" && parts[2] == "ipv4" {
-			country := strings.ToUpper(parts[1])
-			ipStart := parts[3]
-			countStr := parts[4]
+// parsedData holds the lookup tables built from delegated-stats records
+type parsedData struct {
+	cache      map[string][]string
+	provenance map[string]map[string]int
+	registries map[string]map[string][]string
+	statuses   map[string]map[string][]string
+	addresses  map[string]uint64
+	lookup     *lookupIndex
+	asns       map[string][]uint32
+	ipv6       map[string][]string
+	skipped    SkipStats
+
+	// diagnostics tallies the parsed lines, empty for data loaded from a peer
+	diagnostics ParseDiagnostics
+
+	// lastModified is the Last-Modified time of the downloaded file, zero if unknown
+	lastModified time.Time
+	// size is the Content-Length of the downloaded file, -1 if unknown
+	size int64
+}
 
-			count, err := strconv.Atoi(countStr)
-			if err != nil {
-				continue
-			}
+// ParseDelegatedStats parses RIPE NCC delegated-stats data (the format served at
+// ftp.ripe.net/ripe/stats) and returns the allocated and assigned IPv4 CIDR
+// blocks of each country. Comments, blank lines, the version header, summary
+// records and records of other registries or address families are skipped; block start addresses are
+// aligned to their network boundary and duplicate blocks are removed. It
+// returns an error wrapping ErrBadUpstreamData if no IPv4 allocation records
+// are found.
+func ParseDelegatedStats(r io.Reader) (map[string][]string, error) {
+	cache, _, err := ParseDelegatedStatsWithDiagnostics(r)
+	return cache, err
+}
 
-			// Calculate CIDR mask from IP count
-			mask := 32 - int(math.Log2(float64(count)))
+// parseData reads delegated-stats records and builds the lookup tables
+// according to the processor configuration
+func (p *Processor) parseData(r io.Reader) (*parsedData, error) {
+	return parseDelegatedStats(r, p.config)
+}
 
-			ipDataByCountry[country] = append(ipDataByCountry[country], IPData{
-				Country:  country,
-				IPStart:  ipStart,
-				Count:    count,
-				CIDRMask: mask,
-			})
+// parseDelegatedStats reads delegated-stats records and builds the lookup tables.
+// With more than one ParseWorkers the lines are parsed by a worker pool.
+func parseDelegatedStats(r io.Reader, cfg *config.Config) (*parsedData, error) {
+	var tables *recordTables
+	var err error
+	if cfg.ParseWorkers > 1 {
+		tables, err = parseRecordsParallel(r, cfg.StrictParse, cfg.ParseWorkers)
+	} else {
+		tables, err = parseRecords(r, cfg.StrictParse)
+	}
+	if err != nil {
+		if errors.Is(err, ErrBadUpstreamData) {
+			return nil, &parseError{fmt.Errorf("error reading response: %w", err)}
 		}
+		return nil, &parseError{fmt.Errorf("%w: error reading response: %w", ErrDownloadFailed, err)}
 	}
 
-	if err := scanner.Err(); err != nil {
-		return fmt.Errorf("error reading response: %w", err)
+	if tables.mismatches > 0 {
+		log.Printf("Found %d allocation records whose CIDR mask does not match the address count\n", tables.mismatches)
+	}
+
+	ipDataByCountry := tables.ipData
+	asnsByCountry := tables.asns
+
+	if len(ipDataByCountry) == 0 {
+		return nil, &parseError{fmt.Errorf("%w: no IPv4 allocation records found", ErrBadUpstreamData)}
 	}
 
 	// Convert to CIDR notation and update cache
 	newCache := make(map[string][]string)
+	newProvenance := make(map[string]map[string]int)
+	newRegistries := make(map[string]map[string][]string)
+	newStatuses := make(map[string]map[string][]string)
+	newAddresses := make(map[string]uint64)
 	for country, ipDataList := range ipDataByCountry {
-		cidrList := make([]string, 0, len(ipDataList))
-		for _, ipData := range ipDataList {
-			cidr := fmt.Sprintf("%s/%d", ipData.IPStart, ipData.CIDRMask)
-			cidrList = append(cidrList, cidr)
+		ipDataList = dedupeIPData(ipDataList)
+		if cfg.ExcludeSpecial {
+			ipDataList = filterSpecialUse(ipDataList)
 		}
-		newCache[country] = cidrList
+		cidrs := buildCIDRs(ipDataList)
+		newCache[country] = cidrs
+		newProvenance[country] = countByRegistry(ipDataList)
+		newRegistries[country] = groupByRegistry(ipDataList, cidrs)
+		newStatuses[country] = groupByStatus(ipDataList, cidrs)
+		newAddresses[country] = sumAddresses(ipDataList)
 	}
 
-	// Update cache
-	p.cache = newCache
-	p.cacheTime = time.Now()
+	// Blocks of the other statuses are only kept in the status groups
+	for status, byCountry := range tables.statuses {
+		for country, ipDataList := range byCountry {
+			ipDataList = dedupeIPData(ipDataList)
+			if cfg.ExcludeSpecial {
+				ipDataList = filterSpecialUse(ipDataList)
+			}
+			if newStatuses[country] == nil {
+				newStatuses[country] = make(map[string][]string)
+			}
+			newStatuses[country][status] = buildCIDRs(ipDataList)
+		}
+	}
 
-	log.Printf("IP data processed. Found data for %d countries\n", len(p.cache))
-	return nil
+	for country, asns := range asnsByCountry {
+		asnsByCountry[country] = sortedUniqueASNs(asns)
+	}
+
+	ipv6ByCountry := make(map[string][]string, len(tables.ipv6))
+	for country, prefixes := range tables.ipv6 {
+		ipv6ByCountry[country] = prefixStrings(sortedUniquePrefixes(prefixes))
+	}
+
+	return &parsedData{
+		cache:      newCache,
+		provenance: newProvenance,
+		registries: newRegistries,
+		statuses:   newStatuses,
+		addresses:  newAddresses,
+		lookup:     newLookupIndex(newCache, tables.ipv6),
+		asns:       asnsByCountry,
+		ipv6:       ipv6ByCountry,
+		skipped:    tables.skipped,
+
+		diagnostics: tables.diagnostics(),
+	}, nil
 }
 
 // ValidateIPCIDR ensures the IP/CIDR is valid
@@ -3,13 +3,17 @@ package ipdata
 import (
 	"bytes"
 	"errors"
+	"fmt"
 	"io"
+	"log"
 	"math"
 	"net/http"
 	"os"
 	"reflect"
+	"slices"
 	"strconv"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 
@@ -57,8 +61,7 @@ func createTestProcessor() *Processor {
 	}
 
 	return &Processor{
-		cache:      make(map[string][]string),
-		cacheTime:  time.Time{},
+		cache:      NewMemoryCache(),
 		config:     cfg,
 		cacheTTL:   1 * time.Hour,
 		httpClient: &MockHTTPClient{ShouldError: true, ErrorMsg: "mock download error"},
@@ -74,10 +77,9 @@ func createTestProcessorWithMockData(responseBody string) *Processor {
 	}
 
 	return &Processor{
-		cache:     make(map[string][]string),
-		cacheTime: time.Time{},
-		config:    cfg,
-		cacheTTL:  1 * time.Hour,
+		cache:    NewMemoryCache(),
+		config:   cfg,
+		cacheTTL: 1 * time.Hour,
 		httpClient: &MockHTTPClient{
 			ShouldError:  false,
 			ResponseBody: responseBody,
@@ -146,8 +148,7 @@ func (errReadCloser) Close() error               { return nil }
 
 func TestDownloadAndProcessData_CacheShortCircuit(t *testing.T) {
 	processor := &Processor{
-		cache:      map[string][]string{"US": {"1.1.1.0/24"}},
-		cacheTime:  time.Now(),
+		cache:      newTestCache(map[string][]string{"US": {"1.1.1.0/24"}}, time.Now()),
 		cacheTTL:   1 * time.Hour,
 		httpClient: &MockHTTPClient{ResponseBody: "should not be used"},
 		config:     &config.Config{CacheDuration: "1h"},
@@ -170,8 +171,7 @@ func TestDownloadAndProcessData_RequestCreateError(t *testing.T) {
 	ripeURL = "http://[::1" // invalid URL
 
 	processor := &Processor{
-		cache:      make(map[string][]string),
-		cacheTime:  time.Time{},
+		cache:      NewMemoryCache(),
 		cacheTTL:   0,
 		httpClient: &MockHTTPClient{ResponseBody: ""},
 		config:     &config.Config{CacheDuration: "1h"},
@@ -188,9 +188,8 @@ func TestDownloadAndProcessData_RequestCreateError(t *testing.T) {
 
 func TestDownloadAndProcessData_HTTPClientError(t *testing.T) {
 	processor := &Processor{
-		cache:     make(map[string][]string),
-		cacheTime: time.Time{},
-		cacheTTL:  0,
+		cache:    NewMemoryCache(),
+		cacheTTL: 0,
 		httpClient: &MockHTTPClient{
 			ShouldError: true,
 			ErrorMsg:    "boom",
@@ -205,13 +204,15 @@ func TestDownloadAndProcessData_HTTPClientError(t *testing.T) {
 	if !strings.Contains(err.Error(), "failed to download data") {
 		t.Fatalf("unexpected error: %v", err)
 	}
+	if !errors.Is(err, ErrDownloadFailed) {
+		t.Fatalf("expected ErrDownloadFailed, got %v", err)
+	}
 }
 
 func TestDownloadAndProcessData_Non200Response(t *testing.T) {
 	processor := &Processor{
-		cache:     make(map[string][]string),
-		cacheTime: time.Time{},
-		cacheTTL:  0,
+		cache:    NewMemoryCache(),
+		cacheTTL: 0,
 		httpClient: &MockHTTPClient{
 			StatusCode:   http.StatusInternalServerError,
 			ResponseBody: "",
@@ -226,13 +227,19 @@ func TestDownloadAndProcessData_Non200Response(t *testing.T) {
 	if !strings.Contains(err.Error(), "received non-200 response") {
 		t.Fatalf("unexpected error: %v", err)
 	}
+	var statusErr *UpstreamStatusError
+	if !errors.As(err, &statusErr) || statusErr.StatusCode != http.StatusInternalServerError {
+		t.Fatalf("expected UpstreamStatusError with status 500, got %v", err)
+	}
+	if !errors.Is(err, ErrDownloadFailed) {
+		t.Fatalf("expected ErrDownloadFailed, got %v", err)
+	}
 }
 
 func TestDownloadAndProcessData_ScannerError(t *testing.T) {
 	processor := &Processor{
-		cache:     make(map[string][]string),
-		cacheTime: time.Time{},
-		cacheTTL:  0,
+		cache:    NewMemoryCache(),
+		cacheTTL: 0,
 		httpClient: &MockHTTPClient{
 			StatusCode: http.StatusOK,
 			Body:       errReadCloser{},
@@ -247,6 +254,29 @@ func TestDownloadAndProcessData_ScannerError(t *testing.T) {
 	if !strings.Contains(err.Error(), "error reading response") {
 		t.Fatalf("unexpected error: %v", err)
 	}
+	if !errors.Is(err, ErrDownloadFailed) {
+		t.Fatalf("expected ErrDownloadFailed, got %v", err)
+	}
+}
+
+func TestDownloadAndProcessData_NoRecordsIsBadData(t *testing.T) {
+	processor := &Processor{
+		cache:    NewMemoryCache(),
+		cacheTTL: 0,
+		httpClient: &MockHTTPClient{
+			StatusCode:   http.StatusOK,
+			ResponseBody: "<html>maintenance</html>",
+		},
+		config: &config.Config{CacheDuration: "1h"},
+	}
+
+	err := processor.downloadAndProcessData()
+	if !errors.Is(err, ErrBadUpstreamData) {
+		t.Fatalf("expected ErrBadUpstreamData, got %v", err)
+	}
+	if !processor.loadedAt().IsZero() {
+		t.Fatal("expected cache not to be updated")
+	}
 }
 
 func TestDownloadAndProcessData_SuccessParsesAndCaches(t *testing.T) {
@@ -262,9 +292,8 @@ func TestDownloadAndProcessData_SuccessParsesAndCaches(t *testing.T) {
 	}, "\n")
 
 	processor := &Processor{
-		cache:     make(map[string][]string),
-		cacheTime: time.Time{},
-		cacheTTL:  0,
+		cache:    NewMemoryCache(),
+		cacheTTL: 0,
 		httpClient: &MockHTTPClient{
 			StatusCode:   http.StatusOK,
 			ResponseBody: data,
@@ -277,13 +306,13 @@ func TestDownloadAndProcessData_SuccessParsesAndCaches(t *testing.T) {
 		t.Fatalf("unexpected error: %v", err)
 	}
 
-	if len(processor.cache) == 0 {
+	if len(cachedEntries(processor)) == 0 {
 		t.Fatalf("expected cache to be populated")
 	}
-	if got := processor.cache["US"]; !reflect.DeepEqual(got, []string{"192.168.0.0/24"}) {
+	if got := cachedEntries(processor)["US"]; !reflect.DeepEqual(got, []string{"192.168.0.0/24"}) {
 		t.Fatalf("US cache = %#v, want %#v", got, []string{"192.168.0.0/24"})
 	}
-	if got := processor.cache["DE"]; !reflect.DeepEqual(got, []string{"10.0.0.0/16"}) {
+	if got := cachedEntries(processor)["DE"]; !reflect.DeepEqual(got, []string{"10.0.0.0/16"}) {
 		t.Fatalf("DE cache = %#v, want %#v", got, []string{"10.0.0.0/16"})
 	}
 }
@@ -352,8 +381,8 @@ func TestGetIPListForCountry(t *testing.T) {
 
 	// Add test data to cache and set cache time to now (valid cache)
 	testIPList := []string{"192.168.1.0/24", "10.0.0.0/8"}
-	processor.cache["US"] = testIPList
-	processor.cacheTime = time.Now() // Set cache time to now so cache is valid
+	cachedEntries(processor)["US"] = testIPList
+	setCacheTime(processor, time.Now()) // Set cache time to now so cache is valid
 
 	// Test getting data from cache
 	result, err := processor.GetIPListForCountry("US")
@@ -377,13 +406,13 @@ func TestGetIPListForCountry(t *testing.T) {
 
 	// Test cache expiration
 	// Set cache time to the past so it's expired
-	processor.cacheTime = time.Now().Add(-1 * time.Hour)
+	setCacheTime(processor, time.Now().Add(-1*time.Hour))
 
 	// This test is a bit tricky because we'd need to mock the HTTP call
 	// For now, we'll just verify that a downloadAndProcessData call is attempted
 	// by creating a processor with a non-existent URL to cause a download error
 	processor = createTestProcessor()
-	processor.cacheTime = time.Now().Add(-1 * time.Hour) // Set an old cache time
+	setCacheTime(processor, time.Now().Add(-1*time.Hour)) // Set an old cache time
 
 	// Test error case when download fails
 	// We're expecting an error here since we can't download from a real URL in the test
@@ -396,7 +425,7 @@ func TestGetIPListForCountry(t *testing.T) {
 	}
 }
 
-func TestParseIPList(t *testing.T) {
+func TestParseDelegatedStats(t *testing.T) {
 	// Sample RIPE data format for testing
 	sampleData := `#2.0|ripencc|20220101|123456|+0100
 ripencc|US|ipv4|192.168.0.0|256|20220101|allocated
@@ -405,96 +434,91 @@ ripencc|DE|ipv4|10.0.0.0|65536|20220101|allocated
 ripencc|FR|ipv6|2001:db8::|1|20220101|allocated
 apnic|CN|ipv4|172.16.0.0|4096|20220101|allocated`
 
-	// Parse the data
-	ipDataByCountry, err := parseIPList([]byte(sampleData))
+	ipListByCountry, err := ParseDelegatedStats(strings.NewReader(sampleData))
 	if err != nil {
-		t.Errorf("Unexpected error: %v", err)
-	}
-
-	// Verify the results
-	if len(ipDataByCountry) != 2 {
-		t.Errorf("Expected 2 countries (US, DE), got %d", len(ipDataByCountry))
-	}
-
-	// Check the US data
-	usData := ipDataByCountry["US"]
-	if len(usData) != 1 {
-		t.Errorf("Expected 1 IP range for US, got %d", len(usData))
-	}
-	if usData[0].IPStart != "192.168.0.0" {
-		t.Errorf("Expected IP 192.168.0.0, got %s", usData[0].IPStart)
-	}
-	if usData[0].Count != 256 {
-		t.Errorf("Expected count 256, got %d", usData[0].Count)
-	}
-	if usData[0].CIDRMask != 24 {
-		t.Errorf("Expected CIDR mask 24, got %d", usData[0].CIDRMask)
-	}
-
-	// Check the DE data
-	deData := ipDataByCountry["DE"]
-	if len(deData) != 1 {
-		t.Errorf("Expected 1 IP range for DE, got %d", len(deData))
-	}
-	if deData[0].IPStart != "10.0.0.0" {
-		t.Errorf("Expected IP 10.0.0.0, got %s", deData[0].IPStart)
-	}
-	if deData[0].Count != 65536 {
-		t.Errorf("Expected count 65536, got %d", deData[0].Count)
-	}
-	if deData[0].CIDRMask != 16 {
-		t.Errorf("Expected CIDR mask 16, got %d", deData[0].CIDRMask)
+		t.Fatalf("Unexpected error: %v", err)
 	}
 
-	// Verify that we didn't parse IPv6 or data from other registries
-	if _, ok := ipDataByCountry["FR"]; ok {
-		t.Error("Should not have parsed IPv6 data for FR")
+	// IPv6 and other registries are not parsed
+	expected := map[string][]string{
+		"US": {"192.168.0.0/24"},
+		"DE": {"10.0.0.0/16"},
 	}
-	if _, ok := ipDataByCountry["CN"]; ok {
-		t.Error("Should not have parsed data from APNIC for CN")
+	if !reflect.DeepEqual(ipListByCountry, expected) {
+		t.Errorf("ParseDelegatedStats() = %v, want %v", ipListByCountry, expected)
 	}
 }
 
-// Helper function to parse IP list data - simplified version of the processor's code
-func parseIPList(data []byte) (map[string][]IPData, error) {
-	ipDataByCountry := make(map[string][]IPData)
-	lines := string(data)
-
-	for _, line := range strings.Split(lines, "\n") {
-		// Skip comments and empty lines
-		if strings.HasPrefix(line, "#") || strings.TrimSpace(line) == "" {
-			continue
-		}
-
-		parts := strings.Split(line, "|")
-		if len(parts) < 6 {
-			continue
-		}
-
-		// We're only interested in IPv4 records from RIPE NCC
-		if parts[0] == "ripencc" && parts[2] == "ipv4" {
-			country := strings.ToUpper(parts[1])
-			ipStart := parts[3]
-			countStr := parts[4]
+func TestParseDelegatedStats_EdgeCases(t *testing.T) {
+	testCases := []struct {
+		name     string
+		lines    []string
+		expected map[string][]string
+	}{
+		{
+			name: "Version header and summary records",
+			lines: []string{
+				"2|ripencc|20220101|3|19830705|20220101|+0100",
+				"ripencc|*|ipv4|*|1|summary",
+				"ripencc|DE|ipv4|2.0.0.0|1048576|20220101|allocated",
+			},
+			expected: map[string][]string{"DE": {"2.0.0.0/12"}},
+		},
+		{
+			name: "Byte order mark, whitespace and CRLF",
+			lines: []string{
+				"\ufeffripencc|DE|ipv4|2.0.0.0|1048576|20220101|allocated\r",
+				"  ripencc | nl | ipv4 | 31.0.0.0 | 256 | 20220101 | assigned  ",
+			},
+			expected: map[string][]string{"DE": {"2.0.0.0/12"}, "NL": {"31.0.0.0/24"}},
+		},
+		{
+			name: "Unaligned start address and duplicates",
+			lines: []string{
+				"ripencc|DE|ipv4|2.0.0.5|256|20220101|allocated",
+				"ripencc|DE|ipv4|2.0.0.0|256|20220101|allocated",
+			},
+			expected: map[string][]string{"DE": {"2.0.0.0/24"}},
+		},
+		{
+			name: "Malformed records are skipped",
+			lines: []string{
+				"ripencc|DE|ipv4",
+				"ripencc|DE|ipv4|2.0.0.0|many|20220101|allocated",
+				"ripencc|DE|ipv4|2.0.0.0|0|20220101|allocated",
+				"ripencc|DE|ipv4|not-an-ip|256|20220101|allocated",
+				"ripencc|DE|ipv4|5.0.0.0|65536|20220101|allocated",
+			},
+			expected: map[string][]string{"DE": {"5.0.0.0/16"}},
+		},
+		{
+			name: "AS number records are not returned",
+			lines: []string{
+				"ripencc|DE|asn|3320|1|19930901|allocated",
+				"ripencc|DE|ipv4|2.0.0.0|1048576|20220101|allocated",
+			},
+			expected: map[string][]string{"DE": {"2.0.0.0/12"}},
+		},
+	}
 
-			count, err := strconv.Atoi(countStr)
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := ParseDelegatedStats(strings.NewReader(strings.Join(tc.lines, "\n")))
 			if err != nil {
-				continue
+				t.Fatalf("unexpected error: %v", err)
 			}
-
-			// Calculate CIDR mask from IP count
-			mask := 32 - int(math.Log2(float64(count)))
-
-			ipDataByCountry[country] = append(ipDataByCountry[country], IPData{
-				Country:  country,
-				IPStart:  ipStart,
-				Count:    count,
-				CIDRMask: mask,
-			})
-		}
+			if !reflect.DeepEqual(got, tc.expected) {
+				t.Errorf("ParseDelegatedStats() = %v, want %v", got, tc.expected)
+			}
+		})
 	}
+}
 
-	return ipDataByCountry, nil
+func TestParseDelegatedStats_NoRecords(t *testing.T) {
+	_, err := ParseDelegatedStats(strings.NewReader("# only a comment\napnic|CN|ipv4|1.0.1.0|256|20220101|allocated\n"))
+	if !errors.Is(err, ErrBadUpstreamData) {
+		t.Fatalf("expected ErrBadUpstreamData, got %v", err)
+	}
 }
 
 func TestGetIPListForCountryCaseInsensitive(t *testing.T) {
@@ -504,8 +528,8 @@ func TestGetIPListForCountryCaseInsensitive(t *testing.T) {
 
 	// Add test data to cache
 	testIPList := []string{"192.168.1.0/24", "10.0.0.0/8"}
-	processor.cache["US"] = testIPList
-	processor.cacheTime = time.Now()
+	cachedEntries(processor)["US"] = testIPList
+	setCacheTime(processor, time.Now())
 
 	// Test with lowercase country code
 	result, err := processor.GetIPListForCountry("us")
@@ -535,7 +559,7 @@ ripencc|DE|ipv4|192.168.0.0|256|20220101|allocated
 ripencc|DE|ipv4|10.0.0.0|65536|20220101|allocated`
 
 	processor := createTestProcessorWithMockData(mockData)
-	processor.cacheTime = time.Time{} // Ensure cache is expired
+	setCacheTime(processor, time.Time{}) // Ensure cache is expired
 
 	// Get data for DE
 	result, err := processor.GetIPListForCountry("DE")
@@ -565,7 +589,7 @@ ripencc|DE|ipv4|10.0.0.0|65536|20220101|allocated`
 
 func TestGetIPListForCountryHTTPError(t *testing.T) {
 	processor := createTestProcessor()
-	processor.cacheTime = time.Time{} // Ensure cache is expired
+	setCacheTime(processor, time.Time{}) // Ensure cache is expired
 
 	// Try to get data - should fail because of mock error
 	_, err := processor.GetIPListForCountry("US")
@@ -586,10 +610,9 @@ func TestGetIPListForCountryNon200Response(t *testing.T) {
 	}
 
 	processor := &Processor{
-		cache:     make(map[string][]string),
-		cacheTime: time.Time{},
-		config:    cfg,
-		cacheTTL:  1 * time.Hour,
+		cache:    NewMemoryCache(),
+		config:   cfg,
+		cacheTTL: 1 * time.Hour,
 		httpClient: &MockHTTPClient{
 			ShouldError:  false,
 			ResponseBody: "Not Found",
@@ -614,8 +637,8 @@ func TestCacheBehavior(t *testing.T) {
 
 	// Add data to cache
 	testIPList := []string{"192.168.1.0/24"}
-	processor.cache["US"] = testIPList
-	processor.cacheTime = time.Now()
+	cachedEntries(processor)["US"] = testIPList
+	setCacheTime(processor, time.Now())
 
 	// Should get data from cache
 	result, err := processor.GetIPListForCountry("US")
@@ -696,3 +719,1031 @@ func TestProcessorImplementsInterface(t *testing.T) {
 	// This test ensures Processor implements IPProcessor interface
 	var _ IPProcessor = (*Processor)(nil)
 }
+
+func TestGetProvenanceForCountry_MixedRegistries(t *testing.T) {
+	data := strings.Join([]string{
+		"2|ripencc|20220101|5|19830705|20220101|+0100",
+		"ripencc|DE|ipv4|2.0.0.0|1048576|20220101|allocated",
+		"ripencc|DE|ipv4|5.0.0.0|65536|20220101|allocated",
+		"ripencc|US|ipv4|31.0.0.0|256|20220101|allocated",
+		"arin|US|ipv4|3.0.0.0|16777216|20220101|allocated",
+		"apnic|CN|ipv4|1.0.1.0|256|20220101|allocated",
+	}, "\n")
+
+	processor := createTestProcessorWithMockData(data)
+
+	de, err := processor.GetProvenanceForCountry("de")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if want := map[string]int{"ripencc": 2}; !reflect.DeepEqual(de, want) {
+		t.Errorf("DE provenance = %v, want %v", de, want)
+	}
+
+	// Only the RIPE NCC row is served for US, so only it may be attributed
+	us, err := processor.GetProvenanceForCountry("US")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if want := map[string]int{"ripencc": 1}; !reflect.DeepEqual(us, want) {
+		t.Errorf("US provenance = %v, want %v", us, want)
+	}
+
+	cn, err := processor.GetProvenanceForCountry("CN")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(cn) != 0 {
+		t.Errorf("CN provenance = %v, want empty", cn)
+	}
+
+	mc := processor.httpClient.(*MockHTTPClient)
+	if mc.CallCount != 1 {
+		t.Errorf("expected a single download, CallCount=%d", mc.CallCount)
+	}
+}
+
+func TestGetProvenanceForCountry_DownloadError(t *testing.T) {
+	processor := createTestProcessor()
+
+	_, err := processor.GetProvenanceForCountry("US")
+	if !errors.Is(err, ErrDownloadFailed) {
+		t.Fatalf("expected ErrDownloadFailed, got %v", err)
+	}
+}
+
+func TestCountries(t *testing.T) {
+	data := strings.Join([]string{
+		"ripencc|NL|ipv4|31.0.0.0|256|20220101|allocated",
+		"ripencc|DE|ipv4|2.0.0.0|1048576|20220101|allocated",
+		"ripencc|FR|ipv4|5.0.0.0|65536|20220101|allocated",
+		"ripencc|DE|ipv4|6.0.0.0|256|20220101|allocated",
+	}, "\n")
+
+	processor := createTestProcessorWithMockData(data)
+
+	countries, err := processor.Countries()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if want := []string{"DE", "FR", "NL"}; !reflect.DeepEqual(countries, want) {
+		t.Errorf("Countries() = %v, want %v", countries, want)
+	}
+}
+
+func TestDataTime(t *testing.T) {
+	processor := createTestProcessorWithMockData("ripencc|DE|ipv4|2.0.0.0|1048576|20220101|allocated")
+	if got := processor.DataTime(); !got.IsZero() {
+		t.Fatalf("DataTime() = %v, want zero before any download", got)
+	}
+
+	before := time.Now()
+	if err := processor.downloadAndProcessData(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := processor.DataTime(); got.Before(before) || !got.Equal(processor.loadedAt()) {
+		t.Errorf("DataTime() = %v, want cache time %v", got, processor.loadedAt())
+	}
+}
+
+func TestRefreshIfOlderThan(t *testing.T) {
+	data := "ripencc|DE|ipv4|2.0.0.0|1048576|20220101|allocated"
+
+	t.Run("Fresh enough", func(t *testing.T) {
+		processor := createTestProcessorWithMockData(data)
+		setCacheTime(processor, time.Now().Add(-10*time.Minute))
+
+		if err := processor.RefreshIfOlderThan(time.Hour); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if mc := processor.httpClient.(*MockHTTPClient); mc.CallCount != 0 {
+			t.Errorf("expected no download, CallCount=%d", mc.CallCount)
+		}
+	})
+
+	t.Run("Older than max age", func(t *testing.T) {
+		processor := createTestProcessorWithMockData(data)
+		setCacheTime(processor, time.Now().Add(-10*time.Minute))
+
+		if err := processor.RefreshIfOlderThan(5 * time.Minute); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if mc := processor.httpClient.(*MockHTTPClient); mc.CallCount != 1 {
+			t.Errorf("expected a download, CallCount=%d", mc.CallCount)
+		}
+		if time.Since(processor.DataTime()) > time.Minute {
+			t.Errorf("expected data to be refreshed, DataTime()=%v", processor.DataTime())
+		}
+	})
+
+	t.Run("Max age below the minimum cache duration", func(t *testing.T) {
+		processor := createTestProcessorWithMockData(data)
+		processor.minTTL = 5 * time.Minute
+		setCacheTime(processor, time.Now().Add(-time.Minute))
+
+		if err := processor.RefreshIfOlderThan(time.Nanosecond); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if mc := processor.httpClient.(*MockHTTPClient); mc.CallCount != 0 {
+			t.Errorf("expected no download within the minimum cache duration, CallCount=%d", mc.CallCount)
+		}
+	})
+
+	t.Run("Failure reported while serving embedded data", func(t *testing.T) {
+		processor := createTestProcessor()
+		processor.served.Store(&servedData{source: DataSourceEmbedded})
+
+		err := processor.RefreshIfOlderThan(5 * time.Minute)
+		if !errors.Is(err, ErrDownloadFailed) {
+			t.Fatalf("expected ErrDownloadFailed, got %v", err)
+		}
+	})
+}
+
+func TestSnapshot(t *testing.T) {
+	processor := createTestProcessorWithMockData("")
+	loadedAt := time.Now().Add(-time.Minute)
+	processor.cache.Set(map[string][]string{
+		"DE": {"2.0.0.0/12"},
+		"FR": {"5.0.0.0/16", "6.0.0.0/24"},
+	}, loadedAt)
+
+	snapshot, at := processor.Snapshot()
+	if !at.Equal(loadedAt) {
+		t.Errorf("snapshot time = %v, want %v", at, loadedAt)
+	}
+	if !reflect.DeepEqual(snapshot, cachedEntries(processor)) {
+		t.Fatalf("snapshot = %v, want %v", snapshot, cachedEntries(processor))
+	}
+
+	// Mutating the snapshot must not affect the cache
+	snapshot["FR"][0] = "mutated"
+	snapshot["NL"] = []string{"31.0.0.0/24"}
+	if cachedEntries(processor)["FR"][0] != "5.0.0.0/16" {
+		t.Errorf("cache was mutated through the snapshot: %v", cachedEntries(processor)["FR"])
+	}
+	if _, ok := cachedEntries(processor)["NL"]; ok {
+		t.Error("cache gained a country through the snapshot")
+	}
+
+	if mc := processor.httpClient.(*MockHTTPClient); mc.CallCount != 0 {
+		t.Errorf("expected Snapshot not to download, CallCount=%d", mc.CallCount)
+	}
+}
+
+func TestSnapshot_ConsistentDuringRefresh(t *testing.T) {
+	data := strings.Join([]string{
+		"ripencc|DE|ipv4|2.0.0.0|1048576|20220101|allocated",
+		"ripencc|FR|ipv4|5.0.0.0|65536|20220101|allocated",
+	}, "\n")
+	processor := createTestProcessorWithMockData(data)
+	if err := processor.downloadAndProcessData(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	origOutput := log.Writer()
+	log.SetOutput(io.Discard)
+	t.Cleanup(func() { log.SetOutput(origOutput) })
+
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for {
+			select {
+			case <-done:
+				return
+			default:
+			}
+			processor.mutex.Lock()
+			setCacheTime(processor, time.Time{})
+			processor.mutex.Unlock()
+			if err := processor.downloadAndProcessData(); err != nil {
+				t.Errorf("refresh failed: %v", err)
+				return
+			}
+		}
+	}()
+
+	for range 200 {
+		snapshot, at := processor.Snapshot()
+		if at.IsZero() {
+			// Caught between invalidation and refresh; the data is still the previous load
+			continue
+		}
+		if len(snapshot) != 2 || len(snapshot["DE"]) != 1 || len(snapshot["FR"]) != 1 {
+			t.Fatalf("inconsistent snapshot: %v", snapshot)
+		}
+	}
+	close(done)
+	wg.Wait()
+}
+
+func TestGetAllCountries(t *testing.T) {
+	data := strings.Join([]string{
+		"ripencc|NL|ipv4|31.0.0.0|256|20220101|allocated",
+		"ripencc|DE|ipv4|2.0.0.0|1048576|20220101|allocated",
+		"ripencc|FR|ipv4|5.0.0.0|65536|20220101|allocated",
+		"ripencc|DE|ipv4|6.0.0.0|256|20220101|allocated",
+	}, "\n")
+
+	processor := createTestProcessorWithMockData(data)
+
+	all, err := processor.GetAllCountries()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := map[string][]string{
+		"DE": {"2.0.0.0/12", "6.0.0.0/24"},
+		"FR": {"5.0.0.0/16"},
+		"NL": {"31.0.0.0/24"},
+	}
+	if !reflect.DeepEqual(all, want) {
+		t.Fatalf("GetAllCountries() = %v, want %v", all, want)
+	}
+
+	// The result is a defensive copy
+	all["DE"][0] = "0.0.0.0/0"
+	delete(all, "FR")
+	all["XX"] = []string{"1.2.3.0/24"}
+
+	again, err := processor.GetAllCountries()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(again, want) {
+		t.Errorf("cache was mutated through the result: %v", again)
+	}
+
+	if mc := processor.httpClient.(*MockHTTPClient); mc.CallCount != 1 {
+		t.Errorf("expected a single download, CallCount=%d", mc.CallCount)
+	}
+}
+
+func TestGetAllCountries_DownloadError(t *testing.T) {
+	processor := createTestProcessor()
+
+	if _, err := processor.GetAllCountries(); !errors.Is(err, ErrDownloadFailed) {
+		t.Fatalf("expected ErrDownloadFailed, got %v", err)
+	}
+}
+
+func TestCountries_DownloadError(t *testing.T) {
+	processor := createTestProcessor()
+
+	if _, err := processor.Countries(); !errors.Is(err, ErrDownloadFailed) {
+		t.Fatalf("expected ErrDownloadFailed, got %v", err)
+	}
+}
+
+func TestDownloadAndProcessData_StrictParseReportsMaskMismatch(t *testing.T) {
+	data := strings.Join([]string{
+		"ripencc|DE|ipv4|2.0.0.0|256|20220101|allocated",
+		"ripencc|DE|ipv4|5.0.0.0|768|20220101|allocated",
+	}, "\n")
+
+	testCases := []struct {
+		name        string
+		strictParse bool
+		expectLog   bool
+	}{
+		{name: "Strict parse enabled", strictParse: true, expectLog: true},
+		{name: "Strict parse disabled", strictParse: false, expectLog: false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var logBuf bytes.Buffer
+			origOutput := log.Writer()
+			log.SetOutput(&logBuf)
+			t.Cleanup(func() { log.SetOutput(origOutput) })
+
+			processor := createTestProcessorWithMockData(data)
+			processor.config.StrictParse = tc.strictParse
+
+			if err := processor.downloadAndProcessData(); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			output := logBuf.String()
+			if got := strings.Contains(output, "5.0.0.0/23 covers 512 addresses, source count is 768"); got != tc.expectLog {
+				t.Errorf("mismatch logged = %v, want %v; log: %q", got, tc.expectLog, output)
+			}
+			if strings.Contains(output, "2.0.0.0/24 covers") {
+				t.Errorf("power-of-two count must not be reported; log: %q", output)
+			}
+			if got := strings.Contains(output, "Found 1 allocation records"); got != tc.expectLog {
+				t.Errorf("mismatch summary logged = %v, want %v; log: %q", got, tc.expectLog, output)
+			}
+		})
+	}
+}
+
+func TestDownloadAndProcessData_SkipsHeaderAndSummaryRecords(t *testing.T) {
+	data := strings.Join([]string{
+		"2.3|ripencc|20220101|123456|19830705|20220101|+0100",
+		"2|ripencc|20220101|5",
+		"ripencc|*|asn|*|40000|summary",
+		"ripencc|*|ipv4|*|12345|summary",
+		"ripencc|*|ipv6|*|54321|summary",
+		"ripencc|*|ipv4|*|4096",
+		"ripencc|DE|ipv4|2.0.0.0|1048576|20220101|allocated",
+	}, "\n")
+
+	processor := createTestProcessorWithMockData(data)
+	if err := processor.downloadAndProcessData(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if _, ok := cachedEntries(processor)["*"]; ok {
+		t.Fatalf("summary record produced a bogus '*' country entry: %#v", cachedEntries(processor)["*"])
+	}
+	if len(cachedEntries(processor)) != 1 {
+		t.Fatalf("expected only DE in cache, got %#v", cachedEntries(processor))
+	}
+	if got := cachedEntries(processor)["DE"]; !reflect.DeepEqual(got, []string{"2.0.0.0/12"}) {
+		t.Fatalf("DE cache = %#v, want %#v", got, []string{"2.0.0.0/12"})
+	}
+}
+
+func TestIsVersionHeaderAndSummaryRecord(t *testing.T) {
+	testCases := []struct {
+		line    string
+		header  bool
+		summary bool
+	}{
+		{line: "2.3|ripencc|20220101|123456|19830705|20220101|+0100", header: true},
+		{line: "2|apnic|20220101|5", header: true},
+		{line: "ripencc|*|ipv4|*|12345|summary", summary: true},
+		{line: "ripencc|*|ipv4", summary: true},
+		{line: "ripencc|DE|ipv4|2.0.0.0|1048576|20220101|allocated"},
+		{line: "ripencc"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.line, func(t *testing.T) {
+			parts := strings.Split(tc.line, "|")
+			if got := isVersionHeader(parts); got != tc.header {
+				t.Errorf("isVersionHeader = %v, want %v", got, tc.header)
+			}
+			if got := isSummaryRecord(parts); got != tc.summary {
+				t.Errorf("isSummaryRecord = %v, want %v", got, tc.summary)
+			}
+		})
+	}
+}
+
+// waitForRefresh waits until a background refresh started by Ready has finished
+func waitForRefresh(t *testing.T, processor *Processor) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for processor.refreshing.Load() {
+		if time.Now().After(deadline) {
+			t.Fatal("timed out waiting for background refresh")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestReady_ColdCacheStartsBackgroundRefresh(t *testing.T) {
+	processor := createTestProcessorWithMockData("ripencc|DE|ipv4|2.0.0.0|1048576|20220101|allocated")
+
+	if processor.Ready() {
+		t.Fatal("expected cold processor not to be ready")
+	}
+	waitForRefresh(t, processor)
+
+	if !processor.Ready() {
+		t.Fatal("expected processor to be ready after background refresh")
+	}
+	mc := processor.httpClient.(*MockHTTPClient)
+	if mc.CallCount != 1 {
+		t.Fatalf("expected exactly one download, CallCount=%d", mc.CallCount)
+	}
+}
+
+func TestReady_BackgroundRefreshError(t *testing.T) {
+	var logBuf bytes.Buffer
+	origOutput := log.Writer()
+	log.SetOutput(&logBuf)
+	t.Cleanup(func() { log.SetOutput(origOutput) })
+
+	processor := createTestProcessor()
+
+	if processor.Ready() {
+		t.Fatal("expected cold processor not to be ready")
+	}
+	waitForRefresh(t, processor)
+
+	if processor.Ready() {
+		t.Fatal("expected processor to stay not ready after failed refresh")
+	}
+	waitForRefresh(t, processor)
+	if !strings.Contains(logBuf.String(), "Background refresh failed") {
+		t.Fatalf("expected refresh failure to be logged, got %q", logBuf.String())
+	}
+}
+
+func TestReady_DuringDownload(t *testing.T) {
+	processor := createTestProcessor()
+	cachedEntries(processor)["DE"] = []string{"2.0.0.0/12"}
+	setCacheTime(processor, time.Now())
+
+	// A refresh holds the write lock until its download finishes
+	processor.mutex.Lock()
+	defer processor.mutex.Unlock()
+
+	ready := make(chan bool)
+	go func() { ready <- processor.Ready() }()
+	select {
+	case got := <-ready:
+		if !got {
+			t.Error("Ready() = false, want true")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Ready() blocked on the lock held by a download")
+	}
+}
+
+func TestDataSourceAndTime_DuringDownload(t *testing.T) {
+	processor := createTestProcessor()
+	loadedAt := time.Now()
+	processor.applyParsed(&parsedData{cache: map[string][]string{"DE": {"2.0.0.0/12"}}}, loadedAt, DataSourceLive)
+
+	// A refresh holds the write lock until its download finishes
+	processor.mutex.Lock()
+	defer processor.mutex.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		if got := processor.DataSource(); got != DataSourceLive {
+			t.Errorf("DataSource() = %q, want %q", got, DataSourceLive)
+		}
+		if got := processor.DataTime(); !got.Equal(loadedAt) {
+			t.Errorf("DataTime() = %v, want %v", got, loadedAt)
+		}
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("DataSource() or DataTime() blocked on the lock held by a download")
+	}
+}
+
+func TestGetIPListSnapshot(t *testing.T) {
+	data := strings.Join([]string{
+		"2|ripencc|20220101|2|19830705|20220101|+0100",
+		"ripencc|DE|ipv4|2.0.0.0|1048576|20220101|allocated",
+		"ripencc|DE|ipv4|5.0.0.0|65536|20220101|allocated",
+	}, "\n")
+	processor := createTestProcessorWithMockData(data)
+
+	snapshot, err := processor.GetIPListSnapshot("de")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want, _ := processor.GetIPListForCountry("DE")
+	if !slices.Equal(snapshot.CIDRs, want) {
+		t.Errorf("CIDRs = %v, want %v", snapshot.CIDRs, want)
+	}
+	if snapshot.DataSource != DataSourceLive || !snapshot.DataTime.Equal(processor.DataTime()) || snapshot.DataTime.IsZero() {
+		t.Errorf("snapshot source %q at %v, want %q at %v", snapshot.DataSource, snapshot.DataTime, DataSourceLive, processor.DataTime())
+	}
+
+	// The list is a copy, so callers cannot change the cached data
+	snapshot.CIDRs[0] = "10.0.0.0/8"
+	if again, _ := processor.GetIPListSnapshot("DE"); again.CIDRs[0] == "10.0.0.0/8" {
+		t.Error("modifying the snapshot changed the cached list")
+	}
+
+	// Renewing unchanged data keeps the entries
+	processor.mutex.Lock()
+	processor.renewCache()
+	processor.mutex.Unlock()
+	renewed, _ := processor.GetIPListSnapshot("DE")
+	if !slices.Equal(renewed.CIDRs, want) || renewed.DataTime.Before(snapshot.DataTime) {
+		t.Errorf("after renewal got %v at %v, want %v no earlier than %v", renewed.CIDRs, renewed.DataTime, want, snapshot.DataTime)
+	}
+
+	missing, err := processor.GetIPListSnapshot("FR")
+	if err != nil || missing.CIDRs == nil || len(missing.CIDRs) != 0 {
+		t.Errorf("GetIPListSnapshot(FR) = %#v, %v; want an empty list", missing.CIDRs, err)
+	}
+}
+
+func TestGetIPListSnapshot_DownloadError(t *testing.T) {
+	processor := createTestProcessor()
+
+	if _, err := processor.GetIPListSnapshot("DE"); !errors.Is(err, ErrDownloadFailed) {
+		t.Fatalf("expected ErrDownloadFailed, got %v", err)
+	}
+}
+
+func TestReady_Staleness(t *testing.T) {
+	testCases := []struct {
+		name     string
+		age      time.Duration
+		expected bool
+	}{
+		{name: "Fresh", age: 10 * time.Minute, expected: true},
+		{name: "Expired but within stale limit", age: 90 * time.Minute, expected: true},
+		{name: "Excessively stale", age: 3 * time.Hour, expected: false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			processor := createTestProcessor()
+			cachedEntries(processor)["DE"] = []string{"2.0.0.0/12"}
+			setCacheTime(processor, time.Now().Add(-tc.age))
+
+			if got := processor.Ready(); got != tc.expected {
+				t.Errorf("Ready() = %v, want %v", got, tc.expected)
+			}
+			waitForRefresh(t, processor)
+		})
+	}
+}
+
+func TestGetIPListForCountry_DeduplicatesCIDRs(t *testing.T) {
+	data := strings.Join([]string{
+		"ripencc|DE|ipv4|2.0.0.0|1048576|20220101|allocated",
+		"ripencc|DE|ipv4|5.0.0.0|65536|20220101|allocated",
+		"ripencc|DE|ipv4|2.0.0.0|1048576|20220101|assigned",
+		"ripencc|DE|ipv4|5.0.0.0|65536|20220101|allocated",
+	}, "\n")
+
+	processor := createTestProcessorWithMockData(data)
+
+	result, err := processor.GetIPListForCountry("DE")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := []string{"2.0.0.0/12", "5.0.0.0/16"}
+	if !reflect.DeepEqual(result, want) {
+		t.Fatalf("DE = %#v, want %#v", result, want)
+	}
+
+	provenance, err := processor.GetProvenanceForCountry("DE")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if provenance["ripencc"] != 2 {
+		t.Fatalf("DE provenance = %v, want 2 ripencc blocks", provenance)
+	}
+}
+
+func TestNewProcessorWithClient_ClampsCacheDurationToFloor(t *testing.T) {
+	testCases := []struct {
+		name          string
+		cacheDuration string
+		minDuration   string
+		expectedTTL   time.Duration
+		expectWarning bool
+	}{
+		{name: "Below default floor", cacheDuration: "1s", minDuration: "", expectedTTL: 5 * time.Minute, expectWarning: true},
+		{name: "Below custom floor", cacheDuration: "10m", minDuration: "30m", expectedTTL: 30 * time.Minute, expectWarning: true},
+		{name: "Above floor", cacheDuration: "2h", minDuration: "5m", expectedTTL: 2 * time.Hour, expectWarning: false},
+		{name: "Equal to floor", cacheDuration: "5m", minDuration: "5m", expectedTTL: 5 * time.Minute, expectWarning: false},
+		{name: "Invalid floor uses default", cacheDuration: "1m", minDuration: "bogus", expectedTTL: 5 * time.Minute, expectWarning: true},
+		{name: "Floor can be lowered", cacheDuration: "1s", minDuration: "0s", expectedTTL: 1 * time.Second, expectWarning: false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			origArgs := os.Args
+			t.Cleanup(func() { os.Args = origArgs })
+			os.Args = []string{"app"}
+			t.Setenv("CACHE_DURATION", tc.cacheDuration)
+			if tc.minDuration != "" {
+				t.Setenv("MIN_CACHE_DURATION", tc.minDuration)
+			}
+
+			var logBuf bytes.Buffer
+			origOutput := log.Writer()
+			log.SetOutput(&logBuf)
+			t.Cleanup(func() { log.SetOutput(origOutput) })
+
+			processor := NewProcessorWithClient(&MockHTTPClient{})
+			if processor.cacheTTL != tc.expectedTTL {
+				t.Errorf("cacheTTL = %v, want %v", processor.cacheTTL, tc.expectedTTL)
+			}
+			if got := strings.Contains(logBuf.String(), "is below the minimum"); got != tc.expectWarning {
+				t.Errorf("warning logged = %v, want %v; log: %q", got, tc.expectWarning, logBuf.String())
+			}
+		})
+	}
+}
+
+func TestJitterDuration(t *testing.T) {
+	testCases := []struct {
+		name     string
+		base     time.Duration
+		percent  int
+		r        float64
+		expected time.Duration
+	}{
+		{name: "Lower bound", base: time.Hour, percent: 10, r: 0, expected: 54 * time.Minute},
+		{name: "Midpoint", base: time.Hour, percent: 10, r: 0.5, expected: time.Hour},
+		{name: "Near upper bound", base: time.Hour, percent: 10, r: 0.75, expected: 63 * time.Minute},
+		{name: "No jitter", base: time.Hour, percent: 0, r: 0, expected: time.Hour},
+		{name: "Negative percent ignored", base: time.Hour, percent: -20, r: 0, expected: time.Hour},
+		{name: "Percent capped at 100", base: time.Hour, percent: 250, r: 0, expected: 0},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := jitterDuration(tc.base, tc.percent, tc.r); got != tc.expected {
+				t.Errorf("jitterDuration(%v, %d, %v) = %v, want %v", tc.base, tc.percent, tc.r, got, tc.expected)
+			}
+		})
+	}
+}
+
+func TestNewProcessorWithConfig_JitteredTTLWithinBounds(t *testing.T) {
+	cfg := &config.Config{CacheDuration: "1h", MinCacheDuration: "5m", CacheJitter: 20}
+	lower, upper := 48*time.Minute, 72*time.Minute
+
+	for range 200 {
+		processor := newProcessorWithConfig(cfg, &MockHTTPClient{})
+		if processor.cacheTTL < lower || processor.cacheTTL > upper {
+			t.Fatalf("cacheTTL = %v, want within [%v, %v]", processor.cacheTTL, lower, upper)
+		}
+	}
+
+	// Jitter never pushes the TTL below the configured floor
+	cfg = &config.Config{CacheDuration: "5m", MinCacheDuration: "5m", CacheJitter: 50}
+	for range 200 {
+		processor := newProcessorWithConfig(cfg, &MockHTTPClient{})
+		if processor.cacheTTL < 5*time.Minute || processor.cacheTTL > 7*time.Minute+30*time.Second {
+			t.Fatalf("cacheTTL = %v, want within [5m, 7m30s]", processor.cacheTTL)
+		}
+	}
+}
+
+func TestDownloadAndProcessData_NormalizesMisalignedCIDRs(t *testing.T) {
+	data := strings.Join([]string{
+		"ripencc|DE|ipv4|192.168.0.5|256|20220101|allocated",
+		"ripencc|DE|ipv4|::ffff:5.1.2.3|65536|20220101|allocated",
+		"ripencc|DE|ipv4|not-an-ip|256|20220101|allocated",
+		"ripencc|DE|ipv4|31.0.0.0|0|20220101|allocated",
+	}, "\n")
+
+	processor := createTestProcessorWithMockData(data)
+	if err := processor.downloadAndProcessData(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	want := []string{"192.168.0.0/24", "5.1.0.0/16"}
+	if got := cachedEntries(processor)["DE"]; !reflect.DeepEqual(got, want) {
+		t.Fatalf("DE cache = %#v, want %#v", got, want)
+	}
+	for _, cidr := range cachedEntries(processor)["DE"] {
+		if err := ValidateIPCIDR(cidr); err != nil {
+			t.Errorf("cached CIDR %q is invalid: %v", cidr, err)
+		}
+	}
+}
+
+func TestDownloadAndProcessData_MaxDownloadBytes(t *testing.T) {
+	data := strings.Join([]string{
+		"ripencc|DE|ipv4|2.0.0.0|1048576|20220101|allocated",
+		"ripencc|FR|ipv4|5.0.0.0|65536|20220101|allocated",
+	}, "\n")
+
+	testCases := []struct {
+		name        string
+		limit       int64
+		expectError bool
+	}{
+		{name: "Body larger than limit", limit: 20, expectError: true},
+		{name: "Body exactly at limit", limit: int64(len(data)), expectError: false},
+		{name: "Limit disabled", limit: 0, expectError: false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			processor := createTestProcessorWithMockData(data)
+			processor.config.MaxDownloadBytes = tc.limit
+			previous := map[string][]string{"NL": {"31.0.0.0/24"}}
+			processor.cache.Set(previous, time.Time{})
+
+			err := processor.downloadAndProcessData()
+			if !tc.expectError {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				if len(cachedEntries(processor)) != 2 {
+					t.Fatalf("expected 2 countries, got %#v", cachedEntries(processor))
+				}
+				return
+			}
+
+			if !errors.Is(err, ErrDownloadTooLarge) {
+				t.Fatalf("expected ErrDownloadTooLarge, got %v", err)
+			}
+			if !errors.Is(err, ErrBadUpstreamData) {
+				t.Fatalf("expected ErrBadUpstreamData, got %v", err)
+			}
+			if !reflect.DeepEqual(cachedEntries(processor), previous) {
+				t.Fatalf("previous cache not preserved: %#v", cachedEntries(processor))
+			}
+			if !processor.loadedAt().IsZero() {
+				t.Fatal("expected cache time not to be updated")
+			}
+		})
+	}
+}
+
+func TestDownloadAndProcessData_HandlesBOMAndWhitespace(t *testing.T) {
+	testCases := []struct {
+		name string
+		data string
+	}{
+		{
+			name: "BOM before comment header",
+			data: utf8BOM + "# RIPE NCC delegated stats\nripencc|DE|ipv4|2.0.0.0|1048576|20220101|allocated\n",
+		},
+		{
+			name: "BOM before version header",
+			data: utf8BOM + "2.3|ripencc|20220101|2|19830705|20220101|+0100\nripencc|*|ipv4|*|1|summary\nripencc|DE|ipv4|2.0.0.0|1048576|20220101|allocated\n",
+		},
+		{
+			name: "BOM before first record",
+			data: utf8BOM + "ripencc|DE|ipv4|2.0.0.0|1048576|20220101|allocated\n",
+		},
+		{
+			name: "CRLF line endings",
+			data: "2.3|ripencc|20220101|2|19830705|20220101|+0100\r\nripencc|*|ipv4|*|1|summary\r\nripencc|DE|ipv4|2.0.0.0|1048576|20220101|allocated\r\n\r\n",
+		},
+		{
+			name: "Whitespace around fields",
+			data: "  ripencc | de | ipv4 | 2.0.0.0 | 1048576 |20220101| allocated  \t\n",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			processor := createTestProcessorWithMockData(tc.data)
+			if err := processor.downloadAndProcessData(); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			want := map[string][]string{"DE": {"2.0.0.0/12"}}
+			if !reflect.DeepEqual(cachedEntries(processor), want) {
+				t.Fatalf("cache = %#v, want %#v", processor.cache, want)
+			}
+		})
+	}
+}
+
+func TestRefreshParseFailureKeepsPreviousData(t *testing.T) {
+	for _, workers := range []int{1, 4} {
+		t.Run(fmt.Sprintf("%d workers", workers), func(t *testing.T) {
+			p := createTestProcessorWithMockData(exportTestData)
+			p.config.ParseWorkers = workers
+			if err := p.downloadAndProcessData(); err != nil {
+				t.Fatalf("initial download: %v", err)
+			}
+			loadedAt := time.Now().Add(-2 * time.Hour)
+			setCacheTime(p, loadedAt)
+
+			// The refreshed body breaks off after a few valid records
+			valid := "ripencc|NL|ipv4|5.1.0.0|256|20100101|allocated\n" + syntheticDelegatedStats(2*parseChunkLines)
+			p.httpClient = &MockHTTPClient{Body: io.NopCloser(io.MultiReader(strings.NewReader(valid), errReadCloser{}))}
+
+			err := p.downloadAndProcessData()
+			if !errors.Is(err, ErrDownloadFailed) || !isParseError(err) {
+				t.Fatalf("expected a parse error wrapping ErrDownloadFailed, got %v", err)
+			}
+			if got, _ := p.cache.Get("DE"); !reflect.DeepEqual(got, []string{"2.0.0.0/12", "5.0.0.0/16"}) {
+				t.Errorf("DE = %v, want the previous blocks", got)
+			}
+			if _, ok := p.cache.Get("NL"); ok {
+				t.Error("records of the failed download reached the cache")
+			}
+			if got := p.DataTime(); !got.Equal(loadedAt) {
+				t.Errorf("DataTime = %v, want unchanged %v", got, loadedAt)
+			}
+			if got := p.DataSource(); got != DataSourceLive {
+				t.Errorf("DataSource = %q, want %q", got, DataSourceLive)
+			}
+			if p.breaker.failures != 1 {
+				t.Errorf("breaker failures = %d, want 1", p.breaker.failures)
+			}
+		})
+	}
+}
+
+func TestStaleOnParseError(t *testing.T) {
+	testCases := []struct {
+		name    string
+		enabled bool
+		client  *MockHTTPClient
+		wantErr bool
+	}{
+		{
+			name:    "Parse failure served from previous data",
+			enabled: true,
+			client:  &MockHTTPClient{ResponseBody: "ripencc|*|ipv4|*|0|summary\n"},
+		},
+		{
+			name:    "Parse failure fails without the option",
+			client:  &MockHTTPClient{ResponseBody: "ripencc|*|ipv4|*|0|summary\n"},
+			wantErr: true,
+		},
+		{
+			name:    "Download failure still fails",
+			enabled: true,
+			client:  &MockHTTPClient{ShouldError: true, ErrorMsg: "connection refused"},
+			wantErr: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			p := createTestProcessorWithMockData(exportTestData)
+			p.config.StaleOnParseError = tc.enabled
+			if err := p.downloadAndProcessData(); err != nil {
+				t.Fatalf("initial download: %v", err)
+			}
+			setCacheTime(p, time.Now().Add(-2*time.Hour))
+			p.httpClient = tc.client
+
+			got, err := p.GetIPListForCountry("FR")
+			if tc.wantErr {
+				if err == nil {
+					t.Fatalf("expected an error, got %v", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(got, []string{"81.2.69.0/24"}) {
+				t.Errorf("FR = %v, want the previous blocks", got)
+			}
+		})
+	}
+}
+
+func TestStaleOnParseError_NoPreviousData(t *testing.T) {
+	p := createTestProcessorWithMockData("ripencc|*|ipv4|*|0|summary\n")
+	p.config.StaleOnParseError = true
+
+	if _, err := p.GetIPListForCountry("FR"); !errors.Is(err, ErrBadUpstreamData) {
+		t.Fatalf("expected ErrBadUpstreamData, got %v", err)
+	}
+}
+
+func TestGetIPListForCountry_ReturnsCopy(t *testing.T) {
+	want := []string{"2.0.0.0/12", "5.0.0.0/16", "46.0.0.0/8"}
+	p := createTestProcessor()
+	p.cache.Set(map[string][]string{"DE": slices.Clone(want)}, time.Now())
+
+	// Run with -race: readers mutate their results while the data is swapped
+	var wg sync.WaitGroup
+	for range 8 {
+		wg.Go(func() {
+			for range 200 {
+				list, err := p.GetIPListForCountry("DE")
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				list[0] = "0.0.0.0/0"
+				slices.Reverse(list)
+			}
+		})
+	}
+	wg.Go(func() {
+		for range 200 {
+			p.cache.Set(map[string][]string{"DE": slices.Clone(want)}, time.Now())
+		}
+	})
+	wg.Wait()
+
+	if got, _ := p.cache.Get("DE"); !reflect.DeepEqual(got, want) {
+		t.Errorf("cached DE = %v, want %v", got, want)
+	}
+	if got, err := p.GetIPListForCountry("DE"); err != nil || !reflect.DeepEqual(got, want) {
+		t.Errorf("GetIPListForCountry(DE) = %v, %v, want %v", got, err, want)
+	}
+}
+
+func TestGettersReturnCopies(t *testing.T) {
+	day := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	p := createTestProcessorWithMockData(exportTestData)
+	p.config.ArchiveURL = testArchiveURL
+	p.httpClient = routingHTTPClient{
+		ripeURL:                         {ResponseBody: exportTestData},
+		archiveURL(testArchiveURL, day): {ResponseBody: exportTestData},
+	}
+
+	reverseAndAppend := func(v any) {
+		switch list := v.(type) {
+		case []string:
+			slices.Reverse(list)
+			_ = append(list[:1], "0.0.0.0/0")
+		case []uint32:
+			slices.Reverse(list)
+			_ = append(list[:1], 0)
+		}
+	}
+
+	testCases := []struct {
+		name     string
+		get      func() (any, error)
+		mutate   func(v any)
+		expected any
+	}{
+		{
+			name:     "GetIPListForCountry",
+			get:      func() (any, error) { return p.GetIPListForCountry("DE") },
+			mutate:   reverseAndAppend,
+			expected: []string{"2.0.0.0/12", "5.0.0.0/16"},
+		},
+		{
+			name:     "GetIPListForCountryOn",
+			get:      func() (any, error) { return p.GetIPListForCountryOn("DE", day) },
+			mutate:   reverseAndAppend,
+			expected: []string{"2.0.0.0/12", "5.0.0.0/16"},
+		},
+		{
+			name:     "GetIPv6ListForCountry",
+			get:      func() (any, error) { return p.GetIPv6ListForCountry("DE") },
+			mutate:   reverseAndAppend,
+			expected: []string{"2001:db8::/32"},
+		},
+		{
+			name:     "GetASNsForCountry",
+			get:      func() (any, error) { return p.GetASNsForCountry("DE") },
+			mutate:   reverseAndAppend,
+			expected: []uint32{3320, 3321},
+		},
+		{
+			name: "GetIPListByRegistry",
+			get:  func() (any, error) { return p.GetIPListByRegistry("DE") },
+			mutate: func(v any) {
+				registries := v.(map[string][]string)
+				reverseAndAppend(registries["ripencc"])
+				registries["arin"] = []string{"8.0.0.0/8"}
+			},
+			expected: map[string][]string{"ripencc": {"2.0.0.0/12", "5.0.0.0/16"}},
+		},
+		{
+			name:     "GetProvenanceForCountry",
+			get:      func() (any, error) { return p.GetProvenanceForCountry("DE") },
+			mutate:   func(v any) { v.(map[string]int)["ripencc"] = 0 },
+			expected: map[string]int{"ripencc": 2},
+		},
+		{
+			name: "GetAllCountries",
+			get:  func() (any, error) { return p.GetAllCountries() },
+			mutate: func(v any) {
+				all := v.(map[string][]string)
+				reverseAndAppend(all["DE"])
+				delete(all, "FR")
+			},
+			expected: map[string][]string{"DE": {"2.0.0.0/12", "5.0.0.0/16"}, "FR": {"81.2.69.0/24"}},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			first, err := tc.get()
+			if err != nil {
+				t.Fatalf("first call: %v", err)
+			}
+			tc.mutate(first)
+
+			second, err := tc.get()
+			if err != nil {
+				t.Fatalf("second call: %v", err)
+			}
+			if !reflect.DeepEqual(second, tc.expected) {
+				t.Errorf("after mutating the first result got %v, want %v", second, tc.expected)
+			}
+		})
+	}
+}
+
+func BenchmarkGetIPListForCountry(b *testing.B) {
+	p := createTestProcessor()
+	entries := make(map[string][]string)
+	for i := range 250 {
+		country := string(rune('A'+i/26%26)) + string(rune('A'+i%26))
+		entries[country] = []string{"2.0.0.0/12", "5.0.0.0/16", "31.0.0.0/24", "46.0.0.0/8"}
+	}
+	p.cache.Set(entries, time.Now())
+
+	b.ReportAllocs()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			if _, err := p.GetIPListForCountry("DE"); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
@@ -0,0 +1,81 @@
+package ipdata
+
+import (
+	"log"
+	"net/netip"
+	"slices"
+)
+
+// Reassignment is a CIDR block whose country changed between two consecutive
+// refreshes, e.g. after an inter-RIR or intra-RIR transfer
+type Reassignment struct {
+	CIDR string `json:"cidr"`
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+// countryByCIDR maps every block to its country. A block listed under several
+// countries maps to the alphabetically first one.
+func countryByCIDR(all map[string][]string) map[string]string {
+	countries := make([]string, 0, len(all))
+	for country := range all {
+		countries = append(countries, country)
+	}
+	slices.Sort(countries)
+
+	byCIDR := make(map[string]string)
+	for _, country := range countries {
+		for _, cidr := range all[country] {
+			if _, ok := byCIDR[cidr]; !ok {
+				byCIDR[cidr] = country
+			}
+		}
+	}
+	return byCIDR
+}
+
+// findReassignments returns the blocks present in both datasets whose country
+// differs, sorted by address. Blocks are matched exactly, so a block that was
+// split or merged on the way is not reported.
+func findReassignments(previous, current map[string][]string) []Reassignment {
+	before := countryByCIDR(previous)
+	var reassigned []Reassignment
+	for cidr, to := range countryByCIDR(current) {
+		if from, ok := before[cidr]; ok && from != to {
+			reassigned = append(reassigned, Reassignment{CIDR: cidr, From: from, To: to})
+		}
+	}
+	slices.SortFunc(reassigned, func(a, b Reassignment) int {
+		return netip.MustParsePrefix(a.CIDR).Addr().Compare(netip.MustParsePrefix(b.CIDR).Addr())
+	})
+	return reassigned
+}
+
+// cachedCIDRs returns the CIDR blocks of every cached country. The caller
+// must hold the mutex.
+func (p *Processor) cachedCIDRs() map[string][]string {
+	countries := p.cache.Countries()
+	all := make(map[string][]string, len(countries))
+	for _, country := range countries {
+		all[country], _ = p.cache.Get(country)
+	}
+	return all
+}
+
+// trackReassignments records the blocks whose country changed since the
+// previous refresh and logs each of them. Data loaded from the embedded
+// snapshot is not compared against, since it is not a previous refresh.
+// The caller must hold the mutex.
+func (p *Processor) trackReassignments(current map[string][]string) {
+	if source := p.servedData().source; source != DataSourceLive && source != DataSourcePeer {
+		return
+	}
+
+	p.reassigned = findReassignments(p.cachedCIDRs(), current)
+	for _, r := range p.reassigned {
+		log.Printf("Block %s reassigned from %s to %s\n", r.CIDR, r.From, r.To)
+	}
+	if len(p.reassigned) > 0 {
+		log.Printf("Found %d blocks reassigned between countries since the previous refresh\n", len(p.reassigned))
+	}
+}
@@ -0,0 +1,133 @@
+package ipdata
+
+import (
+	"bytes"
+	"log"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestFindReassignments(t *testing.T) {
+	testCases := []struct {
+		name     string
+		previous map[string][]string
+		current  map[string][]string
+		expected []Reassignment
+	}{
+		{
+			name:     "No changes",
+			previous: map[string][]string{"US": {"24.0.0.0/16"}},
+			current:  map[string][]string{"US": {"24.0.0.0/16"}},
+		},
+		{
+			name:     "Block moves to another country",
+			previous: map[string][]string{"US": {"8.0.0.0/8", "24.0.0.0/16"}, "CA": {"99.0.0.0/8"}},
+			current:  map[string][]string{"US": {"8.0.0.0/8"}, "CA": {"24.0.0.0/16", "99.0.0.0/8"}},
+			expected: []Reassignment{{CIDR: "24.0.0.0/16", From: "US", To: "CA"}},
+		},
+		{
+			name:     "New and removed blocks are not reassignments",
+			previous: map[string][]string{"US": {"8.0.0.0/8"}},
+			current:  map[string][]string{"CA": {"99.0.0.0/8"}},
+		},
+		{
+			name:     "Split block is not matched",
+			previous: map[string][]string{"US": {"24.0.0.0/16"}},
+			current:  map[string][]string{"CA": {"24.0.0.0/17", "24.0.128.0/17"}},
+		},
+		{
+			name: "Sorted by address",
+			previous: map[string][]string{
+				"DE": {"81.0.0.0/16", "5.0.0.0/16"},
+				"FR": {"2.0.0.0/12"},
+			},
+			current: map[string][]string{
+				"NL": {"81.0.0.0/16", "5.0.0.0/16"},
+				"BE": {"2.0.0.0/12"},
+			},
+			expected: []Reassignment{
+				{CIDR: "2.0.0.0/12", From: "FR", To: "BE"},
+				{CIDR: "5.0.0.0/16", From: "DE", To: "NL"},
+				{CIDR: "81.0.0.0/16", From: "DE", To: "NL"},
+			},
+		},
+		{
+			name:     "Block listed under several countries maps to the first",
+			previous: map[string][]string{"US": {"24.0.0.0/16"}, "CA": {"24.0.0.0/16"}},
+			current:  map[string][]string{"CA": {"24.0.0.0/16"}},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := findReassignments(tc.previous, tc.current); !reflect.DeepEqual(got, tc.expected) {
+				t.Fatalf("findReassignments = %#v, want %#v", got, tc.expected)
+			}
+		})
+	}
+}
+
+func TestRefreshReportsReassignedBlocks(t *testing.T) {
+	first := strings.Join([]string{
+		"ripencc|US|ipv4|8.0.0.0|16777216|20100101|allocated",
+		"ripencc|US|ipv4|24.0.0.0|65536|20100101|allocated",
+		"ripencc|CA|ipv4|99.0.0.0|16777216|20100101|allocated",
+	}, "\n")
+	second := strings.Join([]string{
+		"ripencc|US|ipv4|8.0.0.0|16777216|20100101|allocated",
+		"ripencc|CA|ipv4|24.0.0.0|65536|20220101|allocated",
+		"ripencc|CA|ipv4|99.0.0.0|16777216|20100101|allocated",
+	}, "\n")
+
+	var logBuf bytes.Buffer
+	origOutput := log.Writer()
+	log.SetOutput(&logBuf)
+	t.Cleanup(func() { log.SetOutput(origOutput) })
+
+	p := createTestProcessorWithMockData(first)
+	client := p.httpClient.(*MockHTTPClient)
+
+	if err := p.downloadIfOlderThan(0); err != nil {
+		t.Fatalf("first refresh: %v", err)
+	}
+	if got := p.Stats().Reassigned; got != nil {
+		t.Fatalf("Reassigned after the first refresh = %v, want none", got)
+	}
+
+	client.ResponseBody = second
+	if err := p.downloadIfOlderThan(0); err != nil {
+		t.Fatalf("second refresh: %v", err)
+	}
+	expected := []Reassignment{{CIDR: "24.0.0.0/16", From: "US", To: "CA"}}
+	if got := p.Stats().Reassigned; !reflect.DeepEqual(got, expected) {
+		t.Fatalf("Reassigned = %v, want %v", got, expected)
+	}
+	if !strings.Contains(logBuf.String(), "Block 24.0.0.0/16 reassigned from US to CA") {
+		t.Errorf("expected the reassignment to be logged, got %q", logBuf.String())
+	}
+	if !strings.Contains(logBuf.String(), "Found 1 blocks reassigned between countries") {
+		t.Errorf("expected a summary line, got %q", logBuf.String())
+	}
+
+	// A refresh without changes clears the report
+	if err := p.downloadIfOlderThan(0); err != nil {
+		t.Fatalf("third refresh: %v", err)
+	}
+	if got := p.Stats().Reassigned; got != nil {
+		t.Fatalf("Reassigned after an unchanged refresh = %v, want none", got)
+	}
+}
+
+func TestRefreshDoesNotCompareAgainstEmbeddedData(t *testing.T) {
+	p := createTestProcessorWithMockData("ripencc|CA|ipv4|24.0.0.0|65536|20220101|allocated")
+	p.cache.Set(map[string][]string{"US": {"24.0.0.0/16"}}, p.loadedAt())
+	p.served.Store(&servedData{source: DataSourceEmbedded, loadedAt: p.loadedAt()})
+
+	if err := p.downloadIfOlderThan(0); err != nil {
+		t.Fatalf("refresh: %v", err)
+	}
+	if got := p.Stats().Reassigned; got != nil {
+		t.Fatalf("Reassigned = %v, want none after replacing embedded data", got)
+	}
+}
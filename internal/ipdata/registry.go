@@ -0,0 +1,34 @@
+package ipdata
+
+import (
+	"slices"
+	"strings"
+)
+
+// groupByRegistry groups the CIDR blocks of a country by their source registry.
+// cidrs must be the blocks built from ipDataList, in the same order.
+func groupByRegistry(ipDataList []IPData, cidrs []string) map[string][]string {
+	groups := make(map[string][]string)
+	for i, ipData := range ipDataList {
+		groups[ipData.Registry] = append(groups[ipData.Registry], cidrs[i])
+	}
+	return groups
+}
+
+// GetIPListByRegistry returns the CIDR blocks of a country grouped by the
+// registry that delegated them
+func (p *Processor) GetIPListByRegistry(countryCode string) (map[string][]string, error) {
+	countryCode = strings.ToUpper(countryCode)
+
+	if err := p.refreshIfOlderThan(p.ttlFor(countryCode)); err != nil {
+		return nil, err
+	}
+
+	p.mutex.RLock()
+	defer p.mutex.RUnlock()
+	result := make(map[string][]string, len(p.registries[countryCode]))
+	for registry, cidrs := range p.registries[countryCode] {
+		result[registry] = slices.Clone(cidrs)
+	}
+	return result, nil
+}
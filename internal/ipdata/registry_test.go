@@ -0,0 +1,86 @@
+package ipdata
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestGroupByRegistry(t *testing.T) {
+	ipDataList := []IPData{
+		{Registry: "ripencc", Country: "US", IPStart: "31.0.0.0", Count: 256, CIDRMask: 24},
+		{Registry: "arin", Country: "US", IPStart: "3.0.0.0", Count: 16777216, CIDRMask: 8},
+		{Registry: "ripencc", Country: "US", IPStart: "46.0.0.0", Count: 65536, CIDRMask: 16},
+		{Registry: "arin", Country: "US", IPStart: "8.0.0.0", Count: 16777216, CIDRMask: 8},
+		{Registry: "apnic", Country: "US", IPStart: "1.0.1.0", Count: 256, CIDRMask: 24},
+	}
+
+	groups := groupByRegistry(ipDataList, buildCIDRs(ipDataList))
+
+	expected := map[string][]string{
+		"ripencc": {"31.0.0.0/24", "46.0.0.0/16"},
+		"arin":    {"3.0.0.0/8", "8.0.0.0/8"},
+		"apnic":   {"1.0.1.0/24"},
+	}
+	if !reflect.DeepEqual(groups, expected) {
+		t.Errorf("groupByRegistry() = %v, want %v", groups, expected)
+	}
+}
+
+func TestGetIPListByRegistry(t *testing.T) {
+	data := strings.Join([]string{
+		"2|ripencc|20220101|5|19830705|20220101|+0100",
+		"ripencc|DE|ipv4|2.0.0.0|1048576|20220101|allocated",
+		"ripencc|DE|ipv4|5.0.0.0|65536|20220101|allocated",
+		"ripencc|US|ipv4|31.0.0.0|256|20220101|allocated",
+		"arin|US|ipv4|3.0.0.0|16777216|20220101|allocated",
+	}, "\n")
+
+	processor := createTestProcessorWithMockData(data)
+
+	de, err := processor.GetIPListByRegistry("de")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if want := map[string][]string{"ripencc": {"2.0.0.0/12", "5.0.0.0/16"}}; !reflect.DeepEqual(de, want) {
+		t.Errorf("DE groups = %v, want %v", de, want)
+	}
+
+	// Only RIPE NCC records are served, so other registries never appear
+	us, err := processor.GetIPListByRegistry("US")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if want := map[string][]string{"ripencc": {"31.0.0.0/24"}}; !reflect.DeepEqual(us, want) {
+		t.Errorf("US groups = %v, want %v", us, want)
+	}
+
+	fr, err := processor.GetIPListByRegistry("FR")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(fr) != 0 {
+		t.Errorf("FR groups = %v, want empty", fr)
+	}
+
+	// Modifying the result must not affect the cache
+	delete(de, "ripencc")
+	if again, _ := processor.GetIPListByRegistry("DE"); len(again["ripencc"]) != 2 {
+		t.Errorf("cached groups were modified: %v", again)
+	}
+
+	mc := processor.httpClient.(*MockHTTPClient)
+	if mc.CallCount != 1 {
+		t.Errorf("expected a single download, CallCount=%d", mc.CallCount)
+	}
+}
+
+func TestGetIPListByRegistry_DownloadError(t *testing.T) {
+	processor := createTestProcessor()
+
+	_, err := processor.GetIPListByRegistry("US")
+	if !errors.Is(err, ErrDownloadFailed) {
+		t.Fatalf("expected ErrDownloadFailed, got %v", err)
+	}
+}
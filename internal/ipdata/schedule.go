@@ -0,0 +1,38 @@
+package ipdata
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+)
+
+// ScheduledRefresh downloads fresh data whatever the age of the cached data,
+// unless the upstream file has not been modified since the cached copy was
+// downloaded, like every refresh. It reports whether the data was downloaded.
+// When the upstream does not answer the check or sends no Last-Modified
+// header, the data is downloaded anyway. With an upstream peer, the peer's
+// /export endpoint is checked instead of the RIPE NCC file.
+func (p *Processor) ScheduledRefresh(ctx context.Context) (bool, error) {
+	return p.refreshData(0)
+}
+
+// upstreamHead sends a HEAD request to the data source URL and returns the
+// response if it is 200 OK
+func (p *Processor) upstreamHead(ctx context.Context) (*http.Response, bool) {
+	ctx, cancel := context.WithTimeout(ctx, upstreamCheckTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, p.sourceURL(), nil)
+	if err != nil {
+		return nil, false
+	}
+
+	resp, err := p.doRequest(req)
+	if err != nil {
+		slog.Error("Checking upstream for new data failed", "error", err)
+		return nil, false
+	}
+	resp.Body.Close()
+
+	return resp, resp.StatusCode == http.StatusOK
+}
@@ -0,0 +1,205 @@
+package ipdata
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+// lastModifiedClient serves exportTestData with a Last-Modified header and
+// Content-Length, and counts the requests by method
+type lastModifiedClient struct {
+	modified   time.Time
+	length     int64 // Content-Length, 0 for unknown
+	headStatus int
+	headErr    error
+	requests   map[string]int
+}
+
+func (c *lastModifiedClient) Do(req *http.Request) (*http.Response, error) {
+	if c.requests == nil {
+		c.requests = make(map[string]int)
+	}
+	c.requests[req.Method]++
+
+	status := http.StatusOK
+	if req.Method == http.MethodHead {
+		if c.headErr != nil {
+			return nil, c.headErr
+		}
+		if c.headStatus != 0 {
+			status = c.headStatus
+		}
+	}
+
+	header := make(http.Header)
+	if !c.modified.IsZero() {
+		header.Set("Last-Modified", c.modified.UTC().Format(http.TimeFormat))
+	}
+	length := c.length
+	if length == 0 {
+		length = -1
+	}
+	return &http.Response{
+		StatusCode:    status,
+		Header:        header,
+		ContentLength: length,
+		Body:          io.NopCloser(strings.NewReader(exportTestData)),
+	}, nil
+}
+
+func TestScheduledRefresh(t *testing.T) {
+	published := time.Date(2024, 1, 2, 1, 0, 0, 0, time.UTC)
+
+	testCases := []struct {
+		name          string
+		client        *lastModifiedClient
+		wantRefreshed bool
+	}{
+		{
+			name:   "Unchanged Last-Modified skips the refresh",
+			client: &lastModifiedClient{modified: published},
+		},
+		{
+			name:          "Advanced Last-Modified refreshes",
+			client:        &lastModifiedClient{modified: published.Add(24 * time.Hour)},
+			wantRefreshed: true,
+		},
+		{
+			name:          "Missing Last-Modified refreshes",
+			client:        &lastModifiedClient{},
+			wantRefreshed: true,
+		},
+		{
+			name:          "Failed check refreshes",
+			client:        &lastModifiedClient{modified: published, headErr: errors.New("connection reset")},
+			wantRefreshed: true,
+		},
+		{
+			name:          "Check error status refreshes",
+			client:        &lastModifiedClient{modified: published, headStatus: http.StatusMethodNotAllowed},
+			wantRefreshed: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			p := createTestProcessor()
+			p.httpClient = &lastModifiedClient{modified: published}
+			if err := p.downloadAndProcessData(); err != nil {
+				t.Fatalf("initial download: %v", err)
+			}
+			loadedAt := p.DataTime()
+
+			p.httpClient = tc.client
+			refreshed, err := p.ScheduledRefresh(context.Background())
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if refreshed != tc.wantRefreshed {
+				t.Errorf("refreshed = %v, want %v", refreshed, tc.wantRefreshed)
+			}
+
+			wantGets := 0
+			if tc.wantRefreshed {
+				wantGets = 1
+			}
+			if got := tc.client.requests[http.MethodGet]; got != wantGets {
+				t.Errorf("GET requests = %d, want %d", got, wantGets)
+			}
+			if got := tc.client.requests[http.MethodHead]; got != 1 {
+				t.Errorf("HEAD requests = %d, want 1", got)
+			}
+			// Unchanged data is renewed, so it counts as fresh like downloaded data
+			if !p.DataTime().After(loadedAt) {
+				t.Errorf("DataTime = %v, want it renewed after %v", p.DataTime(), loadedAt)
+			}
+		})
+	}
+}
+
+func TestRefreshIfStale_UnchangedUpstream(t *testing.T) {
+	published := time.Date(2024, 1, 2, 1, 0, 0, 0, time.UTC)
+	p := createTestProcessor()
+	p.httpClient = &lastModifiedClient{modified: published}
+	if err := p.downloadAndProcessData(); err != nil {
+		t.Fatalf("initial download: %v", err)
+	}
+
+	// Expired data whose upstream file is unchanged is renewed, not downloaded
+	setCacheTime(p, time.Now().Add(-2*time.Hour))
+	client := &lastModifiedClient{modified: published}
+	p.httpClient = client
+	if _, err := p.GetIPListForCountry("DE"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if client.requests[http.MethodHead] != 1 || client.requests[http.MethodGet] != 0 {
+		t.Errorf("requests = %v, want a single HEAD", client.requests)
+	}
+	if age := time.Since(p.DataTime()); age > time.Minute {
+		t.Errorf("data age = %v, want the data renewed", age)
+	}
+}
+
+func TestScheduledRefresh_IgnoresFreshCache(t *testing.T) {
+	p := createTestProcessor()
+	p.httpClient = &lastModifiedClient{}
+	if err := p.downloadAndProcessData(); err != nil {
+		t.Fatalf("initial download: %v", err)
+	}
+
+	// The cached copy has no known Last-Modified, so the data is downloaded
+	// although it is well within the cache duration
+	client := &lastModifiedClient{modified: time.Now()}
+	p.httpClient = client
+	if refreshed, err := p.ScheduledRefresh(context.Background()); err != nil || !refreshed {
+		t.Fatalf("ScheduledRefresh = %v, %v, want a refresh", refreshed, err)
+	}
+	if client.requests[http.MethodGet] != 1 {
+		t.Errorf("GET requests = %d, want 1", client.requests[http.MethodGet])
+	}
+}
+
+func TestScheduledRefresh_PeerUnchanged(t *testing.T) {
+	leader := createTestProcessorWithMockData(exportTestData)
+	var tokens []string
+	srv := newStubLeader(t, leader, &tokens)
+
+	p := createTestProcessor()
+	p.httpClient = srv.Client()
+	p.config.UpstreamPeer = srv.URL
+
+	if refreshed, err := p.ScheduledRefresh(context.Background()); err != nil || !refreshed {
+		t.Fatalf("first ScheduledRefresh = %v, %v, want a refresh", refreshed, err)
+	}
+	if refreshed, err := p.ScheduledRefresh(context.Background()); err != nil || refreshed {
+		t.Fatalf("second ScheduledRefresh = %v, %v, want the unchanged peer dataset skipped", refreshed, err)
+	}
+	if len(tokens) != 1 {
+		t.Errorf("leader served %d exports, want 1", len(tokens))
+	}
+}
+
+func TestScheduledRefresh_DownloadError(t *testing.T) {
+	p := createTestProcessor()
+
+	refreshed, err := p.ScheduledRefresh(context.Background())
+	if !errors.Is(err, ErrDownloadFailed) || refreshed {
+		t.Fatalf("ScheduledRefresh = %v, %v, want ErrDownloadFailed", refreshed, err)
+	}
+}
+
+func TestScheduledRefresh_RequestCreateError(t *testing.T) {
+	oldURL := ripeURL
+	t.Cleanup(func() { ripeURL = oldURL })
+	ripeURL = "http://[::1" // invalid URL
+
+	p := createTestProcessor()
+	if _, ok := p.upstreamHead(context.Background()); ok {
+		t.Fatal("expected the check to fail")
+	}
+}
@@ -0,0 +1,54 @@
+package ipdata
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"time"
+)
+
+// upstreamUnchanged sends a HEAD request to the data source URL and reports
+// whether the file is unchanged since the cached copy was downloaded: its
+// Last-Modified time has not advanced, or, with HeadSizeCheck and no
+// Last-Modified header to tell, its Content-Length equals the size of the
+// previous download. No request is made while there is nothing to compare
+// against. The caller must hold the write lock.
+func (p *Processor) upstreamUnchanged() bool {
+	sizeCheck := p.config.HeadSizeCheck && p.config.UpstreamPeer == "" && p.fileSize > 0
+	if p.modifiedAt.IsZero() && !sizeCheck {
+		return false
+	}
+
+	resp, ok := p.upstreamHead(context.Background())
+	if !ok {
+		return false
+	}
+	if header := resp.Header.Get("Last-Modified"); header != "" {
+		modified, err := http.ParseTime(header)
+		if err != nil || p.modifiedAt.IsZero() || modified.After(p.modifiedAt) {
+			return false
+		}
+		log.Printf("Skipping download, upstream data unchanged since %s\n", modified.Format(http.TimeFormat))
+		return true
+	}
+	if !sizeCheck || resp.ContentLength != p.fileSize {
+		return false
+	}
+	log.Printf("Skipping download, upstream size unchanged at %d bytes\n", p.fileSize)
+	return true
+}
+
+// renewCache marks the cached data as loaded now, without changing it, and
+// runs the refresh hooks, since DataTime has moved on. The caller must hold
+// the write lock.
+func (p *Processor) renewCache() {
+	countries := p.cache.Countries()
+	all := make(map[string][]string, len(countries))
+	for _, country := range countries {
+		all[country], _ = p.cache.Get(country)
+	}
+	loadedAt := time.Now()
+	p.cache.Set(all, loadedAt)
+	p.served.Store(&servedData{entries: all, source: p.servedData().source, loadedAt: loadedAt})
+	p.runRefreshHooks()
+}
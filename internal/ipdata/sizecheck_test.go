@@ -0,0 +1,212 @@
+package ipdata
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestHeadSizeCheck(t *testing.T) {
+	const size = 4096
+
+	testCases := []struct {
+		name          string
+		disabled      bool
+		initial       *lastModifiedClient
+		client        *lastModifiedClient
+		wantRefreshed bool
+		wantHeads     int
+	}{
+		{
+			name:      "Identical size skips the download",
+			initial:   &lastModifiedClient{length: size},
+			client:    &lastModifiedClient{length: size},
+			wantHeads: 1,
+		},
+		{
+			name:          "Different size downloads",
+			initial:       &lastModifiedClient{length: size},
+			client:        &lastModifiedClient{length: size + 1},
+			wantRefreshed: true,
+			wantHeads:     1,
+		},
+		{
+			name:          "Unknown size downloads",
+			initial:       &lastModifiedClient{length: size},
+			client:        &lastModifiedClient{},
+			wantRefreshed: true,
+			wantHeads:     1,
+		},
+		{
+			name:          "Unknown previous size downloads without a check",
+			initial:       &lastModifiedClient{},
+			client:        &lastModifiedClient{length: size},
+			wantRefreshed: true,
+		},
+		{
+			name:          "Last-Modified takes precedence over the size",
+			initial:       &lastModifiedClient{length: size},
+			client:        &lastModifiedClient{length: size, modified: time.Now()},
+			wantRefreshed: true,
+			wantHeads:     1,
+		},
+		{
+			name:          "Failed check downloads",
+			initial:       &lastModifiedClient{length: size},
+			client:        &lastModifiedClient{length: size, headErr: errors.New("connection reset")},
+			wantRefreshed: true,
+			wantHeads:     1,
+		},
+		{
+			name:          "Check error status downloads",
+			initial:       &lastModifiedClient{length: size},
+			client:        &lastModifiedClient{length: size, headStatus: http.StatusMethodNotAllowed},
+			wantRefreshed: true,
+			wantHeads:     1,
+		},
+		{
+			name:          "Disabled check downloads",
+			disabled:      true,
+			initial:       &lastModifiedClient{length: size},
+			client:        &lastModifiedClient{length: size},
+			wantRefreshed: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			p := createTestProcessor()
+			p.config.HeadSizeCheck = !tc.disabled
+			p.httpClient = tc.initial
+			if err := p.downloadAndProcessData(); err != nil {
+				t.Fatalf("initial download: %v", err)
+			}
+			loadedAt := p.loadedAt()
+			before, _ := p.GetIPListForCountry("DE")
+
+			p.httpClient = tc.client
+			refreshed, err := p.refreshData(0)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if refreshed != tc.wantRefreshed {
+				t.Errorf("refreshed = %v, want %v", refreshed, tc.wantRefreshed)
+			}
+
+			wantGets := 0
+			if tc.wantRefreshed {
+				wantGets = 1
+			}
+			if got := tc.client.requests[http.MethodGet]; got != wantGets {
+				t.Errorf("GET requests = %d, want %d", got, wantGets)
+			}
+			if got := tc.client.requests[http.MethodHead]; got != tc.wantHeads {
+				t.Errorf("HEAD requests = %d, want %d", got, tc.wantHeads)
+			}
+
+			// A skipped download still counts as a refresh of the unchanged data
+			if !p.loadedAt().After(loadedAt) {
+				t.Errorf("load time %v not renewed after %v", p.loadedAt(), loadedAt)
+			}
+			if after, _ := p.GetIPListForCountry("DE"); len(after) != len(before) {
+				t.Errorf("DE = %v after the refresh, want %v", after, before)
+			}
+		})
+	}
+}
+
+func TestHeadSizeCheck_ScheduledRefresh(t *testing.T) {
+	p := createTestProcessor()
+	p.config.HeadSizeCheck = true
+	p.httpClient = &lastModifiedClient{length: 4096}
+	if err := p.downloadAndProcessData(); err != nil {
+		t.Fatalf("initial download: %v", err)
+	}
+
+	client := &lastModifiedClient{length: 4096}
+	p.httpClient = client
+	refreshed, err := p.ScheduledRefresh(context.Background())
+	if err != nil || refreshed {
+		t.Fatalf("ScheduledRefresh = %v, %v, want a skipped download", refreshed, err)
+	}
+	if client.requests[http.MethodGet] != 0 {
+		t.Errorf("GET requests = %d, want 0", client.requests[http.MethodGet])
+	}
+}
+
+func TestHeadSizeCheck_SkipRunsRefreshHooks(t *testing.T) {
+	p := createTestProcessor()
+	p.config.HeadSizeCheck = true
+	p.httpClient = &lastModifiedClient{length: 4096}
+	if err := p.downloadAndProcessData(); err != nil {
+		t.Fatalf("initial download: %v", err)
+	}
+
+	// Hooks such as the handler's precompute key their work on DataTime,
+	// which a skipped download moves on
+	refreshed := make(chan time.Time, 1)
+	p.OnRefresh(func() { refreshed <- p.DataTime() })
+	p.httpClient = &lastModifiedClient{length: 4096}
+	if refreshed, err := p.refreshData(0); err != nil || refreshed {
+		t.Fatalf("refreshData = %v, %v, want a skipped download", refreshed, err)
+	}
+
+	select {
+	case dataTime := <-refreshed:
+		if !dataTime.Equal(p.DataTime()) {
+			t.Errorf("callback saw data from %s, want the renewed data from %s", dataTime, p.DataTime())
+		}
+	case <-time.After(time.Second):
+		t.Fatal("callback did not run after a skipped download")
+	}
+}
+
+func TestHeadSizeCheck_FallbackForgetsSize(t *testing.T) {
+	p := createTestProcessor()
+	p.config.HeadSizeCheck = true
+	p.config.FallbackDataURL = "https://mirror.example/delegated"
+	p.httpClient = &fallbackSizeClient{length: 4096, modified: time.Now()}
+	if err := p.downloadAndProcessData(); err != nil {
+		t.Fatalf("initial download: %v", err)
+	}
+
+	// The mirror's size and Last-Modified say nothing about the primary file
+	if p.fileSize != 0 {
+		t.Errorf("fileSize = %d after a fallback download, want 0", p.fileSize)
+	}
+	if !p.modifiedAt.IsZero() {
+		t.Errorf("modifiedAt = %v after a fallback download, want zero", p.modifiedAt)
+	}
+}
+
+func TestHeadSizeCheck_PeerSkipsCheck(t *testing.T) {
+	client := &methodRecordingClient{MockHTTPClient: &MockHTTPClient{}}
+	p := createTestProcessor()
+	p.config.HeadSizeCheck = true
+	p.config.UpstreamPeer = "http://leader:8080"
+	p.httpClient = client
+	p.fileSize = 4096 // would match any check, which must not be made
+
+	if p.upstreamUnchanged() {
+		t.Error("upstreamUnchanged() = true, want false")
+	}
+	if len(client.methods) != 0 {
+		t.Errorf("requests = %v, want none", client.methods)
+	}
+}
+
+// fallbackSizeClient fails the primary download and serves the fallback
+// mirror with a Content-Length and Last-Modified time
+type fallbackSizeClient struct {
+	length   int64
+	modified time.Time
+}
+
+func (c *fallbackSizeClient) Do(req *http.Request) (*http.Response, error) {
+	if req.URL.String() == ripeURL {
+		return nil, errors.New("connection refused")
+	}
+	return (&lastModifiedClient{length: c.length, modified: c.modified}).Do(req)
+}
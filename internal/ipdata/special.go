@@ -0,0 +1,64 @@
+package ipdata
+
+import "net"
+
+// specialUseRanges lists the IANA IPv4 special-purpose address blocks (RFC 6890)
+var specialUseRanges = mustParseCIDRs(
+	"0.0.0.0/8",          // "This network"
+	"10.0.0.0/8",         // Private-use (RFC 1918)
+	"100.64.0.0/10",      // Shared address space (RFC 6598)
+	"127.0.0.0/8",        // Loopback
+	"169.254.0.0/16",     // Link-local
+	"172.16.0.0/12",      // Private-use (RFC 1918)
+	"192.0.0.0/24",       // IETF protocol assignments
+	"192.0.2.0/24",       // Documentation (TEST-NET-1)
+	"192.88.99.0/24",     // Deprecated 6to4 relay anycast
+	"192.168.0.0/16",     // Private-use (RFC 1918)
+	"198.18.0.0/15",      // Benchmarking
+	"198.51.100.0/24",    // Documentation (TEST-NET-2)
+	"203.0.113.0/24",     // Documentation (TEST-NET-3)
+	"224.0.0.0/4",        // Multicast
+	"240.0.0.0/4",        // Reserved
+	"255.255.255.255/32", // Limited broadcast
+)
+
+// mustParseCIDRs parses a list of CIDR strings, panicking on invalid input
+func mustParseCIDRs(cidrs ...string) []*net.IPNet {
+	nets := make([]*net.IPNet, 0, len(cidrs))
+	for _, cidr := range cidrs {
+		_, ipNet, err := net.ParseCIDR(cidr)
+		if err != nil {
+			panic(err)
+		}
+		nets = append(nets, ipNet)
+	}
+	return nets
+}
+
+// isSpecialUse reports whether the CIDR block falls entirely within a special-use range
+func isSpecialUse(cidr string) bool {
+	ip, block, err := net.ParseCIDR(cidr)
+	if err != nil {
+		return false
+	}
+	ones, _ := block.Mask.Size()
+
+	for _, special := range specialUseRanges {
+		specialOnes, _ := special.Mask.Size()
+		if ones >= specialOnes && special.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// filterSpecialUse removes allocation records that fall within special-use ranges
+func filterSpecialUse(ipDataList []IPData) []IPData {
+	filtered := make([]IPData, 0, len(ipDataList))
+	for _, ipData := range ipDataList {
+		if !isSpecialUse(formatCIDR(ipData.IPStart, ipData.CIDRMask)) {
+			filtered = append(filtered, ipData)
+		}
+	}
+	return filtered
+}
@@ -0,0 +1,100 @@
+package ipdata
+
+import (
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/anisimovdk/ip-whitelist-by-country/internal/config"
+)
+
+func TestIsSpecialUse(t *testing.T) {
+	testCases := []struct {
+		cidr     string
+		expected bool
+	}{
+		{cidr: "10.0.0.0/8", expected: true},
+		{cidr: "10.1.0.0/16", expected: true},
+		{cidr: "172.16.0.0/12", expected: true},
+		{cidr: "192.168.1.0/24", expected: true},
+		{cidr: "127.0.0.0/8", expected: true},
+		{cidr: "169.254.0.0/16", expected: true},
+		{cidr: "100.64.0.0/10", expected: true},
+		{cidr: "224.0.0.0/4", expected: true},
+		{cidr: "8.0.0.0/8", expected: false},
+		{cidr: "2.0.0.0/12", expected: false},
+		{cidr: "192.0.0.0/8", expected: false}, // wider than the 192.0.0.0/24 special block
+		{cidr: "not-a-cidr", expected: false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.cidr, func(t *testing.T) {
+			if got := isSpecialUse(tc.cidr); got != tc.expected {
+				t.Errorf("isSpecialUse(%q) = %v, want %v", tc.cidr, got, tc.expected)
+			}
+		})
+	}
+}
+
+func TestMustParseCIDRsPanicsOnInvalid(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Fatal("expected panic for invalid CIDR")
+		}
+	}()
+	mustParseCIDRs("invalid")
+}
+
+func TestDownloadAndProcessData_ExcludeSpecial(t *testing.T) {
+	data := strings.Join([]string{
+		"ripencc|DE|ipv4|10.0.0.0|16777216|20220101|allocated",
+		"ripencc|DE|ipv4|2.0.0.0|1048576|20220101|allocated",
+		"ripencc|NL|ipv4|192.168.0.0|65536|20220101|allocated",
+	}, "\n")
+
+	testCases := []struct {
+		name           string
+		excludeSpecial bool
+		expectedDE     []string
+		expectedNL     []string
+	}{
+		{
+			name:           "Flag off keeps special ranges",
+			excludeSpecial: false,
+			expectedDE:     []string{"10.0.0.0/8", "2.0.0.0/12"},
+			expectedNL:     []string{"192.168.0.0/16"},
+		},
+		{
+			name:           "Flag on drops special ranges",
+			excludeSpecial: true,
+			expectedDE:     []string{"2.0.0.0/12"},
+			expectedNL:     []string{},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			processor := &Processor{
+				cache:    NewMemoryCache(),
+				cacheTTL: 0,
+				httpClient: &MockHTTPClient{
+					StatusCode:   http.StatusOK,
+					ResponseBody: data,
+				},
+				config: &config.Config{CacheDuration: "1h", ExcludeSpecial: tc.excludeSpecial},
+			}
+
+			if err := processor.downloadAndProcessData(); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if got := cachedEntries(processor)["DE"]; !reflect.DeepEqual(got, tc.expectedDE) {
+				t.Errorf("DE cache = %#v, want %#v", got, tc.expectedDE)
+			}
+			if got := cachedEntries(processor)["NL"]; !reflect.DeepEqual(got, tc.expectedNL) {
+				t.Errorf("NL cache = %#v, want %#v", got, tc.expectedNL)
+			}
+		})
+	}
+}
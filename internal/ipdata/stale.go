@@ -0,0 +1,41 @@
+package ipdata
+
+import (
+	"fmt"
+	"log"
+	"time"
+)
+
+// parseMaxStaleAge parses the MaxStaleAge setting. Empty, invalid and
+// non-positive values leave stale data unbounded.
+func parseMaxStaleAge(s string) time.Duration {
+	if s == "" {
+		return 0
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil || d <= 0 {
+		log.Printf("Warning: ignoring invalid max stale age %q\n", s)
+		return 0
+	}
+	return d
+}
+
+// serveStale decides how a failed refresh is answered when a max stale age is
+// configured: cached data younger than it is served, older data fails with
+// ErrNotReady rather than serving outdated blocks. It reports false when no
+// max stale age is set or nothing was downloaded yet, leaving the failure to
+// the caller.
+func (p *Processor) serveStale(refreshErr error) (bool, error) {
+	loadedAt := p.DataTime()
+	if p.maxStaleAge == 0 || loadedAt.IsZero() {
+		return false, nil
+	}
+
+	age := time.Since(loadedAt)
+	if age >= p.maxStaleAge {
+		return true, fmt.Errorf("%w: cached data is %s old, beyond the max stale age of %s: %w",
+			ErrNotReady, age.Round(time.Second), p.maxStaleAge, refreshErr)
+	}
+	log.Printf("Serving stale IP data from %s, refresh failed: %v\n", loadedAt.Format(time.RFC3339), refreshErr)
+	return true, nil
+}
@@ -0,0 +1,136 @@
+package ipdata
+
+import (
+	"bytes"
+	"errors"
+	"log"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseMaxStaleAge(t *testing.T) {
+	testCases := []struct {
+		value         string
+		expected      time.Duration
+		expectWarning bool
+	}{
+		{value: "", expected: 0},
+		{value: "48h", expected: 48 * time.Hour},
+		{value: "bogus", expected: 0, expectWarning: true},
+		{value: "0s", expected: 0, expectWarning: true},
+		{value: "-1h", expected: 0, expectWarning: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.value, func(t *testing.T) {
+			var logBuf bytes.Buffer
+			origOutput := log.Writer()
+			log.SetOutput(&logBuf)
+			t.Cleanup(func() { log.SetOutput(origOutput) })
+
+			if got := parseMaxStaleAge(tc.value); got != tc.expected {
+				t.Errorf("parseMaxStaleAge(%q) = %s, want %s", tc.value, got, tc.expected)
+			}
+			if got := strings.Contains(logBuf.String(), "invalid max stale age"); got != tc.expectWarning {
+				t.Errorf("warning logged = %v, want %v; log: %q", got, tc.expectWarning, logBuf.String())
+			}
+		})
+	}
+}
+
+func TestMaxStaleAge(t *testing.T) {
+	testCases := []struct {
+		name              string
+		maxStaleAge       time.Duration
+		age               time.Duration
+		staleOnParseError bool
+		breakerOpen       bool
+		client            *MockHTTPClient
+		expectedErr       error
+	}{
+		{
+			name:        "Download failure within the max stale age serves stale data",
+			maxStaleAge: 24 * time.Hour,
+			age:         2 * time.Hour,
+			client:      &MockHTTPClient{ShouldError: true, ErrorMsg: "connection refused"},
+		},
+		{
+			name:        "Download failure beyond the max stale age fails",
+			maxStaleAge: 24 * time.Hour,
+			age:         25 * time.Hour,
+			client:      &MockHTTPClient{ShouldError: true, ErrorMsg: "connection refused"},
+			expectedErr: ErrNotReady,
+		},
+		{
+			name:        "Download failure without a max stale age fails",
+			age:         2 * time.Hour,
+			client:      &MockHTTPClient{ShouldError: true, ErrorMsg: "connection refused"},
+			expectedErr: ErrDownloadFailed,
+		},
+		{
+			name:              "Parse failure beyond the max stale age fails",
+			maxStaleAge:       24 * time.Hour,
+			age:               25 * time.Hour,
+			staleOnParseError: true,
+			client:            &MockHTTPClient{ResponseBody: "ripencc|*|ipv4|*|0|summary\n"},
+			expectedErr:       ErrNotReady,
+		},
+		{
+			name:        "Open circuit beyond the max stale age fails",
+			maxStaleAge: 24 * time.Hour,
+			age:         25 * time.Hour,
+			breakerOpen: true,
+			client:      &MockHTTPClient{},
+			expectedErr: ErrNotReady,
+		},
+		{
+			name:        "Open circuit within the max stale age serves stale data",
+			maxStaleAge: 24 * time.Hour,
+			age:         2 * time.Hour,
+			breakerOpen: true,
+			client:      &MockHTTPClient{},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			p := createTestProcessorWithMockData(exportTestData)
+			if err := p.downloadAndProcessData(); err != nil {
+				t.Fatalf("initial download: %v", err)
+			}
+			p.maxStaleAge = tc.maxStaleAge
+			p.config.StaleOnParseError = tc.staleOnParseError
+			if tc.breakerOpen {
+				p.breaker = newCircuitBreaker(1, "1h")
+				p.breaker.recordFailure()
+			}
+			setCacheTime(p, time.Now().Add(-tc.age))
+			p.httpClient = tc.client
+
+			got, err := p.GetIPListForCountry("FR")
+			if tc.expectedErr != nil {
+				if !errors.Is(err, tc.expectedErr) {
+					t.Fatalf("expected %v, got %v, %v", tc.expectedErr, got, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(got, []string{"81.2.69.0/24"}) {
+				t.Errorf("FR = %v, want the stale blocks", got)
+			}
+		})
+	}
+}
+
+func TestMaxStaleAge_NoPreviousData(t *testing.T) {
+	p := createTestProcessor()
+	p.maxStaleAge = 24 * time.Hour
+
+	if _, err := p.GetIPListForCountry("FR"); !errors.Is(err, ErrDownloadFailed) {
+		t.Fatalf("expected ErrDownloadFailed, got %v", err)
+	}
+}
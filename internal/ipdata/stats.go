@@ -0,0 +1,49 @@
+package ipdata
+
+import (
+	"fmt"
+	"slices"
+	"time"
+)
+
+// SkipStats counts delegated-stats records that were skipped while parsing, by reason.
+// Comments, blank lines, the version header and summary records are not counted.
+type SkipStats struct {
+	TooFewFields  int `json:"too_few_fields"` // fewer than the six mandatory fields
+	OtherRegistry int `json:"other_registry"` // record from a registry other than RIPE NCC
+	NonIPv4       int `json:"non_ipv4"`       // record of another type, e.g. ipv6
+	BadCount      int `json:"bad_count"`      // address count that is not an integer in 1..2^32
+	ParseError    int `json:"parse_error"`    // unparseable start address or AS number range
+}
+
+// String formats the counters for log lines
+func (s SkipStats) String() string {
+	return fmt.Sprintf("too few fields %d, other registry %d, non-ipv4 %d, bad count %d, parse error %d",
+		s.TooFewFields, s.OtherRegistry, s.NonIPv4, s.BadCount, s.ParseError)
+}
+
+// Stats summarizes the currently cached IP data
+type Stats struct {
+	DataSource   string         `json:"data_source"`
+	Generated    time.Time      `json:"generated,omitzero"`
+	Countries    int            `json:"countries"`
+	SkippedLines SkipStats      `json:"skipped_lines"`
+	CacheHits    uint64         `json:"cache_hits"`           // lookups served from the cache since startup
+	CacheMisses  uint64         `json:"cache_misses"`         // lookups that found the cache expired since startup
+	Reassigned   []Reassignment `json:"reassigned,omitempty"` // blocks whose country changed in the last refresh
+}
+
+// Stats returns a summary of the cached IP data. It never triggers a download.
+func (p *Processor) Stats() Stats {
+	p.mutex.RLock()
+	defer p.mutex.RUnlock()
+	return Stats{
+		DataSource:   p.servedData().source,
+		Generated:    p.loadedAt(),
+		Countries:    p.cache.Info().Countries,
+		SkippedLines: p.skipped,
+		CacheHits:    p.cacheHits.Load(),
+		CacheMisses:  p.cacheMisses.Load(),
+		Reassigned:   slices.Clone(p.reassigned),
+	}
+}
@@ -0,0 +1,144 @@
+package ipdata
+
+import (
+	"bytes"
+	"io"
+	"log"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseData_SkipReasons(t *testing.T) {
+	data := strings.Join([]string{
+		"2|ripencc|20220101|5|19830705|20220101|+0100",
+		"ripencc|*|ipv4|*|4|summary",
+		"# comment",
+		"",
+		"ripencc|DE|ipv4|2.0.0.0", // too few fields
+		"ripencc|DE",              // too few fields
+		"arin|US|ipv4|3.0.0.0|16777216|20220101|allocated",   // other registry
+		"apnic|CN|ipv4|1.0.1.0|256|20220101|allocated",       // other registry
+		"afrinic|ZA|asn|327680|1|20220101|allocated",         // other registry
+		"ripencc|DE|ipv6|2001:db8::|32|20220101|allocated",   // non-ipv4
+		"ripencc|DE|ipv4|5.0.0.0|many|20220101|allocated",    // bad count
+		"ripencc|DE|ipv4|6.0.0.0|0|20220101|allocated",       // bad count
+		"ripencc|DE|ipv4|7.0.0.0|-256|20220101|allocated",    // bad count
+		"ripencc|DE|ipv4|not-an-ip|256|20220101|allocated",   // parse error
+		"ripencc|DE|asn|AS3320|1|19930901|allocated",         // parse error
+		"ripencc|DE|ipv4|2.0.0.0|1048576|20220101|allocated", // kept
+		"ripencc|DE|asn|3320|1|19930901|allocated",           // kept
+	}, "\n")
+
+	processor := createTestProcessorWithMockData(data)
+	parsed, err := processor.parseData(strings.NewReader(data))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expected := SkipStats{TooFewFields: 2, OtherRegistry: 3, NonIPv4: 1, BadCount: 3, ParseError: 2}
+	if parsed.skipped != expected {
+		t.Errorf("skipped = %+v, want %+v", parsed.skipped, expected)
+	}
+	if len(parsed.cache["DE"]) != 1 || len(parsed.asns["DE"]) != 1 {
+		t.Errorf("expected the valid records to be kept, got cache %v, asns %v", parsed.cache, parsed.asns)
+	}
+}
+
+func TestStats(t *testing.T) {
+	data := strings.Join([]string{
+		"ripencc|DE|ipv4|2.0.0.0|1048576|20220101|allocated",
+		"ripencc|FR|ipv4|5.0.0.0|65536|20220101|allocated",
+		"ripencc|FR|ipv6|2001:db8::|32|20220101|allocated",
+		"ripencc|NL",
+	}, "\n")
+
+	processor := createTestProcessorWithMockData(data)
+	if stats := processor.Stats(); !reflect.DeepEqual(stats, Stats{}) {
+		t.Fatalf("Stats() = %+v, want zero value before any download", stats)
+	}
+
+	var logBuf bytes.Buffer
+	origOutput := log.Writer()
+	log.SetOutput(&logBuf)
+	t.Cleanup(func() { log.SetOutput(origOutput) })
+
+	before := time.Now()
+	if err := processor.downloadAndProcessData(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	stats := processor.Stats()
+	if stats.DataSource != DataSourceLive || stats.Countries != 2 || stats.Generated.Before(before) {
+		t.Errorf("Stats() = %+v, want live data for 2 countries generated after %v", stats, before)
+	}
+	if want := (SkipStats{TooFewFields: 1, NonIPv4: 1}); stats.SkippedLines != want {
+		t.Errorf("SkippedLines = %+v, want %+v", stats.SkippedLines, want)
+	}
+	if want := "skipped lines: too few fields 1, other registry 0, non-ipv4 1, bad count 0, parse error 0"; !strings.Contains(logBuf.String(), want) {
+		t.Errorf("expected download log to contain %q, got %q", want, logBuf.String())
+	}
+}
+
+func TestParseData_OutOfRangeCounts(t *testing.T) {
+	data := strings.Join([]string{
+		"ripencc|DE|ipv4|2.0.0.0|0|20220101|allocated",
+		"ripencc|DE|ipv4|3.0.0.0|4294967297|20220101|allocated",
+		"ripencc|DE|ipv4|4.0.0.0|99999999999999999999999999|20220101|allocated",
+		"ripencc|DE|ipv4|0.0.0.0|4294967296|20220101|allocated",
+		"ripencc|FR|ipv4|5.0.0.0|256|20220101|allocated",
+	}, "\n")
+
+	var logBuf bytes.Buffer
+	origOutput := log.Writer()
+	log.SetOutput(&logBuf)
+	t.Cleanup(func() { log.SetOutput(origOutput) })
+
+	processor := createTestProcessorWithMockData(data)
+	parsed, err := processor.parseData(strings.NewReader(data))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if parsed.skipped.BadCount != 3 {
+		t.Errorf("skipped.BadCount = %d, want 3", parsed.skipped.BadCount)
+	}
+	// A count of exactly 2^32 is the whole IPv4 space and still valid
+	if want := []string{"0.0.0.0/0"}; !slices.Equal(parsed.cache["DE"], want) {
+		t.Errorf("cache[DE] = %v, want %v", parsed.cache["DE"], want)
+	}
+	for country, cidrs := range parsed.cache {
+		for _, cidr := range cidrs {
+			if err := ValidateIPCIDR(cidr); err != nil {
+				t.Errorf("invalid CIDR %q emitted for %s: %v", cidr, country, err)
+			}
+		}
+	}
+	for _, want := range []string{`invalid address count "0"`, `invalid address count "4294967297"`, `invalid address count "99999999999999999999999999"`} {
+		if !strings.Contains(logBuf.String(), want) {
+			t.Errorf("expected log to contain %q, got %q", want, logBuf.String())
+		}
+	}
+}
+
+func TestStats_CacheHitsAndMisses(t *testing.T) {
+	origOutput := log.Writer()
+	log.SetOutput(io.Discard)
+	t.Cleanup(func() { log.SetOutput(origOutput) })
+
+	processor := createTestProcessorWithMockData("ripencc|DE|ipv4|2.0.0.0|1048576|20220101|allocated")
+
+	// The first lookup finds the cache empty, the following ones are served from it
+	for range 3 {
+		if _, err := processor.GetIPListForCountry("DE"); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+
+	stats := processor.Stats()
+	if stats.CacheHits != 2 || stats.CacheMisses != 1 {
+		t.Errorf("CacheHits, CacheMisses = %d, %d; want 2, 1", stats.CacheHits, stats.CacheMisses)
+	}
+}
@@ -0,0 +1,60 @@
+package ipdata
+
+import (
+	"slices"
+	"strings"
+)
+
+// Allocation statuses of delegated-stats records
+const (
+	StatusAllocated = "allocated"
+	StatusAssigned  = "assigned"
+	StatusAvailable = "available"
+	StatusReserved  = "reserved"
+)
+
+// Statuses lists the allocation statuses the CIDR blocks are grouped by
+var Statuses = []string{StatusAllocated, StatusAssigned, StatusAvailable, StatusReserved}
+
+// DefaultStatuses are the statuses of the blocks served as a country's list.
+// Available and reserved space is held by the registry rather than by anyone
+// in the country, so it is only kept in the per-status groups.
+var DefaultStatuses = []string{StatusAllocated, StatusAssigned}
+
+// recordStatus returns the status of a delegated-stats record. Records
+// without a status field are taken to be allocated.
+func recordStatus(parts []string) string {
+	if len(parts) < 7 || parts[6] == "" {
+		return StatusAllocated
+	}
+	return strings.ToLower(parts[6])
+}
+
+// groupByStatus groups the CIDR blocks of a country by their allocation status.
+// cidrs must be the blocks built from ipDataList, in the same order.
+func groupByStatus(ipDataList []IPData, cidrs []string) map[string][]string {
+	groups := make(map[string][]string)
+	for i, ipData := range ipDataList {
+		groups[ipData.Status] = append(groups[ipData.Status], cidrs[i])
+	}
+	return groups
+}
+
+// GetIPListByStatus returns the CIDR blocks of a country grouped by their
+// allocation status, including the available and reserved blocks that are
+// not part of the country's list
+func (p *Processor) GetIPListByStatus(countryCode string) (map[string][]string, error) {
+	countryCode = strings.ToUpper(countryCode)
+
+	if err := p.refreshIfOlderThan(p.ttlFor(countryCode)); err != nil {
+		return nil, err
+	}
+
+	p.mutex.RLock()
+	defer p.mutex.RUnlock()
+	result := make(map[string][]string, len(p.statuses[countryCode]))
+	for status, cidrs := range p.statuses[countryCode] {
+		result[status] = slices.Clone(cidrs)
+	}
+	return result, nil
+}
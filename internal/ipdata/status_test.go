@@ -0,0 +1,145 @@
+package ipdata
+
+import (
+	"errors"
+	"net/netip"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/anisimovdk/ip-whitelist-by-country/internal/config"
+)
+
+// mixedStatusData holds DE records of every allocation status, plus the
+// registry's unallocated space listed under ZZ
+var mixedStatusData = strings.Join([]string{
+	"2|ripencc|20240101|7|19830705|20240101|+0100",
+	"ripencc|DE|ipv4|2.0.0.0|1048576|20100101|allocated|a1",
+	"ripencc|DE|ipv4|5.0.0.0|65536|20100101|assigned|a2",
+	"ripencc|DE|ipv4|31.0.0.0|256|20100101|RESERVED|a3",
+	"ripencc|DE|ipv4|46.0.0.0|256|20100101|available|",
+	"ripencc|DE|ipv4|62.0.0.0|256|20100101",
+	"ripencc|ZZ|ipv4|185.0.0.0|1024|20100101|available|",
+	"ripencc|ZZ|ipv4|185.0.4.0|1024|20100101|reserved|",
+}, "\n")
+
+func TestRecordStatus(t *testing.T) {
+	testCases := []struct {
+		line string
+		want string
+	}{
+		{"ripencc|DE|ipv4|2.0.0.0|256|20100101|allocated", StatusAllocated},
+		{"ripencc|DE|ipv4|2.0.0.0|256|20100101|Assigned|x", StatusAssigned},
+		{"ripencc|ZZ|ipv4|2.0.0.0|256||reserved", StatusReserved},
+		{"ripencc|DE|ipv4|2.0.0.0|256|20100101|", StatusAllocated},
+		{"ripencc|DE|ipv4|2.0.0.0|256|20100101", StatusAllocated},
+	}
+
+	for _, tc := range testCases {
+		if got := recordStatus(strings.Split(tc.line, "|")); got != tc.want {
+			t.Errorf("recordStatus(%q) = %q, want %q", tc.line, got, tc.want)
+		}
+	}
+}
+
+func TestGroupByStatus(t *testing.T) {
+	ipDataList := []IPData{
+		{IPStart: "2.0.0.0", CIDRMask: 12, Status: StatusAllocated},
+		{IPStart: "5.0.0.0", CIDRMask: 16, Status: StatusAssigned},
+		{IPStart: "31.0.0.0", CIDRMask: 24, Status: StatusAllocated},
+	}
+
+	groups := groupByStatus(ipDataList, buildCIDRs(ipDataList))
+
+	expected := map[string][]string{
+		StatusAllocated: {"2.0.0.0/12", "31.0.0.0/24"},
+		StatusAssigned:  {"5.0.0.0/16"},
+	}
+	if !reflect.DeepEqual(groups, expected) {
+		t.Errorf("groupByStatus() = %v, want %v", groups, expected)
+	}
+}
+
+func TestGetIPListByStatus(t *testing.T) {
+	processor := createTestProcessorWithMockData(mixedStatusData)
+
+	de, err := processor.GetIPListByStatus("de")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := map[string][]string{
+		StatusAllocated: {"2.0.0.0/12", "62.0.0.0/24"},
+		StatusAssigned:  {"5.0.0.0/16"},
+		StatusReserved:  {"31.0.0.0/24"},
+		StatusAvailable: {"46.0.0.0/24"},
+	}
+	if !reflect.DeepEqual(de, want) {
+		t.Errorf("DE groups = %v, want %v", de, want)
+	}
+
+	// Only the allocated and assigned blocks make up the country's list
+	list, err := processor.GetIPListForCountry("DE")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if want := []string{"2.0.0.0/12", "5.0.0.0/16", "62.0.0.0/24"}; !reflect.DeepEqual(list, want) {
+		t.Errorf("DE list = %v, want %v", list, want)
+	}
+
+	zz, err := processor.GetIPListByStatus("ZZ")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want = map[string][]string{
+		StatusAvailable: {"185.0.0.0/22"},
+		StatusReserved:  {"185.0.4.0/22"},
+	}
+	if !reflect.DeepEqual(zz, want) {
+		t.Errorf("ZZ groups = %v, want %v", zz, want)
+	}
+	if list, _ := processor.GetIPListForCountry("ZZ"); len(list) != 0 {
+		t.Errorf("ZZ list = %v, want empty", list)
+	}
+
+	// Modifying the result must not affect the cache
+	delete(de, StatusReserved)
+	if again, _ := processor.GetIPListByStatus("DE"); len(again[StatusReserved]) != 1 {
+		t.Errorf("cached groups were modified: %v", again)
+	}
+}
+
+func TestGetIPListByStatus_ExcludedCIDRs(t *testing.T) {
+	processor := createTestProcessorWithMockData(mixedStatusData)
+	processor.excluded = []netip.Prefix{netip.MustParsePrefix("185.0.4.0/23")}
+
+	zz, err := processor.GetIPListByStatus("ZZ")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if want := []string{"185.0.6.0/23"}; !reflect.DeepEqual(zz[StatusReserved], want) {
+		t.Errorf("ZZ reserved = %v, want %v", zz[StatusReserved], want)
+	}
+}
+
+func TestGetIPListByStatus_ExcludeSpecial(t *testing.T) {
+	data := "ripencc|DE|ipv4|2.0.0.0|256|20100101|allocated\n" +
+		"ripencc|ZZ|ipv4|192.0.2.0|256|20100101|reserved\n" +
+		"ripencc|ZZ|ipv4|185.0.0.0|256|20100101|reserved\n"
+
+	parsed, err := parseDelegatedStats(strings.NewReader(data), &config.Config{ExcludeSpecial: true})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if want := []string{"185.0.0.0/24"}; !reflect.DeepEqual(parsed.statuses["ZZ"][StatusReserved], want) {
+		t.Errorf("ZZ reserved = %v, want %v", parsed.statuses["ZZ"][StatusReserved], want)
+	}
+}
+
+func TestGetIPListByStatus_DownloadError(t *testing.T) {
+	processor := createTestProcessor()
+
+	_, err := processor.GetIPListByStatus("DE")
+	if !errors.Is(err, ErrDownloadFailed) {
+		t.Fatalf("expected ErrDownloadFailed, got %v", err)
+	}
+}
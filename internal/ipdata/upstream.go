@@ -0,0 +1,92 @@
+package ipdata
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// upstreamCheckTimeout bounds the request made by CheckUpstream
+const upstreamCheckTimeout = 5 * time.Second
+
+// UpstreamStatus reports whether the data source answered a reachability check
+type UpstreamStatus struct {
+	URL        string `json:"url"`
+	Reachable  bool   `json:"reachable"`
+	StatusCode int    `json:"status_code,omitempty"`
+	LatencyMs  int64  `json:"latency_ms"`
+	Error      string `json:"error,omitempty"`
+}
+
+// sourceURL returns the URL the data is downloaded from: the /export endpoint
+// of the upstream peer if one is configured, the RIPE NCC file otherwise
+func (p *Processor) sourceURL() string {
+	if p.config.UpstreamPeer != "" {
+		return p.exportURL(p.config.UpstreamPeer)
+	}
+	return ripeURL
+}
+
+// CheckUpstream sends a HEAD request to the data source URL and reports whether
+// the file is available and how long the upstream took to answer. It does not
+// download or touch the cached data. The reported URL leaves out the auth
+// token and any password.
+func (p *Processor) CheckUpstream(ctx context.Context) UpstreamStatus {
+	source := p.sourceURL()
+	status := UpstreamStatus{URL: strippedURL(source)}
+
+	ctx, cancel := context.WithTimeout(ctx, upstreamCheckTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, source, nil)
+	if err != nil {
+		status.Error = redactURLError(err).Error()
+		return status
+	}
+
+	start := time.Now()
+	resp, err := p.doRequest(req)
+	status.LatencyMs = time.Since(start).Milliseconds()
+	if err != nil {
+		status.Error = err.Error()
+		return status
+	}
+	resp.Body.Close()
+
+	status.StatusCode = resp.StatusCode
+	status.Reachable = resp.StatusCode == http.StatusOK
+	return status
+}
+
+// doRequest sends req with the HTTP client. Errors leave out the query string
+// and user info of the URL, so auth tokens and passwords stay out of logs and
+// responses.
+func (p *Processor) doRequest(req *http.Request) (*http.Response, error) {
+	resp, err := p.httpClient.Do(req)
+	return resp, redactURLError(err)
+}
+
+// redactURLError strips the query string and user info from the URL carried by
+// a *url.Error in err
+func redactURLError(err error) error {
+	var urlErr *url.Error
+	if errors.As(err, &urlErr) {
+		urlErr.URL = strippedURL(urlErr.URL)
+	}
+	return err
+}
+
+// strippedURL returns raw without its query string and user info. Unparseable
+// URLs are cut at the query string.
+func strippedURL(raw string) string {
+	u, err := url.Parse(raw)
+	if err != nil {
+		before, _, _ := strings.Cut(raw, "?")
+		return before
+	}
+	u.User, u.RawQuery = nil, ""
+	return u.String()
+}
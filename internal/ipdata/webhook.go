@@ -0,0 +1,59 @@
+package ipdata
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+// webhookTimeout bounds the delivery of a refresh notification
+const webhookTimeout = 10 * time.Second
+
+// RefreshSummary is the JSON body POSTed to the refresh webhook after new
+// data has been loaded
+type RefreshSummary struct {
+	Countries  int       `json:"countries"`   // number of countries with IPv4 blocks
+	Blocks     int       `json:"blocks"`      // CIDR blocks across all countries
+	Generated  time.Time `json:"generated"`   // when the data was downloaded
+	DataSource string    `json:"data_source"` // live or peer
+}
+
+// newRefreshSummary summarizes the blocks of a refresh
+func newRefreshSummary(cache map[string][]string, loadedAt time.Time, dataSource string) RefreshSummary {
+	summary := RefreshSummary{Countries: len(cache), Generated: loadedAt, DataSource: dataSource}
+	for _, cidrs := range cache {
+		summary.Blocks += len(cidrs)
+	}
+	return summary
+}
+
+// notifyRefresh POSTs the summary to the refresh webhook. Delivery is best
+// effort: failures are logged and never affect serving. It does not use the
+// download client, whose proxy and pinned host only apply to the data source.
+func notifyRefresh(url string, summary RefreshSummary) {
+	body, _ := json.Marshal(summary)
+
+	ctx, cancel := context.WithTimeout(context.Background(), webhookTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		slog.Error("Refresh webhook failed", "error", err)
+		return
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		slog.Error("Refresh webhook failed", "error", err)
+		return
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		slog.Error("Refresh webhook failed", "url", url, "status", resp.StatusCode)
+	}
+}
@@ -0,0 +1,155 @@
+package ipdata
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// webhookRequest is a notification received by a stub webhook
+type webhookRequest struct {
+	method      string
+	contentType string
+	body        []byte
+}
+
+// newStubWebhook records the notifications it receives and answers them with status
+func newStubWebhook(t *testing.T, status int) (*httptest.Server, <-chan webhookRequest) {
+	t.Helper()
+	requests := make(chan webhookRequest, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		requests <- webhookRequest{method: r.Method, contentType: r.Header.Get("Content-Type"), body: body}
+		w.WriteHeader(status)
+	}))
+	t.Cleanup(srv.Close)
+	return srv, requests
+}
+
+// awaitWebhook returns the next notification received by a stub webhook
+func awaitWebhook(t *testing.T, requests <-chan webhookRequest) webhookRequest {
+	t.Helper()
+	select {
+	case req := <-requests:
+		return req
+	case <-time.After(5 * time.Second):
+		t.Fatal("webhook was not notified")
+		return webhookRequest{}
+	}
+}
+
+func TestRefreshWebhook(t *testing.T) {
+	for _, status := range []int{http.StatusNoContent, http.StatusInternalServerError} {
+		t.Run(http.StatusText(status), func(t *testing.T) {
+			srv, requests := newStubWebhook(t, status)
+			p := createTestProcessorWithMockData(exportTestData)
+			p.config.RefreshWebhookURL = srv.URL
+
+			// A failing webhook does not affect the refresh
+			if err := p.downloadAndProcessData(); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			req := awaitWebhook(t, requests)
+			if req.method != http.MethodPost {
+				t.Errorf("method = %s, want POST", req.method)
+			}
+			if req.contentType != "application/json" {
+				t.Errorf("Content-Type = %q, want application/json", req.contentType)
+			}
+
+			var summary RefreshSummary
+			if err := json.Unmarshal(req.body, &summary); err != nil {
+				t.Fatalf("invalid payload %s: %v", req.body, err)
+			}
+			if summary.Countries != 2 || summary.Blocks != 3 || summary.DataSource != DataSourceLive {
+				t.Errorf("summary = %+v, want 2 countries, 3 blocks from %s", summary, DataSourceLive)
+			}
+			if !summary.Generated.Equal(p.DataTime()) {
+				t.Errorf("generated = %s, want %s", summary.Generated, p.DataTime())
+			}
+			if got, err := p.GetIPListForCountry("FR"); err != nil || len(got) != 1 {
+				t.Errorf("GetIPListForCountry(FR) = %v, %v after the refresh", got, err)
+			}
+		})
+	}
+}
+
+func TestRefreshWebhook_NotCalledOnFailure(t *testing.T) {
+	srv, requests := newStubWebhook(t, http.StatusNoContent)
+	p := createTestProcessor()
+	p.config.RefreshWebhookURL = srv.URL
+
+	if err := p.downloadAndProcessData(); err == nil {
+		t.Fatal("expected the download to fail")
+	}
+	select {
+	case req := <-requests:
+		t.Errorf("webhook notified after a failed refresh: %s", req.body)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestNotifyRefresh_Failures(t *testing.T) {
+	failing, _ := newStubWebhook(t, http.StatusBadGateway)
+	closed := httptest.NewServer(http.NotFoundHandler())
+	closed.Close()
+
+	testCases := []struct {
+		name        string
+		url         string
+		expectedLog string
+	}{
+		{name: "Error status", url: failing.URL, expectedLog: "status=502"},
+		{name: "Unreachable", url: closed.URL, expectedLog: "Refresh webhook failed"},
+		{name: "Invalid URL", url: "http://[::1", expectedLog: "Refresh webhook failed"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var logBuf bytes.Buffer
+			origOutput := log.Writer()
+			log.SetOutput(&logBuf)
+			t.Cleanup(func() { log.SetOutput(origOutput) })
+
+			notifyRefresh(tc.url, RefreshSummary{Countries: 1})
+			if !strings.Contains(logBuf.String(), tc.expectedLog) {
+				t.Errorf("log = %q, want it to contain %q", logBuf.String(), tc.expectedLog)
+			}
+		})
+	}
+}
+
+func TestOnRefresh(t *testing.T) {
+	p := createTestProcessor()
+	refreshed := make(chan time.Time, 1)
+	p.OnRefresh(func() { refreshed <- p.DataTime() })
+
+	if err := p.downloadAndProcessData(); err == nil {
+		t.Fatal("expected the download to fail")
+	}
+	select {
+	case <-refreshed:
+		t.Fatal("callback ran after a failed refresh")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	p.httpClient = &MockHTTPClient{ResponseBody: exportTestData}
+	if err := p.downloadAndProcessData(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	select {
+	case dataTime := <-refreshed:
+		if !dataTime.Equal(p.DataTime()) {
+			t.Errorf("callback saw data from %s, want the refreshed data from %s", dataTime, p.DataTime())
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("callback was not called after the refresh")
+	}
+}